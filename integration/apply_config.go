@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"integration-suricata-ndpi/pkg/executil"
+	"integration-suricata-ndpi/pkg/fsutil"
 	"integration-suricata-ndpi/pkg/logger"
 )
 
@@ -43,6 +44,12 @@ func ApplyConfigWithContext(ctx context.Context, opts ApplyConfigOptions) (Apply
 		return report, fmt.Errorf("reload_command=shutdown is forbidden")
 	}
 
+	if strings.TrimSpace(opts.RulesDeployDir) != "" {
+		if err := validateAndDeployRules(ctx, opts, &report); err != nil {
+			return report, err
+		}
+	}
+
 	if cmdNormalized == "" || cmdNormalized == "none" {
 		report.ReloadStatus = ReloadOK
 		report.Warnings = append(report.Warnings, "reload_command empty/none: reload skipped")
@@ -54,6 +61,12 @@ func ApplyConfigWithContext(ctx context.Context, opts ApplyConfigOptions) (Apply
 		report.ReloadTimeout = reloadTimeout
 	}
 
+	if cmdNormalized == NonblockingReloadCommand {
+		opts.CommandRunner = commandRunner
+		return report, applyNonblockingReload(ctx, opts, &report)
+	}
+
+	jobStep(ctx, "reloading rules (%s)", reloadCommand)
 	rctx, cancel := context.WithTimeout(ctx, reloadTimeout)
 	defer cancel()
 
@@ -83,3 +96,122 @@ func ApplyConfigWithContext(ctx context.Context, opts ApplyConfigOptions) (Apply
 	report.ReloadStatus = ReloadOK
 	return report, nil
 }
+
+func validateAndDeployRules(ctx context.Context, opts ApplyConfigOptions, report *ApplyConfigReport) error {
+	ruleFiles, err := ListRuleFiles(opts.RulesLocalDir, opts.FS)
+	if err != nil {
+		return err
+	}
+	if len(ruleFiles) == 0 {
+		report.Warnings = append(report.Warnings,
+			fmt.Sprintf("no *.rules files in %s: rule deployment skipped", opts.RulesLocalDir),
+		)
+		return nil
+	}
+
+	state, err := LoadRuleOverrides(opts.RuleOverridesStatePath, opts.FS)
+	if err != nil {
+		return err
+	}
+	staged, err := stageRuleFiles(ruleFiles, MergeRuleOverrides(opts.RuleOverrides, state), opts.FS)
+	if staged.Dir != "" {
+		fs := opts.FS
+		if fs == nil {
+			fs = fsutil.OSFS{}
+		}
+		defer func() { _ = fs.RemoveAll(staged.Dir) }()
+	}
+	report.RuleOverrides = staged.Overrides
+	report.Warnings = append(report.Warnings, staged.Warnings...)
+	if err != nil {
+		return err
+	}
+
+	diff, err := diffStagedRules(staged, opts.RulesLocalDir, opts.RulesDeployDir, opts.FS)
+	if err != nil {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("rules diff not computed: %v", err))
+	} else {
+		report.RulesDiff = diff
+	}
+
+	jobStep(ctx, "validating %d rule files with suricata -T", len(staged.Files))
+	vrep, err := ValidateRuleFiles(ctx, RulesValidateOptions{
+		SuricataBinPath:     opts.SuricataBinPath,
+		NDPIPluginPath:      opts.NDPIPluginPath,
+		RuleFiles:           staged.Files,
+		ClassificationFile:  suricataAuxFile(opts.ConfigCandidates, "classification.config"),
+		ReferenceConfigFile: suricataAuxFile(opts.ConfigCandidates, "reference.config"),
+		Timeout:             opts.RulesValidateTimeout,
+		CommandRunner:       opts.CommandRunner,
+		FS:                  opts.FS,
+	})
+	for i := range vrep.Errors {
+		if src, ok := staged.Origin[vrep.Errors[i].File]; ok {
+			vrep.Errors[i].File = src
+		}
+	}
+	report.RulesValidation = &vrep
+	if err != nil {
+		logger.Warnw("Rule set rejected, live rules directory left untouched",
+			"deploy_dir", opts.RulesDeployDir,
+			"error", err,
+		)
+		return err
+	}
+
+	snap, err := snapshotDeployedRules(opts)
+	if err != nil {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("live rules not kept for rollback: %v", err))
+	}
+	drep, err := DeployRuleFiles(staged.Files, opts.RulesDeployDir, opts.FS)
+	report.RulesDeploy = &drep
+	if snap != nil {
+		if err == nil && len(drep.Written)+len(drep.Removed) > 0 {
+			if kerr := snap.keep(); kerr != nil {
+				report.Warnings = append(report.Warnings, fmt.Sprintf("live rules not kept for rollback: %v", kerr))
+			}
+		} else {
+			snap.drop()
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("deploy rules to %s: %w", opts.RulesDeployDir, err)
+	}
+	jobStep(ctx, "rules deployed to %s: %d written, %d unchanged, %d removed",
+		opts.RulesDeployDir, len(drep.Written), len(drep.Unchanged), len(drep.Removed))
+
+	if err := writeBundleProvenance(opts.RulesDeployDir, opts.Bundle, opts.FS); err != nil {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("bundle provenance not recorded: %v", err))
+	}
+	report.Bundle = opts.Bundle
+
+	if stale := ruleFilesNotLoaded(opts); stale != "" {
+		report.Warnings = append(report.Warnings, stale)
+	}
+	return nil
+}
+
+// ruleFilesNotLoaded reports when suricata.yaml would not load the deployed
+// rule files as they are now; reconcile fixes the rule-files list.
+func ruleFilesNotLoaded(opts ApplyConfigOptions) string {
+	fs := opts.FS
+	if fs == nil {
+		fs = fsutil.OSFS{}
+	}
+	target, err := FirstExistingPath(opts.ConfigCandidates)
+	if err != nil {
+		return ""
+	}
+	current, err := fs.ReadFile(target)
+	if err != nil {
+		return ""
+	}
+	_, _, changed, err := patchRuleFilesFromDeployDir(current, opts, fs)
+	if err != nil {
+		return fmt.Sprintf("rule-files in %s not checked: %v", target, err)
+	}
+	if changed {
+		return fmt.Sprintf("rule-files in %s do not match the files in %s: run reconcile (POST /plan) so Suricata loads them", target, opts.RulesDeployDir)
+	}
+	return ""
+}
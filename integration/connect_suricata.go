@@ -30,7 +30,7 @@ func ConnectSuricataWithDialer(socketCandidates []string, timeout time.Duration,
 
 	socketPath, err := FirstExistingSocket(socketCandidates)
 	if err != nil {
-		return nil, fmt.Errorf("suricata control socket not found: %w", err)
+		return nil, ErrSuricataNotReady.Wrap(err)
 	}
 
 	logger.Infow("Connecting to Suricata",
@@ -44,7 +44,7 @@ func ConnectSuricataWithDialer(socketCandidates []string, timeout time.Duration,
 			"socket_path", socketPath,
 			"error", err,
 		)
-		return nil, fmt.Errorf("failed to connect to %s: %w", socketPath, err)
+		return nil, ErrSuricataNotReady.Wrap(fmt.Errorf("connect to %s: %w", socketPath, err))
 	}
 
 	_ = conn.SetDeadline(time.Now().Add(timeout))
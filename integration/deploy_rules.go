@@ -0,0 +1,76 @@
+package integration
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"integration-suricata-ndpi/pkg/fsutil"
+	"integration-suricata-ndpi/pkg/logger"
+)
+
+type RulesDeployReport struct {
+	DeployDir string   `json:"deploy_dir"`
+	Written   []string `json:"written,omitempty"`
+	Unchanged []string `json:"unchanged,omitempty"`
+	Removed   []string `json:"removed,omitempty"`
+}
+
+// DeployRuleFiles mirrors the given rule files into deployDir: changed files are
+// written atomically and *.rules files no longer present locally are removed.
+func DeployRuleFiles(ruleFiles []string, deployDir string, fs fsutil.FS) (RulesDeployReport, error) {
+	if fs == nil {
+		fs = fsutil.OSFS{}
+	}
+
+	rep := RulesDeployReport{DeployDir: deployDir}
+
+	if err := mustBeDir(deployDir, "suricata rules directory", fs); err != nil {
+		return rep, err
+	}
+
+	wanted := make(map[string]struct{}, len(ruleFiles))
+	for _, src := range ruleFiles {
+		name := filepath.Base(src)
+		wanted[name] = struct{}{}
+
+		data, err := fs.ReadFile(src)
+		if err != nil {
+			return rep, fmt.Errorf("read rule file %s: %w", src, err)
+		}
+
+		dst := filepath.Join(deployDir, name)
+		if cur, err := fs.ReadFile(dst); err == nil && bytes.Equal(cur, data) {
+			rep.Unchanged = append(rep.Unchanged, dst)
+			continue
+		}
+
+		if err := writeFileAtomic(dst, data, os.FileMode(0o644), fs); err != nil {
+			return rep, fmt.Errorf("write rule file %s: %w", dst, err)
+		}
+		rep.Written = append(rep.Written, dst)
+	}
+
+	deployed, err := ListRuleFiles(deployDir, fs)
+	if err != nil {
+		return rep, err
+	}
+	for _, p := range deployed {
+		if _, ok := wanted[filepath.Base(p)]; ok {
+			continue
+		}
+		if err := fs.Remove(p); err != nil {
+			return rep, fmt.Errorf("remove stale rule file %s: %w", p, err)
+		}
+		rep.Removed = append(rep.Removed, p)
+	}
+
+	logger.Infow("Rule files deployed",
+		"deploy_dir", deployDir,
+		"written", len(rep.Written),
+		"unchanged", len(rep.Unchanged),
+		"removed", len(rep.Removed),
+	)
+	return rep, nil
+}
@@ -0,0 +1,382 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"integration-suricata-ndpi/internal/config"
+	"integration-suricata-ndpi/pkg/agentclient"
+	"integration-suricata-ndpi/pkg/executil"
+	"integration-suricata-ndpi/pkg/netutil"
+	"integration-suricata-ndpi/pkg/systemd"
+)
+
+type DoctorStatus string
+
+const (
+	DoctorOK   DoctorStatus = "ok"
+	DoctorWarn DoctorStatus = "warn"
+	DoctorFail DoctorStatus = "fail"
+	DoctorSkip DoctorStatus = "skip"
+)
+
+const (
+	DoctorIntegration = "integration"
+	DoctorHostAgent   = "host-agent"
+)
+
+// DoctorFinding is one check result; Hint says how to fix anything not ok.
+type DoctorFinding struct {
+	Check   string       `json:"check"`
+	Status  DoctorStatus `json:"status"`
+	Message string       `json:"message"`
+	Hint    string       `json:"hint,omitempty"`
+}
+
+type DoctorReport struct {
+	Component string          `json:"component"`
+	Config    string          `json:"config"`
+	OK        bool            `json:"ok"` // no check failed
+	Findings  []DoctorFinding `json:"findings"`
+}
+
+type DoctorOptions struct {
+	Component  string // DoctorIntegration or DoctorHostAgent
+	ConfigPath string
+	// HostAgentSocket overrides http.host_agent_socket.
+	HostAgentSocket string
+	// Timeout bounds each probe (commands, dials); default 5s.
+	Timeout time.Duration
+
+	Runner executil.Runner
+	Dialer netutil.Dialer
+}
+
+// RunDoctor runs every environment check and reports all findings instead of
+// stopping at the first problem. Only a config that fails to load cuts it short.
+func RunDoctor(ctx context.Context, opts DoctorOptions) *DoctorReport {
+	if opts.Component == "" {
+		opts.Component = DoctorIntegration
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 5 * time.Second
+	}
+	if opts.Runner == nil {
+		opts.Runner = executil.DefaultRunner{}
+	}
+	if opts.Dialer == nil {
+		opts.Dialer = netutil.DefaultDialer{}
+	}
+
+	d := &doctor{opts: opts, rep: &DoctorReport{Component: opts.Component, Config: opts.ConfigPath, OK: true}}
+
+	cfg, err := config.Load(opts.ConfigPath)
+	if err != nil {
+		d.fail("config", err.Error(), "fix the config file; the error names the offending key")
+		d.add("remaining checks", DoctorSkip, "need a valid config", "")
+		return d.rep
+	}
+	d.ok("config", "loaded "+opts.ConfigPath)
+	d.cfg = cfg
+
+	d.checkPaths()
+	d.checkPlugin()
+	d.checkBuildInfo(ctx)
+	d.checkPluginLine()
+	sock := d.checkSockets()
+	d.checkSuricataSC(ctx, sock)
+	d.checkUnit(ctx)
+	d.checkHostAgent(ctx)
+
+	return d.rep
+}
+
+type doctor struct {
+	opts DoctorOptions
+	cfg  *config.Config
+	rep  *DoctorReport
+
+	suricataCfg string
+}
+
+func (d *doctor) add(check string, status DoctorStatus, msg, hint string) {
+	if status == DoctorFail {
+		d.rep.OK = false
+	}
+	if status == DoctorOK {
+		hint = ""
+	}
+	// command output can span lines; keep one finding per table row
+	msg = strings.Join(strings.Fields(msg), " ")
+	d.rep.Findings = append(d.rep.Findings, DoctorFinding{Check: check, Status: status, Message: msg, Hint: hint})
+}
+
+func (d *doctor) ok(check, msg string)         { d.add(check, DoctorOK, msg, "") }
+func (d *doctor) fail(check, msg, hint string) { d.add(check, DoctorFail, msg, hint) }
+func (d *doctor) warn(check, msg, hint string) { d.add(check, DoctorWarn, msg, hint) }
+
+type pathNeed int
+
+const (
+	needRead pathNeed = iota
+	needWrite
+	needExec
+)
+
+type doctorPath struct {
+	key  string
+	path string
+	dir  bool
+	need pathNeed
+}
+
+func (d *doctor) checkPaths() {
+	cfg := d.cfg
+	paths := []doctorPath{
+		{key: "paths.ndpi_plugin_path", path: cfg.Paths.NDPIPluginPath},
+		{key: "paths.suricatasc", path: cfg.Paths.SuricataSC, need: needExec},
+		{key: "paths.suricata_bin", path: cfg.Paths.SuricataBin, need: needExec},
+	}
+	if d.opts.Component == DoctorHostAgent {
+		paths = append(paths, doctorPath{key: "system.systemctl", path: cfg.System.Systemctl, need: needExec})
+		if cfg.HostAgent.AuditLog != "" {
+			paths = append(paths, doctorPath{key: "host_agent.audit_log (directory)", path: filepath.Dir(cfg.HostAgent.AuditLog), dir: true, need: needWrite})
+		}
+	} else {
+		paths = append(paths,
+			doctorPath{key: "paths.suricata_template", path: cfg.Paths.SuricataTemplate},
+			doctorPath{key: "paths.ndpi_rules_local", path: cfg.Paths.NDPIRulesLocal, dir: true},
+			doctorPath{key: "paths.suricata_rules_dir", path: cfg.Paths.SuricataRulesDir, dir: true, need: needWrite},
+		)
+	}
+
+	for _, p := range paths {
+		if p.path == "" {
+			d.warn(p.key, "not set", "set "+p.key+" in the config")
+			continue
+		}
+		if err := checkPath(p); err != nil {
+			d.fail(p.key, err.Error(), pathHint(p))
+			continue
+		}
+		d.ok(p.key, p.path)
+	}
+
+	// both components rewrite suricata.yaml (reconcile, ndpi enable/disable)
+	p, err := FirstExistingPath(cfg.Suricata.ConfigCandidates)
+	if err != nil {
+		d.fail("suricata config", err.Error(), "install Suricata or point suricata.config_candidates at its suricata.yaml")
+		return
+	}
+	d.suricataCfg = p
+	if err := checkPath(doctorPath{path: p, need: needWrite}); err != nil {
+		d.fail("suricata config", err.Error(), "run as a user that can write "+p+" (usually root or the suricata group)")
+		return
+	}
+	d.ok("suricata config", p)
+}
+
+// access(2) modes; syscall does not export W_OK and X_OK.
+const (
+	accessSearch = 0x1
+	accessWrite  = 0x2
+)
+
+func checkPath(p doctorPath) error {
+	info, err := os.Stat(p.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%s not found", p.path)
+		}
+		return err
+	}
+	if p.dir != info.IsDir() {
+		if p.dir {
+			return fmt.Errorf("%s is not a directory", p.path)
+		}
+		return fmt.Errorf("%s is a directory, want a file", p.path)
+	}
+
+	switch {
+	case p.need == needExec:
+		if info.Mode().Perm()&0o111 == 0 {
+			return fmt.Errorf("%s is not executable (mode %s)", p.path, info.Mode().Perm())
+		}
+	case p.dir && p.need == needWrite:
+		// access(2) instead of a probe file: the directory may be the live
+		// rules dir, and doctor must not change anything it checks
+		if err := syscall.Access(p.path, accessWrite|accessSearch); err != nil {
+			return fmt.Errorf("%s is not writable: %w", p.path, err)
+		}
+	case p.dir:
+		if _, err := os.ReadDir(p.path); err != nil {
+			return fmt.Errorf("%s is not readable: %w", p.path, errors.Unwrap(err))
+		}
+	default:
+		flag := os.O_RDONLY
+		if p.need == needWrite {
+			flag = os.O_RDWR
+		}
+		f, err := os.OpenFile(p.path, flag, 0)
+		if err != nil {
+			return fmt.Errorf("%s is not accessible: %w", p.path, errors.Unwrap(err))
+		}
+		f.Close()
+	}
+	return nil
+}
+
+func pathHint(p doctorPath) string {
+	switch p.need {
+	case needExec:
+		return "install it or fix " + p.key + "; it must be an executable file"
+	case needWrite:
+		return "create " + p.path + " and make it writable by the service user"
+	}
+	return "create " + p.path + " or fix " + p.key + "; the service user must be able to read it"
+}
+
+func (d *doctor) checkPlugin() {
+	const check = "ndpi plugin"
+	path := d.cfg.Paths.NDPIPluginPath
+	if err := CheckNDPIPlugin(PluginCheckOptions{Path: path, SuricataBinPath: d.cfg.Paths.SuricataBin}); err != nil {
+		d.fail(check, err.Error(), "rebuild the plugin from nDPI's Suricata plugin sources against the installed Suricata (see README) and install it at paths.ndpi_plugin_path")
+		return
+	}
+	d.ok(check, path+" is a loadable Suricata plugin")
+}
+
+func (d *doctor) checkBuildInfo(ctx context.Context) {
+	const check = "suricata build"
+	ctx, cancel := context.WithTimeout(ctx, d.opts.Timeout)
+	defer cancel()
+
+	info, err := ReadSuricataBuildInfo(ctx, d.opts.Runner, d.cfg.Paths.SuricataBin)
+	if err != nil {
+		d.fail(check, err.Error(), "check paths.suricata_bin points at a working Suricata "+SupportedSuricataSeries+".x")
+		return
+	}
+	if err := info.Check(); err != nil {
+		d.fail(check, err.Error(), "build Suricata "+SupportedSuricataSeries+".x from source with --enable-ndpi --with-ndpi=<nDPI source> (see README)")
+		return
+	}
+	d.ok(check, "suricata "+info.Version+" with plugin and nDPI support")
+}
+
+func (d *doctor) checkPluginLine() {
+	const check = "plugin line"
+	if d.suricataCfg == "" {
+		d.add(check, DoctorSkip, "no suricata config found", "")
+		return
+	}
+	enabled, line, err := NDPIStatus(d.suricataCfg, d.cfg.Paths.NDPIPluginPath)
+	if err != nil {
+		d.fail(check, err.Error(), "add the plugin under 'plugins:' in the template and run integration reconcile")
+		return
+	}
+	if !enabled {
+		d.warn(check, "commented out: "+strings.TrimSpace(line), "run integration ndpi enable")
+		return
+	}
+	d.ok(check, strings.TrimSpace(line))
+}
+
+// checkSockets dials every control socket candidate and returns the first
+// that answers.
+func (d *doctor) checkSockets() string {
+	reachable := ""
+	for _, p := range d.cfg.Suricata.SocketCandidates {
+		check := "suricata socket " + p
+		c, err := d.opts.Dialer.DialTimeout("unix", p, d.opts.Timeout)
+		if err != nil {
+			d.warn(check, err.Error(), "harmless if another candidate answers; drop stale entries from suricata.socket_candidates")
+			continue
+		}
+		c.Close()
+		d.ok(check, "accepts connections")
+		if reachable == "" {
+			reachable = p
+		}
+	}
+	if reachable == "" {
+		d.fail("suricata socket", "no socket candidate accepts connections",
+			"start Suricata (integration suricata ensure) and check unix-command.filename in suricata.yaml is one of suricata.socket_candidates")
+	}
+	return reachable
+}
+
+func (d *doctor) checkSuricataSC(ctx context.Context, sock string) {
+	const check = "suricatasc"
+	if sock == "" {
+		d.add(check, DoctorSkip, "no reachable control socket", "")
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, d.opts.Timeout)
+	defer cancel()
+
+	out, err := d.opts.Runner.CombinedOutput(ctx, d.cfg.Paths.SuricataSC, "-c", "uptime", sock)
+	if err != nil {
+		d.fail(check, fmt.Sprintf("uptime failed: %v: %s", err, strings.TrimSpace(string(out))),
+			"check the user can write "+sock+" (unix-command mode/group) and paths.suricatasc matches the Suricata version")
+		return
+	}
+	d.ok(check, "uptime answered on "+sock)
+}
+
+func (d *doctor) checkUnit(ctx context.Context) {
+	unit := d.cfg.System.SuricataService
+	check := "systemd unit " + unit
+	ctx, cancel := context.WithTimeout(ctx, d.opts.Timeout)
+	defer cancel()
+
+	m, err := systemd.New(ctx, d.cfg.System.SystemdBackend, d.cfg.System.Systemctl, d.opts.Runner)
+	if err != nil {
+		d.fail(check, err.Error(), "check system.systemd_backend")
+		return
+	}
+	if c, ok := m.(io.Closer); ok {
+		defer c.Close()
+	}
+	st, err := m.Status(ctx, unit)
+	if err != nil {
+		d.fail(check, err.Error(), "check system.systemctl (or the D-Bus backend) and that systemd is running")
+		return
+	}
+	if st.LoadState != "loaded" {
+		d.fail(check, "LoadState="+st.LoadState, "install a unit for Suricata or set system.suricata_service to its name")
+		return
+	}
+	d.ok(check, "loaded")
+}
+
+func (d *doctor) checkHostAgent(ctx context.Context) {
+	const check = "host agent socket"
+	hint := "start host-agent serve and make sure this user may connect to the socket and is granted GET /health in host_agent.access"
+	if d.opts.Component == DoctorHostAgent {
+		hint = "start host-agent serve (or its systemd unit); this only passes while it runs"
+	}
+
+	sock := d.opts.HostAgentSocket
+	if sock == "" {
+		sock = d.cfg.HTTP.HostAgentSocket
+	}
+	if sock == "" {
+		d.fail(check, "http.host_agent_socket is empty", "set http.host_agent_socket")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, d.opts.Timeout)
+	defer cancel()
+	if err := agentclient.New(sock, d.opts.Timeout).Health(ctx); err != nil {
+		d.fail(check, fmt.Sprintf("%s: %v", sock, err), hint)
+		return
+	}
+	d.ok(check, sock+" answers /health")
+}
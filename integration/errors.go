@@ -0,0 +1,40 @@
+package integration
+
+import (
+	"net/http"
+
+	"integration-suricata-ndpi/pkg/apierror"
+)
+
+// Sentinel errors of the operations behind the API; match them with
+// errors.Is. The API answers with their code and status.
+var (
+	ErrConfigNotFound   = apierror.New(http.StatusNotFound, "CONFIG_NOT_FOUND", "suricata.yaml not found in suricata.config_candidates", false)
+	ErrTemplateRender   = apierror.New(http.StatusUnprocessableEntity, "TEMPLATE_RENDER_FAILED", "suricata template could not be rendered", false)
+	ErrConfigInvalid    = apierror.New(http.StatusUnprocessableEntity, "CONFIG_INVALID", "patched suricata.yaml rejected by suricata -T; config not applied", false)
+	ErrRestartFailed    = apierror.ErrRestartFailed
+	ErrSuricataNotReady = apierror.ErrSuricataNotReady
+	ErrReloadFailed     = apierror.ErrReloadFailed
+	ErrNoRollback       = apierror.New(http.StatusConflict, "NO_ROLLBACK", "no previous rule set to roll back to", false)
+)
+
+func (e *RulesRejectedError) ErrorCode() string   { return "RULES_INVALID" }
+func (e *BundleRejectedError) ErrorCode() string  { return "BUNDLE_REJECTED" }
+func (e *RuleNotFoundError) ErrorCode() string    { return "RULE_NOT_FOUND" }
+func (e *invalidOverrideError) ErrorCode() string { return "INVALID_OVERRIDE" }
+func (e *invalidQueryError) ErrorCode() string    { return "INVALID_QUERY" }
+func (e *JobNotFoundError) ErrorCode() string     { return "JOB_NOT_FOUND" }
+func (e *JobFinishedError) ErrorCode() string     { return "JOB_FINISHED" }
+func (e *JobQueueFullError) ErrorCode() string    { return "JOB_QUEUE_FULL" }
+func (e *ReloadNotFoundError) ErrorCode() string  { return "RELOAD_NOT_FOUND" }
+func (e *JobQueueFullError) Retryable() bool      { return true }
+
+func (e *RulesRejectedError) PublicMessage() string   { return "rule set rejected by suricata -T" }
+func (e *BundleRejectedError) PublicMessage() string  { return "rule bundle rejected" }
+func (e *RuleNotFoundError) PublicMessage() string    { return "rule not found in local rules" }
+func (e *invalidOverrideError) PublicMessage() string { return "invalid rule override" }
+func (e *invalidQueryError) PublicMessage() string    { return "invalid rule query" }
+func (e *JobNotFoundError) PublicMessage() string     { return "job not found" }
+func (e *JobFinishedError) PublicMessage() string     { return "job already finished" }
+func (e *JobQueueFullError) PublicMessage() string    { return "job queue is full" }
+func (e *ReloadNotFoundError) PublicMessage() string  { return "rule reload not found" }
@@ -0,0 +1,133 @@
+package integration
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"integration-suricata-ndpi/internal/httpapi"
+)
+
+// Event types published on GET /events.
+const (
+	EventJob               = "job"
+	EventDrift             = "drift"
+	EventNDPIToggled       = "ndpi.toggled"
+	EventSuricataRestarted = "suricata.restarted"
+	EventSocket            = "suricata.socket"
+	EventReload            = "reload"
+)
+
+const subscriberBuffer = 64
+
+// EventBus fans events out to subscribers and keeps the last ones in a ring
+// buffer for Last-Event-ID replay.
+type EventBus struct {
+	mu     sync.Mutex
+	nextID uint64
+	ring   []httpapi.Event
+	start  int
+	size   int
+	subs   map[chan httpapi.Event]struct{}
+}
+
+func NewEventBus(capacity int) *EventBus {
+	if capacity <= 0 {
+		capacity = 256
+	}
+	return &EventBus{
+		nextID: 1,
+		ring:   make([]httpapi.Event, capacity),
+		subs:   make(map[chan httpapi.Event]struct{}),
+	}
+}
+
+func (b *EventBus) Publish(typ string, data any) httpapi.Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ev := httpapi.Event{ID: b.nextID, Type: typ, Time: time.Now().UTC(), Data: data}
+	b.nextID++
+
+	if b.size < len(b.ring) {
+		b.ring[(b.start+b.size)%len(b.ring)] = ev
+		b.size++
+	} else {
+		b.ring[b.start] = ev
+		b.start = (b.start + 1) % len(b.ring)
+	}
+
+	for ch := range b.subs {
+		select {
+		case ch <- ev:
+		default:
+			// a subscriber that cannot keep up is dropped rather than
+			// blocking publishers; it resumes with Last-Event-ID
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+	return ev
+}
+
+// Subscribe returns the buffered events with an id above lastID and a channel
+// of the events published afterwards; the channel is closed when ctx ends.
+func (b *EventBus) Subscribe(ctx context.Context, lastID uint64) ([]httpapi.Event, <-chan httpapi.Event) {
+	ch := make(chan httpapi.Event, subscriberBuffer)
+
+	b.mu.Lock()
+	var replay []httpapi.Event
+	for i := 0; i < b.size; i++ {
+		ev := b.ring[(b.start+i)%len(b.ring)]
+		if ev.ID > lastID {
+			replay = append(replay, ev)
+		}
+	}
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subs[ch]; ok {
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}()
+	return replay, ch
+}
+
+type JobEvent struct {
+	ID     string    `json:"id"`
+	Kind   string    `json:"kind"`
+	Status JobStatus `json:"status"`
+	Step   string    `json:"step,omitempty"`
+	Error  string    `json:"error,omitempty"`
+}
+
+type DriftEvent struct {
+	Drift            bool   `json:"drift"`
+	TargetConfigPath string `json:"target_config_path,omitempty"`
+	RuleFilesChanged bool   `json:"rule_files_changed,omitempty"`
+}
+
+type SocketEvent struct {
+	Reachable bool   `json:"reachable"`
+	Socket    string `json:"socket,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+type ReloadEvent struct {
+	Command string       `json:"command"`
+	Status  ReloadStatus `json:"status"`
+	Reload  *RuleReload  `json:"reload,omitempty"`
+}
+
+func jobEvent(j Job) JobEvent {
+	ev := JobEvent{ID: j.ID, Kind: j.Kind, Status: j.Status, Error: j.Error}
+	if n := len(j.Steps); n > 0 && j.Status == JobRunning {
+		ev.Step = j.Steps[n-1].Message
+	}
+	return ev
+}
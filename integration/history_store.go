@@ -0,0 +1,331 @@
+package integration
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"integration-suricata-ndpi/internal/httpapi"
+	"integration-suricata-ndpi/pkg/apierror"
+	"integration-suricata-ndpi/pkg/fsutil"
+	"integration-suricata-ndpi/pkg/logger"
+)
+
+const historyFile = "history.jsonl"
+
+// OperationRecord is one line of the history: an operation with its inputs,
+// outcome and the config/rule hashes it left behind.
+type OperationRecord struct {
+	Seq          uint64          `json:"seq"`
+	Kind         string          `json:"kind"`
+	JobID        string          `json:"job_id,omitempty"`
+	Identity     string          `json:"identity,omitempty"`
+	Status       string          `json:"status"`
+	Error        string          `json:"error,omitempty"`
+	Code         string          `json:"code,omitempty"`
+	StartedAt    time.Time       `json:"started_at"`
+	FinishedAt   time.Time       `json:"finished_at"`
+	DurationMS   int64           `json:"duration_ms"`
+	Inputs       map[string]any  `json:"inputs,omitempty"`
+	ConfigPath   string          `json:"config_path,omitempty"`
+	ConfigSHA256 string          `json:"config_sha256,omitempty"`
+	RulesSHA256  string          `json:"rules_sha256,omitempty"`
+	Result       json.RawMessage `json:"result,omitempty"`
+}
+
+type HistoryPage struct {
+	Records []OperationRecord `json:"records"`
+	Total   int               `json:"total"`
+	// NextBefore is the "before" value for the next (older) page, 0 on the last one.
+	NextBefore uint64 `json:"next_before,omitempty"`
+}
+
+// HistoryStore appends records to <dir>/history.jsonl. Once the file holds a
+// quarter more than maxRecords it is compacted to the newest maxRecords.
+type HistoryStore struct {
+	mu         sync.Mutex
+	path       string
+	maxRecords int
+	nextSeq    uint64
+	count      int
+}
+
+func OpenHistoryStore(dir string, maxRecords int) (*HistoryStore, error) {
+	if strings.TrimSpace(dir) == "" {
+		return nil, fmt.Errorf("state dir is empty")
+	}
+	if maxRecords <= 0 {
+		maxRecords = 1000
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("create state dir %s: %w", dir, err)
+	}
+
+	s := &HistoryStore{path: filepath.Join(dir, historyFile), maxRecords: maxRecords, nextSeq: 1}
+	if err := s.dropTornTail(); err != nil {
+		return nil, err
+	}
+	recs, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	s.count = len(recs)
+	if n := len(recs); n > 0 {
+		s.nextSeq = recs[n-1].Seq + 1
+	}
+	return s, nil
+}
+
+// dropTornTail cuts a last line left unterminated by a crash while appending,
+// so the next record starts on a line of its own.
+func (s *HistoryStore) dropTornTail() error {
+	raw, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("read history %s: %w", s.path, err)
+	}
+	if len(raw) == 0 || raw[len(raw)-1] == '\n' {
+		return nil
+	}
+	keep := bytes.LastIndexByte(raw, '\n') + 1
+	logger.Warnw("Dropping torn history record", "path", s.path, "bytes", len(raw)-keep)
+	return os.Truncate(s.path, int64(keep))
+}
+
+// load reads all records, oldest first; unreadable lines are skipped.
+func (s *HistoryStore) load() ([]OperationRecord, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("open history %s: %w", s.path, err)
+	}
+	defer f.Close()
+
+	var out []OperationRecord
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	line := 0
+	for sc.Scan() {
+		line++
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+		var rec OperationRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			logger.Warnw("Skipping unreadable history record", "path", s.path, "line", line, "error", err)
+			continue
+		}
+		out = append(out, rec)
+	}
+	if err := sc.Err(); err != nil {
+		return out, fmt.Errorf("read history %s: %w", s.path, err)
+	}
+	return out, nil
+}
+
+func (s *HistoryStore) Append(rec OperationRecord) (OperationRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec.Seq = s.nextSeq
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return rec, fmt.Errorf("encode history record: %w", err)
+	}
+
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return rec, fmt.Errorf("open history %s: %w", s.path, err)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		_ = f.Close()
+		return rec, fmt.Errorf("append history %s: %w", s.path, err)
+	}
+	if err := f.Close(); err != nil {
+		return rec, err
+	}
+	s.nextSeq++
+	s.count++
+
+	if s.count > s.maxRecords+s.maxRecords/4 {
+		if err := s.compactLocked(); err != nil {
+			logger.Warnw("History compaction failed", "path", s.path, "error", err)
+		}
+	}
+	return rec, nil
+}
+
+func (s *HistoryStore) compactLocked() error {
+	recs, err := s.load()
+	if err != nil {
+		return err
+	}
+	if len(recs) > s.maxRecords {
+		recs = recs[len(recs)-s.maxRecords:]
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, r := range recs {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+	if err := writeFileAtomic(s.path, buf.Bytes(), 0o640, fsutil.OSFS{}); err != nil {
+		return fmt.Errorf("compact history %s: %w", s.path, err)
+	}
+	s.count = len(recs)
+	logger.Infow("History compacted", "path", s.path, "records", s.count)
+	return nil
+}
+
+// Query returns matching records newest first, one page at a time.
+func (s *HistoryStore) Query(q httpapi.HistoryQuery) (HistoryPage, error) {
+	s.mu.Lock()
+	recs, err := s.load()
+	s.mu.Unlock()
+	if err != nil {
+		return HistoryPage{}, err
+	}
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+
+	var matched []OperationRecord
+	for i := len(recs) - 1; i >= 0; i-- {
+		r := recs[i]
+		if q.Kind != "" && r.Kind != q.Kind {
+			continue
+		}
+		if q.Status != "" && r.Status != q.Status {
+			continue
+		}
+		if q.JobID != "" && r.JobID != q.JobID {
+			continue
+		}
+		if !q.Since.IsZero() && r.StartedAt.Before(q.Since) {
+			continue
+		}
+		if !q.Until.IsZero() && r.StartedAt.After(q.Until) {
+			continue
+		}
+		matched = append(matched, r)
+	}
+
+	page := HistoryPage{Total: len(matched), Records: []OperationRecord{}}
+	start := 0
+	if q.Before > 0 {
+		start = sort.Search(len(matched), func(i int) bool { return matched[i].Seq < q.Before })
+	}
+	end := start + limit
+	if end > len(matched) {
+		end = len(matched)
+	}
+	page.Records = append(page.Records, matched[start:end]...)
+	if end < len(matched) {
+		page.NextBefore = matched[end-1].Seq
+	}
+	return page, nil
+}
+
+// stateHashes fingerprints what Suricata runs: the live suricata.yaml and the
+// deployed rule files (names and contents, in name order).
+func stateHashes(opts ApplyConfigOptions) (configPath, configSHA, rulesSHA string) {
+	fs := opts.FS
+	if fs == nil {
+		fs = fsutil.OSFS{}
+	}
+	if p, err := FirstExistingPath(opts.ConfigCandidates); err == nil {
+		if b, err := fs.ReadFile(p); err == nil {
+			configPath, configSHA = p, sha256Hex(b)
+		}
+	}
+	if strings.TrimSpace(opts.RulesDeployDir) == "" {
+		return configPath, configSHA, ""
+	}
+	files, err := ListRuleFiles(opts.RulesDeployDir, fs)
+	if err != nil {
+		return configPath, configSHA, ""
+	}
+	var buf bytes.Buffer
+	for _, f := range files {
+		b, err := fs.ReadFile(f)
+		if err != nil {
+			return configPath, configSHA, ""
+		}
+		buf.WriteString(filepath.Base(f))
+		buf.WriteByte(0)
+		buf.Write(b)
+		buf.WriteByte(0)
+	}
+	return configPath, configSHA, sha256Hex(buf.Bytes())
+}
+
+// recordOperation appends the outcome of an operation to the history; without
+// a store it does nothing.
+func (r *Runner) recordOperation(ctx context.Context, kind, identity string, inputs map[string]any, started time.Time, result any, opErr error) {
+	if r.history == nil {
+		return
+	}
+	finished := time.Now().UTC()
+	rec := OperationRecord{
+		Kind:       kind,
+		JobID:      jobIDFromContext(ctx),
+		Identity:   identity,
+		Status:     string(JobSucceeded),
+		StartedAt:  started.UTC(),
+		FinishedAt: finished,
+		DurationMS: finished.Sub(started).Milliseconds(),
+		Inputs:     inputs,
+	}
+	// like a job, the record keeps the code's stable message; the cause is
+	// only logged
+	switch {
+	case opErr == nil:
+	case errors.Is(opErr, context.Canceled):
+		rec.Status, rec.Error = string(JobCanceled), apierror.ErrCanceled.Message
+	default:
+		ae := apierror.From(opErr)
+		rec.Status, rec.Error, rec.Code = string(JobFailed), ae.Message, ae.Code
+		logger.Warnw("Operation failed", "kind", kind, "job_id", rec.JobID, "code", ae.Code, "error", opErr)
+	}
+	rec.ConfigPath, rec.ConfigSHA256, rec.RulesSHA256 = stateHashes(r.opts.Apply)
+	if result != nil {
+		if b, err := json.Marshal(result); err == nil && string(b) != "null" {
+			rec.Result = b
+		}
+	}
+	if _, err := r.history.Append(rec); err != nil {
+		logger.Warnw("Operation not recorded in history", "kind", kind, "error", err)
+	}
+}
+
+// recorded wraps fn so its outcome lands in the history, along with the API
+// caller of the request ctx belongs to.
+func (r *Runner) recorded(ctx context.Context, kind string, inputs map[string]any, fn JobFunc) JobFunc {
+	var identity string
+	if id, ok := httpapi.IdentityFromContext(ctx); ok {
+		identity = id.String()
+	}
+	return func(ctx context.Context) (any, error) {
+		started := time.Now()
+		res, err := fn(ctx)
+		r.recordOperation(ctx, kind, identity, inputs, started, res, err)
+		return res, err
+	}
+}
@@ -2,11 +2,13 @@ package integration
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"net"
 	"net/http"
 	"time"
 
+	"integration-suricata-ndpi/internal/config"
 	"integration-suricata-ndpi/internal/httpapi"
 	"integration-suricata-ndpi/pkg/agentclient"
 	"integration-suricata-ndpi/pkg/logger"
@@ -37,10 +39,25 @@ func (r *Runner) startHTTPServer(ctx context.Context) error {
 		},
 	}
 
+	switch auth := authFromConfig(r.cfg.HTTP.Auth); {
+	case auth.Disabled:
+		logger.Warnw("HTTP API authentication is disabled: every caller is admin", "addr", addr)
+	case !auth.Enabled():
+		return fmt.Errorf("http.auth has no tokens or client_certs: add one (integration token) or set http.auth.disabled: true")
+	}
+
+	tlsCfg, err := newServerTLSConfig(r.cfg.HTTP.TLS)
+	if err != nil {
+		return err
+	}
+
 	ln, err := net.Listen("tcp", addr)
 	if err != nil {
 		return fmt.Errorf("http listen %s: %w", addr, err)
 	}
+	if tlsCfg != nil {
+		ln = tls.NewListener(ln, tlsCfg)
+	}
 
 	r.httpServer = server
 
@@ -55,7 +72,7 @@ func (r *Runner) startHTTPServer(ctx context.Context) error {
 	}()
 
 	go func() {
-		logger.Infow("HTTP server started", "addr", addr)
+		logger.Infow("HTTP server started", "addr", addr, "tls", tlsCfg != nil)
 		if err := server.Serve(ln); err != nil && err != http.ErrServerClosed {
 			logger.Errorw("HTTP server failed", "error", err)
 			select {
@@ -68,49 +85,169 @@ func (r *Runner) startHTTPServer(ctx context.Context) error {
 	return nil
 }
 
+// registerRoutes wires the API to the runner. Operations that change Suricata
+// or the rules run on the job queue, strictly one at a time, and answer 202
+// with the job; GET /plan runs between jobs so it never sees half an apply, and
+// is not recorded in the history since dashboards poll it.
 func (r *Runner) registerRoutes(mux *http.ServeMux) {
+	var auth httpapi.AuthConfig
+	if r.cfg != nil {
+		auth = authFromConfig(r.cfg.HTTP.Auth)
+	}
+
 	srv := httpapi.New(httpapi.Deps{
 		Plan: func(ctx context.Context) (any, error) {
-			r.mu.Lock()
-			defer r.mu.Unlock()
-			return PlanConfig(ctx, r.opts.Apply)
+			return r.jobs.Between(ctx, func(ctx context.Context) (any, error) {
+				return PlanConfig(ctx, r.opts.Apply)
+			})
 		},
 
 		Reconcile: func(ctx context.Context) (any, error) {
-			r.mu.Lock()
-			defer r.mu.Unlock()
-			return ReconcileConfig(ctx, r.opts.Apply)
+			inputs := map[string]any{"template": r.opts.Apply.TemplatePath}
+			return r.jobs.Submit("reconcile", r.recorded(ctx, "reconcile", inputs, func(ctx context.Context) (any, error) {
+				defer r.nudgeState()
+				rep, err := ReconcileConfig(ctx, r.opts.Apply)
+				if rep.RestartPerformed {
+					r.events.Publish(EventSuricataRestarted, RestartEvent{Reason: "reconcile", Command: rep.RestartCommand})
+				}
+				return rep, err
+			}))
 		},
 
 		Apply: func(ctx context.Context) (any, error) {
-			r.mu.Lock()
-			defer r.mu.Unlock()
-			return ApplyConfigWithContext(ctx, r.opts.Apply)
+			inputs := map[string]any{"rules_local_dir": r.opts.Apply.RulesLocalDir, "reload_command": r.opts.Apply.ReloadCommand}
+			return r.jobs.Submit("apply", r.recorded(ctx, "apply", inputs, func(ctx context.Context) (any, error) {
+				if err := r.ensureSuricataViaHostAgent(ctx); err != nil {
+					return nil, err
+				}
+				defer r.nudgeState()
+				rep, err := ApplyConfigWithContext(ctx, r.opts.Apply)
+				r.publishReload(rep)
+				return rep, err
+			}))
 		},
 
-		EnsureSuricata: func(ctx context.Context) error {
-			r.mu.Lock()
-			defer r.mu.Unlock()
-			return r.ensureSuricataViaHostAgent(ctx)
+		MaxBundleSize: MaxRuleBundleSize,
+		ApplyBundle: func(ctx context.Context, src httpapi.BundleSource) (any, error) {
+			inputs := map[string]any{"bundle_path": src.Path}
+			if src.Path == "" {
+				inputs = map[string]any{"bundle_sha256": sha256Hex(src.Data), "bundle_bytes": len(src.Data)}
+			}
+			return r.jobs.Submit("apply-bundle", r.recorded(ctx, "apply-bundle", inputs, func(ctx context.Context) (any, error) {
+				if err := r.ensureSuricataViaHostAgent(ctx); err != nil {
+					return nil, err
+				}
+				defer r.nudgeState()
+				rep, err := r.applyRuleBundle(ctx, src)
+				r.publishReload(rep)
+				return rep, err
+			}))
+		},
+
+		Rollback: func(ctx context.Context) (any, error) {
+			inputs := map[string]any{"rollback_dir": r.opts.Apply.RulesRollbackDir}
+			return r.jobs.Submit("rollback", r.recorded(ctx, "rollback", inputs, func(ctx context.Context) (any, error) {
+				if err := r.ensureSuricataViaHostAgent(ctx); err != nil {
+					return nil, err
+				}
+				defer r.nudgeState()
+				rep, err := RollbackRules(ctx, r.opts.Apply)
+				r.publishReload(rep)
+				return rep, err
+			}))
+		},
+
+		GetReload: func(ctx context.Context, id string) (any, error) {
+			return r.reloads.Get(id)
+		},
+
+		NDPIStatus: func(ctx context.Context) (any, error) {
+			return r.ndpiStatus(ctx)
 		},
 
 		EnableNDPI: func(ctx context.Context) (any, error) {
-			r.mu.Lock()
-			defer r.mu.Unlock()
-			return r.callHostAgent(ctx, true)
+			inputs := map[string]any{"enable": true}
+			return r.jobs.Submit("ndpi-enable", r.recorded(ctx, "ndpi-enable", inputs, func(ctx context.Context) (any, error) {
+				return r.callHostAgent(ctx, true)
+			}))
 		},
 
 		DisableNDPI: func(ctx context.Context) (any, error) {
-			r.mu.Lock()
-			defer r.mu.Unlock()
-			return r.callHostAgent(ctx, false)
+			inputs := map[string]any{"enable": false}
+			return r.jobs.Submit("ndpi-disable", r.recorded(ctx, "ndpi-disable", inputs, func(ctx context.Context) (any, error) {
+				return r.callHostAgent(ctx, false)
+			}))
+		},
+
+		EnsureSuricata: func(ctx context.Context) (any, error) {
+			return r.jobs.Submit("suricata-ensure", r.recorded(ctx, "suricata-ensure", nil, func(ctx context.Context) (any, error) {
+				defer r.nudgeState()
+				return r.ensureSuricata(ctx)
+			}))
+		},
+
+		SubscribeEvents: func(ctx context.Context, lastID uint64) ([]httpapi.Event, <-chan httpapi.Event) {
+			return r.events.Subscribe(ctx, lastID)
+		},
+
+		History: func(ctx context.Context, q httpapi.HistoryQuery) (any, error) {
+			if r.history == nil {
+				return nil, fmt.Errorf("history store is not open")
+			}
+			return r.history.Query(q)
+		},
+
+		ListJobs: func(ctx context.Context) (any, error) {
+			return r.jobs.List(), nil
+		},
+
+		GetJob: func(ctx context.Context, id string) (any, error) {
+			return r.jobs.Get(id)
+		},
+
+		CancelJob: func(ctx context.Context, id string) (any, error) {
+			return r.jobs.Cancel(id)
+		},
+
+		RulesCoverage: func(ctx context.Context) (any, error) {
+			return r.rulesCoverage(ctx)
+		},
+
+		ListRules: func(ctx context.Context, q httpapi.RuleQuery) (any, error) {
+			return r.listRules(ctx, q)
+		},
+
+		GetRule: func(ctx context.Context, sid uint64, source string) (any, error) {
+			return r.getRule(ctx, sid, source)
+		},
+
+		RulesMitre: func(ctx context.Context, source string) (any, error) {
+			return r.rulesMitre(ctx, source)
 		},
+
+		RulesDiff: func(ctx context.Context) (any, error) {
+			return r.rulesDiff(ctx)
+		},
+
+		ValidateRules: func(ctx context.Context, text string) (any, error) {
+			return r.validateRuleText(ctx, text)
+		},
+
+		OverrideRule: func(ctx context.Context, sid uint64, op, action string) (any, error) {
+			inputs := map[string]any{"sid": sid, "op": op, "action": action}
+			return r.jobs.Submit("rule-override", r.recorded(ctx, "rule-override", inputs, func(ctx context.Context) (any, error) {
+				return r.overrideRule(ctx, sid, op, action)
+			}))
+		},
+
+		Auth: auth,
 	})
 
 	srv.Register(mux)
 }
 
-func (r *Runner) callHostAgent(ctx context.Context, enable bool) (*agentclient.ToggleResponse, error) {
+// hostAgent returns a client for http.host_agent_socket.
+func (r *Runner) hostAgent() (*agentclient.Client, error) {
 	if r.cfg == nil {
 		return nil, fmt.Errorf("config is not loaded")
 	}
@@ -124,43 +261,75 @@ func (r *Runner) callHostAgent(ctx context.Context, enable bool) (*agentclient.T
 	if timeout <= 0 {
 		timeout = 10 * time.Second
 	}
+	return agentclient.New(socket, timeout), nil
+}
 
-	client := agentclient.New(socket, timeout)
-
-	if enable {
-		return client.EnableNDPI(ctx)
+func (r *Runner) ndpiStatus(ctx context.Context) (*agentclient.NDPIStatusResponse, error) {
+	client, err := r.hostAgent()
+	if err != nil {
+		return nil, err
 	}
-	return client.DisableNDPI(ctx)
+	return client.NDPIStatus(ctx)
 }
 
-func (r *Runner) ensureSuricataViaHostAgent(ctx context.Context) error {
-	if r.cfg == nil {
-		return fmt.Errorf("config is not loaded")
+func (r *Runner) callHostAgent(ctx context.Context, enable bool) (*agentclient.ToggleResponse, error) {
+	client, err := r.hostAgent()
+	if err != nil {
+		return nil, err
 	}
+	ctx = agentclient.WithRequestID(ctx, jobIDFromContext(ctx))
 
-	socket := r.cfg.HTTP.HostAgentSocket
-	if socket == "" {
-		return fmt.Errorf("http.host_agent_socket is empty")
+	var resp *agentclient.ToggleResponse
+	if enable {
+		resp, err = client.EnableNDPI(ctx)
+	} else {
+		resp, err = client.DisableNDPI(ctx)
 	}
-
-	timeout := r.cfg.HTTP.HostAgentTimeout
-	if timeout <= 0 {
-		timeout = 10 * time.Second
+	if err == nil && resp != nil && resp.OK {
+		r.events.Publish(EventNDPIToggled, NDPIEvent{Enabled: enable, Changed: resp.Changed, Message: resp.Message})
+		r.nudgeState()
 	}
+	return resp, err
+}
+
+func (r *Runner) ensureSuricataViaHostAgent(ctx context.Context) error {
+	_, err := r.ensureSuricata(ctx)
+	return err
+}
 
-	client := agentclient.New(socket, timeout)
+func (r *Runner) ensureSuricata(ctx context.Context) (*agentclient.EnsureSuricataResponse, error) {
+	client, err := r.hostAgent()
+	if err != nil {
+		return nil, err
+	}
+	ctx = agentclient.WithRequestID(ctx, jobIDFromContext(ctx))
 
 	resp, err := client.EnsureSuricataStarted(ctx)
 	if err != nil {
-		return err
+		return resp, err
 	}
 	if !resp.OK {
-		return fmt.Errorf("host-agent ensure suricata failed: %s (%s)", resp.Message, resp.Code)
+		return resp, fmt.Errorf("host-agent ensure suricata failed: %s (%s)", resp.Message, resp.Code)
 	}
 
+	jobStep(ctx, "suricata ensured via host-agent (started=%v)", resp.Started)
+	if resp.Started {
+		r.events.Publish(EventSuricataRestarted, RestartEvent{Reason: "started by host-agent"})
+	}
 	logger.Infow("Suricata ensured via host-agent",
 		"started", resp.Started,
 		"socket", resp.Socket,
 	)
-	return nil
+	return resp, nil
+}
+
+func authFromConfig(c config.AuthConfig) httpapi.AuthConfig {
+	out := httpapi.AuthConfig{Disabled: c.Disabled}
+	for _, t := range c.Tokens {
+		out.Tokens = append(out.Tokens, httpapi.Token{Name: t.Name, SHA256: t.SHA256, Role: t.Role})
+	}
+	for _, cc := range c.ClientCerts {
+		out.ClientCerts = append(out.ClientCerts, httpapi.ClientCert{Name: cc.Name, CommonName: cc.CommonName, Role: cc.Role})
+	}
+	return out
 }
@@ -0,0 +1,212 @@
+package integration
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"integration-suricata-ndpi/internal/config"
+	"integration-suricata-ndpi/pkg/logger"
+)
+
+// tlsFiles serves the certificate and client CA from disk and re-reads them
+// when their size or mtime changes, so renewed certificates are picked up
+// on the next handshake without a restart. A file that fails to load keeps
+// the previous version in use.
+type tlsFiles struct {
+	cfg config.TLSConfig
+	min uint16
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	certSig string
+	pool    *x509.CertPool
+	poolSig string
+}
+
+// newServerTLSConfig returns nil when http.tls is not enabled.
+func newServerTLSConfig(cfg config.TLSConfig) (*tls.Config, error) {
+	if !cfg.Enabled() {
+		return nil, nil
+	}
+	min := uint16(tls.VersionTLS12)
+	if cfg.MinVersion == "1.3" {
+		min = tls.VersionTLS13
+	}
+
+	f := &tlsFiles{cfg: cfg, min: min}
+	if cfg.SelfSigned {
+		cert, err := selfSignedCert(time.Now(), 30*24*time.Hour)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(cert.Certificate[0])
+		logger.Warnw("HTTP API uses a self-signed certificate (http.tls.self_signed); for development only",
+			"sha256", hex.EncodeToString(sum[:]),
+			"not_after", cert.Leaf.NotAfter,
+		)
+		f.cert = cert
+	}
+	if _, err := f.certificate(); err != nil {
+		return nil, err
+	}
+	if _, err := f.clientCAs(); err != nil {
+		return nil, err
+	}
+	return &tls.Config{MinVersion: min, GetConfigForClient: f.configForClient}, nil
+}
+
+func (f *tlsFiles) configForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	cert, err := f.certificate()
+	if err != nil {
+		return nil, err
+	}
+	out := &tls.Config{
+		MinVersion:   f.min,
+		Certificates: []tls.Certificate{*cert},
+	}
+
+	pool, err := f.clientCAs()
+	if err != nil {
+		return nil, err
+	}
+	if pool != nil {
+		out.ClientCAs = pool
+		out.ClientAuth = tls.VerifyClientCertIfGiven
+		if f.cfg.RequireClientCert {
+			out.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return out, nil
+}
+
+func (f *tlsFiles) certificate() (*tls.Certificate, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.cfg.SelfSigned {
+		return f.cert, nil
+	}
+	sig, err := fileSig(f.cfg.CertFile, f.cfg.KeyFile)
+	if err == nil && sig == f.certSig && f.cert != nil {
+		return f.cert, nil
+	}
+	cert, loadErr := tls.LoadX509KeyPair(f.cfg.CertFile, f.cfg.KeyFile)
+	if err == nil {
+		err = loadErr
+	}
+	if err != nil {
+		if f.cert == nil {
+			return nil, fmt.Errorf("load http.tls certificate: %w", err)
+		}
+		logger.Warnw("HTTP TLS certificate reload failed, keeping the previous one",
+			"cert_file", f.cfg.CertFile, "error", err)
+		f.certSig = sig
+		return f.cert, nil
+	}
+
+	if f.cert != nil {
+		logger.Infow("HTTP TLS certificate reloaded", "cert_file", f.cfg.CertFile)
+	}
+	f.cert, f.certSig = &cert, sig
+	return f.cert, nil
+}
+
+func (f *tlsFiles) clientCAs() (*x509.CertPool, error) {
+	if f.cfg.ClientCA == "" {
+		return nil, nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	sig, err := fileSig(f.cfg.ClientCA)
+	if err == nil && sig == f.poolSig && f.pool != nil {
+		return f.pool, nil
+	}
+	var pool *x509.CertPool
+	if err == nil {
+		var raw []byte
+		raw, err = os.ReadFile(f.cfg.ClientCA)
+		if err == nil {
+			pool = x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(raw) {
+				err = fmt.Errorf("no PEM certificates in %s", f.cfg.ClientCA)
+			}
+		}
+	}
+	if err != nil {
+		if f.pool == nil {
+			return nil, fmt.Errorf("load http.tls.client_ca: %w", err)
+		}
+		logger.Warnw("HTTP TLS client CA reload failed, keeping the previous one",
+			"client_ca", f.cfg.ClientCA, "error", err)
+		f.poolSig = sig
+		return f.pool, nil
+	}
+
+	if f.pool != nil {
+		logger.Infow("HTTP TLS client CA reloaded", "client_ca", f.cfg.ClientCA)
+	}
+	f.pool, f.poolSig = pool, sig
+	return f.pool, nil
+}
+
+func fileSig(paths ...string) (string, error) {
+	var sig string
+	for _, p := range paths {
+		st, err := os.Stat(p)
+		if err != nil {
+			return "", err
+		}
+		sig += fmt.Sprintf("%s:%d:%d;", p, st.Size(), st.ModTime().UnixNano())
+	}
+	return sig, nil
+}
+
+// selfSignedCert makes an ECDSA P-256 certificate for localhost, the host
+// name and the loopback addresses.
+func selfSignedCert(now time.Time, validFor time.Duration) (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 126))
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{"localhost"}
+	if h, err := os.Hostname(); err == nil && h != "" && h != "localhost" {
+		names = append(names, h)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: names[len(names)-1], Organization: []string{"integration-suricata-ndpi (self-signed)"}},
+		NotBefore:    now.Add(-time.Minute),
+		NotAfter:     now.Add(validFor),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     names,
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("create self-signed certificate: %w", err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, nil
+}
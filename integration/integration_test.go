@@ -1,25 +1,53 @@
 package integration
 
 import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"debug/elf"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
+	"integration-suricata-ndpi/internal/config"
+	"integration-suricata-ndpi/internal/httpapi"
+	"integration-suricata-ndpi/internal/mocks"
+	"integration-suricata-ndpi/pkg/agentclient"
+	"integration-suricata-ndpi/pkg/apierror"
 	"integration-suricata-ndpi/pkg/fsutil"
+	"integration-suricata-ndpi/pkg/netutil"
+	"integration-suricata-ndpi/pkg/rules"
+	"integration-suricata-ndpi/pkg/systemd"
 )
 
 func TestRunner_StartStop_Basic(t *testing.T) {
 	dir := t.TempDir()
 
-	// ndpi plugin file
+	// ndpi plugin file; like in the service container, its libndpi is not
+	// installed and there is no Suricata binary to ask for --build-info
 	ndpiSo := filepath.Join(dir, "ndpi.so")
-	if err := os.WriteFile(ndpiSo, []byte("fake"), 0o644); err != nil {
-		t.Fatal(err)
-	}
+	writePluginELF(t, ndpiSo, pluginELF{symbols: []string{PluginRegisterSymbol}, needed: []string{"libndpi-missing.so.4"}})
+	suricataBin := filepath.Join(dir, "missing", "suricata")
 
 	// rules dir (может быть пустым — ValidateNDPIConfig это допускает)
 	rulesDir := filepath.Join(dir, "rules", "ndpi")
@@ -61,12 +89,14 @@ unix-command:
 	cfgYAML := `
 http:
   addr: "127.0.0.1:0"
+  auth:
+    disabled: true
 paths:
   ndpi_rules_local: "` + rulesDir + `"
   ndpi_plugin_path: "` + ndpiSo + `"
   suricata_template: "` + tpl + `"
   suricatasc: "` + suricatasc + `"
-  suricata_bin: "/usr/bin/suricata"
+  suricata_bin: "` + suricataBin + `"
 ndpi:
   expected_rules_pattern: ""
 suricata:
@@ -358,7 +388,7 @@ func TestValidateNDPIConfig_OK(t *testing.T) {
 	dir := t.TempDir()
 
 	ndpiSo := filepath.Join(dir, "ndpi.so")
-	writeFile(t, ndpiSo, "fake", 0o644)
+	writePluginELF(t, ndpiSo, pluginELF{symbols: []string{PluginRegisterSymbol}})
 
 	rulesDir := filepath.Join(dir, "rules", "ndpi")
 	if err := os.MkdirAll(rulesDir, 0o755); err != nil {
@@ -423,7 +453,7 @@ func TestValidateNDPIConfig_RulesDirMissing_Error(t *testing.T) {
 	dir := t.TempDir()
 
 	ndpiSo := filepath.Join(dir, "ndpi.so")
-	writeFile(t, ndpiSo, "fake", 0o644)
+	writePluginELF(t, ndpiSo, pluginELF{symbols: []string{PluginRegisterSymbol}})
 
 	rulesDir := filepath.Join(dir, "rules", "ndpi")
 
@@ -451,7 +481,7 @@ func TestValidateNDPIConfig_TemplateMissing_Error(t *testing.T) {
 	dir := t.TempDir()
 
 	ndpiSo := filepath.Join(dir, "ndpi.so")
-	writeFile(t, ndpiSo, "fake", 0o644)
+	writePluginELF(t, ndpiSo, pluginELF{symbols: []string{PluginRegisterSymbol}})
 
 	rulesDir := filepath.Join(dir, "rules", "ndpi")
 	_ = os.MkdirAll(rulesDir, 0o755)
@@ -479,7 +509,7 @@ func TestValidateNDPIConfig_SuricatascMissing_Error(t *testing.T) {
 	dir := t.TempDir()
 
 	ndpiSo := filepath.Join(dir, "ndpi.so")
-	writeFile(t, ndpiSo, "fake", 0o644)
+	writePluginELF(t, ndpiSo, pluginELF{symbols: []string{PluginRegisterSymbol}})
 
 	rulesDir := filepath.Join(dir, "rules", "ndpi")
 	_ = os.MkdirAll(rulesDir, 0o755)
@@ -507,7 +537,7 @@ func TestValidateNDPIConfig_ReloadCommandEmpty_OK(t *testing.T) {
 	dir := t.TempDir()
 
 	ndpiSo := filepath.Join(dir, "ndpi.so")
-	writeFile(t, ndpiSo, "fake", 0o644)
+	writePluginELF(t, ndpiSo, pluginELF{symbols: []string{PluginRegisterSymbol}})
 
 	rulesDir := filepath.Join(dir, "rules", "ndpi")
 	_ = os.MkdirAll(rulesDir, 0o755)
@@ -532,6 +562,131 @@ func TestValidateNDPIConfig_ReloadCommandEmpty_OK(t *testing.T) {
 	}
 }
 
+const buildInfo802 = `This is Suricata version 8.0.2 RELEASE
+Features: PCAP_SET_BUFF AF_PACKET HAVE_PACKET_FANOUT LIBCAP_NG HAVE_LUA RUST POPCNT64
+SIMD support: SSE_4_2 SSE_4_1 SSE_3 SSE_2
+Plugin support (experimental):           yes
+DPDK support:                            no
+  nDPI support:                            yes
+`
+
+func TestParseSuricataBuildInfo(t *testing.T) {
+	info, err := ParseSuricataBuildInfo([]byte(buildInfo802))
+	if err != nil || info != (SuricataBuildInfo{Version: "8.0.2", PluginSupport: true, NDPISupport: true}) {
+		t.Fatalf("parse: %+v %v", info, err)
+	}
+	if err := info.Check(); err != nil {
+		t.Fatalf("8.0.2 with nDPI: %v", err)
+	}
+
+	cases := []struct {
+		out, want string
+	}{
+		{strings.Replace(buildInfo802, "8.0.2", "7.0.10", 1), "suricata 7.0.10 is not supported"},
+		{strings.Replace(buildInfo802, "8.0.2", "8.1.0-dev", 1), "suricata 8.1.0-dev is not supported"},
+		{strings.Replace(buildInfo802, "experimental):           yes", "experimental):           no", 1), "without plugin support"},
+		{strings.Replace(buildInfo802, "  nDPI support:                            yes\n", "", 1), "without nDPI"},
+	}
+	for _, c := range cases {
+		info, err := ParseSuricataBuildInfo([]byte(c.out))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := info.Check(); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%+v: got %v, want %q", info, err, c.want)
+		}
+	}
+
+	if _, err := ParseSuricataBuildInfo([]byte("suricata: unrecognized option\n")); err == nil {
+		t.Fatal("expected error without a version line")
+	}
+}
+
+func TestCheckNDPIPlugin(t *testing.T) {
+	dir := t.TempDir()
+	libDir := filepath.Join(dir, "lib")
+	if err := os.Mkdir(libDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(libDir, "libndpi.so.4"), "", 0o644)
+
+	other := elf.EM_AARCH64
+	if hostMachine() == other {
+		other = elf.EM_X86_64
+	}
+	register := []string{"SCPluginInit", PluginRegisterSymbol}
+
+	cases := []struct {
+		name   string
+		plugin pluginELF
+		raw    string      // written instead of an ELF when set
+		binArc elf.Machine // suricata binary architecture, if any
+		want   string      // error substring, "" for ok
+	}{
+		{name: "ok", plugin: pluginELF{symbols: register, needed: []string{"libndpi.so.4"}}},
+		{name: "not elf", raw: "fake", want: "not an ELF file"},
+		{name: "executable", plugin: pluginELF{typ: elf.ET_EXEC, symbols: register}, want: "not a shared object"},
+		{name: "arch vs host", plugin: pluginELF{machine: other, symbols: register}, want: "built for " + other.String()},
+		{name: "arch vs suricata", plugin: pluginELF{symbols: register}, binArc: other, want: "is " + other.String()},
+		{name: "no register", plugin: pluginELF{symbols: []string{"SCPluginInit"}}, want: "does not export SCPluginRegister"},
+		{name: "missing lib", plugin: pluginELF{symbols: register, needed: []string{"libndpi.so.4", "libnope.so.9"}}, want: "needs libnope.so.9"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			plugin := filepath.Join(dir, c.name+".so")
+			if c.raw != "" {
+				writeFile(t, plugin, c.raw, 0o644)
+			} else {
+				writePluginELF(t, plugin, c.plugin)
+			}
+			opts := PluginCheckOptions{Path: plugin, LibraryDirs: []string{libDir}}
+			if c.binArc != elf.EM_NONE {
+				opts.SuricataBinPath = filepath.Join(dir, c.name+"-suricata")
+				writePluginELF(t, opts.SuricataBinPath, pluginELF{typ: elf.ET_EXEC, machine: c.binArc})
+			}
+
+			err := CheckNDPIPlugin(opts)
+			if c.want == "" {
+				if err != nil {
+					t.Fatalf("unexpected: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), c.want) {
+				t.Fatalf("got %v, want %q", err, c.want)
+			}
+		})
+	}
+}
+
+func TestCheckSuricataCompat_UnsupportedSuricata_Error(t *testing.T) {
+	dir := t.TempDir()
+
+	ndpiSo := filepath.Join(dir, "ndpi.so")
+	writePluginELF(t, ndpiSo, pluginELF{symbols: []string{PluginRegisterSymbol}})
+
+	buildInfo := strings.Replace(buildInfo802, "8.0.2", "7.0.10", 1)
+	opts := SuricataCompatOptions{
+		PluginPath:      ndpiSo,
+		SuricataBinPath: "/usr/bin/suricata",
+		Runner: &mocks.ExecRunner{CombinedOutputFunc: func(_ context.Context, name string, args ...string) ([]byte, error) {
+			if name != "/usr/bin/suricata" || strings.Join(args, " ") != "--build-info" {
+				return nil, fmt.Errorf("unexpected %s %v", name, args)
+			}
+			return []byte(buildInfo), nil
+		}},
+	}
+	_, err := CheckSuricataCompat(context.Background(), opts)
+	if err == nil || !strings.Contains(err.Error(), "suricata 7.0.10 is not supported: the nDPI plugin needs 8.0.x") {
+		t.Fatalf("got %v", err)
+	}
+
+	buildInfo = buildInfo802
+	if info, err := CheckSuricataCompat(context.Background(), opts); err != nil || info.Version != "8.0.2" {
+		t.Fatalf("8.0.2: %+v %v", info, err)
+	}
+}
+
 func TestConnectSuricata_SocketNotFound_Error(t *testing.T) {
 	_, err := ConnectSuricata([]string{"/tmp/definitely-not-exists.sock"}, 10*time.Millisecond)
 	if err == nil {
@@ -648,3 +803,1992 @@ func TestValidateLocalResources_TemplateIsDir_Error(t *testing.T) {
 		t.Fatal("expected error")
 	}
 }
+
+func TestParseSuricataRuleErrors_PerSID(t *testing.T) {
+	out := `Notice: suricata: This is Suricata version 8.0.2 RELEASE running in SYSTEM mode
+Error: detect-parse: unknown rule keyword 'ndpi-protocl'. [SigParseOptions:detect-parse.c:1084]
+Error: detect: error parsing signature "alert tcp any any -> any any (msg:\"x\"; ndpi-protocl:HTTP; sid:3000001;)" from file /tmp/sb/rules/a.rules at line 3 [DetectLoadSigFile:detect-engine-loader.c:217]
+Error: detect: error parsing signature "alert tcp any any -> any any (msg:\"y\"; sid:3000002;" from file /tmp/sb/rules/b.rules at line 7 [DetectLoadSigFile:detect-engine-loader.c:217]`
+
+	origin := func(p string) string { return "/src/" + filepath.Base(p) }
+	errs := parseSuricataRuleErrors(out, origin)
+	if len(errs) != 2 {
+		t.Fatalf("want 2 errors, got %d: %+v", len(errs), errs)
+	}
+	if errs[0].SID != 3000001 || errs[0].File != "/src/a.rules" || errs[0].Line != 3 {
+		t.Fatalf("bad first error: %+v", errs[0])
+	}
+	if errs[0].Message != "unknown rule keyword 'ndpi-protocl'." {
+		t.Fatalf("bad first message: %q", errs[0].Message)
+	}
+	if errs[1].SID != 3000002 || errs[1].Message != "error parsing signature" {
+		t.Fatalf("bad second error: %+v", errs[1])
+	}
+}
+
+func setupRulesApply(t *testing.T, dir, suricataBody string) (ApplyConfigOptions, string) {
+	t.Helper()
+
+	tpl, cfg := setupTemplateAndConfig(t, dir)
+
+	local := filepath.Join(dir, "local")
+	deploy := filepath.Join(dir, "deploy")
+	for _, d := range []string{local, deploy} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(t, filepath.Join(local, "a.rules"), "alert tcp any any -> any any (msg:\"x\"; sid:3000001;)\n", 0o644)
+	writeFile(t, filepath.Join(deploy, "stale.rules"), "old\n", 0o644)
+
+	return ApplyConfigOptions{
+		TemplatePath:     tpl,
+		ConfigCandidates: []string{cfg},
+		SuricataSCPath:   writeExecutable(t, dir, "suricatasc", "#!/bin/sh\necho OK\nexit 0\n"),
+		SuricataBinPath:  writeExecutable(t, dir, "suricata", suricataBody),
+		ReloadCommand:    "reload-rules",
+		ReloadTimeout:    time.Second,
+		RulesLocalDir:    local,
+		RulesDeployDir:   deploy,
+	}, deploy
+}
+
+func TestRuleSandbox_GoesThroughFS(t *testing.T) {
+	written := map[string]string{}
+	var removed []string
+	fs := &mocks.FS{
+		ReadFileFunc: func(name string) ([]byte, error) {
+			if name == "/rules/local.rules" {
+				return []byte("alert ip any any -> any any (msg:\"x\"; sid:1;)\n"), nil
+			}
+			return nil, os.ErrNotExist
+		},
+		MkdirTempFunc: func(dir, pattern string) (string, error) { return "/sandbox", nil },
+		WriteFileFunc: func(name string, data []byte, _ os.FileMode) error {
+			written[name] = string(data)
+			return nil
+		},
+		RemoveAllFunc: func(path string) error {
+			removed = append(removed, path)
+			return nil
+		},
+	}
+
+	sb, err := newRuleSandbox(ruleSandboxOptions{RuleFiles: []string{"/rules/local.rules"}, FS: fs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(written["/sandbox/rules/local.rules"], "sid:1;") ||
+		!strings.Contains(written["/sandbox/suricata.yaml"], "default-rule-path: /sandbox/rules") {
+		t.Fatalf("sandbox not written through the FS: %v", written)
+	}
+	if sb.originOf("/sandbox/rules/local.rules") != "/rules/local.rules" {
+		t.Fatal("origin not kept")
+	}
+	_ = sb.Close()
+	if len(removed) != 1 || removed[0] != "/sandbox" {
+		t.Fatalf("removed: %v", removed)
+	}
+
+	if _, err := newRuleSandbox(ruleSandboxOptions{RuleFiles: []string{"/rules/missing.rules"}, FS: fs}); err == nil {
+		t.Fatal("expected an error for an unreadable rule file")
+	}
+	if len(removed) != 2 {
+		t.Fatal("a failed sandbox must be cleaned up")
+	}
+}
+
+func TestApplyConfig_RulesRejected_DeployDirUntouched(t *testing.T) {
+	dir := t.TempDir()
+	opts, deploy := setupRulesApply(t, dir, `#!/bin/sh
+echo 'Error: detect-parse: invalid sid. [SigParse:detect-parse.c:1]'
+echo 'Error: detect: error parsing signature "alert tcp any any -> any any (msg:\"x\"; sid:3000001;)" from file /tmp/x/rules/a.rules at line 1 [DetectLoadSigFile:detect-engine-loader.c:217]'
+exit 1
+`)
+
+	rep, err := ApplyConfig(opts)
+	var rejected *RulesRejectedError
+	if !errors.As(err, &rejected) {
+		t.Fatalf("want RulesRejectedError, got %v", err)
+	}
+	if rep.RulesValidation == nil || len(rep.RulesValidation.Errors) != 1 || rep.RulesValidation.Errors[0].SID != 3000001 {
+		t.Fatalf("bad validation report: %+v", rep.RulesValidation)
+	}
+	if rep.RulesDeploy != nil || rep.ReloadStatus != "" {
+		t.Fatalf("nothing should be deployed or reloaded: %+v", rep)
+	}
+	if _, err := os.Stat(filepath.Join(deploy, "a.rules")); !os.IsNotExist(err) {
+		t.Fatalf("a.rules must not be deployed, stat err=%v", err)
+	}
+	if _, err := os.Stat(filepath.Join(deploy, "stale.rules")); err != nil {
+		t.Fatalf("stale.rules must be left untouched: %v", err)
+	}
+}
+
+func TestApplyConfig_RulesValid_DeployedAndReloaded(t *testing.T) {
+	dir := t.TempDir()
+	opts, deploy := setupRulesApply(t, dir, "#!/bin/sh\n[ \"$1\" = \"-T\" ] || exit 2\nexit 0\n")
+
+	rep, err := ApplyConfig(opts)
+	if err != nil {
+		t.Fatalf("unexpected: %v", err)
+	}
+	if rep.RulesValidation == nil || !rep.RulesValidation.Valid {
+		t.Fatalf("want valid rule set, got %+v", rep.RulesValidation)
+	}
+	if rep.RulesDeploy == nil || len(rep.RulesDeploy.Written) != 1 || len(rep.RulesDeploy.Removed) != 1 {
+		t.Fatalf("bad deploy report: %+v", rep.RulesDeploy)
+	}
+	if _, err := os.Stat(filepath.Join(deploy, "a.rules")); err != nil {
+		t.Fatalf("a.rules not deployed: %v", err)
+	}
+	if rep.ReloadStatus != ReloadOK {
+		t.Fatalf("want ReloadOK, got %s", rep.ReloadStatus)
+	}
+}
+
+func TestRollbackRules_RestoresPreviousDeploy(t *testing.T) {
+	dir := t.TempDir()
+	opts, deploy := setupRulesApply(t, dir, "#!/bin/sh\n[ \"$1\" = \"-T\" ] || exit 2\nexit 0\n")
+	opts.RulesRollbackDir = filepath.Join(dir, "state", "rules-previous")
+
+	if _, err := RollbackRules(context.Background(), opts); !errors.Is(err, ErrNoRollback) {
+		t.Fatalf("want ErrNoRollback before any deploy, got %v", err)
+	}
+
+	if _, err := ApplyConfig(opts); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if _, err := os.Stat(opts.RulesRollbackDir + ".new"); !os.IsNotExist(err) {
+		t.Fatalf("snapshot staging dir left behind: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(opts.RulesRollbackDir, "stale.rules")); err != nil || string(data) != "old\n" {
+		t.Fatalf("previous rules not kept: %q %v", data, err)
+	}
+
+	// an apply that changes nothing keeps the older rollback target
+	if _, err := ApplyConfig(opts); err != nil {
+		t.Fatalf("second apply: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(opts.RulesRollbackDir, "stale.rules")); err != nil {
+		t.Fatalf("unchanged deploy replaced the rollback target: %v", err)
+	}
+
+	rep, err := RollbackRules(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("rollback: %v", err)
+	}
+	if rep.ReloadStatus != ReloadOK {
+		t.Fatalf("want ReloadOK, got %s", rep.ReloadStatus)
+	}
+	if data, err := os.ReadFile(filepath.Join(deploy, "stale.rules")); err != nil || string(data) != "old\n" {
+		t.Fatalf("stale.rules not restored: %q %v", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(deploy, "a.rules")); !os.IsNotExist(err) {
+		t.Fatalf("a.rules must be gone after rollback: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(opts.RulesRollbackDir, "a.rules")); err != nil {
+		t.Fatalf("rolled-back rules must become the next rollback target: %v", err)
+	}
+}
+
+func TestRunPcapTests_ExpectedAndForbiddenSIDs(t *testing.T) {
+	dir := t.TempDir()
+
+	rulesDir := filepath.Join(dir, "rules")
+	testsDir := filepath.Join(dir, "pcap")
+	for _, d := range []string{rulesDir, testsDir} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(t, filepath.Join(rulesDir, "a.rules"), "alert tcp any any -> any any (msg:\"x\"; sid:1;)\n", 0o644)
+
+	writeFile(t, filepath.Join(testsDir, "http.pcap"), "pcap", 0o644)
+	writeFile(t, filepath.Join(testsDir, "http.yaml"), "expected_sids: [1]\nforbidden_sids: [3]\n", 0o644)
+	writeFile(t, filepath.Join(testsDir, "dns.pcap"), "pcap", 0o644)
+	writeFile(t, filepath.Join(testsDir, "dns.yaml"), "expected_sids: [2]\nforbidden_sids: [1]\n", 0o644)
+	writeFile(t, filepath.Join(testsDir, "noexp.pcap"), "pcap", 0o644)
+
+	// fake suricata: every pcap alerts on sid 1
+	suricata := writeExecutable(t, dir, "suricata", `#!/bin/sh
+while [ $# -gt 0 ]; do
+  if [ "$1" = "-l" ]; then LOGDIR="$2"; fi
+  shift
+done
+echo '{"event_type":"flow"}' > "$LOGDIR/eve.json"
+echo '{"event_type":"alert","alert":{"signature_id":1}}' >> "$LOGDIR/eve.json"
+`)
+
+	rep, err := RunPcapTests(context.Background(), PcapTestOptions{
+		SuricataBinPath: suricata,
+		RulesDir:        rulesDir,
+		TestsDir:        testsDir,
+		Timeout:         5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("unexpected: %v", err)
+	}
+	if rep.Total != 3 || rep.Passed != 1 || rep.Failed != 1 || rep.Skipped != 1 {
+		t.Fatalf("bad totals: %+v", rep)
+	}
+
+	var dns PcapCaseResult
+	for _, c := range rep.Cases {
+		if c.Name == "dns" {
+			dns = c
+		}
+	}
+	if len(dns.MissingSIDs) != 1 || dns.MissingSIDs[0] != 2 || len(dns.ForbiddenHit) != 1 || dns.ForbiddenHit[0] != 1 {
+		t.Fatalf("bad dns case: %+v", dns)
+	}
+
+	var buf strings.Builder
+	if err := WriteJUnitReport(&buf, rep); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, `tests="3" failures="1" skipped="1"`) || !strings.Contains(out, "forbidden sids alerted: 1") {
+		t.Fatalf("bad junit report:\n%s", out)
+	}
+}
+
+func TestBuildCoverageMatrix_Statuses(t *testing.T) {
+	var ruleList []*rules.Rule
+	for _, text := range []string{
+		`alert tcp any any -> any any (msg:"http"; ndpi-protocol:HTTP; sid:1;)`,
+		`alert tcp any any -> any any (msg:"dns"; ndpi-protocol:DNS; sid:2;)`,
+		`alert tcp any any -> any any (msg:"weak"; ndpi-risk:NDPI_TLS_WEAK_CIPHER; sid:3;)`,
+		`alert tcp any any -> any any (msg:"none"; ndpi-protocol:NotARealProto; sid:4;)`,
+	} {
+		r, err := rules.Parse(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ruleList = append(ruleList, r)
+	}
+
+	fixtures := map[string]*PcapExpectations{
+		"http": {ExpectedSIDs: []uint64{1}},
+		"dns":  {ExpectedSIDs: []uint64{2}},
+		"tls":  {ExpectedSIDs: []uint64{3}},
+	}
+	last := &PcapTestReport{
+		FinishedAt: "2026-01-01T00:00:00Z",
+		Cases: []PcapCaseResult{
+			{Name: "http", Passed: true, AlertedSIDs: []uint64{1}},
+			{Name: "dns", Passed: false},
+		},
+	}
+
+	m := BuildCoverageMatrix(ruleList, fixtures, last)
+
+	want := map[uint64]CoverageStatus{1: CoveragePassed, 2: CoverageFailed, 3: CoverageNotRun, 4: CoverageUncovered}
+	for _, rc := range m.Rules {
+		if rc.Status != want[rc.SID] {
+			t.Fatalf("sid %d: want %s, got %s", rc.SID, want[rc.SID], rc.Status)
+		}
+	}
+	if m.Summary.Rules != 4 || m.Summary.RulesExercised != 3 || m.Summary.RulesPassed != 1 || m.Summary.RulesFailed != 1 {
+		t.Fatalf("bad summary: %+v", m.Summary)
+	}
+
+	var unknown *CatalogCoverage
+	for i := range m.Catalog {
+		if m.Catalog[i].Name == "NotARealProto" {
+			unknown = &m.Catalog[i]
+		}
+	}
+	if unknown == nil || unknown.InCatalog || len(unknown.SIDs) != 1 {
+		t.Fatalf("rule-only protocol must be listed outside the catalog: %+v", unknown)
+	}
+
+	var buf strings.Builder
+	if err := m.WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.HasPrefix(out, "kind,key,msg,ndpi_protocols,ndpi_risks,sids,fixtures,exercised,status\n") ||
+		!strings.Contains(out, "rule,1,http,HTTP,,1,http,true,passed\n") {
+		t.Fatalf("bad csv:\n%s", out)
+	}
+}
+
+func TestApplyRuleBundle_VerifiedDeployed_TamperedRejected(t *testing.T) {
+	dir := t.TempDir()
+	opts, deploy := setupRulesApply(t, dir, "#!/bin/sh\nexit 0\n")
+
+	pub, priv, err := GenerateBundleKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ParseBundlePrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.BundlePublicKeys = []string{pub}
+
+	ruleFiles, err := ListRuleFiles(opts.RulesLocalDir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	m, err := BuildRuleBundle(&buf, ruleFiles, "1.0.0", key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.RuleCount != 1 || len(m.Files) != 1 {
+		t.Fatalf("bad manifest: %+v", m)
+	}
+
+	// signed by an unknown key
+	otherPub, _, _ := GenerateBundleKey()
+	bad := opts
+	bad.BundlePublicKeys = []string{otherPub}
+	var rejected *BundleRejectedError
+	if _, err := ApplyRuleBundle(context.Background(), bad, buf.Bytes()); !errors.As(err, &rejected) {
+		t.Fatalf("want BundleRejectedError for untrusted key, got %v", err)
+	}
+
+	// content no longer matches the manifest
+	writeFile(t, filepath.Join(opts.RulesLocalDir, "a.rules"), "alert tcp any any -> any any (msg:\"y\"; sid:3000001;)\n", 0o644)
+	var tampered bytes.Buffer
+	if _, err := BuildRuleBundle(&tampered, ruleFiles, "1.0.0", key, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenRuleBundle(swapBundleManifest(t, tampered.Bytes(), buf.Bytes()), []ed25519.PublicKey{key.Public().(ed25519.PublicKey)}); !errors.As(err, &rejected) || !strings.Contains(rejected.Reason, "sha256 mismatch") {
+		t.Fatalf("want sha256 mismatch, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(deploy, "a.rules")); !os.IsNotExist(err) {
+		t.Fatalf("rejected bundles must not deploy, stat err=%v", err)
+	}
+
+	opts.RulesLocalDir = filepath.Join(dir, "does-not-matter")
+	rep, err := ApplyRuleBundle(context.Background(), opts, buf.Bytes())
+	if err != nil {
+		t.Fatalf("unexpected: %v", err)
+	}
+	if rep.Bundle == nil || rep.Bundle.Manifest.Version != "1.0.0" || rep.Bundle.KeyID != BundleKeyID(key.Public().(ed25519.PublicKey)) {
+		t.Fatalf("bad bundle report: %+v", rep.Bundle)
+	}
+	got, err := os.ReadFile(filepath.Join(deploy, "a.rules"))
+	if err != nil || !strings.Contains(string(got), `msg:"x"`) {
+		t.Fatalf("bundle content not deployed: %q err=%v", got, err)
+	}
+	if _, err := os.Stat(filepath.Join(deploy, "bundle.json")); err != nil {
+		t.Fatalf("bundle provenance not recorded: %v", err)
+	}
+}
+
+func TestApplyRuleBundle_UnpacksThroughFS(t *testing.T) {
+	written := map[string]string{}
+	var removed []string
+	fs := &mocks.FS{
+		ReadFileFunc: func(name string) ([]byte, error) {
+			if name == "/rules/a.rules" {
+				return []byte("alert ip any any -> any any (msg:\"x\"; sid:1;)\n"), nil
+			}
+			return nil, os.ErrNotExist
+		},
+		MkdirTempFunc: func(dir, pattern string) (string, error) { return "/bundle", nil },
+		WriteFileFunc: func(name string, data []byte, _ os.FileMode) error {
+			written[name] = string(data)
+			return nil
+		},
+		RemoveAllFunc: func(path string) error {
+			removed = append(removed, path)
+			return nil
+		},
+	}
+
+	pub, priv, err := GenerateBundleKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ParseBundlePrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := BuildRuleBundle(&buf, []string{"/rules/a.rules"}, "1.0.0", key, fs); err != nil {
+		t.Fatal(err)
+	}
+
+	// the apply itself fails on the missing template; only the unpacking matters
+	_, _ = ApplyRuleBundle(context.Background(), ApplyConfigOptions{
+		TemplatePath:     "/missing/suricata.yaml.tpl",
+		RulesDeployDir:   "/deploy",
+		BundlePublicKeys: []string{pub},
+		FS:               fs,
+	}, buf.Bytes())
+	if !strings.Contains(written["/bundle/a.rules"], "sid:1;") {
+		t.Fatalf("bundle not unpacked through the FS: %v", written)
+	}
+	if len(removed) == 0 || removed[len(removed)-1] != "/bundle" {
+		t.Fatalf("removed: %v", removed)
+	}
+}
+
+// swapBundleManifest returns the rule files of body with the signed manifest of signed.
+func swapBundleManifest(t *testing.T, body, signed []byte) []byte {
+	t.Helper()
+
+	entries := func(b []byte) map[string][]byte {
+		gz, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := make(map[string][]byte)
+		tr := tar.NewReader(gz)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				return out
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, _ := io.ReadAll(tr)
+			out[hdr.Name] = data
+		}
+	}
+	a, s := entries(body), entries(signed)
+	a["manifest.json"] = s["manifest.json"]
+	a["manifest.json.sig"] = s["manifest.json.sig"]
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, data := range a {
+		_ = tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(data))})
+		_, _ = tw.Write(data)
+	}
+	_ = tw.Close()
+	_ = gz.Close()
+	return buf.Bytes()
+}
+
+func TestApplyConfig_RuleOverridesTransformDeployedRules(t *testing.T) {
+	dir := t.TempDir()
+	opts, deploy := setupRulesApply(t, dir, "#!/bin/sh\nexit 0\n")
+
+	writeFile(t, filepath.Join(opts.RulesLocalDir, "a.rules"), `alert tcp any any -> any any (msg:"noisy"; sid:3000001;)
+alert tcp any any -> any any ( \
+    msg:"keep"; \
+# tuned for the lab network
+    sid:3000002; \
+)
+# alert tcp any any -> any any (msg:"off"; sid:3000003;)
+`, 0o644)
+
+	opts.RuleOverrides = []RuleOverride{{SID: 3000002, Action: "drop", Source: "config"}}
+	opts.RuleOverridesStatePath = filepath.Join(dir, "overrides.json")
+	if _, err := SetRuleOverride(opts.RuleOverridesStatePath, 3000001, OverrideDisabled, "", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SetRuleOverride(opts.RuleOverridesStatePath, 3000003, OverrideEnabled, "", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SetRuleOverride(opts.RuleOverridesStatePath, 9, OverrideDisabled, "", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	rep, err := ApplyConfig(opts)
+	if err != nil {
+		t.Fatalf("unexpected: %v", err)
+	}
+	if rep.RuleOverrides == nil || len(rep.RuleOverrides.Applied) != 3 || len(rep.RuleOverrides.Unmatched) != 1 {
+		t.Fatalf("bad overrides report: %+v", rep.RuleOverrides)
+	}
+
+	got, err := os.ReadFile(filepath.Join(deploy, "a.rules"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `# alert tcp any any -> any any (msg:"noisy"; sid:3000001; rev:1;)
+# tuned for the lab network
+drop tcp any any -> any any (msg:"keep"; sid:3000002; rev:1;)
+alert tcp any any -> any any (msg:"off"; sid:3000003; rev:1;)
+`
+	if string(got) != want {
+		t.Fatalf("bad deployed rules:\n%s\nwant:\n%s", got, want)
+	}
+
+	local, _ := os.ReadFile(filepath.Join(opts.RulesLocalDir, "a.rules"))
+	if !strings.HasPrefix(string(local), `alert tcp any any -> any any (msg:"noisy"`) {
+		t.Fatalf("local rule file must not be modified:\n%s", local)
+	}
+}
+
+func TestRulesDiff_ApplyReportAndAPI(t *testing.T) {
+	dir := t.TempDir()
+	opts, deploy := setupRulesApply(t, dir, "#!/bin/sh\nexit 0\n")
+
+	writeFile(t, filepath.Join(deploy, "a.rules"), `alert tcp any any -> any any (msg:"x"; sid:3000001; rev:1;)
+alert tcp any any -> any any (msg:"old"; sid:3000009; rev:1;)
+`, 0o644)
+	writeFile(t, filepath.Join(opts.RulesLocalDir, "a.rules"), `drop tcp any any -> any any (sid:3000001; msg:"x";)
+alert tcp any any -> any any (msg:"new"; sid:3000002;)
+`, 0o644)
+
+	r := NewRunner("", nil, nil)
+	r.opts.Apply = opts
+	mux := http.NewServeMux()
+	r.cfg = openAPIConfig()
+	r.registerRoutes(mux)
+	getDiff := func() RulesDiff {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/rules/diff", nil))
+		var out RulesDiff
+		if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &out) != nil {
+			t.Fatalf("GET /rules/diff: %d %s", rec.Code, rec.Body.String())
+		}
+		return out
+	}
+
+	before := getDiff()
+	if len(before.Added) != 1 || before.Added[0].SID != 3000002 || len(before.Removed) != 1 || before.Removed[0].SID != 3000009 {
+		t.Fatalf("bad diff: %+v", before)
+	}
+	if len(before.Modified) != 1 || len(before.Modified[0].Changes) != 1 || before.Modified[0].Changes[0].Field != "action" {
+		t.Fatalf("bad modified: %+v", before.Modified)
+	}
+	if before.Added[0].File != filepath.Join(opts.RulesLocalDir, "a.rules") {
+		t.Fatalf("diff must point at the local file, got %s", before.Added[0].File)
+	}
+
+	rep, err := ApplyConfig(opts)
+	if err != nil {
+		t.Fatalf("unexpected: %v", err)
+	}
+	if rep.RulesDiff == nil || len(rep.RulesDiff.Modified) != 1 || len(rep.RulesDiff.Added) != 1 || len(rep.RulesDiff.Removed) != 1 {
+		t.Fatalf("apply report must carry the diff: %+v", rep.RulesDiff)
+	}
+
+	if after := getDiff(); !after.Empty() || after.Unchanged != 2 {
+		t.Fatalf("diff after apply must be empty: %+v", after)
+	}
+}
+
+func TestPatchSuricataRuleFiles(t *testing.T) {
+	current := `default-rule-path: /var/lib/suricata/rules
+rule-files:
+  - suricata.rules
+  - ndpi/*.rules
+  - /var/lib/suricata/rules/ndpi/gone.rules
+
+classification-file: /etc/suricata/classification.config
+`
+	got, changed, err := PatchSuricataRuleFiles([]byte(current), "/var/lib/suricata/rules/ndpi/", []string{"/x/b.rules", "/x/a.rules"})
+	if err != nil || !changed {
+		t.Fatalf("changed=%v err=%v", changed, err)
+	}
+	want := `default-rule-path: /var/lib/suricata/rules
+rule-files:
+  - suricata.rules
+  - /var/lib/suricata/rules/ndpi/b.rules
+  - /var/lib/suricata/rules/ndpi/a.rules
+
+classification-file: /etc/suricata/classification.config
+`
+	if string(got) != want {
+		t.Fatalf("bad patch:\n%s\nwant:\n%s", got, want)
+	}
+	if again, changed, err := PatchSuricataRuleFiles(got, "/var/lib/suricata/rules/ndpi", []string{"b.rules", "a.rules"}); err != nil || changed || string(again) != want {
+		t.Fatalf("patch must be idempotent: changed=%v err=%v\n%s", changed, err, again)
+	}
+
+	added, changed, err := PatchSuricataRuleFiles([]byte("plugins:\n  - ndpi.so\n"), "/r", []string{"a.rules"})
+	if err != nil || !changed || string(added) != "plugins:\n  - ndpi.so\n\nrule-files:\n  - /r/a.rules\n" {
+		t.Fatalf("missing block must be added: %v %q", err, added)
+	}
+
+	if _, _, err := PatchSuricataRuleFiles([]byte("rule-files: [a.rules]\n"), "/r", nil); err == nil {
+		t.Fatalf("flow style must be rejected")
+	}
+}
+
+func TestReconcileConfig_RuleFilesFromDeployDir(t *testing.T) {
+	dir := t.TempDir()
+	validated := filepath.Join(dir, "validated.yaml")
+	opts, deploy := setupRulesApply(t, dir, "#!/bin/sh\ncp \"$3\" "+validated+"\nexit 0\n")
+	var restarted []string
+	opts.Systemd = &mocks.SystemdManager{RestartFunc: func(_ context.Context, unit string, _ time.Duration) error {
+		restarted = append(restarted, unit)
+		return nil
+	}}
+	if err := os.Remove(filepath.Join(deploy, "stale.rules")); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(deploy, "a.rules"), "", 0o644)
+	writeFile(t, filepath.Join(deploy, "b.rules"), "", 0o644)
+
+	rep, err := ReconcileConfig(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("unexpected: %v", err)
+	}
+	if !rep.RuleFilesChanged || !rep.Validated || !rep.Applied || len(rep.RuleFiles) != 2 {
+		t.Fatalf("bad report: %+v", rep)
+	}
+	if !rep.RestartPerformed || len(restarted) != 1 || restarted[0] != "suricata" {
+		t.Fatalf("restart must go through the systemd manager: %v %+v", restarted, rep)
+	}
+
+	cfg, _ := os.ReadFile(opts.ConfigCandidates[0])
+	checked, _ := os.ReadFile(validated)
+	if string(cfg) != string(checked) {
+		t.Fatalf("applied config must be the one validated with -T")
+	}
+	for _, f := range []string{"a.rules", "b.rules"} {
+		if !strings.Contains(string(cfg), "  - "+filepath.Join(deploy, f)+"\n") {
+			t.Fatalf("rule-files must list %s:\n%s", f, cfg)
+		}
+	}
+
+	rep, err = ReconcileConfig(context.Background(), opts)
+	if err != nil || rep.WouldChange || rep.RuleFilesChanged {
+		t.Fatalf("second reconcile must be a no-op: %+v %v", rep, err)
+	}
+}
+
+func fakeRulesetSuricatasc(t *testing.T, dir, reloadDelay string) string {
+	t.Helper()
+	state := filepath.Join(dir, "reloaded")
+	return writeExecutable(t, dir, "suricatasc", `#!/bin/sh
+case "$2" in
+ruleset-reload-nonblocking)
+  (sleep `+reloadDelay+`; touch `+state+`) >/dev/null 2>&1 &
+  echo '{"message": "done", "return": "OK"}' ;;
+ruleset-reload-time)
+  if [ -f `+state+` ]; then t=2026-10-19T10:00:01; else t=2026-10-19T10:00:00; fi
+  echo '{"message": [{"id": 0, "last_reload": "'$t'"}], "return": "OK"}' ;;
+ruleset-stats)
+  echo '{"message": [{"id": 0, "last_reload": "2026-10-19T10:00:01", "rules_loaded": 42, "rules_failed": 1, "rules_skipped": 0}], "return": "OK"}' ;;
+*)
+  echo '{"message": "unknown command", "return": "NOK"}'; exit 1 ;;
+esac
+`)
+}
+
+func TestApplyConfig_NonblockingReloadWaitsForNewRuleset(t *testing.T) {
+	dir := t.TempDir()
+	rep, err := ApplyConfig(ApplyConfigOptions{
+		SuricataSCPath:     fakeRulesetSuricatasc(t, dir, "0.1"),
+		ReloadCommand:      NonblockingReloadCommand,
+		ReloadTimeout:      5 * time.Second,
+		ReloadPollInterval: 20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("unexpected: %v", err)
+	}
+	if rep.ReloadStatus != ReloadOK || rep.Reload == nil {
+		t.Fatalf("bad report: %+v", rep)
+	}
+	if rep.Reload.RulesLoaded != 42 || rep.Reload.RulesFailed != 1 || rep.Reload.LastReload != "2026-10-19T10:00:01" || rep.Reload.Duration == "" {
+		t.Fatalf("bad reload: %+v", rep.Reload)
+	}
+
+	rep, err = ApplyConfig(ApplyConfigOptions{
+		SuricataSCPath:     fakeRulesetSuricatasc(t, t.TempDir(), "5"),
+		ReloadCommand:      NonblockingReloadCommand,
+		ReloadTimeout:      200 * time.Millisecond,
+		ReloadPollInterval: 20 * time.Millisecond,
+	})
+	if err != nil || rep.ReloadStatus != ReloadTimeout {
+		t.Fatalf("want reload timeout, got %v %+v", err, rep)
+	}
+
+	rep, err = ApplyConfig(ApplyConfigOptions{
+		SuricataSCPath:     filepath.Join(dir, "no-suricatasc"),
+		ReloadCommand:      NonblockingReloadCommand,
+		ReloadTimeout:      200 * time.Millisecond,
+		ReloadPollInterval: 20 * time.Millisecond,
+	})
+	if !errors.Is(err, ErrReloadFailed) || rep.ReloadStatus != ReloadFailed {
+		t.Fatalf("want RELOAD_FAILED, got %v %+v", err, rep)
+	}
+	if ae := apierror.From(err); ae.Status != http.StatusBadGateway || ae.Message != "suricata rule reload failed" {
+		t.Fatalf("bad api error: %+v", ae)
+	}
+}
+
+func TestJobQueue_SerialAndCancel(t *testing.T) {
+	q := NewJobQueue(10)
+	defer q.Close()
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	first, err := q.Submit("first", func(ctx context.Context) (any, error) {
+		jobStep(ctx, "waiting")
+		close(started)
+		select {
+		case <-release:
+			return "done", nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-started
+
+	ran := false
+	second, _ := q.Submit("second", func(ctx context.Context) (any, error) {
+		ran = true
+		return nil, nil
+	})
+	third, _ := q.Submit("third", func(ctx context.Context) (any, error) {
+		return 42, nil
+	})
+
+	if j, _ := q.Get(second.ID); j.Status != JobQueued {
+		t.Fatalf("second job must wait for the first, got %s", j.Status)
+	}
+	if j, err := q.Cancel(second.ID); err != nil || j.Status != JobCanceled {
+		t.Fatalf("cancel queued: %v %+v", err, j)
+	}
+	close(release)
+
+	fourth, err := q.Submit("fourth", func(ctx context.Context) (any, error) { return "ok", nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j := waitJobDone(t, q, fourth.ID); j.Status != JobSucceeded || j.Result != "ok" {
+		t.Fatalf("bad fourth job: %+v", j)
+	}
+	if ran {
+		t.Fatalf("canceled job must not run")
+	}
+	if j, _ := q.Get(first.ID); j.Status != JobSucceeded || j.Result != "done" || len(j.Steps) != 1 || j.Steps[0].Message != "waiting" {
+		t.Fatalf("bad first job: %+v", j)
+	}
+	if j, _ := q.Get(third.ID); j.Status != JobSucceeded || j.Result != 42 {
+		t.Fatalf("bad third job: %+v", j)
+	}
+	if _, err := q.Cancel(first.ID); err == nil {
+		t.Fatalf("finished job must not be cancelable")
+	}
+
+	blocked, _ := q.Submit("blocked", func(ctx context.Context) (any, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	time.Sleep(20 * time.Millisecond)
+	if _, err := q.Cancel(blocked.ID); err != nil {
+		t.Fatal(err)
+	}
+	after, err := q.Submit("after", func(ctx context.Context) (any, error) { return nil, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitJobDone(t, q, after.ID)
+	if j, _ := q.Get(blocked.ID); j.Status != JobCanceled {
+		t.Fatalf("running job must end canceled, got %s", j.Status)
+	}
+	if jobs := q.List(); len(jobs) != 6 || jobs[0].Kind != "after" {
+		t.Fatalf("bad listing: %d jobs", len(jobs))
+	}
+}
+
+func TestJobQueue_FailedJobHidesCause(t *testing.T) {
+	q := NewJobQueue(10)
+	defer q.Close()
+
+	cases := []struct {
+		err                error
+		wantCode, wantText string
+	}{
+		{fmt.Errorf("patch /etc/suricata/suricata.yaml: %w", errors.New("permission denied")), "INTERNAL", "internal error"},
+		{ErrRestartFailed.Wrap(errors.New("exit status 1: Job for suricata.service failed")), "RESTART_FAILED", "suricata restart failed"},
+		{fmt.Errorf("load /var/lib/x: %w", &RuleNotFoundError{SID: 7}), "RULE_NOT_FOUND", "rule not found in local rules"},
+	}
+	for _, c := range cases {
+		job, err := q.Submit("failing", func(ctx context.Context) (any, error) { return nil, c.err })
+		if err != nil {
+			t.Fatal(err)
+		}
+		j := waitJobDone(t, q, job.ID)
+		if j.Status != JobFailed || j.Code != c.wantCode || j.Error != c.wantText {
+			t.Errorf("%v: got %s %q %q", c.err, j.Status, j.Code, j.Error)
+		}
+	}
+}
+
+func TestJobQueue_BetweenWaitsForRunningJob(t *testing.T) {
+	q := NewJobQueue(10)
+	defer q.Close()
+
+	started, release := make(chan struct{}), make(chan struct{})
+	job, err := q.Submit("apply", func(ctx context.Context) (any, error) {
+		close(started)
+		<-release
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := q.Between(ctx, func(ctx context.Context) (any, error) { return "read", nil }); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Between ran while a job was running: %v", err)
+	}
+
+	close(release)
+	waitJobDone(t, q, job.ID)
+	got, err := q.Between(context.Background(), func(ctx context.Context) (any, error) { return "read", nil })
+	if err != nil || got != "read" {
+		t.Fatalf("Between after the job: %v %v", got, err)
+	}
+	if n := len(q.List()); n != 1 {
+		t.Fatalf("Between must not add jobs, got %d", n)
+	}
+}
+
+// waitJobDone polls the queue until the job has finished.
+func waitJobDone(t *testing.T, q *JobQueue, id string) Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		j, err := q.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if j.finished() {
+			return j
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s did not finish: %+v", id, j)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestJobsAPI_ReconcileRunsAsJob(t *testing.T) {
+	dir := t.TempDir()
+	opts, _ := setupRulesApply(t, dir, "#!/bin/sh\nexit 0\n")
+	opts.Systemd = &mocks.SystemdManager{}
+
+	r := NewRunner("", nil, nil)
+	defer r.jobs.Close()
+	r.opts.Apply = opts
+	mux := http.NewServeMux()
+	r.cfg = openAPIConfig()
+	r.registerRoutes(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/plan", nil))
+	var job Job
+	if rec.Code != http.StatusAccepted || json.Unmarshal(rec.Body.Bytes(), &job) != nil || job.ID == "" {
+		t.Fatalf("POST /plan: %d %s", rec.Code, rec.Body.String())
+	}
+	if loc := rec.Header().Get("Location"); loc != "/jobs/"+job.ID {
+		t.Fatalf("bad Location %q", loc)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for job.Status != JobSucceeded {
+		if job.Status == JobFailed || time.Now().After(deadline) {
+			t.Fatalf("job did not succeed: %+v", job)
+		}
+		time.Sleep(10 * time.Millisecond)
+		rec = httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/jobs/"+job.ID, nil))
+		job = Job{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(job.Steps) < 2 || job.Result.(map[string]any)["restart_performed"] != true {
+		t.Fatalf("bad job: %+v", job)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/jobs", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), job.ID) {
+		t.Fatalf("GET /jobs: %d %s", rec.Code, rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/jobs/"+job.ID, nil))
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("DELETE finished job: want 409, got %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/jobs/nope", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown job: want 404, got %d", rec.Code)
+	}
+}
+
+func TestEventBus_RingReplayAndLive(t *testing.T) {
+	b := NewEventBus(3)
+	for i := 0; i < 5; i++ {
+		b.Publish(EventJob, i)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	replay, live := b.Subscribe(ctx, 0)
+	if len(replay) != 3 || replay[0].ID != 3 || replay[2].ID != 5 {
+		t.Fatalf("ring must keep the last 3 events: %+v", replay)
+	}
+	if again, _ := b.Subscribe(ctx, 4); len(again) != 1 || again[0].ID != 5 {
+		t.Fatalf("replay after Last-Event-ID 4: %+v", again)
+	}
+
+	b.Publish(EventDrift, DriftEvent{Drift: true})
+	if ev := <-live; ev.ID != 6 || ev.Type != EventDrift {
+		t.Fatalf("bad live event: %+v", ev)
+	}
+	cancel()
+	if _, ok := <-live; ok {
+		t.Fatalf("live channel must close with the subscriber context")
+	}
+}
+
+func TestCheckState_WaitsForRunningJob(t *testing.T) {
+	dir := t.TempDir()
+	opts, _ := setupRulesApply(t, dir, "#!/bin/sh\nexit 0\n")
+	opts.SocketCandidates = []string{filepath.Join(dir, "missing.sock")}
+
+	r := NewRunner("", nil, nil)
+	defer r.jobs.Close()
+	r.opts.Apply = opts
+
+	started, release := make(chan struct{}), make(chan struct{})
+	job, err := r.jobs.Submit("apply", func(ctx context.Context) (any, error) {
+		close(started)
+		<-release
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-started
+
+	m := &stateMonitor{dialer: netutil.DefaultDialer{}}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	r.checkState(ctx, m)
+	if m.drift != nil {
+		t.Fatalf("drift checked while a job was running")
+	}
+
+	close(release)
+	waitJobDone(t, r.jobs, job.ID)
+	r.checkState(context.Background(), m)
+	if m.drift == nil || !*m.drift {
+		t.Fatalf("drift not checked after the job")
+	}
+}
+
+func TestEventsAPI_DriftAndJobEvents(t *testing.T) {
+	dir := t.TempDir()
+	opts, _ := setupRulesApply(t, dir, "#!/bin/sh\nexit 0\n")
+	opts.SocketCandidates = []string{filepath.Join(dir, "missing.sock")}
+
+	r := NewRunner("", nil, nil)
+	defer r.jobs.Close()
+	r.opts.Apply = opts
+	mux := http.NewServeMux()
+	r.cfg = openAPIConfig()
+	r.registerRoutes(mux)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	r.checkState(context.Background(), &stateMonitor{dialer: netutil.DefaultDialer{}})
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/events", nil)
+	req.Header.Set("Last-Event-ID", "1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("bad content type %q", ct)
+	}
+
+	noop, err := r.jobs.Submit("noop", func(ctx context.Context) (any, error) {
+		jobStep(ctx, "working")
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitJobDone(t, r.jobs, noop.ID)
+
+	type sse struct {
+		id, typ string
+		data    map[string]any
+	}
+	var got []sse
+	sc := bufio.NewScanner(resp.Body)
+	cur := sse{}
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case strings.HasPrefix(line, "id: "):
+			cur.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			cur.typ = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			var ev map[string]any
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &ev); err != nil {
+				t.Fatal(err)
+			}
+			cur.data = ev["data"].(map[string]any)
+		case line == "":
+			got = append(got, cur)
+			cur = sse{}
+		}
+		if n := len(got); n > 0 && got[n-1].typ == EventJob && got[n-1].data["status"] == string(JobSucceeded) {
+			break
+		}
+	}
+
+	if len(got) < 5 || got[0].id != "2" || got[0].typ != EventDrift || got[0].data["drift"] != true {
+		t.Fatalf("replay must start after Last-Event-ID with the drift event: %+v", got)
+	}
+	var statuses []string
+	for _, ev := range got[1:] {
+		if ev.typ == EventJob {
+			statuses = append(statuses, fmt.Sprint(ev.data["status"], ev.data["step"]))
+		}
+	}
+	want := []string{"queued<nil>", "running<nil>", "runningworking", "succeeded<nil>"}
+	if strings.Join(statuses, ",") != strings.Join(want, ",") {
+		t.Fatalf("bad job events: %v", statuses)
+	}
+}
+
+func TestHistoryStore_PersistFilterPageCompact(t *testing.T) {
+	dir := t.TempDir()
+	store, err := OpenHistoryStore(dir, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < 6; i++ {
+		kind := "apply"
+		if i%2 == 1 {
+			kind = "plan"
+		}
+		if _, err := store.Append(OperationRecord{Kind: kind, Status: "succeeded", StartedAt: base.Add(time.Duration(i) * time.Minute)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	page, err := store.Query(httpapi.HistoryQuery{})
+	if err != nil || page.Total != 4 || page.Records[0].Seq != 6 || page.Records[3].Seq != 3 {
+		t.Fatalf("compaction must keep the newest 4: %v %+v", err, page)
+	}
+
+	f, _ := os.OpenFile(filepath.Join(dir, historyFile), os.O_APPEND|os.O_WRONLY, 0)
+	_, _ = f.WriteString(`{"seq":7,"kind":"tor`)
+	_ = f.Close()
+
+	store, err = OpenHistoryStore(dir, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, err := store.Append(OperationRecord{Kind: "plan", Status: "failed", StartedAt: base.Add(time.Hour)})
+	if err != nil || rec.Seq != 7 {
+		t.Fatalf("sequence must survive reopen: %v %d", err, rec.Seq)
+	}
+
+	page, _ = store.Query(httpapi.HistoryQuery{Kind: "plan", Limit: 2})
+	if page.Total != 3 || len(page.Records) != 2 || page.Records[0].Seq != 7 || page.NextBefore != 6 {
+		t.Fatalf("bad first page: %+v", page)
+	}
+	page, _ = store.Query(httpapi.HistoryQuery{Kind: "plan", Limit: 2, Before: page.NextBefore})
+	if len(page.Records) != 1 || page.Records[0].Seq != 4 || page.NextBefore != 0 {
+		t.Fatalf("bad last page: %+v", page)
+	}
+	page, _ = store.Query(httpapi.HistoryQuery{Status: "failed", Since: base.Add(30 * time.Minute)})
+	if page.Total != 1 || page.Records[0].Seq != 7 {
+		t.Fatalf("bad status/since filter: %+v", page)
+	}
+}
+
+func TestHistoryAPI_RecordsMutationsOnly(t *testing.T) {
+	dir := t.TempDir()
+	opts, _ := setupRulesApply(t, dir, "#!/bin/sh\nexit 0\n")
+
+	r := NewRunner("", nil, nil)
+	defer r.jobs.Close()
+	r.opts.Apply = opts
+	store, err := OpenHistoryStore(filepath.Join(dir, "state"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.history = store
+	mux := http.NewServeMux()
+	r.cfg = openAPIConfig()
+	r.registerRoutes(mux)
+
+	// GET /plan is polled by dashboards; it must not grow the history
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/plan", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET /plan: %d %s", rec.Code, rec.Body.String())
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/apply", nil))
+	var job Job
+	if rec.Code != http.StatusAccepted || json.Unmarshal(rec.Body.Bytes(), &job) != nil {
+		t.Fatalf("POST /apply: %d %s", rec.Code, rec.Body.String())
+	}
+	waitJobDone(t, r.jobs, job.ID)
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/history?limit=10", nil))
+	var page HistoryPage
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &page) != nil || len(page.Records) != 1 {
+		t.Fatalf("GET /history: %d %s", rec.Code, rec.Body.String())
+	}
+	got := page.Records[0]
+	cfg, _ := os.ReadFile(opts.ConfigCandidates[0])
+	if got.Kind != "apply" || got.JobID != job.ID || got.ConfigSHA256 != sha256Hex(cfg) || got.RulesSHA256 == "" {
+		t.Fatalf("bad record: %+v", got)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/history?since=yesterday", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("bad since: want 400, got %d", rec.Code)
+	}
+}
+
+func TestRecordOperation_HidesCause(t *testing.T) {
+	r := NewRunner("", nil, nil)
+	defer r.jobs.Close()
+	store, err := OpenHistoryStore(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.history = store
+
+	cause := ErrRestartFailed.Wrap(errors.New("exit status 1: /etc/suricata/suricata.yaml: permission denied"))
+	r.recordOperation(context.Background(), "ensure", "", nil, time.Now(), nil, cause)
+
+	page, err := store.Query(httpapi.HistoryQuery{})
+	if err != nil || len(page.Records) != 1 {
+		t.Fatalf("query: %v %+v", err, page)
+	}
+	got := page.Records[0]
+	if got.Status != string(JobFailed) || got.Code != "RESTART_FAILED" || got.Error != "suricata restart failed" {
+		t.Fatalf("got %s %q %q", got.Status, got.Code, got.Error)
+	}
+}
+
+func TestAPIAuth_TokensRolesAndIdentity(t *testing.T) {
+	dir := t.TempDir()
+	opts, _ := setupRulesApply(t, dir, "#!/bin/sh\nexit 0\n")
+
+	r := NewRunner("", nil, nil)
+	defer r.jobs.Close()
+	r.opts.Apply = opts
+	r.cfg = &config.Config{HTTP: config.HTTPConfig{Auth: config.AuthConfig{
+		Tokens: []config.TokenConfig{
+			{Name: "dash", SHA256: sha256Hex([]byte("view-token")), Role: "viewer"},
+			{Name: "ci", SHA256: sha256Hex([]byte("op-token")), Role: "operator"},
+		},
+		ClientCerts: []config.ClientCertConfig{{Name: "ops", CommonName: "ops.example", Role: "admin"}},
+	}}}
+	store, err := OpenHistoryStore(filepath.Join(dir, "state"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.history = store
+	mux := http.NewServeMux()
+	r.registerRoutes(mux)
+
+	do := func(method, target, token string, cn string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, target, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		if cn != "" {
+			req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: cn}}}}}
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do(http.MethodGet, "/health", "", ""); rec.Code != http.StatusOK {
+		t.Fatalf("/health must stay open: %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, "/jobs", "", ""); rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") == "" {
+		t.Fatalf("no token: want 401, got %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, "/jobs", "wrong", "ops.example"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("bad token: want 401, got %d", rec.Code)
+	}
+
+	rec := do(http.MethodGet, "/plan", "view-token", "")
+	if rec.Code != http.StatusOK || rec.Header().Get("X-Auth-Identity") != "token:dash" || rec.Header().Get("X-Auth-Role") != "viewer" {
+		t.Fatalf("viewer GET /plan: %d %v", rec.Code, rec.Header())
+	}
+	rec = do(http.MethodPost, "/apply", "view-token", "")
+	if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "role operator required") {
+		t.Fatalf("viewer POST /apply: want 403, got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodDelete, "/jobs/nope", "op-token", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("operator DELETE /jobs: want 404, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, "/ndpi/enable", "op-token", ""); rec.Code != http.StatusForbidden {
+		t.Fatalf("operator POST /ndpi/enable: want 403, got %d", rec.Code)
+	}
+
+	rec = do(http.MethodGet, "/jobs", "", "ops.example")
+	if rec.Code != http.StatusOK || rec.Header().Get("X-Auth-Identity") != "mtls:ops" || rec.Header().Get("X-Auth-Role") != "admin" {
+		t.Fatalf("client cert: %d %v", rec.Code, rec.Header())
+	}
+	if rec := do(http.MethodGet, "/jobs", "", "stranger"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("unknown client cert: want 401, got %d", rec.Code)
+	}
+
+	rec = do(http.MethodPost, "/apply", "op-token", "")
+	var job Job
+	if rec.Code != http.StatusAccepted || json.Unmarshal(rec.Body.Bytes(), &job) != nil {
+		t.Fatalf("operator POST /apply: %d %s", rec.Code, rec.Body.String())
+	}
+	waitJobDone(t, r.jobs, job.ID)
+	page, err := store.Query(httpapi.HistoryQuery{Kind: "apply"})
+	if err != nil || len(page.Records) != 1 || page.Records[0].Identity != "token:ci" {
+		t.Fatalf("history identity: %v %+v", err, page)
+	}
+}
+
+func writeCertPEM(t *testing.T, cert *tls.Certificate, certPath, keyPath string) {
+	t.Helper()
+	key, err := x509.MarshalECPrivateKey(cert.PrivateKey.(*ecdsa.PrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, certPath, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]})), 0o644)
+	if keyPath != "" {
+		writeFile(t, keyPath, string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: key})), 0o600)
+	}
+}
+
+func TestHTTPTLS_ReloadsCertificateAndVerifiesClients(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath, caPath := filepath.Join(dir, "api.crt"), filepath.Join(dir, "api.key"), filepath.Join(dir, "ca.pem")
+
+	first, err := selfSignedCert(time.Now(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeCertPEM(t, first, certPath, keyPath)
+
+	// a self-signed client certificate doubles as its own CA
+	clientKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(7),
+		Subject:               pkix.Name{CommonName: "ops-laptop"},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	clientDER, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &clientKey.PublicKey, clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCert := &tls.Certificate{Certificate: [][]byte{clientDER}, PrivateKey: clientKey}
+	writeCertPEM(t, clientCert, caPath, "")
+
+	tlsCfg, err := newServerTLSConfig(config.TLSConfig{CertFile: certPath, KeyFile: keyPath, ClientCA: caPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewRunner("", nil, nil)
+	defer r.jobs.Close()
+	r.cfg = &config.Config{HTTP: config.HTTPConfig{Auth: config.AuthConfig{
+		ClientCerts: []config.ClientCertConfig{{Name: "ops", CommonName: "ops-laptop", Role: "viewer"}},
+	}}}
+	mux := http.NewServeMux()
+	r.registerRoutes(mux)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: mux}
+	go func() { _ = srv.Serve(tls.NewListener(ln, tlsCfg)) }()
+	defer srv.Close()
+
+	get := func(withClientCert bool) (*http.Response, *big.Int) {
+		t.Helper()
+		cc := &tls.Config{InsecureSkipVerify: true}
+		if withClientCert {
+			cc.Certificates = []tls.Certificate{*clientCert}
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: cc, DisableKeepAlives: true}}
+		resp, err := client.Get("https://" + ln.Addr().String() + "/jobs")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp, resp.TLS.PeerCertificates[0].SerialNumber
+	}
+
+	resp, serial := get(true)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("X-Auth-Identity") != "mtls:ops" || serial.Cmp(first.Leaf.SerialNumber) != 0 {
+		t.Fatalf("mtls: %d %q serial %v", resp.StatusCode, resp.Header.Get("X-Auth-Identity"), serial)
+	}
+	if resp, _ := get(false); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("no client cert: want 401, got %d", resp.StatusCode)
+	}
+
+	second, err := selfSignedCert(time.Now(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeCertPEM(t, second, certPath, keyPath)
+	later := time.Now().Add(time.Minute)
+	_ = os.Chtimes(certPath, later, later)
+	if _, serial := get(true); serial.Cmp(second.Leaf.SerialNumber) != 0 {
+		t.Fatalf("certificate not reloaded: serial %v", serial)
+	}
+
+	writeFile(t, certPath, "garbage", 0o644)
+	if _, serial := get(true); serial.Cmp(second.Leaf.SerialNumber) != 0 {
+		t.Fatalf("broken certificate must keep the previous one: serial %v", serial)
+	}
+}
+
+func TestAPIErrors_TypedCodes(t *testing.T) {
+	dir := t.TempDir()
+	opts, _ := setupRulesApply(t, dir, "#!/bin/sh\nexit 0\n")
+	opts.ConfigCandidates = []string{filepath.Join(dir, "etc", "missing.yaml")}
+
+	sock := filepath.Join(dir, "agent.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	agent := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/ndpi/enable" {
+			w.WriteHeader(http.StatusConflict)
+			_, _ = io.WriteString(w, `{"ok":false,"changed":false,"code":"NDPI_NOT_CONFIGURED","message":"ndpi plugin line not found in suricata config"}`)
+			return
+		}
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = io.WriteString(w, `{"ok":false,"code":"FORBIDDEN","message":"caller is not allowed to use this endpoint"}`)
+	})}
+	go func() { _ = agent.Serve(ln) }()
+	defer agent.Close()
+
+	r := NewRunner("", nil, nil)
+	defer r.jobs.Close()
+	r.opts.Apply = opts
+	r.cfg = &config.Config{HTTP: config.HTTPConfig{HostAgentSocket: sock, HostAgentTimeout: 2 * time.Second, Auth: config.AuthConfig{Disabled: true}}}
+	mux := http.NewServeMux()
+	r.registerRoutes(mux)
+
+	do := func(method, target string) (int, map[string]any, string) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+		var out map[string]any
+		if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+			t.Fatalf("%s %s: bad json %q", method, target, rec.Body.String())
+		}
+		return rec.Code, out, rec.Body.String()
+	}
+
+	code, out, _ := do(http.MethodPost, "/ndpi/enable")
+	if code != http.StatusAccepted {
+		t.Fatalf("POST /ndpi/enable must answer with a job: %d %v", code, out)
+	}
+	if j := waitJobDone(t, r.jobs, out["id"].(string)); j.Status != JobFailed || j.Code != "NDPI_NOT_CONFIGURED" || j.Retryable {
+		t.Fatalf("agent code not passed through: %+v", j)
+	}
+	_, out, _ = do(http.MethodPost, "/ndpi/disable")
+	if j := waitJobDone(t, r.jobs, out["id"].(string)); j.Code != "HOST_AGENT_FORBIDDEN" {
+		t.Fatalf("agent refusal: %+v", j)
+	}
+	code, out, _ = do(http.MethodGet, "/ndpi/status")
+	if code != http.StatusBadGateway || out["code"] != "HOST_AGENT_FORBIDDEN" {
+		t.Fatalf("agent refusal on status: %d %v", code, out)
+	}
+
+	_, err = agentclient.New(sock, time.Second).EnableNDPI(context.Background())
+	if !errors.Is(err, agentclient.ErrNDPINotConfigured) {
+		t.Fatalf("agentclient: want ErrNDPINotConfigured, got %v", err)
+	}
+	_, err = agentclient.New(filepath.Join(dir, "nobody.sock"), time.Second).EnableNDPI(context.Background())
+	if !errors.Is(err, agentclient.ErrUnavailable) {
+		t.Fatalf("agentclient: want ErrUnavailable, got %v", err)
+	}
+
+	code, out, body := do(http.MethodGet, "/plan")
+	if code != http.StatusNotFound || out["code"] != "CONFIG_NOT_FOUND" || strings.Contains(body, dir) {
+		t.Fatalf("missing config: %d %s", code, body)
+	}
+	if _, err := PlanConfig(context.Background(), opts); !errors.Is(err, ErrConfigNotFound) {
+		t.Fatalf("PlanConfig: want ErrConfigNotFound, got %v", err)
+	}
+
+	// untyped failures keep their text out of the response
+	code, out, body = do(http.MethodGet, "/history")
+	if code != http.StatusInternalServerError || out["code"] != "INTERNAL" || strings.Contains(body, "history store") {
+		t.Fatalf("untyped error: %d %s", code, body)
+	}
+
+	code, out, _ = do(http.MethodGet, "/jobs/nope")
+	if code != http.StatusNotFound || out["code"] != "JOB_NOT_FOUND" || out["details"].(map[string]any)["id"] != "nope" {
+		t.Fatalf("typed error: %d %v", code, out)
+	}
+}
+
+func TestRulesAPI_QueryGetValidate(t *testing.T) {
+	dir := t.TempDir()
+	local := filepath.Join(dir, "local")
+	if err := os.MkdirAll(local, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(local, "a.rules"), `alert tcp any any -> any any (msg:"http"; requires:keyword ndpi-protocol; ndpi-protocol:HTTP; metadata:mitre_technique_id T1071.001; sid:1;)
+alert udp any any -> any any (msg:"dns"; requires:keyword ndpi-protocol; ndpi-protocol:DNS; metadata:mitre_technique_id T1590; sid:2;)
+`, 0o644)
+	writeFile(t, filepath.Join(local, "b.rules"), `alert tcp any any -> any any (msg:"weak"; requires:keyword ndpi-risk; ndpi-risk:NDPI_TLS_WEAK_CIPHER; metadata:mitre_technique_id T1573; sid:3;)
+`, 0o644)
+
+	r := NewRunner("", nil, nil)
+	r.opts.Apply = ApplyConfigOptions{
+		RulesLocalDir:          local,
+		RuleOverridesStatePath: filepath.Join(dir, "overrides.json"),
+	}
+	mux := http.NewServeMux()
+	r.cfg = openAPIConfig()
+	r.registerRoutes(mux)
+
+	do := func(method, target, body string) (int, map[string]any) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+		var out map[string]any
+		if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+			t.Fatalf("%s %s: bad json %q", method, target, rec.Body.String())
+		}
+		return rec.Code, out
+	}
+	sids := func(listing map[string]any) []float64 {
+		var out []float64
+		for _, v := range listing["rules"].([]any) {
+			out = append(out, v.(map[string]any)["sid"].(float64))
+		}
+		return out
+	}
+
+	code, job := do(http.MethodPost, "/rules/3/action", `{"action":"drop"}`)
+	if code != http.StatusAccepted {
+		t.Fatalf("action override: %d", code)
+	}
+	if j := waitJobDone(t, r.jobs, job["id"].(string)); j.Status != JobSucceeded {
+		t.Fatalf("action override: %+v", j)
+	}
+
+	cases := map[string][]float64{
+		"/rules":                                {1, 2, 3},
+		"/rules?transport=udp":                  {2},
+		"/rules?ndpi_protocol=http":             {1},
+		"/rules?ndpi_risk=NDPI_TLS_WEAK_CIPHER": {3},
+		"/rules?mitre=T1071":                    {1},
+		"/rules?file=b.rules":                   {3},
+		"/rules?action=drop":                    {3},
+		"/rules?sid=2":                          {2},
+	}
+	for target, want := range cases {
+		code, out := do(http.MethodGet, target, "")
+		if code != http.StatusOK {
+			t.Fatalf("GET %s: %d %v", target, code, out)
+		}
+		if got := sids(out); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Fatalf("GET %s: want sids %v, got %v", target, want, got)
+		}
+	}
+
+	code, detail := do(http.MethodGet, "/rules/1", "")
+	if code != http.StatusOK || detail["direction"] != "->" || len(detail["options"].([]any)) != 5 {
+		t.Fatalf("GET /rules/1: %d %v", code, detail)
+	}
+	if code, _ := do(http.MethodGet, "/rules/42", ""); code != http.StatusNotFound {
+		t.Fatalf("GET /rules/42: want 404, got %d", code)
+	}
+
+	code, lint := do(http.MethodPost, "/rules/validate", `alert tcp any any -> any any (msg:"x"; ndpi-protocol:HTTP; metadata:mitre_technique_id T1071; sid:2;)`)
+	if code != http.StatusOK || lint["valid"] != false {
+		t.Fatalf("POST /rules/validate: %d %v", code, lint)
+	}
+	findings := fmt.Sprint(lint["rules"])
+	if !strings.Contains(findings, "requires") || !strings.Contains(findings, "sid-in-use") {
+		t.Fatalf("missing findings: %s", findings)
+	}
+
+	// an unreadable local rule set must not pass as "no SID in use"
+	if err := os.Mkdir(filepath.Join(local, "broken.rules"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if code, out := do(http.MethodPost, "/rules/validate", `alert tcp any any -> any any (msg:"x"; sid:9;)`); code != http.StatusInternalServerError {
+		t.Fatalf("POST /rules/validate with unreadable rules: want 500, got %d %v", code, out)
+	}
+}
+
+func TestBuildMitreReport_GroupsByTactic(t *testing.T) {
+	var ruleList []*rules.Rule
+	for _, text := range []string{
+		`alert tcp any any -> any any (msg:"a"; metadata:mitre_technique_id T1071; sid:1;)`,
+		`alert tcp any any -> any any (msg:"b"; metadata:mitre_technique_id T1040; sid:2;)`,
+		`alert tcp any any -> any any (msg:"c"; metadata:mitre_technique_id T1071.999; sid:3;)`,
+		`alert tcp any any -> any any (msg:"d"; metadata:mitre_technique_id T9999; sid:4;)`,
+		`alert tcp any any -> any any (msg:"e"; sid:5;)`,
+		`# alert tcp any any -> any any (msg:"off"; metadata:mitre_technique_id T1046; sid:6;)`,
+	} {
+		parsed, _, err := rules.ParseReader(strings.NewReader(text), "")
+		if err != nil || len(parsed) != 1 {
+			t.Fatalf("parse %q: %v", text, err)
+		}
+		ruleList = append(ruleList, parsed[0])
+	}
+
+	rep := BuildMitreReport(ruleList)
+	if rep.Summary.Rules != 5 || rep.Summary.RulesMapped != 3 || rep.Summary.TacticsCovered != 3 {
+		t.Fatalf("bad summary: %+v", rep.Summary)
+	}
+
+	tactics := make(map[string]MitreTacticCoverage)
+	for _, c := range rep.Tactics {
+		tactics[c.ID] = c
+	}
+	if c := tactics["TA0011"]; c.Rules != 2 || len(c.Techniques) != 2 || c.Techniques[0].ID != "T1071" {
+		t.Fatalf("bad command and control coverage: %+v", c)
+	}
+	// T1040 belongs to both Credential Access and Discovery
+	if tactics["TA0006"].Rules != 1 || tactics["TA0007"].Rules != 1 {
+		t.Fatalf("T1040 must count under both tactics: %+v %+v", tactics["TA0006"], tactics["TA0007"])
+	}
+	if len(rep.Unknown) != 1 || rep.Unknown[0].ID != "T9999" || len(rep.Unmapped) != 1 || rep.Unmapped[0] != 5 {
+		t.Fatalf("bad unknown/unmapped: %+v %+v", rep.Unknown, rep.Unmapped)
+	}
+}
+
+// specOps reads an OpenAPI document into "METHOD /path" -> operation and
+// fails on a $ref that does not resolve.
+func specOps(t *testing.T, raw []byte) map[string]map[string]any {
+	t.Helper()
+	var doc map[string]any
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		t.Fatalf("spec is not JSON: %v", err)
+	}
+
+	var walk func(v any)
+	walk = func(v any) {
+		switch x := v.(type) {
+		case map[string]any:
+			if ref, ok := x["$ref"].(string); ok {
+				var cur any = doc
+				for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+					m, _ := cur.(map[string]any)
+					cur = m[part]
+				}
+				if cur == nil {
+					t.Errorf("unresolved $ref %s", ref)
+				}
+			}
+			for _, e := range x {
+				walk(e)
+			}
+		case []any:
+			for _, e := range x {
+				walk(e)
+			}
+		}
+	}
+	walk(doc)
+
+	ops := make(map[string]map[string]any)
+	paths, _ := doc["paths"].(map[string]any)
+	for path, item := range paths {
+		for method, op := range item.(map[string]any) {
+			if method == "parameters" {
+				continue
+			}
+			ops[strings.ToUpper(method)+" "+path] = op.(map[string]any)
+		}
+	}
+	return ops
+}
+
+func TestOpenAPI_SpecMatchesHandlers(t *testing.T) {
+	ops := specOps(t, httpapi.OpenAPISpec())
+
+	routes := make(map[string]httpapi.Role)
+	for _, rt := range httpapi.Routes() {
+		routes[rt.Method+" "+rt.Path] = rt.Role
+	}
+	for key, role := range routes {
+		op, ok := ops[key]
+		if !ok {
+			t.Errorf("%s is served but not in openapi.json", key)
+			continue
+		}
+		if want := op["x-required-role"]; want != role.String() {
+			t.Errorf("%s: spec says role %v, server needs %s", key, want, role)
+		}
+		if sec, ok := op["security"].([]any); role == httpapi.RoleNone && (!ok || len(sec) != 0) {
+			t.Errorf("%s is open but the spec asks for credentials", key)
+		}
+	}
+
+	// Every documented operation reaches its handler (not the mux's own 404/405)
+	// and answers with a status the spec lists.
+	mux := http.NewServeMux()
+	httpapi.New(httpapi.Deps{Auth: httpapi.AuthConfig{Disabled: true}}).Register(mux)
+	for key, op := range ops {
+		if _, ok := routes[key]; !ok {
+			t.Errorf("%s is in openapi.json but not served", key)
+			continue
+		}
+		method, path, _ := strings.Cut(key, " ")
+		target := strings.NewReplacer("{id}", "job-1", "{sid}", "1").Replace(path)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+
+		if !strings.HasPrefix(rec.Header().Get("Content-Type"), "application/json") {
+			t.Errorf("%s: not answered by a handler: %d %q", key, rec.Code, rec.Body.String())
+			continue
+		}
+		responses, _ := op["responses"].(map[string]any)
+		if _, ok := responses[fmt.Sprint(rec.Code)]; !ok && responses["default"] == nil {
+			t.Errorf("%s: status %d is not documented", key, rec.Code)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if rec.Code != http.StatusOK || !bytes.Equal(rec.Body.Bytes(), httpapi.OpenAPISpec()) {
+		t.Fatalf("GET /openapi.json: %d", rec.Code)
+	}
+}
+
+// TestAgentClient_CoversAgentSpec drives every agentclient call against a fake
+// agent and checks that together they hit exactly the documented routes.
+func TestAgentClient_CoversAgentSpec(t *testing.T) {
+	raw, err := os.ReadFile(filepath.Join("..", "pkg", "hostagent", "openapi.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ops := specOps(t, raw)
+
+	dir := t.TempDir()
+	sock := filepath.Join(dir, "agent.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hit := make(chan string, 32)
+	agent := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hit <- r.Method + " " + r.URL.Path
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/ndpi/enable" {
+			_, _ = io.WriteString(w, `{"ok":true,"changed":true,"enabled":true,"code":"","message":"ok"}`)
+			return
+		}
+		if r.URL.Path == "/suricata/status" {
+			_, _ = io.WriteString(w, `{"ok":true,"unit":"suricata","active_state":"active","main_pid":42,"ndpi":{"loaded":true,"source":"maps"},`+
+				`"last_restart":{"time":"2026-10-19T09:12:01Z","reason":"POST /ndpi/enable","by":"host-agent","ok":true}}`)
+			return
+		}
+		if r.URL.Path == "/audit" {
+			_, _ = io.WriteString(w, `{"ok":true,"records":[{"seq":1,"path":"/ndpi/enable","peer":{"uid":0,"gid":0,"pid":1}}],"chain":{"ok":true,"records":1}}`)
+			return
+		}
+		_, _ = io.WriteString(w, `{"ok":true,"enabled":true,"line":"- /usr/lib/ndpi.so"}`)
+	})}
+	go func() { _ = agent.Serve(ln) }()
+	defer agent.Close()
+
+	ctx := context.Background()
+	c := agentclient.New(sock, 2*time.Second)
+	if err := c.Health(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.OpenAPI(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if st, err := c.NDPIStatus(ctx); err != nil || !st.Enabled || st.Line == "" {
+		t.Fatalf("ndpi status: %+v %v", st, err)
+	}
+	if _, err := c.EnableNDPI(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.DisableNDPI(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.EnsureSuricataStarted(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ReloadSuricata(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if st, err := c.SuricataStatus(ctx); err != nil || st.ActiveState != "active" || !st.NDPI.Loaded || st.LastRestart == nil {
+		t.Fatalf("suricata status: %+v %v", st, err)
+	}
+	if a, err := c.Audit(ctx, 10); err != nil || len(a.Records) != 1 || a.Records[0].Peer == nil || !a.Chain.OK {
+		t.Fatalf("audit: %+v %v", a, err)
+	}
+	close(hit)
+
+	called := make(map[string]bool)
+	for key := range hit {
+		called[key] = true
+		if _, ok := ops[key]; !ok {
+			t.Errorf("agentclient calls %s, which the agent spec does not document", key)
+		}
+	}
+	for key := range ops {
+		if !called[key] {
+			t.Errorf("agentclient has no call for %s", key)
+		}
+	}
+}
+
+func TestDoctor_ReportsEveryFinding(t *testing.T) {
+	dir := t.TempDir()
+	plugin := filepath.Join(dir, "ndpi.so")
+	writePluginELF(t, plugin, pluginELF{symbols: []string{PluginRegisterSymbol}})
+	sc := writeExecutable(t, dir, "suricatasc", "#!/bin/sh\n")
+	bin := writeExecutable(t, dir, "suricata", "#!/bin/sh\n")
+	tpl, suricataCfg := setupTemplateAndConfig(t, dir)
+	writeFile(t, suricataCfg, "plugins:\n  # - "+plugin+"\n", 0o644)
+	rulesLocal := filepath.Join(dir, "rules")
+	if err := os.Mkdir(rulesLocal, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	stale := filepath.Join(dir, "stale.sock")
+	startUnixSocketListener(t, stale).Close()
+	live := filepath.Join(dir, "live.sock")
+	defer startUnixSocketListener(t, live).Close()
+
+	agentSock := filepath.Join(dir, "agent.sock")
+	l, err := net.Listen("unix", agentSock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { _, _ = io.WriteString(w, "ok\n") })}
+	go func() { _ = srv.Serve(l) }()
+	defer srv.Close()
+
+	cfgPath := filepath.Join(dir, "config.yaml")
+	writeFile(t, cfgPath, fmt.Sprintf(`
+http:
+  host_agent_socket: %q
+paths:
+  ndpi_rules_local: %q
+  ndpi_plugin_path: %q
+  suricata_template: %q
+  suricatasc: %q
+  suricata_bin: %q
+  suricata_rules_dir: %q
+suricata:
+  socket_candidates: [%q, %q]
+  config_candidates: [%q]
+system:
+  systemctl: /bin/systemctl
+  systemd_backend: systemctl
+  suricata_service: suricata
+`, agentSock, rulesLocal, plugin, tpl, sc, bin, filepath.Join(dir, "missing"), stale, live, suricataCfg), 0o644)
+
+	var ran []string
+	runner := &mocks.ExecRunner{CombinedOutputFunc: func(_ context.Context, name string, args ...string) ([]byte, error) {
+		ran = append(ran, filepath.Base(name)+" "+strings.Join(args, " "))
+		switch filepath.Base(name) {
+		case "suricata":
+			return []byte("This is Suricata version 8.0.1 RELEASE\nFeatures: AF_PACKET HAVE_LUA\n"), nil
+		case "suricatasc":
+			return []byte(`{"message": 42, "return": "OK"}`), nil
+		case "systemctl":
+			return []byte("LoadState=not-found\nActiveState=inactive\n"), nil
+		}
+		return nil, fmt.Errorf("unexpected %s", name)
+	}}
+
+	rep := RunDoctor(context.Background(), DoctorOptions{ConfigPath: cfgPath, Runner: runner, Timeout: time.Second})
+	if rep.OK {
+		t.Fatal("report ok despite failures")
+	}
+
+	want := map[string]DoctorStatus{
+		"config":                   DoctorOK,
+		"paths.ndpi_plugin_path":   DoctorOK,
+		"paths.suricatasc":         DoctorOK,
+		"paths.suricata_bin":       DoctorOK,
+		"paths.suricata_template":  DoctorOK,
+		"paths.ndpi_rules_local":   DoctorOK,
+		"paths.suricata_rules_dir": DoctorFail,
+		"suricata config":          DoctorOK,
+		"ndpi plugin":              DoctorOK,
+		"suricata build":           DoctorFail,
+		"plugin line":              DoctorWarn,
+		"suricata socket " + stale: DoctorWarn,
+		"suricata socket " + live:  DoctorOK,
+		"suricatasc":               DoctorOK,
+		"systemd unit suricata":    DoctorFail,
+		"host agent socket":        DoctorOK,
+	}
+	got := make(map[string]DoctorStatus)
+	for _, f := range rep.Findings {
+		got[f.Check] = f.Status
+		if f.Status != DoctorOK && f.Status != DoctorSkip && f.Hint == "" {
+			t.Errorf("%s: %s without a hint", f.Check, f.Status)
+		}
+	}
+	for check, status := range want {
+		if got[check] != status {
+			t.Errorf("%s = %q, want %q", check, got[check], status)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("findings %v, want %d checks", got, len(want))
+	}
+	if !strings.Contains(strings.Join(ran, "\n"), "suricatasc -c uptime "+live) {
+		t.Errorf("suricatasc not run against the live socket: %q", ran)
+	}
+
+	// a broken config is itself a finding, not an error
+	writeFile(t, cfgPath, "paths: [\n", 0o644)
+	rep = RunDoctor(context.Background(), DoctorOptions{ConfigPath: cfgPath, Runner: runner})
+	if rep.OK || rep.Findings[0].Check != "config" || rep.Findings[0].Status != DoctorFail {
+		t.Fatalf("bad config: %+v", rep)
+	}
+}
+
+func TestDBusManager_WaitsForJobResult(t *testing.T) {
+	ctx := context.Background()
+	since := time.Date(2026, 10, 19, 9, 12, 1, 0, time.UTC)
+	bus := &mocks.SystemdBus{
+		UnitProperties: map[string]any{
+			"LoadState": "loaded", "ActiveState": "active", "SubState": "running",
+			"ActiveEnterTimestamp": uint64(since.UnixMicro()),
+		},
+		ServiceProperties: map[string]any{"MainPID": uint32(4242), "Result": "success", "NRestarts": uint32(2)},
+	}
+	m := systemd.NewDBusManagerWithBus(bus)
+
+	if err := m.Restart(ctx, "suricata", time.Second); err != nil {
+		t.Fatalf("restart: %v", err)
+	}
+	if err := m.ReloadOrRestart(ctx, "suricata.service", time.Second); err != nil {
+		t.Fatalf("reload-or-restart: %v", err)
+	}
+	if err := m.Start(ctx, "suricata.socket", time.Second); err != nil {
+		t.Fatalf("start socket: %v", err)
+	}
+	// the bus rejects bare names, so the config default "suricata" must be completed
+	if got := strings.Join(bus.Calls, ","); got != "RestartUnit suricata.service,ReloadOrRestartUnit suricata.service,StartUnit suricata.socket" {
+		t.Fatalf("calls: %s", got)
+	}
+
+	st, err := m.Status(ctx, "suricata")
+	if err != nil || st.ActiveState != "active" || st.SubState != "running" || st.MainPID != 4242 ||
+		st.NRestarts != 2 || st.Since == nil || !st.Since.Equal(since) {
+		t.Fatalf("status: %+v %v", st, err)
+	}
+	if ok, err := m.IsActive(ctx, "suricata"); !ok || err != nil {
+		t.Fatalf("is-active: %v %v", ok, err)
+	}
+	if pid, err := m.MainPID(ctx, "suricata"); pid != 4242 || err != nil {
+		t.Fatalf("main pid: %d %v", pid, err)
+	}
+
+	// the enqueue succeeds but JobRemoved reports the failure
+	bus.JobResult = func(method, unit string) string { return "failed" }
+	bus.UnitProperties["ActiveState"], bus.UnitProperties["SubState"] = "failed", "failed"
+	bus.ServiceProperties["Result"] = "exit-code"
+	err = m.Start(ctx, "suricata", time.Second)
+	if err == nil || !strings.Contains(err.Error(), `finished with "failed" (ActiveState=failed SubState=failed Result=exit-code)`) {
+		t.Fatalf("failed job: %v", err)
+	}
+
+	bus.JobResult = func(method, unit string) string { return "" }
+	if err := m.Stop(ctx, "suricata", 20*time.Millisecond); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("no JobRemoved: %v", err)
+	}
+
+	bus.JobErr = errors.New("Unit nope.service not found.")
+	if err := m.Restart(ctx, "nope", time.Second); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("enqueue error: %v", err)
+	}
+
+	_ = m.Close()
+	if !bus.Closed {
+		t.Fatal("bus not closed")
+	}
+}
+
+func TestSystemctlManager_Fallback(t *testing.T) {
+	ctx := context.Background()
+	var ran []string
+	runner := &mocks.ExecRunner{CombinedOutputFunc: func(_ context.Context, name string, args ...string) ([]byte, error) {
+		ran = append(ran, strings.Join(args, " "))
+		if args[0] == "show" {
+			return []byte("LoadState=loaded\nActiveState=active\nSubState=running\nMainPID=77\n" +
+				"ActiveEnterTimestamp=Mon 2026-10-19 09:12:01 UTC\nResult=success\nNRestarts=1\n"), nil
+		}
+		return nil, nil
+	}}
+
+	m, err := systemd.New(ctx, systemd.BackendSystemctl, "/bin/systemctl", runner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.ReloadOrRestart(ctx, "suricata", time.Second); err != nil {
+		t.Fatal(err)
+	}
+	st, err := m.Status(ctx, "suricata")
+	if err != nil || st.ActiveState != "active" || st.SubState != "running" || st.MainPID != 77 || st.NRestarts != 1 ||
+		st.Since == nil || !st.Since.Equal(time.Date(2026, 10, 19, 9, 12, 1, 0, time.UTC)) {
+		t.Fatalf("status: %+v %v", st, err)
+	}
+	if ran[0] != "reload-or-restart suricata" || !strings.HasPrefix(ran[1], "show --property=") {
+		t.Fatalf("ran: %q", ran)
+	}
+
+	if _, err := systemd.New(ctx, "upstart", "", nil); err == nil {
+		t.Fatal("expected error for an unknown backend")
+	}
+}
+
+// openAPIConfig runs the API without authentication, for tests of the routes.
+func openAPIConfig() *config.Config {
+	return &config.Config{HTTP: config.HTTPConfig{Auth: config.AuthConfig{Disabled: true}}}
+}
+
+func TestDoctorCheckPath_WritableDirLeftUntouched(t *testing.T) {
+	dir := t.TempDir()
+	if err := checkPath(doctorPath{key: "paths.suricata_rules_dir", path: dir, dir: true, need: needWrite}); err != nil {
+		t.Fatalf("writable dir: %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("doctor left files behind: %v", entries)
+	}
+	if err := checkPath(doctorPath{key: "paths.suricata_rules_dir", path: filepath.Join(dir, "nope"), dir: true, need: needWrite}); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("missing dir: %v", err)
+	}
+}
@@ -0,0 +1,366 @@
+package integration
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"integration-suricata-ndpi/pkg/apierror"
+	"integration-suricata-ndpi/pkg/logger"
+)
+
+type JobStatus string
+
+const (
+	JobQueued    JobStatus = "queued"
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+	JobCanceled  JobStatus = "canceled"
+)
+
+type JobStep struct {
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+}
+
+type Job struct {
+	ID         string     `json:"id"`
+	Kind       string     `json:"kind"`
+	Status     JobStatus  `json:"status"`
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Steps      []JobStep  `json:"steps"`
+	Result     any        `json:"result,omitempty"`
+	// Error is the full error text; Code, Details and Retryable follow the
+	// API error model.
+	Error     string `json:"error,omitempty"`
+	Code      string `json:"code,omitempty"`
+	Details   any    `json:"details,omitempty"`
+	Retryable bool   `json:"retryable,omitempty"`
+}
+
+// JobID lets the HTTP layer answer 202 with a Location for submitted jobs.
+func (j Job) JobID() string { return j.ID }
+
+func (j Job) finished() bool {
+	return j.Status == JobSucceeded || j.Status == JobFailed || j.Status == JobCanceled
+}
+
+type JobFunc func(ctx context.Context) (any, error)
+
+type JobNotFoundError struct {
+	ID string
+}
+
+func (e *JobNotFoundError) Error() string   { return fmt.Sprintf("job %q not found", e.ID) }
+func (e *JobNotFoundError) HTTPStatus() int { return 404 }
+func (e *JobNotFoundError) Details() any    { return map[string]string{"id": e.ID} }
+
+type JobFinishedError struct {
+	ID     string
+	Status JobStatus
+}
+
+func (e *JobFinishedError) Error() string {
+	return fmt.Sprintf("job %q already %s", e.ID, e.Status)
+}
+func (e *JobFinishedError) HTTPStatus() int { return 409 }
+func (e *JobFinishedError) Details() any {
+	return map[string]string{"id": e.ID, "status": string(e.Status)}
+}
+
+type JobQueueFullError struct{}
+
+func (e *JobQueueFullError) Error() string   { return "job queue is full" }
+func (e *JobQueueFullError) HTTPStatus() int { return 503 }
+func (e *JobQueueFullError) Details() any    { return nil }
+
+type jobEntry struct {
+	job    Job
+	fn     JobFunc
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// JobQueue runs jobs strictly one at a time, in submission order, and keeps
+// the most recent finished ones for GET /jobs.
+type JobQueue struct {
+	mu      sync.Mutex
+	ctx     context.Context
+	stop    context.CancelFunc
+	limit   int
+	jobs    map[string]*jobEntry
+	order   []string
+	pending chan *jobEntry
+	notify  func(Job)
+	// busy is held while a job or a Between call runs.
+	busy chan struct{}
+}
+
+func NewJobQueue(limit int) *JobQueue {
+	if limit <= 0 {
+		limit = 100
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	q := &JobQueue{
+		ctx:     ctx,
+		stop:    stop,
+		limit:   limit,
+		jobs:    make(map[string]*jobEntry),
+		pending: make(chan *jobEntry, 64),
+		busy:    make(chan struct{}, 1),
+	}
+	go q.work()
+	return q
+}
+
+// Notify registers fn to be called with every job state change and step. It
+// runs under the queue lock, so fn must not call back into the queue.
+func (q *JobQueue) Notify(fn func(Job)) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.notify = fn
+}
+
+func (q *JobQueue) changedLocked(e *jobEntry) {
+	if q.notify != nil {
+		q.notify(e.snapshot())
+	}
+}
+
+// Close cancels the running job and stops the worker; queued jobs are canceled.
+func (q *JobQueue) Close() {
+	q.stop()
+}
+
+func (q *JobQueue) Submit(kind string, fn JobFunc) (Job, error) {
+	e := &jobEntry{
+		job:  Job{ID: newJobID(), Kind: kind, Status: JobQueued, CreatedAt: time.Now().UTC(), Steps: []JobStep{}},
+		fn:   fn,
+		done: make(chan struct{}),
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	select {
+	case q.pending <- e:
+	default:
+		return Job{}, &JobQueueFullError{}
+	}
+	q.jobs[e.job.ID] = e
+	q.order = append(q.order, e.job.ID)
+	q.trimLocked()
+	q.changedLocked(e)
+
+	logger.Infow("Job queued", "id", e.job.ID, "kind", kind)
+	return e.job, nil
+}
+
+// Between runs fn while no job is running, without making it a job; reads
+// such as GET /plan use it so they never see a half-applied change.
+func (q *JobQueue) Between(ctx context.Context, fn JobFunc) (any, error) {
+	select {
+	case q.busy <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-q.busy }()
+	return fn(ctx)
+}
+
+func (q *JobQueue) Get(id string) (Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	e, ok := q.jobs[id]
+	if !ok {
+		return Job{}, &JobNotFoundError{ID: id}
+	}
+	return e.snapshot(), nil
+}
+
+// List returns the known jobs, newest first.
+func (q *JobQueue) List() []Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	out := make([]Job, 0, len(q.order))
+	for i := len(q.order) - 1; i >= 0; i-- {
+		out = append(out, q.jobs[q.order[i]].snapshot())
+	}
+	return out
+}
+
+// Cancel drops a queued job or cancels the context of the running one.
+func (q *JobQueue) Cancel(id string) (Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	e, ok := q.jobs[id]
+	if !ok {
+		return Job{}, &JobNotFoundError{ID: id}
+	}
+	switch {
+	case e.job.finished():
+		return e.snapshot(), &JobFinishedError{ID: id, Status: e.job.Status}
+	case e.job.Status == JobQueued:
+		q.finishLocked(e, nil, context.Canceled)
+	default:
+		e.cancel()
+		e.stepLocked("cancel requested")
+		q.changedLocked(e)
+	}
+	return e.snapshot(), nil
+}
+
+func (q *JobQueue) work() {
+	for {
+		select {
+		case <-q.ctx.Done():
+			q.drain()
+			return
+		case e := <-q.pending:
+			q.run(e)
+		}
+	}
+}
+
+func (q *JobQueue) drain() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for {
+		select {
+		case e := <-q.pending:
+			if e.job.Status == JobQueued {
+				q.finishLocked(e, nil, context.Canceled)
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (q *JobQueue) run(e *jobEntry) {
+	q.busy <- struct{}{}
+	defer func() { <-q.busy }()
+
+	q.mu.Lock()
+	if e.job.Status != JobQueued {
+		q.mu.Unlock()
+		return
+	}
+	ctx, cancel := context.WithCancel(q.ctx)
+	defer cancel()
+	now := time.Now().UTC()
+	e.cancel = cancel
+	e.job.Status = JobRunning
+	e.job.StartedAt = &now
+	q.changedLocked(e)
+	q.mu.Unlock()
+
+	logger.Infow("Job started", "id", e.job.ID, "kind", e.job.Kind)
+	result, err := e.fn(context.WithValue(ctx, jobCtxKey{}, &jobStepper{q: q, e: e}))
+	if err == nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+
+	q.mu.Lock()
+	q.finishLocked(e, result, err)
+	q.mu.Unlock()
+}
+
+func (q *JobQueue) finishLocked(e *jobEntry, result any, err error) {
+	now := time.Now().UTC()
+	e.job.FinishedAt = &now
+	e.job.Result = result
+	switch {
+	case err == nil:
+		e.job.Status = JobSucceeded
+	case errors.Is(err, context.Canceled):
+		e.job.Status = JobCanceled
+		e.job.Error = apierror.ErrCanceled.Message
+	default:
+		// the job shows the code's stable message; the cause is only logged
+		ae := apierror.From(err)
+		e.job.Status = JobFailed
+		e.job.Error = ae.Message
+		e.job.Code = ae.Code
+		e.job.Details = ae.Details
+		e.job.Retryable = ae.Retryable
+	}
+	close(e.done)
+	q.changedLocked(e)
+
+	if err != nil {
+		logger.Infow("Job finished", "id", e.job.ID, "kind", e.job.Kind, "status", e.job.Status, "code", e.job.Code, "error", err)
+	} else {
+		logger.Infow("Job finished", "id", e.job.ID, "kind", e.job.Kind, "status", e.job.Status)
+	}
+	q.trimLocked()
+}
+
+// trimLocked forgets the oldest finished jobs beyond the limit.
+func (q *JobQueue) trimLocked() {
+	for len(q.order) > q.limit {
+		idx := -1
+		for i, id := range q.order {
+			if q.jobs[id].job.finished() {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			return
+		}
+		delete(q.jobs, q.order[idx])
+		q.order = append(q.order[:idx], q.order[idx+1:]...)
+	}
+}
+
+func (e *jobEntry) snapshot() Job {
+	j := e.job
+	j.Steps = append([]JobStep(nil), e.job.Steps...)
+	return j
+}
+
+func (e *jobEntry) stepLocked(msg string) {
+	e.job.Steps = append(e.job.Steps, JobStep{Time: time.Now().UTC(), Message: msg})
+}
+
+type jobCtxKey struct{}
+
+type jobStepper struct {
+	q *JobQueue
+	e *jobEntry
+}
+
+// jobStep appends to the step log of the job running ctx; outside a job it is
+// a no-op.
+func jobStep(ctx context.Context, format string, args ...any) {
+	s, ok := ctx.Value(jobCtxKey{}).(*jobStepper)
+	if !ok {
+		return
+	}
+	s.q.mu.Lock()
+	defer s.q.mu.Unlock()
+	s.e.stepLocked(fmt.Sprintf(format, args...))
+	s.q.changedLocked(s.e)
+}
+
+func jobIDFromContext(ctx context.Context) string {
+	if s, ok := ctx.Value(jobCtxKey{}).(*jobStepper); ok {
+		return s.e.job.ID
+	}
+	return ""
+}
+
+func newJobID() string {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,111 @@
+package integration
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Skipped  int             `xml:"skipped,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Body    string `xml:",chardata"`
+}
+
+func WriteJUnitReport(w io.Writer, rep PcapTestReport) error {
+	suite := junitTestSuite{
+		Name:     "ndpi-rules-pcap",
+		Tests:    rep.Total,
+		Failures: rep.Failed,
+		Skipped:  rep.Skipped,
+		Time:     junitSeconds(rep.Duration),
+	}
+
+	for _, c := range rep.Cases {
+		tc := junitTestCase{
+			Name:      c.Name,
+			ClassName: "pcap",
+			Time:      junitSeconds(c.Duration),
+		}
+
+		switch {
+		case c.Skipped:
+			tc.Skipped = &junitMessage{Message: c.Error}
+		case !c.Passed:
+			tc.Failure = &junitMessage{
+				Message: pcapFailureSummary(c),
+				Body:    c.Output,
+			}
+		}
+		if len(c.AlertedSIDs) > 0 {
+			tc.SystemOut = "alerted sids: " + joinSIDs(c.AlertedSIDs)
+		}
+
+		suite.Cases = append(suite.Cases, tc)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(junitTestSuites{Suites: []junitTestSuite{suite}}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func pcapFailureSummary(c PcapCaseResult) string {
+	if c.Error != "" {
+		return c.Error
+	}
+	var parts []string
+	if len(c.MissingSIDs) > 0 {
+		parts = append(parts, "expected sids not alerted: "+joinSIDs(c.MissingSIDs))
+	}
+	if len(c.ForbiddenHit) > 0 {
+		parts = append(parts, "forbidden sids alerted: "+joinSIDs(c.ForbiddenHit))
+	}
+	return strings.Join(parts, "; ")
+}
+
+func joinSIDs(sids []uint64) string {
+	s := make([]string, 0, len(sids))
+	for _, sid := range sids {
+		s = append(s, fmt.Sprintf("%d", sid))
+	}
+	return strings.Join(s, ",")
+}
+
+func junitSeconds(d string) string {
+	dur, err := time.ParseDuration(d)
+	if err != nil {
+		return "0"
+	}
+	return fmt.Sprintf("%.3f", dur.Seconds())
+}
@@ -1,11 +1,17 @@
 package integration
 
 import (
+	"path/filepath"
+
 	"integration-suricata-ndpi/internal/config"
 	"integration-suricata-ndpi/pkg/executil"
 	"integration-suricata-ndpi/pkg/fsutil"
 )
 
+func OptionsFromConfig(cfg *config.Config) RunnerOptions {
+	return buildRunnerOptions(cfg, executil.DefaultRunner{}, fsutil.OSFS{})
+}
+
 func buildRunnerOptions(cfg *config.Config, runner executil.Runner, fs fsutil.FS) RunnerOptions {
 	paths := cfg.Paths
 	suricata := cfg.Suricata
@@ -23,9 +29,22 @@ func buildRunnerOptions(cfg *config.Config, runner executil.Runner, fs fsutil.FS
 
 			SystemctlPath:   sys.Systemctl,
 			SuricataService: sys.SuricataService,
+			SystemdBackend:  sys.SystemdBackend,
+
+			ReloadCommand:      reload.Command,
+			ReloadTimeout:      reload.Timeout,
+			ReloadPollInterval: reload.PollInterval,
+
+			NDPIPluginPath:       paths.NDPIPluginPath,
+			RulesLocalDir:        paths.NDPIRulesLocal,
+			RulesDeployDir:       paths.SuricataRulesDir,
+			RulesValidateTimeout: cfg.Rules.ValidateTimeout,
+			BundlePublicKeys:     cfg.Rules.BundlePublicKeys,
+
+			RuleOverrides:          ruleOverridesFromConfig(cfg.Rules.Overrides),
+			RuleOverridesStatePath: cfg.Rules.OverridesStatePath,
+			RulesRollbackDir:       rulesRollbackDir(cfg.State.Dir),
 
-			ReloadCommand: reload.Command,
-			ReloadTimeout: reload.Timeout,
 			CommandRunner: runner,
 			FS:            fs,
 		},
@@ -43,7 +62,24 @@ func buildRunnerOptions(cfg *config.Config, runner executil.Runner, fs fsutil.FS
 			SocketCandidates: suricata.SocketCandidates,
 			SystemctlPath:    cfg.System.Systemctl,
 			SystemdUnit:      cfg.System.SuricataService,
+			SystemdBackend:   cfg.System.SystemdBackend,
 			StartTimeout:     suricata.StartTimeout,
 		},
+		PcapTests: PcapTestOptions{
+			SuricataBinPath: paths.SuricataBin,
+			NDPIPluginPath:  paths.NDPIPluginPath,
+			RulesDir:        paths.NDPIRulesLocal,
+			TestsDir:        cfg.Rules.TestsDir,
+			Timeout:         cfg.Rules.TestTimeout,
+			CommandRunner:   runner,
+			FS:              fs,
+		},
+	}
+}
+
+func rulesRollbackDir(stateDir string) string {
+	if stateDir == "" {
+		return ""
 	}
+	return filepath.Join(stateDir, "rules-previous")
 }
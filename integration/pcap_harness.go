@@ -0,0 +1,320 @@
+package integration
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	yaml "gopkg.in/yaml.v3"
+
+	"integration-suricata-ndpi/pkg/executil"
+	"integration-suricata-ndpi/pkg/fsutil"
+	"integration-suricata-ndpi/pkg/logger"
+)
+
+const defaultPcapTestTimeout = 2 * time.Minute
+
+type PcapTestOptions struct {
+	SuricataBinPath string
+	NDPIPluginPath  string
+	RulesDir        string
+	TestsDir        string
+	Timeout         time.Duration
+
+	CommandRunner executil.Runner
+	FS            fsutil.FS
+}
+
+// PcapExpectations is the per-pcap expectations file (<name>.yaml next to <name>.pcap).
+type PcapExpectations struct {
+	Description   string   `yaml:"description" json:"description,omitempty"`
+	ExpectedSIDs  []uint64 `yaml:"expected_sids" json:"expected_sids,omitempty"`
+	ForbiddenSIDs []uint64 `yaml:"forbidden_sids" json:"forbidden_sids,omitempty"`
+}
+
+type PcapCaseResult struct {
+	Name         string            `json:"name"`
+	Pcap         string            `json:"pcap"`
+	Expectations *PcapExpectations `json:"expectations,omitempty"`
+
+	AlertedSIDs  []uint64 `json:"alerted_sids,omitempty"`
+	MissingSIDs  []uint64 `json:"missing_sids,omitempty"`
+	ForbiddenHit []uint64 `json:"forbidden_hit,omitempty"`
+
+	Passed   bool   `json:"passed"`
+	Skipped  bool   `json:"skipped,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Output   string `json:"output,omitempty"`
+	Duration string `json:"duration"`
+}
+
+type PcapTestReport struct {
+	RulesDir  string           `json:"rules_dir"`
+	TestsDir  string           `json:"tests_dir"`
+	RuleFiles []string         `json:"rule_files"`
+	Cases     []PcapCaseResult `json:"cases"`
+
+	Total    int    `json:"total"`
+	Passed   int    `json:"passed"`
+	Failed   int    `json:"failed"`
+	Skipped  int    `json:"skipped"`
+	Duration string `json:"duration"`
+
+	FinishedAt string `json:"finished_at"`
+}
+
+func (r PcapTestReport) OK() bool { return r.Failed == 0 }
+
+func RunPcapTests(ctx context.Context, opts PcapTestOptions) (rep PcapTestReport, err error) {
+	fs := opts.FS
+	if fs == nil {
+		fs = fsutil.OSFS{}
+	}
+	runner := opts.CommandRunner
+	if runner == nil {
+		runner = executil.DefaultRunner{}
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	suricataBin := strings.TrimSpace(opts.SuricataBinPath)
+	if suricataBin == "" {
+		suricataBin = "suricata"
+	}
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = defaultPcapTestTimeout
+	}
+
+	rep = PcapTestReport{
+		RulesDir: opts.RulesDir,
+		TestsDir: opts.TestsDir,
+	}
+	started := time.Now()
+	defer func() {
+		rep.Duration = time.Since(started).Round(time.Millisecond).String()
+		rep.FinishedAt = time.Now().UTC().Format(time.RFC3339)
+	}()
+
+	if err := mustBeDir(opts.TestsDir, "pcap tests directory", fs); err != nil {
+		return rep, err
+	}
+
+	ruleFiles, err := ListRuleFiles(opts.RulesDir, fs)
+	if err != nil {
+		return rep, err
+	}
+	if len(ruleFiles) == 0 {
+		return rep, fmt.Errorf("no *.rules files found in %s", opts.RulesDir)
+	}
+	rep.RuleFiles = ruleFiles
+
+	pcaps, err := listPcaps(opts.TestsDir, fs)
+	if err != nil {
+		return rep, err
+	}
+	if len(pcaps) == 0 {
+		logger.Warnw("No pcap fixtures found", "tests_dir", opts.TestsDir)
+		return rep, nil
+	}
+
+	sb, err := newRuleSandbox(ruleSandboxOptions{
+		NDPIPluginPath: opts.NDPIPluginPath,
+		RuleFiles:      ruleFiles,
+		EVELog:         true,
+		FS:             fs,
+	})
+	if err != nil {
+		return rep, err
+	}
+	defer func() { _ = sb.Close() }()
+
+	for _, pcap := range pcaps {
+		if err := ctx.Err(); err != nil {
+			return rep, err
+		}
+
+		res := runPcapCase(ctx, runner, fs, suricataBin, sb, pcap, timeout)
+
+		rep.Total++
+		switch {
+		case res.Skipped:
+			rep.Skipped++
+		case res.Passed:
+			rep.Passed++
+		default:
+			rep.Failed++
+		}
+		rep.Cases = append(rep.Cases, res)
+
+		logger.Infow("Pcap test finished",
+			"name", res.Name,
+			"passed", res.Passed,
+			"skipped", res.Skipped,
+			"missing_sids", res.MissingSIDs,
+			"forbidden_hit", res.ForbiddenHit,
+			"error", res.Error,
+		)
+	}
+
+	return rep, nil
+}
+
+func runPcapCase(ctx context.Context, runner executil.Runner, fs fsutil.FS, suricataBin string, sb *ruleSandbox, pcap string, timeout time.Duration) (res PcapCaseResult) {
+	name := strings.TrimSuffix(filepath.Base(pcap), filepath.Ext(pcap))
+	res = PcapCaseResult{Name: name, Pcap: pcap}
+
+	started := time.Now()
+	defer func() { res.Duration = time.Since(started).Round(time.Millisecond).String() }()
+
+	exp, err := loadPcapExpectations(pcap, fs)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			res.Skipped = true
+			res.Error = "no expectations file"
+			return res
+		}
+		res.Error = err.Error()
+		return res
+	}
+	res.Expectations = exp
+
+	logDir := filepath.Join(sb.LogDir, name)
+	if err := os.MkdirAll(logDir, 0o755); err != nil {
+		res.Error = fmt.Sprintf("create log dir: %v", err)
+		return res
+	}
+
+	rctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	out, rerr := runner.CombinedOutput(rctx, suricataBin,
+		"-c", sb.ConfigPath,
+		"-r", pcap,
+		"-l", logDir,
+		"-k", "none",
+		"--runmode", "single",
+	)
+	res.Output = strings.TrimSpace(string(out))
+
+	if errors.Is(rctx.Err(), context.DeadlineExceeded) {
+		res.Error = fmt.Sprintf("suricata -r timed out after %s", timeout)
+		return res
+	}
+	if rerr != nil {
+		res.Error = fmt.Sprintf("suricata -r failed: %v", rerr)
+		return res
+	}
+
+	alerted, err := readEVEAlertSIDs(filepath.Join(logDir, "eve.json"), fs)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	res.AlertedSIDs = sortedSIDs(alerted)
+
+	for _, sid := range exp.ExpectedSIDs {
+		if _, ok := alerted[sid]; !ok {
+			res.MissingSIDs = append(res.MissingSIDs, sid)
+		}
+	}
+	for _, sid := range exp.ForbiddenSIDs {
+		if _, ok := alerted[sid]; ok {
+			res.ForbiddenHit = append(res.ForbiddenHit, sid)
+		}
+	}
+
+	res.Passed = len(res.MissingSIDs) == 0 && len(res.ForbiddenHit) == 0
+	return res
+}
+
+func listPcaps(dir string, fs fsutil.FS) ([]string, error) {
+	var out []string
+	for _, pattern := range []string{"*.pcap", "*.pcapng"} {
+		files, err := fs.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, fmt.Errorf("list pcaps in %s: %w", dir, err)
+		}
+		out = append(out, files...)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+func loadPcapExpectations(pcap string, fs fsutil.FS) (*PcapExpectations, error) {
+	base := strings.TrimSuffix(pcap, filepath.Ext(pcap))
+
+	var lastErr error
+	for _, ext := range []string{".yaml", ".yml"} {
+		p := base + ext
+		raw, err := fs.ReadFile(p)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		var exp PcapExpectations
+		if err := yaml.Unmarshal(raw, &exp); err != nil {
+			return nil, fmt.Errorf("parse expectations %s: %w", p, err)
+		}
+		return &exp, nil
+	}
+	return nil, lastErr
+}
+
+func readEVEAlertSIDs(path string, fs fsutil.FS) (map[uint64]struct{}, error) {
+	out := make(map[uint64]struct{})
+
+	raw, err := fs.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return out, nil
+		}
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+
+	var ev struct {
+		EventType string `json:"event_type"`
+		Alert     struct {
+			SignatureID uint64 `json:"signature_id"`
+		} `json:"alert"`
+	}
+
+	sc := bufio.NewScanner(bytes.NewReader(raw))
+	sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		ev.EventType = ""
+		ev.Alert.SignatureID = 0
+		if err := json.Unmarshal(line, &ev); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", path, err)
+		}
+		if ev.EventType == "alert" && ev.Alert.SignatureID != 0 {
+			out[ev.Alert.SignatureID] = struct{}{}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("scan %s: %w", path, err)
+	}
+	return out, nil
+}
+
+func sortedSIDs(set map[uint64]struct{}) []uint64 {
+	out := make([]uint64, 0, len(set))
+	for sid := range set {
+		out = append(out, sid)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
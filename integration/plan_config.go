@@ -17,6 +17,9 @@ type PlanReport struct {
 	CurrentBytes int `json:"current_bytes"`
 	PatchedBytes int `json:"patched_bytes"`
 
+	RuleFiles        []string `json:"rule_files,omitempty"`
+	RuleFilesChanged bool     `json:"rule_files_changed"`
+
 	WouldChange     bool `json:"would_change"`
 	RestartRequired bool `json:"restart_required"`
 }
@@ -40,12 +43,12 @@ func PlanConfig(ctx context.Context, opts ApplyConfigOptions) (PlanReport, error
 
 	rendered, _, err := RenderTemplateStrict(tpl)
 	if err != nil {
-		return rep, fmt.Errorf("failed to render template %s: %w", opts.TemplatePath, err)
+		return rep, ErrTemplateRender.Wrap(fmt.Errorf("render template %s: %w", opts.TemplatePath, err))
 	}
 
 	target, err := FirstExistingPath(opts.ConfigCandidates)
 	if err != nil {
-		return rep, fmt.Errorf("suricata.yaml not found in candidates: %w", err)
+		return rep, ErrConfigNotFound.Wrap(err)
 	}
 	rep.TargetConfigPath = target
 
@@ -58,6 +61,13 @@ func PlanConfig(ctx context.Context, opts ApplyConfigOptions) (PlanReport, error
 	if err != nil {
 		return rep, fmt.Errorf("failed to patch config %s: %w", target, err)
 	}
+	patched, ruleFiles, ruleFilesChanged, err := patchRuleFilesFromDeployDir(patched, opts, fs)
+	if err != nil {
+		return rep, fmt.Errorf("failed to patch rule-files in %s: %w", target, err)
+	}
+	rep.RuleFiles = ruleFiles
+	rep.RuleFilesChanged = ruleFilesChanged
+	changed = changed || ruleFilesChanged
 
 	rep.CurrentBytes = len(current)
 	rep.PatchedBytes = len(patched)
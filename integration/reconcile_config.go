@@ -3,6 +3,7 @@ package integration
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -11,6 +12,7 @@ import (
 	"integration-suricata-ndpi/pkg/executil"
 	"integration-suricata-ndpi/pkg/fsutil"
 	"integration-suricata-ndpi/pkg/logger"
+	"integration-suricata-ndpi/pkg/systemd"
 )
 
 type ReconcileReport struct {
@@ -23,6 +25,9 @@ type ReconcileReport struct {
 	CurrentBytes int `json:"current_bytes"`
 	PatchedBytes int `json:"patched_bytes"`
 
+	RuleFiles        []string `json:"rule_files,omitempty"`
+	RuleFilesChanged bool     `json:"rule_files_changed"`
+
 	WouldChange      bool `json:"would_change"`
 	Applied          bool `json:"applied"`
 	Validated        bool `json:"validated"`
@@ -53,12 +58,12 @@ func ReconcileConfig(ctx context.Context, opts ApplyConfigOptions) (ReconcileRep
 	}
 	rendered, _, err := RenderTemplateStrict(tpl)
 	if err != nil {
-		return rep, fmt.Errorf("render template %s: %w", opts.TemplatePath, err)
+		return rep, ErrTemplateRender.Wrap(fmt.Errorf("render template %s: %w", opts.TemplatePath, err))
 	}
 
 	target, err := FirstExistingPath(opts.ConfigCandidates)
 	if err != nil {
-		return rep, fmt.Errorf("suricata.yaml not found: %w", err)
+		return rep, ErrConfigNotFound.Wrap(err)
 	}
 	rep.TargetConfigPath = target
 
@@ -71,6 +76,13 @@ func ReconcileConfig(ctx context.Context, opts ApplyConfigOptions) (ReconcileRep
 	if err != nil {
 		return rep, fmt.Errorf("patch config %s: %w", target, err)
 	}
+	patched, ruleFiles, ruleFilesChanged, err := patchRuleFilesFromDeployDir(patched, opts, fs)
+	if err != nil {
+		return rep, fmt.Errorf("patch rule-files in %s: %w", target, err)
+	}
+	rep.RuleFiles = ruleFiles
+	rep.RuleFilesChanged = ruleFilesChanged
+	changed = changed || ruleFilesChanged
 
 	rep.CurrentBytes = len(current)
 	rep.PatchedBytes = len(patched)
@@ -105,11 +117,12 @@ func ReconcileConfig(ctx context.Context, opts ApplyConfigOptions) (ReconcileRep
 	vctx, cancel := context.WithTimeout(vctx, 30*time.Second)
 	defer cancel()
 
+	jobStep(vctx, "suricata.yaml patched, validating with suricata -T")
 	out, verr := runner.CombinedOutput(vctx, suricataBin, "-T", "-c", tmpPath)
 	vout := strings.TrimSpace(string(out))
 	if verr != nil {
 		_ = fs.Remove(tmpPath)
-		return rep, fmt.Errorf("suricata -T failed; config NOT applied. err=%v output=%q", verr, vout)
+		return rep, ErrConfigInvalid.Wrap(fmt.Errorf("err=%v output=%q", verr, vout)).WithDetails(map[string]string{"output": vout})
 	}
 	rep.Validated = true
 
@@ -120,29 +133,33 @@ func ReconcileConfig(ctx context.Context, opts ApplyConfigOptions) (ReconcileRep
 	_ = fs.Remove(tmpPath)
 	rep.Applied = true
 
-	systemctl := strings.TrimSpace(opts.SystemctlPath)
-	if systemctl == "" {
-		systemctl = "/usr/bin/systemctl"
-	}
 	unit := strings.TrimSpace(opts.SuricataService)
 	if unit == "" {
 		unit = "suricata"
 	}
 
-	rep.RestartCommand = fmt.Sprintf("%s restart %s", systemctl, unit)
+	rep.RestartCommand = fmt.Sprintf("systemd restart %s", unit)
 
 	logger.Infow("Suricata YAML patched & validated (-T), restarting service",
 		"path", target,
 		"cmd", rep.RestartCommand,
 	)
 
-	rctx, rcancel := context.WithTimeout(ctx, 60*time.Second)
-	defer rcancel()
-
-	rout, rerr := runner.CombinedOutput(rctx, systemctl, "restart", unit)
-	rep.RestartOutput = strings.TrimSpace(string(rout))
-	if rerr != nil {
-		return rep, fmt.Errorf("suricata restart failed: err=%v output=%q", rerr, rep.RestartOutput)
+	jobStep(ctx, "config written to %s, restarting %s", target, unit)
+	mgr := opts.Systemd
+	if mgr == nil {
+		m, err := systemd.New(ctx, opts.SystemdBackend, opts.SystemctlPath, runner)
+		if err != nil {
+			return rep, ErrRestartFailed.Wrap(err)
+		}
+		if c, ok := m.(io.Closer); ok {
+			defer c.Close()
+		}
+		mgr = m
+	}
+	if rerr := mgr.Restart(ctx, unit, 60*time.Second); rerr != nil {
+		rep.RestartOutput = rerr.Error()
+		return rep, ErrRestartFailed.Wrap(rerr)
 	}
 	rep.RestartPerformed = true
 
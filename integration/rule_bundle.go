@@ -0,0 +1,431 @@
+package integration
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"integration-suricata-ndpi/pkg/fsutil"
+	"integration-suricata-ndpi/pkg/logger"
+	"integration-suricata-ndpi/pkg/rules"
+)
+
+const (
+	bundleManifestName  = "manifest.json"
+	bundleSignatureName = "manifest.json.sig"
+	bundleRulesPrefix   = "rules/"
+
+	// MaxRuleBundleSize bounds both the uploaded archive and its unpacked content.
+	MaxRuleBundleSize = 64 << 20
+
+	bundleProvenanceName = "bundle.json"
+)
+
+type RuleBundleFile struct {
+	Name   string `json:"name"`
+	SHA256 string `json:"sha256"`
+	Rules  int    `json:"rules"`
+}
+
+type RuleBundleManifest struct {
+	Version   string           `json:"version"`
+	CreatedAt string           `json:"created_at,omitempty"`
+	RuleCount int              `json:"rule_count"`
+	Files     []RuleBundleFile `json:"files"`
+}
+
+// AppliedRuleBundle is what an apply reports, and what is recorded next to the
+// deployed rules, for a verified bundle.
+type AppliedRuleBundle struct {
+	Manifest  RuleBundleManifest `json:"manifest"`
+	SHA256    string             `json:"sha256"`
+	KeyID     string             `json:"key_id"`
+	AppliedAt string             `json:"applied_at,omitempty"`
+}
+
+type RuleBundle struct {
+	Manifest RuleBundleManifest
+	SHA256   string
+	KeyID    string
+	Files    map[string][]byte
+}
+
+type BundleRejectedError struct {
+	Reason string
+	File   string
+}
+
+func (e *BundleRejectedError) Error() string {
+	if e.File != "" {
+		return fmt.Sprintf("rule bundle rejected: %s: %s", e.File, e.Reason)
+	}
+	return "rule bundle rejected: " + e.Reason
+}
+
+func (e *BundleRejectedError) HTTPStatus() int { return 422 }
+
+func (e *BundleRejectedError) Details() any {
+	return map[string]string{"reason": e.Reason, "file": e.File}
+}
+
+func rejectBundle(file, format string, args ...any) error {
+	return &BundleRejectedError{Reason: fmt.Sprintf(format, args...), File: file}
+}
+
+func BundleKeyID(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
+
+func ParseBundlePublicKeys(encoded []string) ([]ed25519.PublicKey, error) {
+	out := make([]ed25519.PublicKey, 0, len(encoded))
+	for i, s := range encoded {
+		raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+		if err != nil || len(raw) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("bundle public key #%d is not a base64 Ed25519 public key", i)
+		}
+		out = append(out, ed25519.PublicKey(raw))
+	}
+	return out, nil
+}
+
+// ParseBundlePrivateKey accepts a base64 Ed25519 seed (32 bytes) or full private key (64 bytes).
+func ParseBundlePrivateKey(encoded string) (ed25519.PrivateKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("bundle private key is not base64: %w", err)
+	}
+	switch len(raw) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(raw), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(raw), nil
+	default:
+		return nil, fmt.Errorf("bundle private key has %d bytes, want %d or %d", len(raw), ed25519.SeedSize, ed25519.PrivateKeySize)
+	}
+}
+
+func GenerateBundleKey() (pub, priv string, err error) {
+	pk, sk, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	return base64.StdEncoding.EncodeToString(pk), base64.StdEncoding.EncodeToString(sk.Seed()), nil
+}
+
+// BuildRuleBundle writes a signed tar.gz with manifest.json, manifest.json.sig
+// and the rule files under rules/.
+func BuildRuleBundle(w io.Writer, ruleFiles []string, version string, key ed25519.PrivateKey, fs fsutil.FS) (RuleBundleManifest, error) {
+	if fs == nil {
+		fs = fsutil.OSFS{}
+	}
+
+	m := RuleBundleManifest{
+		Version:   version,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+	if strings.TrimSpace(version) == "" {
+		return m, fmt.Errorf("bundle version is empty")
+	}
+	if len(ruleFiles) == 0 {
+		return m, fmt.Errorf("no rule files to bundle")
+	}
+
+	contents := make(map[string][]byte, len(ruleFiles))
+	for _, p := range ruleFiles {
+		name := filepath.Base(p)
+		if _, dup := contents[name]; dup {
+			return m, fmt.Errorf("duplicate rule file name %s", name)
+		}
+		data, err := fs.ReadFile(p)
+		if err != nil {
+			return m, fmt.Errorf("read rule file %s: %w", p, err)
+		}
+		n, err := countBundleRules(name, data)
+		if err != nil {
+			return m, err
+		}
+		contents[name] = data
+		m.Files = append(m.Files, RuleBundleFile{Name: name, SHA256: sha256Hex(data), Rules: n})
+		m.RuleCount += n
+	}
+	sort.Slice(m.Files, func(i, j int) bool { return m.Files[i].Name < m.Files[j].Name })
+
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return m, err
+	}
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(key, manifest))
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	add := func(name string, data []byte) error {
+		hdr := &tar.Header{Name: name, Mode: 0o644, Size: int64(len(data)), ModTime: time.Now()}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+
+	if err := add(bundleManifestName, manifest); err != nil {
+		return m, err
+	}
+	if err := add(bundleSignatureName, []byte(sig+"\n")); err != nil {
+		return m, err
+	}
+	for _, f := range m.Files {
+		if err := add(bundleRulesPrefix+f.Name, contents[f.Name]); err != nil {
+			return m, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return m, err
+	}
+	return m, gz.Close()
+}
+
+// OpenRuleBundle unpacks a bundle in memory and checks, in order: the manifest
+// signature against the trusted keys, the file set and SHA-256 of every rule
+// file, and the rule counts. Nothing is written to disk.
+func OpenRuleBundle(data []byte, keys []ed25519.PublicKey) (*RuleBundle, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no trusted bundle public keys configured (rules.bundle_public_keys)")
+	}
+	if len(data) > MaxRuleBundleSize {
+		return nil, rejectBundle("", "bundle exceeds %d bytes", MaxRuleBundleSize)
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, rejectBundle("", "not a gzip archive: %v", err)
+	}
+	defer gz.Close()
+
+	var (
+		manifest  []byte
+		signature []byte
+		files     = make(map[string][]byte)
+		total     int64
+	)
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, rejectBundle("", "corrupt tar archive: %v", err)
+		}
+		if hdr.Typeflag == tar.TypeDir {
+			continue
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			return nil, rejectBundle(hdr.Name, "unsupported entry type")
+		}
+
+		total += hdr.Size
+		if total > MaxRuleBundleSize {
+			return nil, rejectBundle(hdr.Name, "unpacked bundle exceeds %d bytes", MaxRuleBundleSize)
+		}
+		body, err := io.ReadAll(io.LimitReader(tr, hdr.Size))
+		if err != nil {
+			return nil, rejectBundle(hdr.Name, "read entry: %v", err)
+		}
+
+		name := path.Clean(strings.TrimPrefix(hdr.Name, "./"))
+		switch {
+		case name == bundleManifestName:
+			manifest = body
+		case name == bundleSignatureName:
+			signature = body
+		case strings.HasPrefix(name, bundleRulesPrefix):
+			base := strings.TrimPrefix(name, bundleRulesPrefix)
+			if strings.Contains(base, "/") || !strings.HasSuffix(base, ".rules") {
+				return nil, rejectBundle(hdr.Name, "only rules/*.rules entries are allowed")
+			}
+			if _, dup := files[base]; dup {
+				return nil, rejectBundle(hdr.Name, "duplicate entry")
+			}
+			files[base] = body
+		default:
+			return nil, rejectBundle(hdr.Name, "unexpected entry")
+		}
+	}
+
+	if manifest == nil {
+		return nil, rejectBundle(bundleManifestName, "missing")
+	}
+	if signature == nil {
+		return nil, rejectBundle(bundleSignatureName, "missing")
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return nil, rejectBundle(bundleSignatureName, "not a base64 Ed25519 signature")
+	}
+
+	var keyID string
+	for _, k := range keys {
+		if ed25519.Verify(k, manifest, sig) {
+			keyID = BundleKeyID(k)
+			break
+		}
+	}
+	if keyID == "" {
+		return nil, rejectBundle(bundleSignatureName, "signature does not match any trusted key")
+	}
+
+	b := &RuleBundle{SHA256: sha256Hex(data), KeyID: keyID, Files: files}
+	if err := json.Unmarshal(manifest, &b.Manifest); err != nil {
+		return nil, rejectBundle(bundleManifestName, "invalid json: %v", err)
+	}
+	if err := verifyBundleContents(b.Manifest, files); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func verifyBundleContents(m RuleBundleManifest, files map[string][]byte) error {
+	if strings.TrimSpace(m.Version) == "" {
+		return rejectBundle(bundleManifestName, "version is empty")
+	}
+	if len(m.Files) == 0 {
+		return rejectBundle(bundleManifestName, "no files listed")
+	}
+
+	listed := make(map[string]struct{}, len(m.Files))
+	total := 0
+	for _, f := range m.Files {
+		listed[f.Name] = struct{}{}
+		data, ok := files[f.Name]
+		if !ok {
+			return rejectBundle(bundleRulesPrefix+f.Name, "listed in manifest but missing from bundle")
+		}
+		if got := sha256Hex(data); !strings.EqualFold(got, f.SHA256) {
+			return rejectBundle(bundleRulesPrefix+f.Name, "sha256 mismatch: manifest %s, content %s", f.SHA256, got)
+		}
+		n, err := countBundleRules(f.Name, data)
+		if err != nil {
+			return rejectBundle(bundleRulesPrefix+f.Name, "%v", err)
+		}
+		if n != f.Rules {
+			return rejectBundle(bundleRulesPrefix+f.Name, "manifest lists %d rules, file has %d", f.Rules, n)
+		}
+		total += n
+	}
+	for name := range files {
+		if _, ok := listed[name]; !ok {
+			return rejectBundle(bundleRulesPrefix+name, "not listed in manifest")
+		}
+	}
+	if total != m.RuleCount {
+		return rejectBundle(bundleManifestName, "rule_count is %d, files have %d", m.RuleCount, total)
+	}
+	return nil
+}
+
+func countBundleRules(name string, data []byte) (int, error) {
+	parsed, perrs, err := rules.ParseReader(bytes.NewReader(data), name)
+	if err != nil {
+		return 0, err
+	}
+	if len(perrs) > 0 {
+		return 0, perrs[0]
+	}
+	n := 0
+	for _, r := range parsed {
+		if !r.Disabled {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// ApplyRuleBundle verifies the bundle, unpacks it into a temporary directory
+// and runs the regular apply with it as the local rule set.
+func ApplyRuleBundle(ctx context.Context, opts ApplyConfigOptions, data []byte) (ApplyConfigReport, error) {
+	if strings.TrimSpace(opts.RulesDeployDir) == "" {
+		return ApplyConfigReport{}, fmt.Errorf("paths.suricata_rules_dir is empty: cannot deploy a rule bundle")
+	}
+
+	keys, err := ParseBundlePublicKeys(opts.BundlePublicKeys)
+	if err != nil {
+		return ApplyConfigReport{}, err
+	}
+	b, err := OpenRuleBundle(data, keys)
+	if err != nil {
+		logger.Warnw("Rule bundle rejected", "error", err)
+		return ApplyConfigReport{}, err
+	}
+
+	fs := opts.FS
+	if fs == nil {
+		fs = fsutil.OSFS{}
+	}
+	dir, err := fs.MkdirTemp("", "rule-bundle-")
+	if err != nil {
+		return ApplyConfigReport{}, fmt.Errorf("create bundle dir: %w", err)
+	}
+	defer func() { _ = fs.RemoveAll(dir) }()
+
+	for name, content := range b.Files {
+		if err := fs.WriteFile(filepath.Join(dir, name), content, 0o644); err != nil {
+			return ApplyConfigReport{}, fmt.Errorf("unpack bundle file %s: %w", name, err)
+		}
+	}
+
+	logger.Infow("Rule bundle verified",
+		"version", b.Manifest.Version,
+		"key_id", b.KeyID,
+		"files", len(b.Manifest.Files),
+		"rules", b.Manifest.RuleCount,
+	)
+
+	opts.RulesLocalDir = dir
+	opts.Bundle = &AppliedRuleBundle{
+		Manifest: b.Manifest,
+		SHA256:   b.SHA256,
+		KeyID:    b.KeyID,
+	}
+	return ApplyConfigWithContext(ctx, opts)
+}
+
+// writeBundleProvenance records which bundle the deployed rules came from;
+// a deploy from the plain local directory removes the record.
+func writeBundleProvenance(deployDir string, b *AppliedRuleBundle, fs fsutil.FS) error {
+	if fs == nil {
+		fs = fsutil.OSFS{}
+	}
+	p := filepath.Join(deployDir, bundleProvenanceName)
+
+	if b == nil {
+		if err := fs.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+
+	b.AppliedAt = time.Now().UTC().Format(time.RFC3339)
+	raw, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(p, append(raw, '\n'), 0o644, fs)
+}
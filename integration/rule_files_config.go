@@ -0,0 +1,135 @@
+package integration
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"integration-suricata-ndpi/pkg/fsutil"
+)
+
+// PatchSuricataRuleFiles makes the rule-files list load exactly the given files
+// from deployDir, by absolute path. Entries outside deployDir (suricata.rules,
+// manual rules) are kept; entries inside it, including globs such as
+// <deployDir>/*.rules, are replaced by the explicit list.
+func PatchSuricataRuleFiles(current []byte, deployDir string, files []string) ([]byte, bool, error) {
+	lines := splitLines(current)
+	deployDir = filepath.Clean(deployDir)
+
+	want := make([]string, 0, len(files))
+	for _, f := range files {
+		want = append(want, filepath.Join(deployDir, filepath.Base(f)))
+	}
+
+	for _, line := range lines {
+		key := normalizeKey(line)
+		if indentWidth(line) == 0 && !isCommented(line) && strings.HasPrefix(key, "rule-files:") && key != "rule-files:" {
+			return nil, false, fmt.Errorf("rule-files in flow style is not supported: %q", strings.TrimSpace(line))
+		}
+	}
+
+	rulePath := topLevelScalar(lines, "default-rule-path")
+	managed := func(entry string) bool {
+		if !filepath.IsAbs(entry) {
+			if rulePath == "" {
+				return false
+			}
+			entry = filepath.Join(rulePath, entry)
+		}
+		return filepath.Dir(filepath.Clean(entry)) == deployDir
+	}
+
+	start, end, base, found := findBlockRange(lines, "rule-files")
+	if !found {
+		if len(want) == 0 {
+			return current, false, nil
+		}
+		out := trimTrailingEmpty(lines)
+		out = append(out, "", "rule-files:")
+		for _, p := range want {
+			out = append(out, "  - "+p)
+		}
+		return joinLines(out), true, nil
+	}
+
+	body := lines[start+1 : end]
+	trimmed := trimTrailingEmpty(body)
+	trailing := body[len(trimmed):]
+	body = trimmed
+
+	itemIndent := strings.Repeat(" ", base+2)
+	block := []string{uncommentLine(lines[start])}
+	for _, line := range body {
+		trim := strings.TrimSpace(line)
+		if strings.HasPrefix(trim, "-") {
+			itemIndent = line[:indentWidth(line)]
+			entry := strings.Trim(strings.TrimSpace(strings.TrimPrefix(trim, "-")), `"'`)
+			if managed(entry) {
+				continue
+			}
+		}
+		block = append(block, line)
+	}
+	for _, p := range want {
+		block = append(block, itemIndent+"- "+p)
+	}
+	block = append(block, trailing...)
+
+	if sliceEqual(lines[start:end], block) {
+		return current, false, nil
+	}
+	out := make([]string, 0, len(lines)-(end-start)+len(block))
+	out = append(out, lines[:start]...)
+	out = append(out, block...)
+	out = append(out, lines[end:]...)
+	return joinLines(out), true, nil
+}
+
+// patchRuleFilesFromDeployDir applies PatchSuricataRuleFiles with the rule
+// files currently deployed; it is a no-op when no deploy dir is configured.
+func patchRuleFilesFromDeployDir(cfg []byte, opts ApplyConfigOptions, fs fsutil.FS) ([]byte, []string, bool, error) {
+	deployDir := strings.TrimSpace(opts.RulesDeployDir)
+	if deployDir == "" {
+		return cfg, nil, false, nil
+	}
+	files, err := ListRuleFiles(deployDir, fs)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	patched, changed, err := PatchSuricataRuleFiles(cfg, deployDir, files)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	loaded := make([]string, 0, len(files))
+	for _, f := range files {
+		loaded = append(loaded, filepath.Join(filepath.Clean(deployDir), filepath.Base(f)))
+	}
+	return patched, loaded, changed, nil
+}
+
+func topLevelScalar(lines []string, key string) string {
+	prefix := key + ":"
+	for _, line := range lines {
+		if indentWidth(line) != 0 || !strings.HasPrefix(line, prefix) {
+			continue
+		}
+		v := strings.TrimSpace(strings.TrimPrefix(line, prefix))
+		if i := strings.Index(v, " #"); i >= 0 {
+			v = strings.TrimSpace(v[:i])
+		}
+		return strings.Trim(v, `"'`)
+	}
+	return ""
+}
+
+func trimTrailingEmpty(lines []string) []string {
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+func joinLines(lines []string) []byte {
+	return []byte(strings.Join(trimTrailingEmpty(lines), "\n") + "\n")
+}
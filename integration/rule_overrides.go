@@ -0,0 +1,213 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"integration-suricata-ndpi/internal/config"
+	"integration-suricata-ndpi/pkg/fsutil"
+	"integration-suricata-ndpi/pkg/rules"
+)
+
+const (
+	OverrideEnabled  = "enabled"
+	OverrideDisabled = "disabled"
+)
+
+type RuleOverride struct {
+	SID       uint64 `json:"sid"`
+	State     string `json:"state,omitempty"`
+	Action    string `json:"action,omitempty"`
+	Source    string `json:"source,omitempty"`
+	UpdatedAt string `json:"updated_at,omitempty"`
+}
+
+type AppliedRuleOverride struct {
+	SID    uint64 `json:"sid"`
+	File   string `json:"file"`
+	State  string `json:"state,omitempty"`
+	Action string `json:"action,omitempty"`
+}
+
+type RuleOverridesReport struct {
+	Applied   []AppliedRuleOverride `json:"applied,omitempty"`
+	Unmatched []uint64              `json:"unmatched,omitempty"`
+}
+
+type RuleNotFoundError struct {
+	SID uint64
+}
+
+func (e *RuleNotFoundError) Error() string {
+	return fmt.Sprintf("rule sid %d not found in local rules", e.SID)
+}
+
+func (e *RuleNotFoundError) HTTPStatus() int { return 404 }
+
+func (e *RuleNotFoundError) Details() any { return map[string]uint64{"sid": e.SID} }
+
+func ruleOverridesFromConfig(in []config.RuleOverrideConfig) []RuleOverride {
+	out := make([]RuleOverride, 0, len(in))
+	for _, o := range in {
+		out = append(out, RuleOverride{SID: o.SID, State: o.State, Action: o.Action, Source: "config"})
+	}
+	return out
+}
+
+func LoadRuleOverrides(path string, fs fsutil.FS) ([]RuleOverride, error) {
+	if fs == nil {
+		fs = fsutil.OSFS{}
+	}
+	if strings.TrimSpace(path) == "" {
+		return nil, nil
+	}
+
+	raw, err := fs.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read rule overrides %s: %w", path, err)
+	}
+	var out []RuleOverride
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return nil, fmt.Errorf("parse rule overrides %s: %w", path, err)
+	}
+	return out, nil
+}
+
+func SaveRuleOverrides(path string, list []RuleOverride, fs fsutil.FS) error {
+	if strings.TrimSpace(path) == "" {
+		return fmt.Errorf("rules.overrides_state_path is empty")
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].SID < list[j].SID })
+
+	b, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	if fs == nil {
+		fs = fsutil.OSFS{}
+	}
+	if err := fs.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, append(b, '\n'), 0o644, fs)
+}
+
+// SetRuleOverride updates the persisted override for sid. An override left with
+// neither state nor action is dropped.
+func SetRuleOverride(path string, sid uint64, state, action string, fs fsutil.FS) (RuleOverride, error) {
+	list, err := LoadRuleOverrides(path, fs)
+	if err != nil {
+		return RuleOverride{}, err
+	}
+
+	var cur RuleOverride
+	kept := list[:0]
+	for _, o := range list {
+		if o.SID == sid {
+			cur = o
+			continue
+		}
+		kept = append(kept, o)
+	}
+
+	cur.SID = sid
+	cur.Source = "api"
+	cur.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	if state != "" {
+		cur.State = state
+	}
+	if action != "" {
+		cur.Action = action
+	}
+	if cur.State != "" || cur.Action != "" {
+		kept = append(kept, cur)
+	}
+
+	return cur, SaveRuleOverrides(path, kept, fs)
+}
+
+// MergeRuleOverrides layers persisted (API) overrides over the config ones,
+// field by field.
+func MergeRuleOverrides(base, state []RuleOverride) map[uint64]RuleOverride {
+	out := make(map[uint64]RuleOverride, len(base)+len(state))
+	for _, layer := range [][]RuleOverride{base, state} {
+		for _, o := range layer {
+			cur, ok := out[o.SID]
+			if !ok {
+				out[o.SID] = o
+				continue
+			}
+			if o.State != "" {
+				cur.State = o.State
+			}
+			if o.Action != "" {
+				cur.Action = o.Action
+			}
+			cur.Source = o.Source
+			cur.UpdatedAt = o.UpdatedAt
+			out[o.SID] = cur
+		}
+	}
+	return out
+}
+
+func (o RuleOverride) apply(r *rules.Rule) (*rules.Rule, bool) {
+	out := r.Clone()
+	switch o.State {
+	case OverrideDisabled:
+		out.Disabled = true
+	case OverrideEnabled:
+		out.Disabled = false
+	}
+	if o.Action != "" {
+		out.Action = o.Action
+	}
+	return out, out.Disabled != r.Disabled || out.Action != r.Action
+}
+
+// ApplyRuleOverrides rewrites the rules of one file that have an override;
+// a rewritten rule is emitted on a single line, everything else is kept as is.
+func ApplyRuleOverrides(data []byte, file string, overrides map[uint64]RuleOverride) ([]byte, []AppliedRuleOverride, error) {
+	if len(overrides) == 0 {
+		return data, nil, nil
+	}
+
+	parsed, _, err := rules.ParseReader(bytes.NewReader(data), file)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	lines := strings.Split(string(data), "\n")
+	var applied []AppliedRuleOverride
+	for i := len(parsed) - 1; i >= 0; i-- {
+		r := parsed[i]
+		o, ok := overrides[r.SID()]
+		if !ok {
+			continue
+		}
+		applied = append(applied, AppliedRuleOverride{SID: r.SID(), File: file, State: o.State, Action: o.Action})
+
+		nr, changed := o.apply(r)
+		if !changed {
+			continue
+		}
+		// comment lines inside a multi-line rule go before the rewritten
+		// single-line rule, as rules.Format does
+		repl := append(append([]string(nil), nr.Comments...), nr.String())
+		rest := append(repl, lines[r.EndLine:]...)
+		lines = append(lines[:r.Line-1], rest...)
+	}
+
+	sort.Slice(applied, func(i, j int) bool { return applied[i].SID < applied[j].SID })
+	return []byte(strings.Join(lines, "\n")), applied, nil
+}
@@ -0,0 +1,255 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"integration-suricata-ndpi/pkg/executil"
+	"integration-suricata-ndpi/pkg/logger"
+)
+
+// NonblockingReloadCommand makes apply follow the reload through
+// ruleset-reload-time instead of waiting on the control socket; see RuleReload.
+const NonblockingReloadCommand = "ruleset-reload-nonblocking"
+
+const defaultReloadPollInterval = 500 * time.Millisecond
+
+// RuleReload is one ruleset-reload-nonblocking, followed until Suricata reports
+// a newer ruleset-reload-time.
+type RuleReload struct {
+	ID           string       `json:"id"`
+	Status       ReloadStatus `json:"status"`
+	Error        string       `json:"error,omitempty"`
+	StartedAt    time.Time    `json:"started_at"`
+	FinishedAt   *time.Time   `json:"finished_at,omitempty"`
+	Duration     string       `json:"duration,omitempty"`
+	LastReload   string       `json:"last_reload,omitempty"`
+	RulesLoaded  int          `json:"rules_loaded"`
+	RulesFailed  int          `json:"rules_failed"`
+	RulesSkipped int          `json:"rules_skipped"`
+}
+
+type ReloadNotFoundError struct {
+	ID string
+}
+
+func (e *ReloadNotFoundError) Error() string   { return fmt.Sprintf("rule reload %q not found", e.ID) }
+func (e *ReloadNotFoundError) HTTPStatus() int { return 404 }
+func (e *ReloadNotFoundError) Details() any    { return map[string]string{"id": e.ID} }
+
+// RuleReloadTracker keeps the most recent reloads so they can be polled by ID,
+// also while the apply job that started one is still waiting for it.
+type RuleReloadTracker struct {
+	mu      sync.Mutex
+	limit   int
+	reloads map[string]*RuleReload
+	order   []string
+}
+
+func NewRuleReloadTracker(limit int) *RuleReloadTracker {
+	if limit <= 0 {
+		limit = 32
+	}
+	return &RuleReloadTracker{limit: limit, reloads: make(map[string]*RuleReload)}
+}
+
+func (t *RuleReloadTracker) Get(id string) (RuleReload, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	rl, ok := t.reloads[id]
+	if !ok {
+		return RuleReload{}, &ReloadNotFoundError{ID: id}
+	}
+	return *rl, nil
+}
+
+// put records rl; a nil tracker ignores it.
+func (t *RuleReloadTracker) put(rl RuleReload) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.reloads[rl.ID]; !ok {
+		t.order = append(t.order, rl.ID)
+		if len(t.order) > t.limit {
+			delete(t.reloads, t.order[0])
+			t.order = t.order[1:]
+		}
+	}
+	t.reloads[rl.ID] = &rl
+}
+
+func newReloadID() string {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b[:])
+}
+
+type suricatascReply struct {
+	Return  string          `json:"return"`
+	Message json.RawMessage `json:"message"`
+}
+
+func suricatascCommand(ctx context.Context, runner executil.Runner, scPath, cmd string) (json.RawMessage, error) {
+	out, err := runner.CombinedOutput(ctx, scPath, "-c", cmd)
+	text := strings.TrimSpace(string(out))
+	if err != nil {
+		return nil, fmt.Errorf("suricatasc %s: %w (output=%q)", cmd, err, text)
+	}
+	var reply suricatascReply
+	if err := json.Unmarshal(bytes.TrimSpace(out), &reply); err != nil {
+		return nil, fmt.Errorf("suricatasc %s: unexpected output %q", cmd, text)
+	}
+	if reply.Return != "OK" {
+		return nil, fmt.Errorf("suricatasc %s: %s", cmd, strings.Trim(string(reply.Message), `"`))
+	}
+	return reply.Message, nil
+}
+
+type rulesetStats struct {
+	LastReload   string `json:"last_reload"`
+	RulesLoaded  int    `json:"rules_loaded"`
+	RulesFailed  int    `json:"rules_failed"`
+	RulesSkipped int    `json:"rules_skipped"`
+}
+
+// firstRulesetEntry decodes ruleset-reload-time/ruleset-stats replies, which
+// are a list with one entry per detect engine (a single object on some builds).
+func firstRulesetEntry(msg json.RawMessage) (rulesetStats, error) {
+	var list []rulesetStats
+	if err := json.Unmarshal(msg, &list); err == nil {
+		if len(list) == 0 {
+			return rulesetStats{}, fmt.Errorf("empty ruleset reply")
+		}
+		return list[0], nil
+	}
+	var one rulesetStats
+	if err := json.Unmarshal(msg, &one); err != nil {
+		return rulesetStats{}, fmt.Errorf("unexpected ruleset reply %s", msg)
+	}
+	return one, nil
+}
+
+func rulesetQuery(ctx context.Context, opts ApplyConfigOptions, cmd string) (rulesetStats, error) {
+	msg, err := suricatascCommand(ctx, opts.CommandRunner, opts.SuricataSCPath, cmd)
+	if err != nil {
+		return rulesetStats{}, err
+	}
+	return firstRulesetEntry(msg)
+}
+
+// startNonblockingReload records the current ruleset-reload-time and asks
+// Suricata to reload in the background.
+func startNonblockingReload(ctx context.Context, opts ApplyConfigOptions) (RuleReload, string, error) {
+	rl := RuleReload{ID: newReloadID(), Status: ReloadPending, StartedAt: time.Now().UTC()}
+
+	before, err := rulesetQuery(ctx, opts, "ruleset-reload-time")
+	if err != nil {
+		logger.Warnw("ruleset-reload-time unavailable before reload", "error", err)
+	}
+	if _, err := suricatascCommand(ctx, opts.CommandRunner, opts.SuricataSCPath, NonblockingReloadCommand); err != nil {
+		return rl, "", err
+	}
+	jobStep(ctx, "ruleset reload %s requested (previous reload %s)", rl.ID, before.LastReload)
+	return rl, before.LastReload, nil
+}
+
+// waitRulesetReload polls until ruleset-reload-time moves past baseline, then
+// reads ruleset-stats. The result is in rl.
+func waitRulesetReload(ctx context.Context, opts ApplyConfigOptions, baseline string, rl *RuleReload) {
+	interval := opts.ReloadPollInterval
+	if interval <= 0 {
+		interval = defaultReloadPollInterval
+	}
+	finish := func(status ReloadStatus, err error) {
+		now := time.Now().UTC()
+		rl.Status = status
+		rl.FinishedAt = &now
+		rl.Duration = now.Sub(rl.StartedAt).Round(time.Millisecond).String()
+		if err != nil {
+			rl.Error = err.Error()
+		}
+	}
+
+	var lastErr error
+	for {
+		cur, err := rulesetQuery(ctx, opts, "ruleset-reload-time")
+		if err == nil && cur.LastReload != "" && cur.LastReload != baseline {
+			rl.LastReload = cur.LastReload
+			break
+		}
+		if err != nil {
+			lastErr = err
+		}
+
+		t := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			if lastErr == nil {
+				lastErr = fmt.Errorf("ruleset-reload-time did not change")
+			}
+			finish(ReloadTimeout, lastErr)
+			return
+		case <-t.C:
+		}
+	}
+
+	stats, err := rulesetQuery(ctx, opts, "ruleset-stats")
+	if err != nil {
+		finish(ReloadFailed, fmt.Errorf("ruleset reloaded at %s but stats are unavailable: %w", rl.LastReload, err))
+		return
+	}
+	rl.RulesLoaded = stats.RulesLoaded
+	rl.RulesFailed = stats.RulesFailed
+	rl.RulesSkipped = stats.RulesSkipped
+	finish(ReloadOK, nil)
+
+	jobStep(ctx, "ruleset reloaded at %s: %d rules loaded, %d failed, %d skipped",
+		rl.LastReload, rl.RulesLoaded, rl.RulesFailed, rl.RulesSkipped)
+	logger.Infow("Ruleset reload finished",
+		"id", rl.ID,
+		"last_reload", rl.LastReload,
+		"rules_loaded", rl.RulesLoaded,
+		"rules_failed", rl.RulesFailed,
+		"duration", rl.Duration,
+	)
+}
+
+// applyNonblockingReload starts the reload and waits, up to the reload
+// timeout, until the new ruleset is live. With opts.Reloads the reload can be
+// polled by ID meanwhile. A reload Suricata does not accept is ErrReloadFailed;
+// one that is not visible in time is only a warning.
+func applyNonblockingReload(ctx context.Context, opts ApplyConfigOptions, report *ApplyConfigReport) error {
+	rl, baseline, err := startNonblockingReload(ctx, opts)
+	if err != nil {
+		report.ReloadStatus = ReloadFailed
+		return ErrReloadFailed.Wrap(err)
+	}
+	opts.Reloads.put(rl)
+
+	wctx, cancel := context.WithTimeout(ctx, report.ReloadTimeout)
+	defer cancel()
+	waitRulesetReload(wctx, opts, baseline, &rl)
+	opts.Reloads.put(rl)
+	if rl.Status == ReloadTimeout && errors.Is(ctx.Err(), context.Canceled) {
+		return ctx.Err()
+	}
+	report.ReloadStatus = rl.Status
+	report.Reload = &rl
+	if rl.Status != ReloadOK {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("ruleset reload %s: %s", rl.Status, rl.Error))
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package integration
+
+import (
+	"bytes"
+	"fmt"
+
+	"integration-suricata-ndpi/pkg/fsutil"
+	"integration-suricata-ndpi/pkg/rules"
+)
+
+type RuleSet struct {
+	Dir    string             `json:"dir"`
+	Files  []string           `json:"files"`
+	Rules  []*rules.Rule      `json:"rules"`
+	Errors []rules.ParseError `json:"errors,omitempty"`
+}
+
+func LoadRuleSet(dir string, fs fsutil.FS) (RuleSet, error) {
+	if fs == nil {
+		fs = fsutil.OSFS{}
+	}
+
+	rs := RuleSet{Dir: dir}
+
+	files, err := ListRuleFiles(dir, fs)
+	if err != nil {
+		return rs, err
+	}
+	rs.Files = files
+
+	for _, f := range files {
+		raw, err := fs.ReadFile(f)
+		if err != nil {
+			return rs, fmt.Errorf("read rule file %s: %w", f, err)
+		}
+		parsed, perrs, err := rules.ParseReader(bytes.NewReader(raw), f)
+		if err != nil {
+			return rs, fmt.Errorf("parse rule file %s: %w", f, err)
+		}
+		rs.Rules = append(rs.Rules, parsed...)
+		rs.Errors = append(rs.Errors, perrs...)
+	}
+	return rs, nil
+}
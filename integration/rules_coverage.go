@@ -0,0 +1,333 @@
+package integration
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"integration-suricata-ndpi/pkg/fsutil"
+	"integration-suricata-ndpi/pkg/rules"
+)
+
+type CoverageStatus string
+
+const (
+	CoveragePassed    CoverageStatus = "passed"
+	CoverageFailed    CoverageStatus = "failed"
+	CoverageNotRun    CoverageStatus = "not_run"
+	CoverageUncovered CoverageStatus = "uncovered"
+)
+
+type RuleCoverage struct {
+	SID           uint64         `json:"sid"`
+	Msg           string         `json:"msg,omitempty"`
+	File          string         `json:"file,omitempty"`
+	NDPIProtocols []string       `json:"ndpi_protocols,omitempty"`
+	NDPIRisks     []string       `json:"ndpi_risks,omitempty"`
+	Fixtures      []string       `json:"fixtures,omitempty"`
+	Exercised     bool           `json:"exercised"`
+	Status        CoverageStatus `json:"status"`
+}
+
+type CatalogCoverage struct {
+	Kind      string         `json:"kind"`
+	Name      string         `json:"name"`
+	InCatalog bool           `json:"in_catalog"`
+	SIDs      []uint64       `json:"sids,omitempty"`
+	Fixtures  []string       `json:"fixtures,omitempty"`
+	Exercised bool           `json:"exercised"`
+	Status    CoverageStatus `json:"status"`
+}
+
+type CoverageSummary struct {
+	Rules            int `json:"rules"`
+	RulesExercised   int `json:"rules_exercised"`
+	RulesPassed      int `json:"rules_passed"`
+	RulesFailed      int `json:"rules_failed"`
+	Catalog          int `json:"catalog"`
+	CatalogWithRules int `json:"catalog_with_rules"`
+	CatalogExercised int `json:"catalog_exercised"`
+}
+
+type CoverageMatrix struct {
+	GeneratedAt string            `json:"generated_at"`
+	TestRunAt   string            `json:"test_run_at,omitempty"`
+	Summary     CoverageSummary   `json:"summary"`
+	Rules       []RuleCoverage    `json:"rules"`
+	Catalog     []CatalogCoverage `json:"catalog"`
+}
+
+func LoadPcapFixtures(testsDir string, fs fsutil.FS) (map[string]*PcapExpectations, error) {
+	if fs == nil {
+		fs = fsutil.OSFS{}
+	}
+
+	out := make(map[string]*PcapExpectations)
+	pcaps, err := listPcaps(testsDir, fs)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range pcaps {
+		exp, err := loadPcapExpectations(p, fs)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		out[strings.TrimSuffix(filepath.Base(p), filepath.Ext(p))] = exp
+	}
+	return out, nil
+}
+
+// BuildCoverageMatrix relates rules and the nDPI catalog to pcap fixtures. A
+// fixture exercises a SID when it expects it or alerted on it in the last run;
+// the status comes from the last run of those fixtures, if any.
+func BuildCoverageMatrix(ruleList []*rules.Rule, fixtures map[string]*PcapExpectations, last *PcapTestReport) CoverageMatrix {
+	m := CoverageMatrix{
+		GeneratedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+
+	results := make(map[string]PcapCaseResult)
+	sidFixtures := make(map[uint64]map[string]struct{})
+	addFixture := func(sid uint64, fixture string) {
+		if sidFixtures[sid] == nil {
+			sidFixtures[sid] = make(map[string]struct{})
+		}
+		sidFixtures[sid][fixture] = struct{}{}
+	}
+
+	for name, exp := range fixtures {
+		for _, sid := range exp.ExpectedSIDs {
+			addFixture(sid, name)
+		}
+	}
+	if last != nil {
+		m.TestRunAt = last.FinishedAt
+		for _, c := range last.Cases {
+			results[c.Name] = c
+			for _, sid := range c.AlertedSIDs {
+				addFixture(sid, c.Name)
+			}
+		}
+	}
+
+	type catalogKey struct{ kind, name string }
+	catalog := make(map[catalogKey]*CatalogCoverage)
+	for _, p := range rules.NDPIProtocols() {
+		catalog[catalogKey{"protocol", strings.ToLower(p)}] = &CatalogCoverage{Kind: "protocol", Name: p, InCatalog: true}
+	}
+	for _, r := range rules.NDPIRisks() {
+		catalog[catalogKey{"risk", strings.ToLower(r)}] = &CatalogCoverage{Kind: "risk", Name: r, InCatalog: true}
+	}
+	entry := func(kind, name string) *CatalogCoverage {
+		k := catalogKey{kind, strings.ToLower(name)}
+		if e, ok := catalog[k]; ok {
+			return e
+		}
+		e := &CatalogCoverage{Kind: kind, Name: name}
+		catalog[k] = e
+		return e
+	}
+
+	for _, r := range ruleList {
+		if r.Disabled {
+			continue
+		}
+		sid := r.SID()
+		rc := RuleCoverage{
+			SID:           sid,
+			Msg:           r.Msg(),
+			File:          r.File,
+			NDPIProtocols: r.NDPIProtocols(),
+			NDPIRisks:     r.NDPIRisks(),
+			Fixtures:      sortedKeys(sidFixtures[sid]),
+		}
+		rc.Exercised = len(rc.Fixtures) > 0
+		rc.Status = coverageStatus(rc.Fixtures, results)
+		m.Rules = append(m.Rules, rc)
+
+		for _, p := range rc.NDPIProtocols {
+			e := entry("protocol", p)
+			e.SIDs = append(e.SIDs, sid)
+			e.Fixtures = append(e.Fixtures, rc.Fixtures...)
+		}
+		for _, rk := range rc.NDPIRisks {
+			e := entry("risk", rk)
+			e.SIDs = append(e.SIDs, sid)
+			e.Fixtures = append(e.Fixtures, rc.Fixtures...)
+		}
+	}
+	sort.Slice(m.Rules, func(i, j int) bool { return m.Rules[i].SID < m.Rules[j].SID })
+
+	for _, e := range catalog {
+		sort.Slice(e.SIDs, func(i, j int) bool { return e.SIDs[i] < e.SIDs[j] })
+		e.Fixtures = dedupStrings(e.Fixtures)
+		e.Exercised = len(e.Fixtures) > 0
+		e.Status = coverageStatus(e.Fixtures, results)
+		m.Catalog = append(m.Catalog, *e)
+	}
+	sort.Slice(m.Catalog, func(i, j int) bool {
+		if m.Catalog[i].Kind != m.Catalog[j].Kind {
+			return m.Catalog[i].Kind < m.Catalog[j].Kind
+		}
+		return strings.ToLower(m.Catalog[i].Name) < strings.ToLower(m.Catalog[j].Name)
+	})
+
+	m.Summary.Rules = len(m.Rules)
+	for _, rc := range m.Rules {
+		if rc.Exercised {
+			m.Summary.RulesExercised++
+		}
+		switch rc.Status {
+		case CoveragePassed:
+			m.Summary.RulesPassed++
+		case CoverageFailed:
+			m.Summary.RulesFailed++
+		}
+	}
+	m.Summary.Catalog = len(m.Catalog)
+	for _, e := range m.Catalog {
+		if len(e.SIDs) > 0 {
+			m.Summary.CatalogWithRules++
+		}
+		if e.Exercised {
+			m.Summary.CatalogExercised++
+		}
+	}
+
+	return m
+}
+
+func coverageStatus(fixtures []string, results map[string]PcapCaseResult) CoverageStatus {
+	if len(fixtures) == 0 {
+		return CoverageUncovered
+	}
+	ran := false
+	for _, f := range fixtures {
+		res, ok := results[f]
+		if !ok || res.Skipped {
+			continue
+		}
+		ran = true
+		if !res.Passed {
+			return CoverageFailed
+		}
+	}
+	if !ran {
+		return CoverageNotRun
+	}
+	return CoveragePassed
+}
+
+func (m CoverageMatrix) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"kind", "key", "msg", "ndpi_protocols", "ndpi_risks", "sids", "fixtures", "exercised", "status"}); err != nil {
+		return err
+	}
+
+	for _, rc := range m.Rules {
+		sid := strconv.FormatUint(rc.SID, 10)
+		if err := cw.Write([]string{
+			"rule", sid, rc.Msg,
+			strings.Join(rc.NDPIProtocols, " "),
+			strings.Join(rc.NDPIRisks, " "),
+			sid,
+			strings.Join(rc.Fixtures, " "),
+			strconv.FormatBool(rc.Exercised),
+			string(rc.Status),
+		}); err != nil {
+			return err
+		}
+	}
+
+	for _, e := range m.Catalog {
+		sids := make([]string, 0, len(e.SIDs))
+		for _, sid := range e.SIDs {
+			sids = append(sids, strconv.FormatUint(sid, 10))
+		}
+		protocols, risks := "", ""
+		if e.Kind == "protocol" {
+			protocols = e.Name
+		} else {
+			risks = e.Name
+		}
+		if err := cw.Write([]string{
+			e.Kind, e.Name, "",
+			protocols, risks,
+			strings.Join(sids, " "),
+			strings.Join(e.Fixtures, " "),
+			strconv.FormatBool(e.Exercised),
+			string(e.Status),
+		}); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func (m CoverageMatrix) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(m)
+}
+
+func WritePcapTestReport(path string, rep PcapTestReport, fs fsutil.FS) error {
+	b, err := json.MarshalIndent(rep, "", "  ")
+	if err != nil {
+		return err
+	}
+	if fs == nil {
+		fs = fsutil.OSFS{}
+	}
+	if err := fs.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, append(b, '\n'), 0o644, fs)
+}
+
+// ReadPcapTestReport returns nil without error when no run has been recorded yet.
+func ReadPcapTestReport(path string, fs fsutil.FS) (*PcapTestReport, error) {
+	if fs == nil {
+		fs = fsutil.OSFS{}
+	}
+	raw, err := fs.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read test report %s: %w", path, err)
+	}
+	var rep PcapTestReport
+	if err := json.Unmarshal(raw, &rep); err != nil {
+		return nil, fmt.Errorf("parse test report %s: %w", path, err)
+	}
+	return &rep, nil
+}
+
+func sortedKeys(set map[string]struct{}) []string {
+	out := make([]string, 0, len(set))
+	for k := range set {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func dedupStrings(in []string) []string {
+	set := make(map[string]struct{}, len(in))
+	for _, s := range in {
+		set[s] = struct{}{}
+	}
+	return sortedKeys(set)
+}
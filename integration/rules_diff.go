@@ -0,0 +1,73 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+
+	"integration-suricata-ndpi/pkg/fsutil"
+	"integration-suricata-ndpi/pkg/rules"
+)
+
+// RulesDiff is what an apply would change in detection logic: the effective
+// local rules (overrides applied) against the rules currently deployed.
+type RulesDiff struct {
+	LocalDir  string `json:"local_dir"`
+	DeployDir string `json:"deploy_dir"`
+	rules.Diff
+	Errors []rules.ParseError `json:"errors,omitempty"`
+}
+
+func diffStagedRules(staged stagedRules, localDir, deployDir string, fs fsutil.FS) (*RulesDiff, error) {
+	if fs == nil {
+		fs = fsutil.OSFS{}
+	}
+	out := &RulesDiff{LocalDir: localDir, DeployDir: deployDir}
+
+	var local []*rules.Rule
+	for _, f := range staged.Files {
+		raw, err := fs.ReadFile(f)
+		if err != nil {
+			return out, fmt.Errorf("read staged rule file %s: %w", f, err)
+		}
+		src := staged.Origin[f]
+		parsed, perrs, err := rules.ParseReader(bytes.NewReader(raw), src)
+		if err != nil {
+			return out, fmt.Errorf("parse rule file %s: %w", src, err)
+		}
+		local = append(local, parsed...)
+		out.Errors = append(out.Errors, perrs...)
+	}
+
+	deployed, err := LoadRuleSet(deployDir, fs)
+	if err != nil {
+		return out, err
+	}
+	out.Errors = append(out.Errors, deployed.Errors...)
+
+	out.Diff = rules.DiffRules(deployed.Rules, local)
+	return out, nil
+}
+
+func (r *Runner) rulesDiff(ctx context.Context) (*RulesDiff, error) {
+	_ = ctx
+
+	opts := r.opts.Apply
+	ruleFiles, err := ListRuleFiles(opts.RulesLocalDir, r.fs)
+	if err != nil {
+		return nil, err
+	}
+	overrides, err := r.effectiveRuleOverrides()
+	if err != nil {
+		return nil, err
+	}
+	staged, err := stageRuleFiles(ruleFiles, overrides, r.fs)
+	if staged.Dir != "" {
+		defer func() { _ = os.RemoveAll(staged.Dir) }()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return diffStagedRules(staged, opts.RulesLocalDir, opts.RulesDeployDir, r.fs)
+}
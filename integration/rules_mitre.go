@@ -0,0 +1,150 @@
+package integration
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"integration-suricata-ndpi/pkg/rules"
+)
+
+type MitreTechniqueCoverage struct {
+	ID   string   `json:"id"`
+	Name string   `json:"name,omitempty"`
+	SIDs []uint64 `json:"sids"`
+}
+
+type MitreTacticCoverage struct {
+	ID         string                   `json:"id"`
+	Name       string                   `json:"name"`
+	Domain     string                   `json:"domain"`
+	Rules      int                      `json:"rules"`
+	Techniques []MitreTechniqueCoverage `json:"techniques"`
+}
+
+type MitreReport struct {
+	Source  string `json:"source"`
+	Dir     string `json:"dir"`
+	Summary struct {
+		Rules          int `json:"rules"`
+		RulesMapped    int `json:"rules_mapped"`
+		Techniques     int `json:"techniques"`
+		TacticsCovered int `json:"tactics_covered"`
+	} `json:"summary"`
+	Tactics  []MitreTacticCoverage    `json:"tactics"`
+	Unmapped []uint64                 `json:"unmapped,omitempty"`
+	Unknown  []MitreTechniqueCoverage `json:"unknown,omitempty"`
+}
+
+// BuildMitreReport groups enabled rules by ATT&CK tactic and technique. A
+// sub-technique missing from the catalog is counted under its parent's tactics.
+func BuildMitreReport(ruleList []*rules.Rule) MitreReport {
+	var rep MitreReport
+
+	byTactic := make(map[string]map[string][]uint64)
+	unknown := make(map[string][]uint64)
+	techniques := make(map[string]struct{})
+	mapped := make(map[uint64]struct{})
+
+	for _, r := range ruleList {
+		if r.Disabled {
+			continue
+		}
+		rep.Summary.Rules++
+		sid := r.SID()
+
+		ids := r.MitreTechniques()
+		if len(ids) == 0 {
+			rep.Unmapped = append(rep.Unmapped, sid)
+			continue
+		}
+		for _, id := range ids {
+			id = strings.ToUpper(strings.TrimSpace(id))
+			t, ok := rules.LookupMitreTechnique(id)
+			if !ok {
+				parent, _, _ := strings.Cut(id, ".")
+				t, ok = rules.LookupMitreTechnique(parent)
+			}
+			if !ok {
+				unknown[id] = append(unknown[id], sid)
+				continue
+			}
+			mapped[sid] = struct{}{}
+			techniques[id] = struct{}{}
+			for _, ta := range t.Tactics {
+				if byTactic[ta] == nil {
+					byTactic[ta] = make(map[string][]uint64)
+				}
+				byTactic[ta][id] = append(byTactic[ta][id], sid)
+			}
+		}
+	}
+
+	for _, ta := range rules.MitreTactics() {
+		c := MitreTacticCoverage{ID: ta.ID, Name: ta.Name, Domain: ta.Domain, Techniques: []MitreTechniqueCoverage{}}
+		sids := make(map[uint64]struct{})
+		for id, list := range byTactic[ta.ID] {
+			tc := MitreTechniqueCoverage{ID: id, SIDs: sortedSIDList(list)}
+			if t, ok := rules.LookupMitreTechnique(id); ok {
+				tc.Name = t.Name
+			}
+			c.Techniques = append(c.Techniques, tc)
+			for _, sid := range list {
+				sids[sid] = struct{}{}
+			}
+		}
+		sort.Slice(c.Techniques, func(i, j int) bool { return c.Techniques[i].ID < c.Techniques[j].ID })
+		c.Rules = len(sids)
+		if c.Rules > 0 {
+			rep.Summary.TacticsCovered++
+		}
+		rep.Tactics = append(rep.Tactics, c)
+	}
+
+	for id, list := range unknown {
+		rep.Unknown = append(rep.Unknown, MitreTechniqueCoverage{ID: id, SIDs: sortedSIDList(list)})
+	}
+	sort.Slice(rep.Unknown, func(i, j int) bool { return rep.Unknown[i].ID < rep.Unknown[j].ID })
+	sort.Slice(rep.Unmapped, func(i, j int) bool { return rep.Unmapped[i] < rep.Unmapped[j] })
+
+	rep.Summary.RulesMapped = len(mapped)
+	rep.Summary.Techniques = len(techniques)
+	return rep
+}
+
+func sortedSIDList(in []uint64) []uint64 {
+	set := make(map[uint64]struct{}, len(in))
+	out := make([]uint64, 0, len(in))
+	for _, sid := range in {
+		if _, dup := set[sid]; dup {
+			continue
+		}
+		set[sid] = struct{}{}
+		out = append(out, sid)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
+
+// rulesMitre reports on the effective rule set: rules disabled by an override are left out.
+func (r *Runner) rulesMitre(ctx context.Context, source string) (MitreReport, error) {
+	_ = ctx
+
+	source, ruleSet, overrides, err := r.loadRulesForQuery(source)
+	if err != nil {
+		return MitreReport{}, err
+	}
+
+	effective := make([]*rules.Rule, 0, len(ruleSet.Rules))
+	for _, rule := range ruleSet.Rules {
+		if o, ok := overrides[rule.SID()]; ok {
+			rule, _ = o.apply(rule)
+		}
+		effective = append(effective, rule)
+	}
+
+	rep := BuildMitreReport(effective)
+	rep.Source = source
+	rep.Dir = ruleSet.Dir
+	return rep, nil
+}
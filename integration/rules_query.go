@@ -0,0 +1,173 @@
+package integration
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+
+	"integration-suricata-ndpi/internal/httpapi"
+	"integration-suricata-ndpi/pkg/rules"
+)
+
+type RuleDetail struct {
+	RuleView
+
+	Src       string              `json:"src"`
+	SrcPort   string              `json:"src_port"`
+	Direction string              `json:"direction"`
+	Dst       string              `json:"dst"`
+	DstPort   string              `json:"dst_port"`
+	Options   []rules.Option      `json:"options"`
+	Metadata  map[string][]string `json:"metadata,omitempty"`
+	Requires  []string            `json:"requires,omitempty"`
+	Raw       string              `json:"raw"`
+}
+
+type invalidQueryError struct {
+	msg string
+}
+
+func (e *invalidQueryError) Error() string   { return e.msg }
+func (e *invalidQueryError) HTTPStatus() int { return 400 }
+func (e *invalidQueryError) Details() any    { return map[string]string{"reason": e.msg} }
+
+func matchRule(v RuleView, q httpapi.RuleQuery) bool {
+	if q.SID != 0 && v.SID != q.SID {
+		return false
+	}
+	if q.Action != "" && !strings.EqualFold(v.EffectiveAction, q.Action) {
+		return false
+	}
+	if q.Transport != "" && !strings.EqualFold(v.Proto, q.Transport) {
+		return false
+	}
+	if q.NDPIProtocol != "" && !containsFold(v.NDPIProtocols, q.NDPIProtocol) {
+		return false
+	}
+	if q.NDPIRisk != "" && !containsFold(v.NDPIRisks, q.NDPIRisk) {
+		return false
+	}
+	if q.Mitre != "" && !matchMitre(v.MitreTechniques, q.Mitre) {
+		return false
+	}
+	if q.File != "" && v.File != q.File && filepath.Base(v.File) != q.File {
+		return false
+	}
+	return true
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchMitre treats a technique as matching its sub-techniques (T1071 matches T1071.001).
+func matchMitre(techniques []string, id string) bool {
+	for _, t := range techniques {
+		if strings.EqualFold(t, id) || strings.HasPrefix(strings.ToUpper(t), strings.ToUpper(id)+".") {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Runner) rulesDir(source string) (string, string, error) {
+	switch source {
+	case "", "local":
+		return "local", r.opts.Apply.RulesLocalDir, nil
+	case "deployed":
+		if strings.TrimSpace(r.opts.Apply.RulesDeployDir) == "" {
+			return "", "", &invalidQueryError{msg: "paths.suricata_rules_dir is empty: no deployed rule set"}
+		}
+		return "deployed", r.opts.Apply.RulesDeployDir, nil
+	default:
+		return "", "", &invalidQueryError{msg: "source must be local or deployed"}
+	}
+}
+
+func (r *Runner) loadRulesForQuery(source string) (string, RuleSet, map[uint64]RuleOverride, error) {
+	source, dir, err := r.rulesDir(source)
+	if err != nil {
+		return "", RuleSet{}, nil, err
+	}
+	ruleSet, err := LoadRuleSet(dir, r.fs)
+	if err != nil {
+		return "", RuleSet{}, nil, err
+	}
+	overrides, err := r.effectiveRuleOverrides()
+	if err != nil {
+		return "", RuleSet{}, nil, err
+	}
+	return source, ruleSet, overrides, nil
+}
+
+// getRule prefers an enabled rule when a SID also appears commented out.
+func (r *Runner) getRule(ctx context.Context, sid uint64, source string) (RuleDetail, error) {
+	_ = ctx
+
+	_, ruleSet, overrides, err := r.loadRulesForQuery(source)
+	if err != nil {
+		return RuleDetail{}, err
+	}
+
+	var found *rules.Rule
+	for _, rule := range ruleSet.Rules {
+		if rule.SID() != sid {
+			continue
+		}
+		if found == nil || (found.Disabled && !rule.Disabled) {
+			found = rule
+		}
+	}
+	if found == nil {
+		return RuleDetail{}, &RuleNotFoundError{SID: sid}
+	}
+
+	return RuleDetail{
+		RuleView:  newRuleView(found, overrides),
+		Src:       found.Src,
+		SrcPort:   found.SrcPort,
+		Direction: found.Direction,
+		Dst:       found.Dst,
+		DstPort:   found.DstPort,
+		Options:   found.Options,
+		Metadata:  found.Metadata(),
+		Requires:  found.Requires(),
+		Raw:       found.Raw,
+	}, nil
+}
+
+// validateRuleText lints a client-supplied rule body; SIDs already used by the
+// local rule set are reported as warnings since the body may be an update.
+func (r *Runner) validateRuleText(ctx context.Context, text string) (rules.LintReport, error) {
+	_ = ctx
+
+	rep := rules.LintText(text)
+
+	ruleSet, err := LoadRuleSet(r.opts.Apply.RulesLocalDir, r.fs)
+	if err != nil {
+		return rules.LintReport{}, err
+	}
+	existing := make(map[uint64]*rules.Rule, len(ruleSet.Rules))
+	for _, rule := range ruleSet.Rules {
+		if !rule.Disabled {
+			existing[rule.SID()] = rule
+		}
+	}
+	for i := range rep.Rules {
+		res := &rep.Rules[i]
+		if prev, ok := existing[res.SID]; ok {
+			res.Findings = append(res.Findings, rules.Finding{
+				Severity: rules.SeverityWarning,
+				Code:     "sid-in-use",
+				Message:  "sid is already used in " + filepath.Base(prev.File) + " (the rule would be replaced)",
+			})
+			rep.Summary.Warnings++
+		}
+	}
+	return rep, nil
+}
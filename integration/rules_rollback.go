@@ -0,0 +1,106 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"integration-suricata-ndpi/pkg/fsutil"
+	"integration-suricata-ndpi/pkg/logger"
+)
+
+// rollbackSnapshot copies the live rules aside before a deploy. keep makes it
+// the rollback target once the deploy changed something; drop discards it.
+type rollbackSnapshot struct {
+	dir, tmp string
+	fs       fsutil.FS
+}
+
+func snapshotDeployedRules(opts ApplyConfigOptions) (*rollbackSnapshot, error) {
+	if strings.TrimSpace(opts.RulesRollbackDir) == "" {
+		return nil, nil
+	}
+	fs := opts.FS
+	if fs == nil {
+		fs = fsutil.OSFS{}
+	}
+
+	s := &rollbackSnapshot{dir: opts.RulesRollbackDir, tmp: opts.RulesRollbackDir + ".new", fs: fs}
+	if err := fs.RemoveAll(s.tmp); err != nil {
+		return nil, err
+	}
+	if err := fs.MkdirAll(s.tmp, 0o750); err != nil {
+		return nil, err
+	}
+
+	live, err := ListRuleFiles(opts.RulesDeployDir, fs)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range append(live, filepath.Join(opts.RulesDeployDir, bundleProvenanceName)) {
+		data, err := fs.ReadFile(p)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", p, err)
+		}
+		if err := fs.WriteFile(filepath.Join(s.tmp, filepath.Base(p)), data, 0o640); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *rollbackSnapshot) keep() error {
+	if err := s.fs.RemoveAll(s.dir); err != nil {
+		return err
+	}
+	return s.fs.Rename(s.tmp, s.dir)
+}
+
+func (s *rollbackSnapshot) drop() {
+	_ = s.fs.RemoveAll(s.tmp)
+}
+
+// RollbackRules deploys the rule set that was live before the last deploy that
+// changed it, and reloads Suricata like an apply. The files are deployed as
+// they were, so overrides are not applied again; the rules replaced by the
+// rollback become the next rollback target.
+func RollbackRules(ctx context.Context, opts ApplyConfigOptions) (ApplyConfigReport, error) {
+	if strings.TrimSpace(opts.RulesRollbackDir) == "" || strings.TrimSpace(opts.RulesDeployDir) == "" {
+		return ApplyConfigReport{}, ErrNoRollback
+	}
+	fs := opts.FS
+	if fs == nil {
+		fs = fsutil.OSFS{}
+	}
+
+	files, err := ListRuleFiles(opts.RulesRollbackDir, fs)
+	if err != nil {
+		return ApplyConfigReport{}, err
+	}
+	if len(files) == 0 {
+		return ApplyConfigReport{}, ErrNoRollback
+	}
+
+	opts.Bundle = nil
+	if raw, err := fs.ReadFile(filepath.Join(opts.RulesRollbackDir, bundleProvenanceName)); err == nil {
+		var b AppliedRuleBundle
+		if err := json.Unmarshal(raw, &b); err == nil {
+			opts.Bundle = &b
+		}
+	}
+
+	logger.Infow("Rolling back rules", "from", opts.RulesRollbackDir, "files", len(files))
+	jobStep(ctx, "rolling back to the %d rule files in %s", len(files), opts.RulesRollbackDir)
+
+	opts.RulesLocalDir = opts.RulesRollbackDir
+	opts.RuleOverrides = nil
+	opts.RuleOverridesStatePath = ""
+	return ApplyConfigWithContext(ctx, opts)
+}
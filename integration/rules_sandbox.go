@@ -0,0 +1,194 @@
+package integration
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"integration-suricata-ndpi/pkg/fsutil"
+)
+
+type ruleSandbox struct {
+	Dir        string
+	RulesDir   string
+	LogDir     string
+	ConfigPath string
+
+	// sandbox file name -> original candidate path
+	Origin map[string]string
+
+	fs fsutil.FS
+}
+
+type ruleSandboxOptions struct {
+	NDPIPluginPath      string
+	RuleFiles           []string
+	ClassificationFile  string
+	ReferenceConfigFile string
+	EVELog              bool
+
+	FS fsutil.FS
+}
+
+func newRuleSandbox(opts ruleSandboxOptions) (*ruleSandbox, error) {
+	fs := opts.FS
+	if fs == nil {
+		fs = fsutil.OSFS{}
+	}
+	dir, err := fs.MkdirTemp("", "suricata-rules-sandbox-*")
+	if err != nil {
+		return nil, fmt.Errorf("create sandbox dir: %w", err)
+	}
+
+	sb := &ruleSandbox{
+		Dir:        dir,
+		RulesDir:   filepath.Join(dir, "rules"),
+		LogDir:     filepath.Join(dir, "log"),
+		ConfigPath: filepath.Join(dir, "suricata.yaml"),
+		Origin:     make(map[string]string, len(opts.RuleFiles)),
+		fs:         fs,
+	}
+
+	if err := sb.populate(opts); err != nil {
+		_ = sb.Close()
+		return nil, err
+	}
+	return sb, nil
+}
+
+func (s *ruleSandbox) populate(opts ruleSandboxOptions) error {
+	if err := s.fs.MkdirAll(s.RulesDir, 0o755); err != nil {
+		return fmt.Errorf("create sandbox rules dir: %w", err)
+	}
+	if err := s.fs.MkdirAll(s.LogDir, 0o755); err != nil {
+		return fmt.Errorf("create sandbox log dir: %w", err)
+	}
+
+	var names []string
+	for _, src := range opts.RuleFiles {
+		name := filepath.Base(src)
+		if prev, dup := s.Origin[name]; dup {
+			return fmt.Errorf("duplicate rule file name %q (%s and %s)", name, prev, src)
+		}
+
+		data, err := s.fs.ReadFile(src)
+		if err != nil {
+			return fmt.Errorf("read rule file %s: %w", src, err)
+		}
+		if err := s.fs.WriteFile(filepath.Join(s.RulesDir, name), data, 0o644); err != nil {
+			return fmt.Errorf("copy rule file %s: %w", src, err)
+		}
+
+		s.Origin[name] = src
+		names = append(names, name)
+	}
+
+	cfg := renderSandboxConfig(s, names, opts)
+	if err := s.fs.WriteFile(s.ConfigPath, []byte(cfg), 0o644); err != nil {
+		return fmt.Errorf("write sandbox config: %w", err)
+	}
+	return nil
+}
+
+func (s *ruleSandbox) Close() error {
+	return s.fs.RemoveAll(s.Dir)
+}
+
+// originOf maps a path reported by the engine back to the candidate rule file.
+func (s *ruleSandbox) originOf(path string) string {
+	if src, ok := s.Origin[filepath.Base(path)]; ok {
+		return src
+	}
+	return path
+}
+
+func renderSandboxConfig(s *ruleSandbox, ruleFiles []string, opts ruleSandboxOptions) string {
+	var b strings.Builder
+
+	b.WriteString("%YAML 1.1\n---\n")
+	b.WriteString(`vars:
+  address-groups:
+    HOME_NET: "[192.168.0.0/16,10.0.0.0/8,172.16.0.0/12]"
+    EXTERNAL_NET: "!$HOME_NET"
+    HTTP_SERVERS: "$HOME_NET"
+    SMTP_SERVERS: "$HOME_NET"
+    SQL_SERVERS: "$HOME_NET"
+    DNS_SERVERS: "$HOME_NET"
+    TELNET_SERVERS: "$HOME_NET"
+    AIM_SERVERS: "$EXTERNAL_NET"
+    DC_SERVERS: "$HOME_NET"
+    DNP3_SERVER: "$HOME_NET"
+    DNP3_CLIENT: "$HOME_NET"
+    MODBUS_CLIENT: "$HOME_NET"
+    MODBUS_SERVER: "$HOME_NET"
+    ENIP_CLIENT: "$HOME_NET"
+    ENIP_SERVER: "$HOME_NET"
+  port-groups:
+    HTTP_PORTS: "80"
+    SHELLCODE_PORTS: "!80"
+    ORACLE_PORTS: 1521
+    SSH_PORTS: 22
+    DNP3_PORTS: 20000
+    MODBUS_PORTS: 502
+    FILE_DATA_PORTS: "[$HTTP_PORTS,110,143]"
+    FTP_PORTS: 21
+    GENEVE_PORTS: 6081
+    VXLAN_PORTS: 4789
+    TEREDO_PORTS: 3544
+`)
+
+	fmt.Fprintf(&b, "default-log-dir: %s\n", s.LogDir)
+	fmt.Fprintf(&b, "default-rule-path: %s\n", s.RulesDir)
+
+	b.WriteString("rule-files:\n")
+	for _, name := range ruleFiles {
+		fmt.Fprintf(&b, "  - %s\n", name)
+	}
+
+	if opts.ClassificationFile != "" {
+		fmt.Fprintf(&b, "classification-file: %s\n", opts.ClassificationFile)
+	}
+	if opts.ReferenceConfigFile != "" {
+		fmt.Fprintf(&b, "reference-config-file: %s\n", opts.ReferenceConfigFile)
+	}
+
+	if opts.NDPIPluginPath != "" {
+		b.WriteString("plugins:\n")
+		fmt.Fprintf(&b, "  - %s\n", opts.NDPIPluginPath)
+	}
+
+	b.WriteString(`logging:
+  default-log-level: notice
+  outputs:
+    - console:
+        enabled: yes
+`)
+
+	if opts.EVELog {
+		b.WriteString(`outputs:
+  - eve-log:
+      enabled: yes
+      filetype: regular
+      filename: eve.json
+      types:
+        - alert
+`)
+	} else {
+		b.WriteString("outputs: []\n")
+	}
+
+	return b.String()
+}
+
+func suricataAuxFile(configCandidates []string, name string) string {
+	target, err := FirstExistingPath(configCandidates)
+	if err != nil {
+		return ""
+	}
+	p := filepath.Join(filepath.Dir(target), name)
+	if _, err := os.Stat(p); err != nil {
+		return ""
+	}
+	return p
+}
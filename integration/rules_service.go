@@ -0,0 +1,192 @@
+package integration
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"integration-suricata-ndpi/internal/httpapi"
+	"integration-suricata-ndpi/pkg/logger"
+	"integration-suricata-ndpi/pkg/rules"
+)
+
+func (r *Runner) rulesCoverage(ctx context.Context) (CoverageMatrix, error) {
+	_ = ctx
+
+	if r.cfg == nil {
+		return CoverageMatrix{}, fmt.Errorf("config is not loaded")
+	}
+	opts := r.opts.PcapTests
+
+	ruleSet, err := LoadRuleSet(opts.RulesDir, r.fs)
+	if err != nil {
+		return CoverageMatrix{}, err
+	}
+	fixtures, err := LoadPcapFixtures(opts.TestsDir, r.fs)
+	if err != nil {
+		return CoverageMatrix{}, err
+	}
+	last, err := ReadPcapTestReport(r.cfg.Rules.TestReportPath, r.fs)
+	if err != nil {
+		return CoverageMatrix{}, err
+	}
+
+	return BuildCoverageMatrix(ruleSet.Rules, fixtures, last), nil
+}
+
+func (r *Runner) applyRuleBundle(ctx context.Context, src httpapi.BundleSource) (ApplyConfigReport, error) {
+	data := src.Data
+	if src.Path != "" {
+		raw, err := r.fs.ReadFile(src.Path)
+		if err != nil {
+			return ApplyConfigReport{}, fmt.Errorf("read rule bundle %s: %w", src.Path, err)
+		}
+		data = raw
+	}
+	return ApplyRuleBundle(ctx, r.opts.Apply, data)
+}
+
+type RuleView struct {
+	SID      uint64 `json:"sid"`
+	Rev      int    `json:"rev,omitempty"`
+	Action   string `json:"action"`
+	Disabled bool   `json:"disabled,omitempty"`
+	Msg      string `json:"msg,omitempty"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+
+	Proto           string   `json:"proto"`
+	NDPIProtocols   []string `json:"ndpi_protocols,omitempty"`
+	NDPIRisks       []string `json:"ndpi_risks,omitempty"`
+	MitreTechniques []string `json:"mitre_techniques,omitempty"`
+
+	Override          *RuleOverride `json:"override,omitempty"`
+	EffectiveAction   string        `json:"effective_action"`
+	EffectiveDisabled bool          `json:"effective_disabled,omitempty"`
+}
+
+type RulesListing struct {
+	Source    string             `json:"source"`
+	Dir       string             `json:"dir"`
+	Total     int                `json:"total"`
+	Matched   int                `json:"matched"`
+	Rules     []RuleView         `json:"rules"`
+	Overrides []RuleOverride     `json:"overrides,omitempty"`
+	Errors    []rules.ParseError `json:"errors,omitempty"`
+}
+
+type RuleOverrideResult struct {
+	Override      RuleOverride `json:"override"`
+	ApplyRequired bool         `json:"apply_required"`
+}
+
+type invalidOverrideError struct {
+	msg string
+}
+
+func (e *invalidOverrideError) Error() string   { return e.msg }
+func (e *invalidOverrideError) HTTPStatus() int { return 400 }
+func (e *invalidOverrideError) Details() any    { return map[string]string{"reason": e.msg} }
+
+func (r *Runner) effectiveRuleOverrides() (map[uint64]RuleOverride, error) {
+	state, err := LoadRuleOverrides(r.opts.Apply.RuleOverridesStatePath, r.fs)
+	if err != nil {
+		return nil, err
+	}
+	return MergeRuleOverrides(r.opts.Apply.RuleOverrides, state), nil
+}
+
+func (r *Runner) listRules(ctx context.Context, q httpapi.RuleQuery) (RulesListing, error) {
+	_ = ctx
+
+	source, ruleSet, overrides, err := r.loadRulesForQuery(q.Source)
+	if err != nil {
+		return RulesListing{}, err
+	}
+
+	out := RulesListing{Source: source, Dir: ruleSet.Dir, Errors: ruleSet.Errors, Rules: make([]RuleView, 0, len(ruleSet.Rules))}
+	for _, rule := range ruleSet.Rules {
+		if v := newRuleView(rule, overrides); matchRule(v, q) {
+			out.Rules = append(out.Rules, v)
+		}
+	}
+	out.Total = len(ruleSet.Rules)
+	out.Matched = len(out.Rules)
+
+	for _, o := range overrides {
+		out.Overrides = append(out.Overrides, o)
+	}
+	sort.Slice(out.Overrides, func(i, j int) bool { return out.Overrides[i].SID < out.Overrides[j].SID })
+	return out, nil
+}
+
+func newRuleView(rule *rules.Rule, overrides map[uint64]RuleOverride) RuleView {
+	v := RuleView{
+		SID:             rule.SID(),
+		Rev:             rule.Rev(),
+		Action:          rule.Action,
+		Disabled:        rule.Disabled,
+		Msg:             rule.Msg(),
+		File:            rule.File,
+		Line:            rule.Line,
+		Proto:           rule.Proto,
+		NDPIProtocols:   rule.NDPIProtocols(),
+		NDPIRisks:       rule.NDPIRisks(),
+		MitreTechniques: rule.MitreTechniques(),
+	}
+	eff := rule
+	if o, ok := overrides[v.SID]; ok {
+		v.Override = &o
+		eff, _ = o.apply(rule)
+	}
+	v.EffectiveAction = eff.Action
+	v.EffectiveDisabled = eff.Disabled
+	return v
+}
+
+// overrideRule persists a disable/enable/action override; it takes effect on the next apply.
+func (r *Runner) overrideRule(ctx context.Context, sid uint64, op, action string) (RuleOverrideResult, error) {
+	_ = ctx
+
+	var state string
+	switch op {
+	case "disable":
+		state = OverrideDisabled
+	case "enable":
+		state = OverrideEnabled
+	case "action":
+		action = strings.TrimSpace(action)
+		if !rules.IsAction(action) || action == "config" {
+			return RuleOverrideResult{}, &invalidOverrideError{msg: fmt.Sprintf("invalid rule action %q", action)}
+		}
+	default:
+		return RuleOverrideResult{}, &invalidOverrideError{msg: fmt.Sprintf("unknown override %q", op)}
+	}
+
+	ruleSet, err := LoadRuleSet(r.opts.Apply.RulesLocalDir, r.fs)
+	if err != nil {
+		return RuleOverrideResult{}, err
+	}
+	found := false
+	for _, rule := range ruleSet.Rules {
+		if rule.SID() == sid {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return RuleOverrideResult{}, &RuleNotFoundError{SID: sid}
+	}
+
+	if _, err := SetRuleOverride(r.opts.Apply.RuleOverridesStatePath, sid, state, action, r.fs); err != nil {
+		return RuleOverrideResult{}, err
+	}
+	overrides, err := r.effectiveRuleOverrides()
+	if err != nil {
+		return RuleOverrideResult{}, err
+	}
+
+	logger.Infow("Rule override stored", "sid", sid, "op", op, "action", action)
+	return RuleOverrideResult{Override: overrides[sid], ApplyRequired: true}, nil
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 	"net/http"
-	"sync"
 	"time"
 
 	"integration-suricata-ndpi/internal/config"
@@ -21,7 +20,11 @@ type Runner struct {
 	opts          RunnerOptions
 	httpServer    *http.Server
 	httpErrCh     chan error
-	mu            sync.Mutex
+	jobs          *JobQueue
+	events        *EventBus
+	history       *HistoryStore
+	reloads       *RuleReloadTracker
+	stateNudge    chan struct{}
 }
 
 func NewRunner(configPath string, commandRunner executil.Runner, fs fsutil.FS) *Runner {
@@ -32,12 +35,20 @@ func NewRunner(configPath string, commandRunner executil.Runner, fs fsutil.FS) *
 		fs = fsutil.OSFS{}
 	}
 
-	return &Runner{
+	r := &Runner{
 		configPath:    configPath,
 		commandRunner: commandRunner,
 		fs:            fs,
 		httpErrCh:     make(chan error, 1),
-	}
+		jobs:          NewJobQueue(100),
+		events:        NewEventBus(0),
+		reloads:       NewRuleReloadTracker(32),
+		stateNudge:    make(chan struct{}, 1),
+	}
+	r.jobs.Notify(func(j Job) {
+		r.events.Publish(EventJob, jobEvent(j))
+	})
+	return r
 }
 
 func (r *Runner) Start(ctx context.Context) error {
@@ -49,6 +60,14 @@ func (r *Runner) Start(ctx context.Context) error {
 	}
 	r.cfg = cfg
 	r.opts = buildRunnerOptions(cfg, r.commandRunner, r.fs)
+	r.opts.Apply.Reloads = r.reloads
+	r.events = NewEventBus(cfg.HTTP.EventsBuffer)
+
+	history, err := OpenHistoryStore(cfg.State.Dir, cfg.State.HistoryMaxRecords)
+	if err != nil {
+		return fmt.Errorf("open state store: %w", err)
+	}
+	r.history = history
 
 	if err := r.checkContext(ctx); err != nil {
 		return err
@@ -86,6 +105,7 @@ func (r *Runner) Start(ctx context.Context) error {
 	if err := r.startHTTPServer(ctx); err != nil {
 		return err
 	}
+	go r.watchState(ctx, cfg.HTTP.StateCheckInterval)
 
 	logger.Infow("Waiting for shutdown signal")
 
@@ -99,6 +119,7 @@ func (r *Runner) Start(ctx context.Context) error {
 
 func (r *Runner) Stop(ctx context.Context) error {
 	logger.Infow("Stopping integration workflow")
+	r.jobs.Close()
 	if r.httpServer != nil {
 		return r.httpServer.Shutdown(ctx)
 	}
@@ -0,0 +1,80 @@
+package integration
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"integration-suricata-ndpi/pkg/fsutil"
+	"integration-suricata-ndpi/pkg/rules"
+)
+
+type stagedRules struct {
+	Dir       string
+	Files     []string
+	Origin    map[string]string // staged path -> local path
+	Overrides *RuleOverridesReport
+	Warnings  []string
+}
+
+// stageRuleFiles prepares what gets validated and deployed: overrides are
+// applied and every file is put in canonical form (rules fmt), so unchanged
+// rule sets produce byte-identical deploys. The caller removes Dir.
+func stageRuleFiles(ruleFiles []string, overrides map[uint64]RuleOverride, fs fsutil.FS) (stagedRules, error) {
+	if fs == nil {
+		fs = fsutil.OSFS{}
+	}
+	st := stagedRules{Origin: make(map[string]string, len(ruleFiles))}
+
+	dir, err := fs.MkdirTemp("", "rules-stage-")
+	if err != nil {
+		return st, fmt.Errorf("create staging dir: %w", err)
+	}
+	st.Dir = dir
+
+	var orep RuleOverridesReport
+	matched := make(map[uint64]struct{})
+	for _, src := range ruleFiles {
+		data, err := fs.ReadFile(src)
+		if err != nil {
+			return st, fmt.Errorf("read rule file %s: %w", src, err)
+		}
+
+		data, applied, err := ApplyRuleOverrides(data, src, overrides)
+		if err != nil {
+			return st, fmt.Errorf("apply overrides to %s: %w", src, err)
+		}
+		for _, a := range applied {
+			matched[a.SID] = struct{}{}
+		}
+		orep.Applied = append(orep.Applied, applied...)
+
+		if formatted, err := rules.FormatRules(data, src); err != nil {
+			st.Warnings = append(st.Warnings, fmt.Sprintf("%s deployed as is, not canonicalized: %v", src, err))
+		} else {
+			data = formatted
+		}
+
+		dst := filepath.Join(dir, filepath.Base(src))
+		if err := fs.WriteFile(dst, data, 0o644); err != nil {
+			return st, fmt.Errorf("stage rule file %s: %w", dst, err)
+		}
+		st.Files = append(st.Files, dst)
+		st.Origin[dst] = src
+	}
+
+	if len(overrides) == 0 {
+		return st, nil
+	}
+	for sid := range overrides {
+		if _, ok := matched[sid]; !ok {
+			orep.Unmatched = append(orep.Unmatched, sid)
+		}
+	}
+	sort.Slice(orep.Unmatched, func(i, j int) bool { return orep.Unmatched[i] < orep.Unmatched[j] })
+	for _, sid := range orep.Unmatched {
+		st.Warnings = append(st.Warnings, fmt.Sprintf("rule override for sid %d matches no local rule", sid))
+	}
+	st.Overrides = &orep
+	return st, nil
+}
@@ -3,6 +3,7 @@ package integration
 import (
 	"context"
 	"fmt"
+	"io"
 	"strings"
 	"time"
 
@@ -11,9 +12,6 @@ import (
 )
 
 func EnsureSuricataStarted(opts SuricataStartOptions) error {
-	if opts.Systemd == nil {
-		opts.Systemd = systemd.NewManager(opts.SystemctlPath, nil)
-	}
 	if opts.Dialer == nil {
 		opts.Dialer = netutil.DefaultDialer{}
 	}
@@ -33,12 +31,23 @@ func EnsureSuricataStarted(opts SuricataStartOptions) error {
 	ctx, cancel := context.WithTimeout(context.Background(), opts.StartTimeout)
 	defer cancel()
 
+	if opts.Systemd == nil {
+		m, err := systemd.New(ctx, opts.SystemdBackend, opts.SystemctlPath, nil)
+		if err != nil {
+			return ErrRestartFailed.Wrap(err)
+		}
+		if c, ok := m.(io.Closer); ok {
+			defer c.Close()
+		}
+		opts.Systemd = m
+	}
+
 	if err := opts.Systemd.Restart(ctx, unit, opts.StartTimeout); err != nil {
-		return fmt.Errorf("failed to start suricata via systemd: %w", err)
+		return ErrRestartFailed.Wrap(fmt.Errorf("start %s via systemd: %w", unit, err))
 	}
 
 	if err := EnsureSuricataRunningWithDialer(opts.SocketCandidates, opts.Dialer); err != nil {
-		return fmt.Errorf("suricata started but socket not reachable: %w", err)
+		return ErrSuricataNotReady.Wrap(fmt.Errorf("suricata started but socket not reachable: %w", err))
 	}
 
 	return nil
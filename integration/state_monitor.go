@@ -0,0 +1,108 @@
+package integration
+
+import (
+	"context"
+	"time"
+
+	"integration-suricata-ndpi/pkg/logger"
+	"integration-suricata-ndpi/pkg/netutil"
+)
+
+type NDPIEvent struct {
+	Enabled bool   `json:"enabled"`
+	Changed bool   `json:"changed"`
+	Message string `json:"message,omitempty"`
+}
+
+type RestartEvent struct {
+	Reason  string `json:"reason"`
+	Command string `json:"command,omitempty"`
+}
+
+// stateMonitor remembers the last published drift and socket state, so only
+// changes become events.
+type stateMonitor struct {
+	drift    *bool
+	socketUp *bool
+	dialer   netutil.Dialer
+}
+
+// watchState checks for config drift and control-socket reachability every
+// interval, and right away when nudged after a job.
+func (r *Runner) watchState(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	m := &stateMonitor{dialer: netutil.DefaultDialer{}}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		r.checkState(ctx, m)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-r.stateNudge:
+		}
+	}
+}
+
+func (r *Runner) nudgeState() {
+	select {
+	case r.stateNudge <- struct{}{}:
+	default:
+	}
+}
+
+func (r *Runner) checkState(ctx context.Context, m *stateMonitor) {
+	ev := SocketEvent{}
+	sock, err := FirstExistingSocket(r.opts.Apply.SocketCandidates)
+	if err == nil {
+		ev.Socket = sock
+		var conn interface{ Close() error }
+		conn, err = m.dialer.DialTimeout("unix", sock, 2*time.Second)
+		if err == nil {
+			_ = conn.Close()
+		}
+	}
+	ev.Reachable = err == nil
+	if err != nil {
+		ev.Error = err.Error()
+	}
+	if m.socketUp == nil || *m.socketUp != ev.Reachable {
+		up := ev.Reachable
+		m.socketUp = &up
+		r.events.Publish(EventSocket, ev)
+	}
+
+	// like GET /plan, wait for a running job so a half-applied change is not
+	// reported as drift
+	res, err := r.jobs.Between(ctx, func(ctx context.Context) (any, error) {
+		return PlanConfig(ctx, r.opts.Apply)
+	})
+	if err != nil {
+		if ctx.Err() == nil {
+			logger.Warnw("Drift check failed", "error", err)
+		}
+		return
+	}
+	plan := res.(PlanReport)
+	// a clean first check is not news; drift, and any later change, is
+	if (m.drift == nil && plan.WouldChange) || (m.drift != nil && *m.drift != plan.WouldChange) {
+		r.events.Publish(EventDrift, DriftEvent{
+			Drift:            plan.WouldChange,
+			TargetConfigPath: plan.TargetConfigPath,
+			RuleFilesChanged: plan.RuleFilesChanged,
+		})
+	}
+	drift := plan.WouldChange
+	m.drift = &drift
+}
+
+func (r *Runner) publishReload(rep ApplyConfigReport) {
+	if rep.ReloadStatus == "" {
+		return
+	}
+	r.events.Publish(EventReload, ReloadEvent{Command: rep.ReloadCommand, Status: rep.ReloadStatus, Reload: rep.Reload})
+}
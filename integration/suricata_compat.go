@@ -0,0 +1,285 @@
+package integration
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"debug/elf"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+
+	"integration-suricata-ndpi/pkg/executil"
+	"integration-suricata-ndpi/pkg/fsutil"
+)
+
+// SupportedSuricataSeries is the Suricata major.minor the nDPI plugin is built
+// against; plugins are not ABI compatible across minor releases.
+const SupportedSuricataSeries = "8.0"
+
+// PluginRegisterSymbol is the entry point Suricata resolves in every plugin.
+const PluginRegisterSymbol = "SCPluginRegister"
+
+// SuricataBuildInfo is what `suricata --build-info` says about the build.
+type SuricataBuildInfo struct {
+	Version       string `json:"version"`
+	PluginSupport bool   `json:"plugin_support"`
+	NDPISupport   bool   `json:"ndpi_support"`
+}
+
+var buildInfoVersionRe = regexp.MustCompile(`This is Suricata version (\S+)`)
+
+// ParseSuricataBuildInfo reads the version line and the "Plugin support" and
+// "nDPI support" summary lines; a missing line counts as no.
+func ParseSuricataBuildInfo(out []byte) (SuricataBuildInfo, error) {
+	var info SuricataBuildInfo
+	m := buildInfoVersionRe.FindSubmatch(out)
+	if m == nil {
+		return info, fmt.Errorf("no version line in suricata --build-info output")
+	}
+	info.Version = string(m[1])
+
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		key, value, ok := strings.Cut(sc.Text(), ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		yes := strings.HasPrefix(strings.ToLower(strings.TrimSpace(value)), "yes")
+		switch {
+		case strings.HasPrefix(key, "plugin support"):
+			info.PluginSupport = yes
+		case strings.HasPrefix(key, "ndpi support"):
+			info.NDPISupport = yes
+		}
+	}
+	return info, nil
+}
+
+// ReadSuricataBuildInfo runs `<bin> --build-info` and parses it.
+func ReadSuricataBuildInfo(ctx context.Context, runner executil.Runner, bin string) (SuricataBuildInfo, error) {
+	if runner == nil {
+		runner = executil.DefaultRunner{}
+	}
+	out, err := runner.CombinedOutput(ctx, bin, "--build-info")
+	if err != nil {
+		return SuricataBuildInfo{}, fmt.Errorf("%s --build-info: %w (output=%q)", bin, err, strings.TrimSpace(string(out)))
+	}
+	return ParseSuricataBuildInfo(out)
+}
+
+// Check reports why the nDPI plugin cannot run on this build, if it cannot.
+func (b SuricataBuildInfo) Check() error {
+	if !SupportedSuricataVersion(b.Version) {
+		return fmt.Errorf("suricata %s is not supported: the nDPI plugin needs %s.x", b.Version, SupportedSuricataSeries)
+	}
+	if !b.PluginSupport {
+		return fmt.Errorf("suricata %s was built without plugin support, so ndpi.so cannot be loaded", b.Version)
+	}
+	if !b.NDPISupport {
+		return fmt.Errorf("suricata %s was built without nDPI (reconfigure with --enable-ndpi --with-ndpi=<nDPI source>)", b.Version)
+	}
+	return nil
+}
+
+// SupportedSuricataVersion reports whether v ("8.0.2", "8.0.1-dev") is in the
+// supported series.
+func SupportedSuricataVersion(v string) bool {
+	parts := strings.SplitN(v, ".", 3)
+	if len(parts) < 2 {
+		return false
+	}
+	for _, p := range parts[:2] {
+		if _, err := strconv.Atoi(p); err != nil {
+			return false
+		}
+	}
+	return parts[0]+"."+parts[1] == SupportedSuricataSeries
+}
+
+// PluginCheckOptions describe the plugin and what it must match.
+type PluginCheckOptions struct {
+	Path string
+	// SuricataBinPath, when it is an ELF file, sets the architecture the plugin
+	// must match; otherwise the host architecture is used.
+	SuricataBinPath string
+	// LibraryDirs are searched for needed libraries before the system dirs.
+	LibraryDirs []string
+	FS          fsutil.FS
+}
+
+// CheckNDPIPlugin verifies ndpi.so is a shared object for the right
+// architecture that exports SCPluginRegister and whose needed libraries exist.
+func CheckNDPIPlugin(opts PluginCheckOptions) error {
+	fs := opts.FS
+	if fs == nil {
+		fs = fsutil.OSFS{}
+	}
+
+	raw, err := fs.ReadFile(opts.Path)
+	if err != nil {
+		return fmt.Errorf("read nDPI plugin: %w", err)
+	}
+	f, err := elf.NewFile(bytes.NewReader(raw))
+	if err != nil {
+		return fmt.Errorf("nDPI plugin %s is not an ELF file: %w", opts.Path, err)
+	}
+	defer f.Close()
+
+	if f.Type != elf.ET_DYN {
+		return fmt.Errorf("nDPI plugin %s is %s, not a shared object", opts.Path, f.Type)
+	}
+
+	want, from := hostMachine(), "this host"
+	if opts.SuricataBinPath != "" {
+		if bin, err := fs.ReadFile(opts.SuricataBinPath); err == nil {
+			if bf, err := elf.NewFile(bytes.NewReader(bin)); err == nil {
+				want, from = bf.Machine, opts.SuricataBinPath
+				bf.Close()
+			}
+		}
+	}
+	if want != elf.EM_NONE && f.Machine != want {
+		return fmt.Errorf("nDPI plugin %s is built for %s but %s is %s", opts.Path, f.Machine, from, want)
+	}
+
+	syms, err := f.DynamicSymbols()
+	if err != nil {
+		return fmt.Errorf("nDPI plugin %s has no dynamic symbols: %w", opts.Path, err)
+	}
+	if !slices.ContainsFunc(syms, func(s elf.Symbol) bool {
+		return s.Name == PluginRegisterSymbol && s.Section != elf.SHN_UNDEF && elf.ST_TYPE(s.Info) == elf.STT_FUNC
+	}) {
+		return fmt.Errorf("nDPI plugin %s does not export %s, so it is not a Suricata plugin", opts.Path, PluginRegisterSymbol)
+	}
+
+	needed, err := f.ImportedLibraries()
+	if err != nil {
+		return fmt.Errorf("read needed libraries of %s: %w", opts.Path, err)
+	}
+	dirs := append(slices.Clone(opts.LibraryDirs), pluginRunPath(f, opts.Path)...)
+	dirs = append(dirs, systemLibraryDirs()...)
+	for _, lib := range needed {
+		if !libraryExists(fs, dirs, lib) {
+			return fmt.Errorf("nDPI plugin %s needs %s, which is not installed (searched %s)", opts.Path, lib, strings.Join(dirs, ":"))
+		}
+	}
+	return nil
+}
+
+// SuricataCompatOptions describe the Suricata install the plugin must load into.
+type SuricataCompatOptions struct {
+	PluginPath      string
+	SuricataBinPath string
+	LibraryDirs     []string
+
+	Runner executil.Runner
+	FS     fsutil.FS
+}
+
+// CheckSuricataCompat runs CheckNDPIPlugin and the --build-info checks. It
+// needs the host's libraries and binary, so it belongs where Suricata runs:
+// the host agent and doctor, not the service container.
+func CheckSuricataCompat(ctx context.Context, opts SuricataCompatOptions) (SuricataBuildInfo, error) {
+	if err := CheckNDPIPlugin(PluginCheckOptions{
+		Path:            opts.PluginPath,
+		SuricataBinPath: opts.SuricataBinPath,
+		LibraryDirs:     opts.LibraryDirs,
+		FS:              opts.FS,
+	}); err != nil {
+		return SuricataBuildInfo{}, err
+	}
+	info, err := ReadSuricataBuildInfo(ctx, opts.Runner, opts.SuricataBinPath)
+	if err != nil {
+		return SuricataBuildInfo{}, err
+	}
+	return info, info.Check()
+}
+
+var goarchMachine = map[string]elf.Machine{
+	"386":     elf.EM_386,
+	"amd64":   elf.EM_X86_64,
+	"arm":     elf.EM_ARM,
+	"arm64":   elf.EM_AARCH64,
+	"ppc64le": elf.EM_PPC64,
+	"riscv64": elf.EM_RISCV,
+	"s390x":   elf.EM_S390,
+}
+
+func hostMachine() elf.Machine {
+	return goarchMachine[runtime.GOARCH] // EM_NONE when unknown: not checked
+}
+
+// pluginRunPath expands DT_RUNPATH/DT_RPATH, including $ORIGIN.
+func pluginRunPath(f *elf.File, path string) []string {
+	var dirs []string
+	for _, tag := range []elf.DynTag{elf.DT_RUNPATH, elf.DT_RPATH} {
+		vals, _ := f.DynString(tag)
+		for _, v := range vals {
+			for _, d := range filepath.SplitList(v) {
+				d = strings.ReplaceAll(d, "${ORIGIN}", filepath.Dir(path))
+				d = strings.ReplaceAll(d, "$ORIGIN", filepath.Dir(path))
+				dirs = append(dirs, d)
+			}
+		}
+	}
+	return dirs
+}
+
+// systemLibraryDirs approximates the dynamic loader's search path:
+// LD_LIBRARY_PATH, /etc/ld.so.conf(.d) and the default dirs.
+func systemLibraryDirs() []string {
+	dirs := filepath.SplitList(os.Getenv("LD_LIBRARY_PATH"))
+	confs, _ := filepath.Glob("/etc/ld.so.conf.d/*.conf")
+	for _, conf := range append([]string{"/etc/ld.so.conf"}, confs...) {
+		raw, err := os.ReadFile(conf)
+		if err != nil {
+			continue
+		}
+		for _, ln := range strings.Split(string(raw), "\n") {
+			ln = strings.TrimSpace(ln)
+			if ln == "" || strings.HasPrefix(ln, "#") || strings.HasPrefix(ln, "include") {
+				continue
+			}
+			dirs = append(dirs, ln)
+		}
+	}
+	return append(dirs, "/lib", "/usr/lib", "/lib64", "/usr/lib64", "/usr/local/lib",
+		"/lib/"+multiarch(), "/usr/lib/"+multiarch())
+}
+
+func multiarch() string {
+	switch runtime.GOARCH {
+	case "amd64":
+		return "x86_64-linux-gnu"
+	case "arm64":
+		return "aarch64-linux-gnu"
+	case "386":
+		return "i386-linux-gnu"
+	case "arm":
+		return "arm-linux-gnueabihf"
+	}
+	return runtime.GOARCH + "-linux-gnu"
+}
+
+func libraryExists(fs fsutil.FS, dirs []string, lib string) bool {
+	if strings.Contains(lib, "/") {
+		_, err := fs.Stat(lib)
+		return err == nil
+	}
+	for _, d := range dirs {
+		if d == "" {
+			continue
+		}
+		if _, err := fs.Stat(filepath.Join(d, lib)); err == nil {
+			return true
+		}
+	}
+	return false
+}
@@ -1,6 +1,9 @@
 package integration
 
 import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
 	"net"
 	"os"
 	"path/filepath"
@@ -68,3 +71,82 @@ func startUnixSocketListener(t *testing.T, sock string) net.Listener {
 
 	return l
 }
+
+type pluginELF struct {
+	typ     elf.Type    // default ET_DYN
+	machine elf.Machine // default: this host
+	symbols []string    // exported functions
+	needed  []string    // DT_NEEDED libraries
+}
+
+// writePluginELF writes a minimal 64-bit ELF with just the dynamic symbol
+// and DT_NEEDED tables that CheckNDPIPlugin reads.
+func writePluginELF(t *testing.T, path string, p pluginELF) {
+	t.Helper()
+	if p.typ == elf.ET_NONE {
+		p.typ = elf.ET_DYN
+	}
+	if p.machine == elf.EM_NONE {
+		p.machine = hostMachine()
+	}
+
+	le := binary.LittleEndian
+	dynstr := []byte{0}
+	str := func(s string) uint32 {
+		off := len(dynstr)
+		dynstr = append(append(dynstr, s...), 0)
+		return uint32(off)
+	}
+	var dynsym, dynamic bytes.Buffer
+	_ = binary.Write(&dynsym, le, elf.Sym64{})
+	for _, name := range p.symbols {
+		_ = binary.Write(&dynsym, le, elf.Sym64{Name: str(name), Info: elf.ST_INFO(elf.STB_GLOBAL, elf.STT_FUNC), Shndx: 1, Value: 0x1000})
+	}
+	for _, lib := range p.needed {
+		_ = binary.Write(&dynamic, le, elf.Dyn64{Tag: int64(elf.DT_NEEDED), Val: uint64(str(lib))})
+	}
+	_ = binary.Write(&dynamic, le, elf.Dyn64{Tag: int64(elf.DT_NULL)})
+	shstr := []byte("\x00.dynstr\x00.dynsym\x00.dynamic\x00.shstrtab\x00")
+
+	align := func(n int) int { return (n + 7) &^ 7 }
+	dynstrOff := 64
+	dynsymOff := align(dynstrOff + len(dynstr))
+	dynamicOff := dynsymOff + dynsym.Len()
+	shstrOff := dynamicOff + dynamic.Len()
+	shOff := align(shstrOff + len(shstr))
+
+	h := elf.Header64{
+		Type:      uint16(p.typ),
+		Machine:   uint16(p.machine),
+		Version:   uint32(elf.EV_CURRENT),
+		Shoff:     uint64(shOff),
+		Ehsize:    64,
+		Shentsize: 64,
+		Shnum:     5,
+		Shstrndx:  4,
+	}
+	copy(h.Ident[:], elf.ELFMAG)
+	h.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	h.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	h.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+
+	sections := []elf.Section64{
+		{},
+		{Name: 1, Type: uint32(elf.SHT_STRTAB), Off: uint64(dynstrOff), Size: uint64(len(dynstr)), Addralign: 1},
+		{Name: 9, Type: uint32(elf.SHT_DYNSYM), Off: uint64(dynsymOff), Size: uint64(dynsym.Len()), Link: 1, Info: 1, Addralign: 8, Entsize: 24},
+		{Name: 17, Type: uint32(elf.SHT_DYNAMIC), Off: uint64(dynamicOff), Size: uint64(dynamic.Len()), Link: 1, Addralign: 8, Entsize: 16},
+		{Name: 26, Type: uint32(elf.SHT_STRTAB), Off: uint64(shstrOff), Size: uint64(len(shstr)), Addralign: 1},
+	}
+
+	var b bytes.Buffer
+	_ = binary.Write(&b, le, h)
+	pad := func(to int) { b.Write(make([]byte, to-b.Len())) }
+	b.Write(dynstr)
+	pad(dynsymOff)
+	b.Write(dynsym.Bytes())
+	b.Write(dynamic.Bytes())
+	b.Write(shstr)
+	pad(shOff)
+	_ = binary.Write(&b, le, sections)
+	writeFile(t, path, b.String(), 0o644)
+}
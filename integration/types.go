@@ -22,6 +22,13 @@ type ApplyConfigReport struct {
 	ReloadStatus     ReloadStatus
 	ReloadOutput     string
 	Warnings         []string
+
+	RulesValidation *RulesValidationReport
+	RulesDeploy     *RulesDeployReport
+	Bundle          *AppliedRuleBundle
+	RuleOverrides   *RuleOverridesReport
+	RulesDiff       *RulesDiff
+	Reload          *RuleReload
 }
 
 type ApplyConfigOptions struct {
@@ -34,9 +41,32 @@ type ApplyConfigOptions struct {
 
 	SystemctlPath   string
 	SuricataService string
+	SystemdBackend  string
+	// Systemd restarts the unit after a reconcile; built from SystemdBackend
+	// when nil.
+	Systemd systemd.Manager
 
 	ReloadCommand string
 	ReloadTimeout time.Duration
+	// ReloadPollInterval paces ruleset-reload-time polling (NonblockingReloadCommand).
+	ReloadPollInterval time.Duration
+	// Reloads, when set, records every nonblocking reload for GET /reloads/{id}.
+	Reloads *RuleReloadTracker
+
+	NDPIPluginPath       string
+	RulesLocalDir        string
+	RulesDeployDir       string
+	RulesValidateTimeout time.Duration
+	BundlePublicKeys     []string
+
+	RuleOverrides          []RuleOverride
+	RuleOverridesStatePath string
+	// RulesRollbackDir keeps the rules a deploy replaced, for RollbackRules;
+	// empty disables rollback.
+	RulesRollbackDir string
+
+	// Bundle is set when RulesLocalDir holds an unpacked, verified bundle.
+	Bundle *AppliedRuleBundle
 
 	CommandRunner executil.Runner
 	FS            fsutil.FS
@@ -66,18 +96,21 @@ const (
 	ReloadOK      ReloadStatus = "ok"
 	ReloadTimeout ReloadStatus = "timeout"
 	ReloadFailed  ReloadStatus = "failed"
+	ReloadPending ReloadStatus = "pending"
 )
 
 type RunnerOptions struct {
 	Apply         ApplyConfigOptions
 	NDPIValidate  NDPIValidateOptions
 	SuricataStart SuricataStartOptions
+	PcapTests     PcapTestOptions
 }
 
 type SuricataStartOptions struct {
 	SocketCandidates []string
 	SystemctlPath    string
 	SystemdUnit      string
+	SystemdBackend   string
 	StartTimeout     time.Duration
 	Dialer           netutil.Dialer
 	Systemd          systemd.Manager
@@ -0,0 +1,219 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"integration-suricata-ndpi/pkg/executil"
+	"integration-suricata-ndpi/pkg/fsutil"
+	"integration-suricata-ndpi/pkg/logger"
+)
+
+const defaultRulesValidateTimeout = 30 * time.Second
+
+type RulesValidateOptions struct {
+	SuricataBinPath     string
+	NDPIPluginPath      string
+	RuleFiles           []string
+	ClassificationFile  string
+	ReferenceConfigFile string
+	Timeout             time.Duration
+
+	CommandRunner executil.Runner
+	FS            fsutil.FS
+}
+
+type RuleError struct {
+	SID       uint64 `json:"sid,omitempty"`
+	File      string `json:"file,omitempty"`
+	Line      int    `json:"line,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	Message   string `json:"message"`
+}
+
+type RulesValidationReport struct {
+	RuleFiles []string    `json:"rule_files"`
+	Valid     bool        `json:"valid"`
+	Errors    []RuleError `json:"errors,omitempty"`
+	Output    string      `json:"output,omitempty"`
+	Duration  string      `json:"duration"`
+}
+
+type RulesRejectedError struct {
+	Report RulesValidationReport
+}
+
+func (e *RulesRejectedError) Error() string {
+	if len(e.Report.Errors) == 0 {
+		return "rule set rejected by suricata -T"
+	}
+	first := e.Report.Errors[0]
+	if first.SID != 0 {
+		return fmt.Sprintf("rule set rejected by suricata -T: %d error(s), first sid=%d: %s",
+			len(e.Report.Errors), first.SID, first.Message)
+	}
+	return fmt.Sprintf("rule set rejected by suricata -T: %d error(s), first: %s",
+		len(e.Report.Errors), first.Message)
+}
+
+func (e *RulesRejectedError) HTTPStatus() int { return http.StatusUnprocessableEntity }
+
+func (e *RulesRejectedError) Details() any { return e.Report }
+
+func ListRuleFiles(dir string, fs fsutil.FS) ([]string, error) {
+	if fs == nil {
+		fs = fsutil.OSFS{}
+	}
+	files, err := fs.Glob(filepath.Join(dir, "*.rules"))
+	if err != nil {
+		return nil, fmt.Errorf("list rule files in %s: %w", dir, err)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func ValidateRuleFiles(ctx context.Context, opts RulesValidateOptions) (RulesValidationReport, error) {
+	rep := RulesValidationReport{
+		RuleFiles: append([]string(nil), opts.RuleFiles...),
+	}
+
+	if len(opts.RuleFiles) == 0 {
+		rep.Valid = true
+		rep.Duration = "0s"
+		return rep, nil
+	}
+
+	runner := opts.CommandRunner
+	if runner == nil {
+		runner = executil.DefaultRunner{}
+	}
+	suricataBin := strings.TrimSpace(opts.SuricataBinPath)
+	if suricataBin == "" {
+		suricataBin = "suricata"
+	}
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = defaultRulesValidateTimeout
+	}
+
+	sb, err := newRuleSandbox(ruleSandboxOptions{
+		NDPIPluginPath:      opts.NDPIPluginPath,
+		RuleFiles:           opts.RuleFiles,
+		ClassificationFile:  opts.ClassificationFile,
+		ReferenceConfigFile: opts.ReferenceConfigFile,
+		FS:                  opts.FS,
+	})
+	if err != nil {
+		return rep, err
+	}
+	defer func() { _ = sb.Close() }()
+
+	logger.Infow("Validating rule files in sandbox (suricata -T)",
+		"rule_files", len(opts.RuleFiles),
+		"sandbox", sb.Dir,
+		"timeout", timeout,
+	)
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	vctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	started := time.Now()
+	out, verr := runner.CombinedOutput(vctx, suricataBin, "-T", "-c", sb.ConfigPath, "-l", sb.LogDir)
+	rep.Duration = time.Since(started).Round(time.Millisecond).String()
+	rep.Output = strings.TrimSpace(string(out))
+
+	if errors.Is(vctx.Err(), context.DeadlineExceeded) {
+		return rep, fmt.Errorf("suricata -T timed out after %s", timeout)
+	}
+	if verr == nil && vctx.Err() != nil {
+		return rep, vctx.Err()
+	}
+
+	rep.Errors = parseSuricataRuleErrors(rep.Output, sb.originOf)
+
+	if verr == nil && len(rep.Errors) == 0 {
+		rep.Valid = true
+		return rep, nil
+	}
+
+	if len(rep.Errors) == 0 {
+		rep.Errors = append(rep.Errors, RuleError{
+			Message: fmt.Sprintf("suricata -T failed: %v", verr),
+		})
+	}
+	return rep, &RulesRejectedError{Report: rep}
+}
+
+var (
+	sigErrorRe   = regexp.MustCompile(`error parsing signature "(.*)" from file (.+?) at line (\d+)`)
+	sidRe        = regexp.MustCompile(`(?:^|[;(\s])sid\s*:\s*(\d+)`)
+	logSuffixRe  = regexp.MustCompile(`\s*\[[A-Za-z0-9_]+:[A-Za-z0-9_.\-]+:\d+\]\s*$`)
+	logPrefixRe  = regexp.MustCompile(`^(?:\S+\s+-\s+)?(?:<?(?:Error|E)>?:?\s*|\[ERRCODE:[^\]]*\]\s*-\s*)`)
+	logModuleRe  = regexp.MustCompile(`^[a-z0-9\-]+:\s+`)
+	logErrLineRe = regexp.MustCompile(`(?i)(^|\s|<)(error|e):|\[ERRCODE:`)
+)
+
+// parseSuricataRuleErrors turns `suricata -T` output into per-signature errors.
+// Error lines preceding an "error parsing signature" line are its reason.
+func parseSuricataRuleErrors(output string, origin func(string) string) []RuleError {
+	var (
+		errs    []RuleError
+		pending []string
+	)
+
+	for _, raw := range strings.Split(output, "\n") {
+		line := strings.TrimSpace(raw)
+		if line == "" {
+			continue
+		}
+
+		if m := sigErrorRe.FindStringSubmatch(line); m != nil {
+			sig := strings.ReplaceAll(m[1], `\"`, `"`)
+			lineNo, _ := strconv.Atoi(m[3])
+			file := m[2]
+			if origin != nil {
+				file = origin(file)
+			}
+
+			re := RuleError{
+				File:      file,
+				Line:      lineNo,
+				Signature: sig,
+				Message:   strings.Join(pending, "; "),
+			}
+			if sm := sidRe.FindStringSubmatch(sig); sm != nil {
+				re.SID, _ = strconv.ParseUint(sm[1], 10, 64)
+			}
+			if re.Message == "" {
+				re.Message = "error parsing signature"
+			}
+
+			errs = append(errs, re)
+			pending = nil
+			continue
+		}
+
+		if logErrLineRe.MatchString(line) {
+			pending = append(pending, cleanSuricataLogLine(line))
+		}
+	}
+	return errs
+}
+
+func cleanSuricataLogLine(line string) string {
+	line = logSuffixRe.ReplaceAllString(line, "")
+	line = logPrefixRe.ReplaceAllString(line, "")
+	line = logModuleRe.ReplaceAllString(line, "")
+	return strings.TrimSpace(line)
+}
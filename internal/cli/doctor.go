@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"integration-suricata-ndpi/integration"
+)
+
+func doctorCommand(component string, extra ...cli.Flag) *cli.Command {
+	return &cli.Command{
+		Name:  "doctor",
+		Usage: "Check config, paths, Suricata, the plugin and the sockets; report every problem with a fix",
+		Flags: append([]cli.Flag{
+			&cli.StringFlag{
+				Name:  "config",
+				Value: "config/config.yaml",
+				Usage: "Path to config file",
+			},
+			&cli.StringFlag{
+				Name:    "output",
+				Aliases: []string{"o"},
+				Value:   "table",
+				Usage:   "table or json",
+			},
+			&cli.DurationFlag{
+				Name:  "timeout",
+				Value: 5 * time.Second,
+				Usage: "Timeout for each probe",
+			},
+		}, extra...),
+		Action: func(c *cli.Context) error {
+			t := &target{output: c.String("output"), out: c.App.Writer}
+			if t.output != "table" && t.output != "json" {
+				return fmt.Errorf("--output must be table or json, got %q", t.output)
+			}
+
+			rep := integration.RunDoctor(c.Context, integration.DoctorOptions{
+				Component:       component,
+				ConfigPath:      c.String("config"),
+				HostAgentSocket: c.String("sock"),
+				Timeout:         c.Duration("timeout"),
+			})
+			if err := t.print(rep, func(w io.Writer) { printDoctor(w, rep) }); err != nil {
+				return err
+			}
+
+			failed := 0
+			for _, f := range rep.Findings {
+				if f.Status == integration.DoctorFail {
+					failed++
+				}
+			}
+			if failed > 0 {
+				return fmt.Errorf("doctor: %d check(s) failed", failed)
+			}
+			return nil
+		},
+	}
+}
+
+func printDoctor(w io.Writer, rep *integration.DoctorReport) {
+	for _, f := range rep.Findings {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", f.Status, f.Check, f.Message)
+		if f.Hint != "" {
+			fmt.Fprintf(w, "\t\t-> %s\n", f.Hint)
+		}
+	}
+}
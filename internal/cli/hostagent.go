@@ -6,6 +6,7 @@ import (
 
 	"github.com/urfave/cli/v2"
 
+	"integration-suricata-ndpi/integration"
 	"integration-suricata-ndpi/internal/app"
 	"integration-suricata-ndpi/internal/wire"
 )
@@ -49,10 +50,15 @@ func NewHostAgentApp() *cli.App {
 						Value: "",
 						Usage: "Path to systemctl (overrides config)",
 					},
+					&cli.StringFlag{
+						Name:  "audit-log",
+						Value: "",
+						Usage: "Path to the audit log (overrides config)",
+					},
 					&cli.DurationFlag{
 						Name:  "restart-timeout",
 						Value: 20 * time.Second,
-						Usage: "systemctl restart timeout",
+						Usage: "Suricata restart timeout",
 					},
 					&cli.DurationFlag{
 						Name:  "shutdown-timeout",
@@ -68,6 +74,7 @@ func NewHostAgentApp() *cli.App {
 						NDPIPluginPath:  c.String("ndpi-plugin"),
 						SystemdUnit:     c.String("unit"),
 						SystemctlPath:   c.String("systemctl"),
+						AuditLogPath:    c.String("audit-log"),
 						RestartTimeout:  c.Duration("restart-timeout"),
 						ShutdownTimeout: c.Duration("shutdown-timeout"),
 					}
@@ -79,6 +86,10 @@ func NewHostAgentApp() *cli.App {
 					return app.RunWithSignals(context.Background(), svc, opts.ShutdownTimeout)
 				},
 			},
+			doctorCommand(integration.DoctorHostAgent, &cli.StringFlag{
+				Name:  "sock",
+				Usage: "Host agent unix socket to probe (default: http.host_agent_socket)",
+			}),
 		},
 	}
 }
@@ -6,6 +6,7 @@ import (
 
 	"github.com/urfave/cli/v2"
 
+	"integration-suricata-ndpi/integration"
 	"integration-suricata-ndpi/internal/app"
 	"integration-suricata-ndpi/internal/wire"
 )
@@ -38,6 +39,14 @@ func NewIntegrationApp() *cli.App {
 					return app.RunWithSignals(context.Background(), svc, c.Duration("shutdown-timeout"))
 				},
 			},
+			planCommand(),
+			reconcileCommand(),
+			applyCommand(),
+			ndpiCommand(),
+			suricataCommand(),
+			doctorCommand(integration.DoctorIntegration),
+			rulesCommand(),
+			tokenCommand(),
 		},
 	}
 }
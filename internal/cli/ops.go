@@ -0,0 +1,530 @@
+package cli
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"integration-suricata-ndpi/integration"
+	"integration-suricata-ndpi/internal/config"
+	"integration-suricata-ndpi/pkg/agentclient"
+	"integration-suricata-ndpi/pkg/apiclient"
+)
+
+// opsFlags are shared by the one-off operations. Without --server they run in
+// this process from --config; with it they call a running service.
+func opsFlags(extra ...cli.Flag) []cli.Flag {
+	return append([]cli.Flag{
+		&cli.StringFlag{
+			Name:  "config",
+			Value: "config/config.yaml",
+			Usage: "Path to config file (in-process mode)",
+		},
+		&cli.StringFlag{
+			Name:    "server",
+			EnvVars: []string{"INTEGRATION_SERVER"},
+			Usage:   "URL of a running integration service, e.g. https://127.0.0.1:8080",
+		},
+		&cli.StringFlag{
+			Name:    "token",
+			EnvVars: []string{"INTEGRATION_TOKEN"},
+			Usage:   "Bearer token for --server",
+		},
+		&cli.StringFlag{
+			Name:  "ca-cert",
+			Usage: "PEM CA to verify the --server certificate",
+		},
+		&cli.BoolFlag{
+			Name:  "insecure",
+			Usage: "Skip verification of the --server certificate (self-signed dev certificates)",
+		},
+		&cli.StringFlag{
+			Name:    "output",
+			Aliases: []string{"o"},
+			Value:   "table",
+			Usage:   "table or json",
+		},
+		&cli.DurationFlag{
+			Name:  "timeout",
+			Value: 5 * time.Minute,
+			Usage: "Give up after this long",
+		},
+	}, extra...)
+}
+
+func waitFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name:  "wait",
+		Value: true,
+		Usage: "With --server, wait for the job to finish (--wait=false prints the queued job)",
+	}
+}
+
+func planCommand() *cli.Command {
+	return &cli.Command{
+		Name:   "plan",
+		Usage:  "Show what reconcile would change in the Suricata config",
+		Flags:  opsFlags(),
+		Action: runPlan,
+	}
+}
+
+func reconcileCommand() *cli.Command {
+	return &cli.Command{
+		Name:   "reconcile",
+		Usage:  "Patch the Suricata config from the template and restart Suricata if needed",
+		Flags:  opsFlags(waitFlag()),
+		Action: runReconcile,
+	}
+}
+
+func applyCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "apply",
+		Usage: "Validate and deploy the local rules (or a signed bundle) and reload Suricata",
+		Flags: opsFlags(waitFlag(), &cli.StringFlag{
+			Name:  "bundle",
+			Usage: "Signed rule bundle (.tar.gz) to apply instead of the local rules",
+		}),
+		Action: runApply,
+	}
+}
+
+func ndpiCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "ndpi",
+		Usage: "nDPI plugin state; enable and disable go through the host agent",
+		Subcommands: []*cli.Command{
+			{
+				Name:   "status",
+				Usage:  "Show whether the nDPI plugin is enabled in the Suricata config",
+				Flags:  opsFlags(),
+				Action: runNDPIStatus,
+			},
+			{
+				Name:   "enable",
+				Usage:  "Enable the nDPI plugin and restart Suricata",
+				Flags:  opsFlags(waitFlag()),
+				Action: func(c *cli.Context) error { return runNDPIToggle(c, true) },
+			},
+			{
+				Name:   "disable",
+				Usage:  "Disable the nDPI plugin and restart Suricata",
+				Flags:  opsFlags(waitFlag()),
+				Action: func(c *cli.Context) error { return runNDPIToggle(c, false) },
+			},
+		},
+	}
+}
+
+func suricataCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "suricata",
+		Usage: "Suricata service operations",
+		Subcommands: []*cli.Command{
+			{
+				Name:   "ensure",
+				Usage:  "Start Suricata through the host agent unless its control socket answers",
+				Flags:  opsFlags(waitFlag()),
+				Action: runSuricataEnsure,
+			},
+		},
+	}
+}
+
+// target is where an operation runs: a config for in-process calls or a
+// client for --server.
+type target struct {
+	cfg    *config.Config
+	client *apiclient.Client
+	output string
+	out    io.Writer
+}
+
+func newTarget(c *cli.Context) (*target, error) {
+	t := &target{output: c.String("output"), out: c.App.Writer}
+	if t.output != "table" && t.output != "json" {
+		return nil, fmt.Errorf("--output must be table or json, got %q", t.output)
+	}
+
+	if server := c.String("server"); server != "" {
+		tlsCfg := &tls.Config{InsecureSkipVerify: c.Bool("insecure")}
+		if p := c.String("ca-cert"); p != "" {
+			raw, err := os.ReadFile(p)
+			if err != nil {
+				return nil, fmt.Errorf("read --ca-cert: %w", err)
+			}
+			tlsCfg.RootCAs = x509.NewCertPool()
+			if !tlsCfg.RootCAs.AppendCertsFromPEM(raw) {
+				return nil, fmt.Errorf("no PEM certificates in %s", p)
+			}
+		}
+		client, err := apiclient.New(server, apiclient.Options{
+			Token:   c.String("token"),
+			TLS:     tlsCfg,
+			Timeout: c.Duration("timeout"),
+		})
+		if err != nil {
+			return nil, err
+		}
+		t.client = client
+		return t, nil
+	}
+
+	cfg, err := config.Load(c.String("config"))
+	if err != nil {
+		return nil, err
+	}
+	t.cfg = cfg
+	return t, nil
+}
+
+func (t *target) applyOptions() integration.ApplyConfigOptions {
+	return integration.OptionsFromConfig(t.cfg).Apply
+}
+
+func (t *target) hostAgent() (*agentclient.Client, error) {
+	socket := t.cfg.HTTP.HostAgentSocket
+	if socket == "" {
+		return nil, fmt.Errorf("http.host_agent_socket is empty")
+	}
+	return agentclient.New(socket, t.cfg.HTTP.HostAgentTimeout), nil
+}
+
+func opsContext(c *cli.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(c.Context, c.Duration("timeout"))
+}
+
+func runPlan(c *cli.Context) error {
+	t, err := newTarget(c)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := opsContext(c)
+	defer cancel()
+
+	var rep integration.PlanReport
+	if t.client != nil {
+		out, err := t.client.Plan(ctx)
+		if err != nil {
+			return err
+		}
+		rep = *out
+	} else {
+		rep, err = integration.PlanConfig(ctx, t.applyOptions())
+		if err != nil {
+			return err
+		}
+	}
+	return t.print(rep, func(w io.Writer) { printPlan(w, rep) })
+}
+
+func runReconcile(c *cli.Context) error {
+	t, err := newTarget(c)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := opsContext(c)
+	defer cancel()
+
+	if t.client != nil {
+		return t.runJob(ctx, c.Bool("wait"), t.client.Reconcile, func(w io.Writer, raw json.RawMessage) {
+			var rep integration.ReconcileReport
+			if json.Unmarshal(raw, &rep) == nil {
+				printReconcile(w, rep)
+			}
+		})
+	}
+
+	rep, err := integration.ReconcileConfig(ctx, t.applyOptions())
+	if perr := t.print(rep, func(w io.Writer) { printReconcile(w, rep) }); perr != nil {
+		return perr
+	}
+	return err
+}
+
+func runApply(c *cli.Context) error {
+	t, err := newTarget(c)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := opsContext(c)
+	defer cancel()
+
+	var bundle []byte
+	if p := c.String("bundle"); p != "" {
+		bundle, err = os.ReadFile(p)
+		if err != nil {
+			return fmt.Errorf("read bundle: %w", err)
+		}
+	}
+
+	if t.client != nil {
+		submit := t.client.Apply
+		if bundle != nil {
+			submit = func(ctx context.Context) (*integration.Job, error) { return t.client.ApplyBundle(ctx, bundle) }
+		}
+		return t.runJob(ctx, c.Bool("wait"), submit, func(w io.Writer, raw json.RawMessage) {
+			var rep integration.ApplyConfigReport
+			if json.Unmarshal(raw, &rep) == nil {
+				printApply(w, rep)
+			}
+		})
+	}
+
+	// the service makes sure Suricata runs before every apply; do the same
+	if err := t.ensureSuricata(ctx); err != nil {
+		return err
+	}
+
+	var rep integration.ApplyConfigReport
+	if bundle != nil {
+		rep, err = integration.ApplyRuleBundle(ctx, t.applyOptions(), bundle)
+	} else {
+		rep, err = integration.ApplyConfigWithContext(ctx, t.applyOptions())
+	}
+	if perr := t.print(rep, func(w io.Writer) { printApply(w, rep) }); perr != nil {
+		return perr
+	}
+	return err
+}
+
+// ensureSuricata starts Suricata through the host agent unless its control
+// socket already answers.
+func (t *target) ensureSuricata(ctx context.Context) error {
+	agent, err := t.hostAgent()
+	if err != nil {
+		return err
+	}
+	resp, err := agent.EnsureSuricataStarted(ctx)
+	if err != nil {
+		return err
+	}
+	if !resp.OK {
+		return fmt.Errorf("host-agent ensure suricata failed: %s (%s)", resp.Message, resp.Code)
+	}
+	return nil
+}
+
+func runNDPIStatus(c *cli.Context) error {
+	t, err := newTarget(c)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := opsContext(c)
+	defer cancel()
+
+	var st agentclient.NDPIStatusResponse
+	if t.client != nil {
+		out, err := t.client.NDPIStatus(ctx)
+		if err != nil {
+			return err
+		}
+		st = *out
+	} else {
+		// read the config here; only changing it needs the host agent
+		cfgPath, err := integration.FirstExistingPath(t.cfg.Suricata.ConfigCandidates)
+		if err != nil {
+			return fmt.Errorf("suricata.config_candidates: %w", err)
+		}
+		enabled, line, err := integration.NDPIStatus(cfgPath, t.cfg.Paths.NDPIPluginPath)
+		if err != nil {
+			return err
+		}
+		st = agentclient.NDPIStatusResponse{OK: true, Enabled: enabled, Line: line}
+	}
+	return t.print(st, func(w io.Writer) {
+		row(w, "enabled", st.Enabled)
+		row(w, "line", st.Line)
+	})
+}
+
+func runNDPIToggle(c *cli.Context, enable bool) error {
+	t, err := newTarget(c)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := opsContext(c)
+	defer cancel()
+
+	if t.client != nil {
+		submit := t.client.DisableNDPI
+		if enable {
+			submit = t.client.EnableNDPI
+		}
+		return t.runJob(ctx, c.Bool("wait"), submit, func(w io.Writer, raw json.RawMessage) {
+			var resp agentclient.ToggleResponse
+			if json.Unmarshal(raw, &resp) == nil {
+				printToggle(w, &resp)
+			}
+		})
+	}
+
+	agent, err := t.hostAgent()
+	if err != nil {
+		return err
+	}
+	var resp *agentclient.ToggleResponse
+	if enable {
+		resp, err = agent.EnableNDPI(ctx)
+	} else {
+		resp, err = agent.DisableNDPI(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	return t.print(resp, func(w io.Writer) { printToggle(w, resp) })
+}
+
+func printToggle(w io.Writer, resp *agentclient.ToggleResponse) {
+	row(w, "enabled", resp.Enabled)
+	row(w, "changed", resp.Changed)
+	row(w, "message", resp.Message)
+}
+
+func runSuricataEnsure(c *cli.Context) error {
+	t, err := newTarget(c)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := opsContext(c)
+	defer cancel()
+
+	if t.client != nil {
+		return t.runJob(ctx, c.Bool("wait"), t.client.EnsureSuricata, func(w io.Writer, raw json.RawMessage) {
+			var resp agentclient.EnsureSuricataResponse
+			if json.Unmarshal(raw, &resp) == nil {
+				printEnsure(w, &resp)
+			}
+		})
+	}
+
+	agent, err := t.hostAgent()
+	if err != nil {
+		return err
+	}
+	resp, err := agent.EnsureSuricataStarted(ctx)
+	if err != nil {
+		return err
+	}
+	return t.print(resp, func(w io.Writer) { printEnsure(w, resp) })
+}
+
+func printEnsure(w io.Writer, resp *agentclient.EnsureSuricataResponse) {
+	row(w, "started", resp.Started)
+	row(w, "socket", resp.Socket)
+	row(w, "message", resp.Message)
+}
+
+// runJob submits a job on the server and, with wait, polls it to the end. A
+// job that does not succeed is printed and returned as an error.
+func (t *target) runJob(ctx context.Context, wait bool, submit func(context.Context) (*integration.Job, error), result func(io.Writer, json.RawMessage)) error {
+	job, err := submit(ctx)
+	if err != nil {
+		return err
+	}
+	if wait {
+		if job, err = t.client.WaitJob(ctx, job.ID, time.Second); err != nil {
+			return err
+		}
+	}
+
+	raw, _ := json.Marshal(job.Result)
+	if err := t.print(job, func(w io.Writer) {
+		row(w, "job", job.ID)
+		row(w, "kind", job.Kind)
+		row(w, "status", job.Status)
+		if job.Error != "" {
+			row(w, "error", job.Error)
+			row(w, "code", job.Code)
+		}
+		if job.Result != nil {
+			result(w, raw)
+		}
+	}); err != nil {
+		return err
+	}
+
+	if wait && job.Status != integration.JobSucceeded {
+		return fmt.Errorf("job %s %s", job.ID, job.Status)
+	}
+	return nil
+}
+
+// print writes v as indented JSON or, for table output, the rows table adds.
+func (t *target) print(v any, table func(w io.Writer)) error {
+	if t.output == "json" {
+		enc := json.NewEncoder(t.out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+	tw := tabwriter.NewWriter(t.out, 0, 4, 2, ' ', 0)
+	table(tw)
+	return tw.Flush()
+}
+
+func row(w io.Writer, key string, value any) {
+	fmt.Fprintf(w, "%s\t%v\n", key, value)
+}
+
+func printPlan(w io.Writer, rep integration.PlanReport) {
+	row(w, "target config", rep.TargetConfigPath)
+	row(w, "template", rep.TemplatePath)
+	row(w, "would change", rep.WouldChange)
+	row(w, "restart required", rep.RestartRequired)
+	row(w, "current sha256", rep.CurrentSHA256)
+	row(w, "patched sha256", rep.PatchedSHA256)
+	row(w, "bytes", fmt.Sprintf("%d -> %d", rep.CurrentBytes, rep.PatchedBytes))
+	row(w, "rule files", strings.Join(rep.RuleFiles, ", "))
+	row(w, "rule files changed", rep.RuleFilesChanged)
+}
+
+func printReconcile(w io.Writer, rep integration.ReconcileReport) {
+	row(w, "target config", rep.TargetConfigPath)
+	row(w, "would change", rep.WouldChange)
+	row(w, "applied", rep.Applied)
+	row(w, "validated", rep.Validated)
+	row(w, "restart required", rep.RestartRequired)
+	row(w, "restart performed", rep.RestartPerformed)
+	if rep.RestartCommand != "" {
+		row(w, "restart command", rep.RestartCommand)
+	}
+	row(w, "patched sha256", rep.PatchedSHA256)
+}
+
+func printApply(w io.Writer, rep integration.ApplyConfigReport) {
+	row(w, "target config", rep.TargetConfigPath)
+	if v := rep.RulesValidation; v != nil {
+		row(w, "rules valid", v.Valid)
+		if len(v.Errors) > 0 {
+			row(w, "rule errors", len(v.Errors))
+		}
+	}
+	if d := rep.RulesDeploy; d != nil {
+		row(w, "rules deployed", fmt.Sprintf("%d written, %d unchanged, %d removed", len(d.Written), len(d.Unchanged), len(d.Removed)))
+	}
+	if b := rep.Bundle; b != nil {
+		row(w, "bundle", fmt.Sprintf("%s (%s, key %s)", b.Manifest.Version, b.SHA256, b.KeyID))
+	}
+	if d := rep.RulesDiff; d != nil {
+		row(w, "rules diff", fmt.Sprintf("+%d -%d ~%d", len(d.Added), len(d.Removed), len(d.Modified)))
+	}
+	row(w, "reload command", rep.ReloadCommand)
+	row(w, "reload status", rep.ReloadStatus)
+	if r := rep.Reload; r != nil {
+		row(w, "rules loaded", r.RulesLoaded)
+		row(w, "rules failed", r.RulesFailed)
+	}
+	for _, warn := range rep.Warnings {
+		row(w, "warning", warn)
+	}
+}
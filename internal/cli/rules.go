@@ -0,0 +1,311 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/urfave/cli/v2"
+
+	"integration-suricata-ndpi/integration"
+	"integration-suricata-ndpi/internal/config"
+	"integration-suricata-ndpi/pkg/rules"
+)
+
+func rulesCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "rules",
+		Usage: "nDPI rule set tooling",
+		Subcommands: []*cli.Command{
+			{
+				Name:  "test",
+				Usage: "Replay pcap fixtures offline (suricata -r) and check alerts against expectations",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "config",
+						Value: "config/config.yaml",
+						Usage: "Path to config file",
+					},
+					&cli.StringFlag{
+						Name:  "tests-dir",
+						Value: "",
+						Usage: "Directory with *.pcap fixtures and <name>.yaml expectations (overrides rules.tests_dir)",
+					},
+					&cli.StringFlag{
+						Name:  "rules-dir",
+						Value: "",
+						Usage: "Directory with *.rules files under test (overrides paths.ndpi_rules_local)",
+					},
+					&cli.StringFlag{
+						Name:  "junit",
+						Value: "-",
+						Usage: "Write JUnit XML report to this path ('-' for stdout)",
+					},
+					&cli.StringFlag{
+						Name:  "report",
+						Value: "",
+						Usage: "Write JSON test report to this path (overrides rules.test_report_path)",
+					},
+					&cli.StringFlag{
+						Name:  "coverage-json",
+						Value: "",
+						Usage: "Write rule coverage matrix as JSON to this path",
+					},
+					&cli.StringFlag{
+						Name:  "coverage-csv",
+						Value: "",
+						Usage: "Write rule coverage matrix as CSV to this path",
+					},
+				},
+				Action: runRulesTest,
+			},
+			{
+				Name:  "bundle",
+				Usage: "Package *.rules into a signed bundle (tar.gz with manifest.json and Ed25519 signature)",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "rules-dir",
+						Required: true,
+						Usage:    "Directory with *.rules files to package",
+					},
+					&cli.StringFlag{
+						Name:     "version",
+						Required: true,
+						Usage:    "Bundle version recorded in manifest.json",
+					},
+					&cli.StringFlag{
+						Name:     "key",
+						Required: true,
+						Usage:    "File with the base64 Ed25519 private key (see 'rules keygen')",
+					},
+					&cli.StringFlag{
+						Name:     "out",
+						Required: true,
+						Usage:    "Output bundle path (.tar.gz)",
+					},
+				},
+				Action: runRulesBundle,
+			},
+			{
+				Name:      "fmt",
+				Usage:     "Rewrite rule files in canonical form (one rule per line, fixed option order)",
+				ArgsUsage: "[file or directory ...]",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "config",
+						Value: "config/config.yaml",
+						Usage: "Path to config file (used for paths.ndpi_rules_local when no arguments are given)",
+					},
+					&cli.BoolFlag{
+						Name:  "check",
+						Usage: "Do not write; list files that are not formatted and fail if there are any",
+					},
+				},
+				Action: runRulesFmt,
+			},
+			{
+				Name:  "keygen",
+				Usage: "Generate an Ed25519 key pair for signing rule bundles",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "out",
+						Required: true,
+						Usage:    "Private key path; the public key is written to <out>.pub",
+					},
+				},
+				Action: runRulesKeygen,
+			},
+		},
+	}
+}
+
+func runRulesTest(c *cli.Context) error {
+	cfg, err := config.Load(c.String("config"))
+	if err != nil {
+		return err
+	}
+
+	opts := integration.OptionsFromConfig(cfg).PcapTests
+	if v := c.String("tests-dir"); v != "" {
+		opts.TestsDir = v
+	}
+	if v := c.String("rules-dir"); v != "" {
+		opts.RulesDir = v
+	}
+
+	rep, err := integration.RunPcapTests(context.Background(), opts)
+	if err != nil {
+		return err
+	}
+
+	reportPath := cfg.Rules.TestReportPath
+	if v := c.String("report"); v != "" {
+		reportPath = v
+	}
+	if reportPath != "" {
+		if err := integration.WritePcapTestReport(reportPath, rep, nil); err != nil {
+			return fmt.Errorf("write test report: %w", err)
+		}
+	}
+
+	if c.String("coverage-json") != "" || c.String("coverage-csv") != "" {
+		ruleSet, err := integration.LoadRuleSet(opts.RulesDir, nil)
+		if err != nil {
+			return err
+		}
+		fixtures, err := integration.LoadPcapFixtures(opts.TestsDir, nil)
+		if err != nil {
+			return err
+		}
+		matrix := integration.BuildCoverageMatrix(ruleSet.Rules, fixtures, &rep)
+
+		if p := c.String("coverage-json"); p != "" {
+			if err := writeOutput(p, matrix.WriteJSON); err != nil {
+				return fmt.Errorf("write coverage json: %w", err)
+			}
+		}
+		if p := c.String("coverage-csv"); p != "" {
+			if err := writeOutput(p, matrix.WriteCSV); err != nil {
+				return fmt.Errorf("write coverage csv: %w", err)
+			}
+		}
+	}
+
+	if err := writeOutput(c.String("junit"), func(w io.Writer) error {
+		return integration.WriteJUnitReport(w, rep)
+	}); err != nil {
+		return fmt.Errorf("write junit report: %w", err)
+	}
+
+	if !rep.OK() {
+		return fmt.Errorf("%d of %d pcap tests failed", rep.Failed, rep.Total)
+	}
+	return nil
+}
+
+func writeOutput(path string, write func(w io.Writer) error) error {
+	if path == "" || path == "-" {
+		return write(os.Stdout)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func runRulesBundle(c *cli.Context) error {
+	raw, err := os.ReadFile(c.String("key"))
+	if err != nil {
+		return fmt.Errorf("read signing key: %w", err)
+	}
+	key, err := integration.ParseBundlePrivateKey(string(raw))
+	if err != nil {
+		return err
+	}
+
+	ruleFiles, err := integration.ListRuleFiles(c.String("rules-dir"), nil)
+	if err != nil {
+		return err
+	}
+
+	var m integration.RuleBundleManifest
+	if err := writeOutput(c.String("out"), func(w io.Writer) error {
+		m, err = integration.BuildRuleBundle(w, ruleFiles, c.String("version"), key, nil)
+		return err
+	}); err != nil {
+		return fmt.Errorf("build bundle: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "bundle %s: version=%s files=%d rules=%d key_id=%s\n",
+		c.String("out"), m.Version, len(m.Files), m.RuleCount, integration.BundleKeyID(key.Public().(ed25519.PublicKey)))
+	return nil
+}
+
+func runRulesKeygen(c *cli.Context) error {
+	pub, priv, err := integration.GenerateBundleKey()
+	if err != nil {
+		return err
+	}
+
+	out := c.String("out")
+	if err := os.WriteFile(out, []byte(priv+"\n"), 0o600); err != nil {
+		return err
+	}
+	if err := os.WriteFile(out+".pub", []byte(pub+"\n"), 0o644); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "private key: %s\npublic key:  %s.pub (add to rules.bundle_public_keys)\n", out, out)
+	return nil
+}
+
+func runRulesFmt(c *cli.Context) error {
+	targets := c.Args().Slice()
+	if len(targets) == 0 {
+		cfg, err := config.Load(c.String("config"))
+		if err != nil {
+			return err
+		}
+		targets = []string{cfg.Paths.NDPIRulesLocal}
+	}
+
+	var files []string
+	for _, t := range targets {
+		st, err := os.Stat(t)
+		if err != nil {
+			return err
+		}
+		if !st.IsDir() {
+			files = append(files, t)
+			continue
+		}
+		list, err := integration.ListRuleFiles(t, nil)
+		if err != nil {
+			return err
+		}
+		files = append(files, list...)
+	}
+
+	unformatted := 0
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return err
+		}
+		out, err := rules.FormatRules(data, f)
+		if err != nil {
+			return fmt.Errorf("%s: %w", f, err)
+		}
+		if bytes.Equal(data, out) {
+			continue
+		}
+
+		unformatted++
+		if c.Bool("check") {
+			fmt.Println(f)
+			continue
+		}
+		st, err := os.Stat(f)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(f, out, st.Mode().Perm()); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "formatted %s\n", f)
+	}
+
+	if c.Bool("check") && unformatted > 0 {
+		return fmt.Errorf("%d of %d rule files are not formatted (run 'integration rules fmt')", unformatted, len(files))
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package cli
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+
+	"integration-suricata-ndpi/internal/httpapi"
+)
+
+func tokenCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "token",
+		Usage: "Generate an API bearer token and the http.auth.tokens entry for it",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "name",
+				Required: true,
+				Usage:    "Identity reported for requests made with the token",
+			},
+			&cli.StringFlag{
+				Name:  "role",
+				Value: "viewer",
+				Usage: "viewer, operator or admin",
+			},
+		},
+		Action: runToken,
+	}
+}
+
+func runToken(c *cli.Context) error {
+	role := httpapi.ParseRole(c.String("role"))
+	if role == httpapi.RoleNone {
+		return fmt.Errorf("role must be viewer, operator or admin, got %q", c.String("role"))
+	}
+
+	var raw [32]byte
+	if _, err := rand.Read(raw[:]); err != nil {
+		return err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw[:])
+	sum := sha256.Sum256([]byte(token))
+
+	fmt.Fprintf(c.App.Writer, "token: %s\n\n", token)
+	fmt.Fprintf(c.App.Writer, "# add under http.auth.tokens; the token itself is not stored\n")
+	fmt.Fprintf(c.App.Writer, "- name: %q\n  sha256: %q\n  role: %q\n", c.String("name"), hex.EncodeToString(sum[:]), role)
+	return nil
+}
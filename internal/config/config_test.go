@@ -24,8 +24,29 @@ func TestApplyDefaults(t *testing.T) {
 	if cfg.Reload.Timeout != 5*time.Second {
 		t.Fatalf("reload.timeout: want 5s, got %v", cfg.Reload.Timeout)
 	}
-	if cfg.Reload.Command != "reconfigure" {
-		t.Fatalf("reload.command: want reconfigure, got %q", cfg.Reload.Command)
+	if cfg.Reload.Command != "ruleset-reload-nonblocking" {
+		t.Fatalf("reload.command: want ruleset-reload-nonblocking, got %q", cfg.Reload.Command)
+	}
+	if cfg.State.Dir != "/var/lib/integration-suricata-ndpi" || cfg.State.HistoryMaxRecords != 1000 {
+		t.Fatalf("state: want /var/lib/integration-suricata-ndpi/1000, got %q/%d", cfg.State.Dir, cfg.State.HistoryMaxRecords)
+	}
+	if cfg.HTTP.TLS.MinVersion != "1.2" || cfg.HTTP.TLS.Enabled() {
+		t.Fatalf("http.tls: want disabled with min_version 1.2, got %+v", cfg.HTTP.TLS)
+	}
+	if cfg.Reload.PollInterval != 500*time.Millisecond {
+		t.Fatalf("reload.poll_interval: want 500ms, got %v", cfg.Reload.PollInterval)
+	}
+	if cfg.Rules.ValidateTimeout != 30*time.Second {
+		t.Fatalf("rules.validate_timeout: want 30s, got %v", cfg.Rules.ValidateTimeout)
+	}
+	if cfg.Rules.TestsDir != "/var/lib/integration-suricata-ndpi/tests/pcap" || cfg.Rules.TestReportPath != "/var/lib/integration-suricata-ndpi/last_test_report.json" {
+		t.Fatalf("rules tests: want paths under /var/lib/integration-suricata-ndpi, got %q and %q", cfg.Rules.TestsDir, cfg.Rules.TestReportPath)
+	}
+	if cfg.Rules.OverridesStatePath != "/var/lib/integration-suricata-ndpi/overrides.json" {
+		t.Fatalf("rules.overrides_state_path: want /var/lib/integration-suricata-ndpi/overrides.json, got %q", cfg.Rules.OverridesStatePath)
+	}
+	if cfg.HostAgent.AuditLog != "/var/lib/ndpi-agent/audit.jsonl" {
+		t.Fatalf("host_agent.audit_log: want /var/lib/ndpi-agent/audit.jsonl, got %q", cfg.HostAgent.AuditLog)
 	}
 	if cfg.System.Systemctl != "/usr/bin/systemctl" {
 		t.Fatalf("system.systemctl: want /usr/bin/systemctl, got %q", cfg.System.Systemctl)
@@ -33,6 +54,9 @@ func TestApplyDefaults(t *testing.T) {
 	if cfg.System.SuricataService != "suricata" {
 		t.Fatalf("system.suricata_service: want suricata, got %q", cfg.System.SuricataService)
 	}
+	if cfg.System.SystemdBackend != "auto" {
+		t.Fatalf("system.systemd_backend: want auto, got %q", cfg.System.SystemdBackend)
+	}
 }
 
 func TestValidate_RequiredFields(t *testing.T) {
@@ -138,6 +162,79 @@ func TestValidate_RequiredFields(t *testing.T) {
 			}(),
 			wantErr: "config: reload.command=shutdown is forbidden",
 		},
+		{
+			name: "tls key without cert",
+			cfg: func() *Config {
+				c := base()
+				c.HTTP.TLS.KeyFile = "/etc/ssl/api.key"
+				return c
+			}(),
+			wantErr: "config: http.tls.cert_file and http.tls.key_file go together",
+		},
+		{
+			name: "tls client ca without tls",
+			cfg: func() *Config {
+				c := base()
+				c.HTTP.TLS.ClientCA = "/etc/ssl/ca.pem"
+				return c
+			}(),
+			wantErr: "config: http.tls.client_ca needs http.tls.cert_file or http.tls.self_signed",
+		},
+		{
+			name: "auth token not hashed",
+			cfg: func() *Config {
+				c := base()
+				c.HTTP.Auth.Tokens = []TokenConfig{{Name: "ci", SHA256: "s3cret", Role: "operator"}}
+				return c
+			}(),
+			wantErr: "config: http.auth.tokens[0].sha256 must be a hex sha256 digest",
+		},
+		{
+			name: "auth token unknown role",
+			cfg: func() *Config {
+				c := base()
+				c.HTTP.Auth.Tokens = []TokenConfig{{Name: "ci", SHA256: strings.Repeat("ab", 32), Role: "root"}}
+				return c
+			}(),
+			wantErr: "config: http.auth.tokens[0].role must be viewer, operator or admin",
+		},
+		{
+			name: "auth disabled with tokens",
+			cfg: func() *Config {
+				c := base()
+				c.HTTP.Auth.Disabled = true
+				c.HTTP.Auth.Tokens = []TokenConfig{{Name: "ci", SHA256: strings.Repeat("ab", 32), Role: "operator"}}
+				return c
+			}(),
+			wantErr: "config: http.auth.disabled cannot be combined with tokens or client_certs",
+		},
+		{
+			name: "access rule without callers",
+			cfg: func() *Config {
+				c := base()
+				c.HostAgent.Access = []AccessRuleConfig{{Name: "monitoring", Routes: []string{"GET /health"}}}
+				return c
+			}(),
+			wantErr: "config: host_agent.access[0] names no users or groups",
+		},
+		{
+			name: "access rule without routes",
+			cfg: func() *Config {
+				c := base()
+				c.HostAgent.Access = []AccessRuleConfig{{Name: "monitoring", Users: []string{"monitoring"}}}
+				return c
+			}(),
+			wantErr: "config: host_agent.access[0].routes is required",
+		},
+		{
+			name: "unknown systemd backend",
+			cfg: func() *Config {
+				c := base()
+				c.System.SystemdBackend = "sysvinit"
+				return c
+			}(),
+			wantErr: "config: system.systemd_backend must be auto, dbus or systemctl",
+		},
 	}
 
 	for _, tc := range cases {
@@ -12,6 +12,18 @@ func applyDefaults(cfg *Config) {
 	if cfg.HTTP.HostAgentTimeout == 0 {
 		cfg.HTTP.HostAgentTimeout = 10 * time.Second
 	}
+	if cfg.HTTP.TLS.MinVersion == "" {
+		cfg.HTTP.TLS.MinVersion = "1.2"
+	}
+	if cfg.State.Dir == "" {
+		cfg.State.Dir = "/var/lib/integration-suricata-ndpi"
+	}
+	if cfg.State.HistoryMaxRecords == 0 {
+		cfg.State.HistoryMaxRecords = 1000
+	}
+	if cfg.HTTP.EventsBuffer == 0 {
+		cfg.HTTP.EventsBuffer = 256
+	}
 	if cfg.Paths.SuricataBin == "" {
 		cfg.Paths.SuricataBin = "/usr/bin/suricata"
 	}
@@ -19,15 +31,39 @@ func applyDefaults(cfg *Config) {
 		cfg.Reload.Timeout = 5 * time.Second
 	}
 	if cfg.Reload.Command == "" {
-		cfg.Reload.Command = "reconfigure"
+		cfg.Reload.Command = "ruleset-reload-nonblocking"
+	}
+	if cfg.Reload.PollInterval == 0 {
+		cfg.Reload.PollInterval = 500 * time.Millisecond
+	}
+	if cfg.Rules.ValidateTimeout == 0 {
+		cfg.Rules.ValidateTimeout = 30 * time.Second
+	}
+	if cfg.Rules.TestsDir == "" {
+		cfg.Rules.TestsDir = "/var/lib/integration-suricata-ndpi/tests/pcap"
+	}
+	if cfg.Rules.TestReportPath == "" {
+		cfg.Rules.TestReportPath = "/var/lib/integration-suricata-ndpi/last_test_report.json"
+	}
+	if cfg.Rules.OverridesStatePath == "" {
+		cfg.Rules.OverridesStatePath = "/var/lib/integration-suricata-ndpi/overrides.json"
+	}
+	if cfg.Rules.TestTimeout == 0 {
+		cfg.Rules.TestTimeout = 2 * time.Minute
 	}
 	if cfg.Suricata.StartTimeout == 0 {
 		cfg.Suricata.StartTimeout = 30 * time.Second
 	}
+	if cfg.HostAgent.AuditLog == "" {
+		cfg.HostAgent.AuditLog = "/var/lib/ndpi-agent/audit.jsonl"
+	}
 	if cfg.System.Systemctl == "" {
 		cfg.System.Systemctl = "/usr/bin/systemctl"
 	}
 	if cfg.System.SuricataService == "" {
 		cfg.System.SuricataService = "suricata"
 	}
+	if cfg.System.SystemdBackend == "" {
+		cfg.System.SystemdBackend = "auto"
+	}
 }
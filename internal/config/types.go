@@ -6,6 +6,54 @@ type HTTPConfig struct {
 	Addr             string        `yaml:"addr"`
 	HostAgentSocket  string        `yaml:"host_agent_socket"`
 	HostAgentTimeout time.Duration `yaml:"host_agent_timeout"`
+
+	// EventsBuffer is how many events GET /events keeps for Last-Event-ID replay.
+	EventsBuffer int `yaml:"events_buffer"`
+	// StateCheckInterval paces the drift and control-socket checks behind
+	// GET /events; 0 disables them.
+	StateCheckInterval time.Duration `yaml:"state_check_interval"`
+
+	Auth AuthConfig `yaml:"auth"`
+	TLS  TLSConfig  `yaml:"tls"`
+}
+
+// TLSConfig serves the API over TLS. Certificate, key and client CA are
+// re-read when the files change.
+type TLSConfig struct {
+	CertFile   string `yaml:"cert_file"`
+	KeyFile    string `yaml:"key_file"`
+	MinVersion string `yaml:"min_version"` // 1.2 | 1.3
+	// ClientCA verifies client certificates (mTLS) against these PEM CAs.
+	ClientCA          string `yaml:"client_ca"`
+	RequireClientCert bool   `yaml:"require_client_cert"`
+	// SelfSigned generates a throwaway certificate at startup (development).
+	SelfSigned bool `yaml:"self_signed"`
+}
+
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != "" || c.SelfSigned
+}
+
+// AuthConfig protects the HTTP API. The service refuses to start with no
+// tokens and no client certs unless Disabled opens the API to everyone as
+// admin.
+type AuthConfig struct {
+	Tokens      []TokenConfig      `yaml:"tokens"`
+	ClientCerts []ClientCertConfig `yaml:"client_certs"`
+	Disabled    bool               `yaml:"disabled"`
+}
+
+type TokenConfig struct {
+	Name   string `yaml:"name"`
+	SHA256 string `yaml:"sha256"` // hex sha256 of the token, never the token itself
+	Role   string `yaml:"role"`   // viewer | operator | admin
+}
+
+// ClientCertConfig maps a verified client certificate (by subject CN) to a role.
+type ClientCertConfig struct {
+	Name       string `yaml:"name"`
+	CommonName string `yaml:"common_name"`
+	Role       string `yaml:"role"`
 }
 
 type PathsConfig struct {
@@ -14,6 +62,7 @@ type PathsConfig struct {
 	SuricataTemplate string `yaml:"suricata_template"`
 	SuricataSC       string `yaml:"suricatasc"`
 	SuricataBin      string `yaml:"suricata_bin"`
+	SuricataRulesDir string `yaml:"suricata_rules_dir"`
 }
 
 type NDPIConfig struct {
@@ -36,11 +85,59 @@ type ApplyConfig struct {
 type ReloadConfig struct {
 	Timeout time.Duration `yaml:"timeout"`
 	Command string        `yaml:"command"`
+	// PollInterval paces ruleset-reload-time polling for ruleset-reload-nonblocking.
+	PollInterval time.Duration `yaml:"poll_interval"`
+}
+
+type RulesConfig struct {
+	ValidateTimeout time.Duration `yaml:"validate_timeout"`
+	TestsDir        string        `yaml:"tests_dir"`
+	TestTimeout     time.Duration `yaml:"test_timeout"`
+	TestReportPath  string        `yaml:"test_report_path"`
+
+	// BundlePublicKeys are base64 Ed25519 keys trusted to sign rule bundles.
+	BundlePublicKeys []string `yaml:"bundle_public_keys"`
+
+	Overrides          []RuleOverrideConfig `yaml:"overrides"`
+	OverridesStatePath string               `yaml:"overrides_state_path"`
+}
+
+type RuleOverrideConfig struct {
+	SID    uint64 `yaml:"sid"`
+	State  string `yaml:"state"`  // enabled | disabled
+	Action string `yaml:"action"` // e.g. drop
+}
+
+// StateConfig is where the service keeps what must survive restarts.
+type StateConfig struct {
+	Dir               string `yaml:"dir"`
+	HistoryMaxRecords int    `yaml:"history_max_records"`
+}
+
+// HostAgentConfig is read by the host agent only.
+type HostAgentConfig struct {
+	// AuditLog is the hash-chained record of every mutating call (GET /audit).
+	AuditLog string `yaml:"audit_log"`
+	// Access authorizes callers by SO_PEERCRED; a route nobody is granted
+	// gets 403, so empty denies every call.
+	Access []AccessRuleConfig `yaml:"access"`
+}
+
+// AccessRuleConfig grants routes ("GET /ndpi/status", "/health", "POST /ndpi/*",
+// "*") to users and groups, by name or numeric id.
+type AccessRuleConfig struct {
+	Name   string   `yaml:"name"`
+	Users  []string `yaml:"users"`
+	Groups []string `yaml:"groups"`
+	Routes []string `yaml:"routes"`
 }
 
 type SystemConfig struct {
 	Systemctl       string `yaml:"systemctl"`
 	SuricataService string `yaml:"suricata_service"`
+	// SystemdBackend picks how units are managed: auto (D-Bus, falling back
+	// to systemctl), dbus or systemctl.
+	SystemdBackend string `yaml:"systemd_backend"`
 }
 
 type Config struct {
@@ -50,5 +147,9 @@ type Config struct {
 	Suricata SuricataConfig `yaml:"suricata"`
 	Apply    ApplyConfig    `yaml:"apply"`
 	Reload   ReloadConfig   `yaml:"reload"`
+	Rules    RulesConfig    `yaml:"rules"`
 	System   SystemConfig   `yaml:"system"`
+	State    StateConfig    `yaml:"state"`
+
+	HostAgent HostAgentConfig `yaml:"host_agent"`
 }
@@ -1,8 +1,14 @@
 package config
 
 import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"strings"
+
+	"integration-suricata-ndpi/pkg/rules"
 )
 
 func validate(cfg *Config) error {
@@ -24,6 +30,15 @@ func validate(cfg *Config) error {
 	if len(cfg.Suricata.ConfigCandidates) == 0 {
 		return fmt.Errorf("config: suricata.config_candidates is required")
 	}
+	if cfg.State.HistoryMaxRecords < 0 {
+		return fmt.Errorf("config: state.history_max_records must be >= 0")
+	}
+	if cfg.HTTP.EventsBuffer < 0 {
+		return fmt.Errorf("config: http.events_buffer must be >= 0")
+	}
+	if cfg.HTTP.StateCheckInterval < 0 {
+		return fmt.Errorf("config: http.state_check_interval must be >= 0")
+	}
 	if cfg.Reload.Timeout <= 0 {
 		return fmt.Errorf("config: reload.timeout must be > 0")
 	}
@@ -32,9 +47,101 @@ func validate(cfg *Config) error {
 	if cmd == "shutdown" {
 		return fmt.Errorf("config: reload.command=shutdown is forbidden")
 	}
+	if cfg.Rules.ValidateTimeout < 0 {
+		return fmt.Errorf("config: rules.validate_timeout must be >= 0")
+	}
+	for i, k := range cfg.Rules.BundlePublicKeys {
+		raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(k))
+		if err != nil || len(raw) != ed25519.PublicKeySize {
+			return fmt.Errorf("config: rules.bundle_public_keys[%d] must be a base64 Ed25519 public key", i)
+		}
+	}
+	for i, o := range cfg.Rules.Overrides {
+		if o.SID == 0 {
+			return fmt.Errorf("config: rules.overrides[%d].sid is required", i)
+		}
+		switch o.State {
+		case "", "enabled", "disabled":
+		default:
+			return fmt.Errorf("config: rules.overrides[%d].state must be enabled or disabled", i)
+		}
+		if o.Action != "" && (!rules.IsAction(o.Action) || o.Action == "config") {
+			return fmt.Errorf("config: rules.overrides[%d].action %q is not a rule action", i, o.Action)
+		}
+		if o.State == "" && o.Action == "" {
+			return fmt.Errorf("config: rules.overrides[%d] sets neither state nor action", i)
+		}
+	}
+	if err := validateTLS(cfg.HTTP.TLS); err != nil {
+		return err
+	}
+	if cfg.HTTP.Auth.Disabled && (len(cfg.HTTP.Auth.Tokens) > 0 || len(cfg.HTTP.Auth.ClientCerts) > 0) {
+		return fmt.Errorf("config: http.auth.disabled cannot be combined with tokens or client_certs")
+	}
+	for i, t := range cfg.HTTP.Auth.Tokens {
+		if strings.TrimSpace(t.Name) == "" {
+			return fmt.Errorf("config: http.auth.tokens[%d].name is required", i)
+		}
+		if raw, err := hex.DecodeString(strings.TrimSpace(t.SHA256)); err != nil || len(raw) != sha256.Size {
+			return fmt.Errorf("config: http.auth.tokens[%d].sha256 must be a hex sha256 digest", i)
+		}
+		if !validRole(t.Role) {
+			return fmt.Errorf("config: http.auth.tokens[%d].role must be viewer, operator or admin", i)
+		}
+	}
+	for i, c := range cfg.HTTP.Auth.ClientCerts {
+		if strings.TrimSpace(c.CommonName) == "" {
+			return fmt.Errorf("config: http.auth.client_certs[%d].common_name is required", i)
+		}
+		if !validRole(c.Role) {
+			return fmt.Errorf("config: http.auth.client_certs[%d].role must be viewer, operator or admin", i)
+		}
+	}
+	for i, a := range cfg.HostAgent.Access {
+		if len(a.Users) == 0 && len(a.Groups) == 0 {
+			return fmt.Errorf("config: host_agent.access[%d] names no users or groups", i)
+		}
+		if len(a.Routes) == 0 {
+			return fmt.Errorf("config: host_agent.access[%d].routes is required", i)
+		}
+	}
+	switch cfg.System.SystemdBackend {
+	case "", "auto", "dbus", "systemctl":
+	default:
+		return fmt.Errorf("config: system.systemd_backend must be auto, dbus or systemctl")
+	}
 	if cfg.Suricata.StartTimeout <= 0 {
 		return fmt.Errorf("config: suricata.start_timeout must be > 0")
 	}
 
 	return nil
 }
+
+func validRole(r string) bool {
+	switch r {
+	case "viewer", "operator", "admin":
+		return true
+	}
+	return false
+}
+
+func validateTLS(c TLSConfig) error {
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return fmt.Errorf("config: http.tls.cert_file and http.tls.key_file go together")
+	}
+	if c.SelfSigned && c.CertFile != "" {
+		return fmt.Errorf("config: http.tls.self_signed and http.tls.cert_file are exclusive")
+	}
+	switch c.MinVersion {
+	case "", "1.2", "1.3":
+	default:
+		return fmt.Errorf("config: http.tls.min_version must be 1.2 or 1.3")
+	}
+	if !c.Enabled() && (c.ClientCA != "" || c.RequireClientCert) {
+		return fmt.Errorf("config: http.tls.client_ca needs http.tls.cert_file or http.tls.self_signed")
+	}
+	if c.RequireClientCert && c.ClientCA == "" {
+		return fmt.Errorf("config: http.tls.require_client_cert needs http.tls.client_ca")
+	}
+	return nil
+}
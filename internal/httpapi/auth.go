@@ -0,0 +1,168 @@
+package httpapi
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"integration-suricata-ndpi/pkg/apierror"
+)
+
+// Role is what a caller may do; each role includes the ones below it.
+type Role int
+
+const (
+	RoleNone Role = iota
+	RoleViewer
+	RoleOperator
+	RoleAdmin
+)
+
+func (r Role) String() string {
+	switch r {
+	case RoleViewer:
+		return "viewer"
+	case RoleOperator:
+		return "operator"
+	case RoleAdmin:
+		return "admin"
+	}
+	return "none"
+}
+
+func ParseRole(s string) Role {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "viewer":
+		return RoleViewer
+	case "operator":
+		return RoleOperator
+	case "admin":
+		return RoleAdmin
+	}
+	return RoleNone
+}
+
+// Token is a bearer token, stored as the hex SHA-256 of its value.
+type Token struct {
+	Name   string
+	SHA256 string
+	Role   string
+}
+
+// ClientCert grants a role to a verified client certificate by common name.
+type ClientCert struct {
+	Name       string
+	CommonName string
+	Role       string
+}
+
+// AuthConfig lists who may call the API. Disabled makes every caller
+// "anonymous" with the admin role; without it and without credentials
+// nobody gets in.
+type AuthConfig struct {
+	Tokens      []Token
+	ClientCerts []ClientCert
+	Disabled    bool
+}
+
+func (c AuthConfig) Enabled() bool {
+	return len(c.Tokens) > 0 || len(c.ClientCerts) > 0
+}
+
+// Identity is the caller a request was authenticated as.
+type Identity struct {
+	Name   string `json:"name"`
+	Method string `json:"method"` // token | mtls | none
+	Role   string `json:"role"`
+}
+
+func (id Identity) String() string {
+	return id.Method + ":" + id.Name
+}
+
+type identityKey struct{}
+
+// IdentityFromContext returns the caller of the request ctx belongs to.
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(Identity)
+	return id, ok
+}
+
+type authenticator struct {
+	cfg AuthConfig
+}
+
+// authenticate prefers a bearer token over the client certificate, so a
+// token can narrow what a certificate holder does.
+func (a *authenticator) authenticate(r *http.Request) (Identity, Role, bool) {
+	if a.cfg.Disabled {
+		return Identity{Name: "anonymous", Method: "none", Role: RoleAdmin.String()}, RoleAdmin, true
+	}
+
+	if tok, ok := bearerToken(r); ok {
+		sum := sha256.Sum256([]byte(tok))
+		got := hex.EncodeToString(sum[:])
+		var match *Token
+		for i := range a.cfg.Tokens {
+			want := strings.ToLower(strings.TrimSpace(a.cfg.Tokens[i].SHA256))
+			if subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1 {
+				match = &a.cfg.Tokens[i]
+			}
+		}
+		if match == nil {
+			return Identity{}, RoleNone, false
+		}
+		role := ParseRole(match.Role)
+		return Identity{Name: match.Name, Method: "token", Role: role.String()}, role, true
+	}
+
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+		cn := r.TLS.VerifiedChains[0][0].Subject.CommonName
+		for _, c := range a.cfg.ClientCerts {
+			if c.CommonName == cn {
+				role := ParseRole(c.Role)
+				name := c.Name
+				if name == "" {
+					name = cn
+				}
+				return Identity{Name: name, Method: "mtls", Role: role.String()}, role, true
+			}
+		}
+	}
+	return Identity{}, RoleNone, false
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	h := r.Header.Get("Authorization")
+	scheme, tok, ok := strings.Cut(h, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	tok = strings.TrimSpace(tok)
+	return tok, tok != ""
+}
+
+// guardFunc answers 401 to unknown callers and 403 to callers below what need
+// asks for; every answer names the identity in X-Auth-Identity and X-Auth-Role.
+func (s *Server) guardFunc(need func(*http.Request) Role, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, role, ok := s.auth.authenticate(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="integration"`)
+			writeJSONError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+		w.Header().Set("X-Auth-Identity", id.String())
+		w.Header().Set("X-Auth-Role", id.Role)
+
+		if want := need(r); role < want {
+			ae := apierror.ForStatus(http.StatusForbidden, "role "+want.String()+" required")
+			writeJSON(w, ae.Status, ae.WithDetails(map[string]any{"identity": id}))
+			return
+		}
+		h(w, r.WithContext(context.WithValue(r.Context(), identityKey{}, id)))
+	}
+}
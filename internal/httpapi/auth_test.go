@@ -0,0 +1,177 @@
+package httpapi
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func tokenSum(tok string) string {
+	sum := sha256.Sum256([]byte(tok))
+	return hex.EncodeToString(sum[:])
+}
+
+func newAuthMux(auth AuthConfig) *http.ServeMux {
+	mux := http.NewServeMux()
+	New(Deps{Auth: auth}).Register(mux)
+	return mux
+}
+
+var testAuth = AuthConfig{
+	Tokens: []Token{
+		{Name: "dash", SHA256: tokenSum("viewer-token"), Role: "viewer"},
+		{Name: "ci", SHA256: tokenSum("operator-token"), Role: "operator"},
+		{Name: "root", SHA256: strings.ToUpper(tokenSum("admin-token")), Role: "admin"},
+	},
+	ClientCerts: []ClientCert{{CommonName: "ops.example", Role: "operator"}},
+}
+
+func TestAuth_RoleMatrix(t *testing.T) {
+	mux := newAuthMux(testAuth)
+	tokens := map[Role]string{RoleViewer: "viewer-token", RoleOperator: "operator-token", RoleAdmin: "admin-token"}
+
+	for _, rt := range Routes() {
+		target := strings.NewReplacer("{id}", "job-1", "{sid}", "1").Replace(rt.Path)
+		for _, role := range []Role{RoleViewer, RoleOperator, RoleAdmin} {
+			req := httptest.NewRequest(rt.Method, target, nil)
+			req.Header.Set("Authorization", "Bearer "+tokens[role])
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			switch {
+			case role < rt.Role && rec.Code != http.StatusForbidden:
+				t.Errorf("%s %s as %s: got %d, want 403", rt.Method, rt.Path, role, rec.Code)
+			case role >= rt.Role && (rec.Code == http.StatusUnauthorized || rec.Code == http.StatusForbidden):
+				t.Errorf("%s %s as %s: got %d, want it let through", rt.Method, rt.Path, role, rec.Code)
+			}
+			if rt.Role != RoleNone && rec.Header().Get("X-Auth-Role") != role.String() {
+				t.Errorf("%s %s as %s: X-Auth-Role %q", rt.Method, rt.Path, role, rec.Header().Get("X-Auth-Role"))
+			}
+		}
+	}
+}
+
+func TestAuth_RouteRoles(t *testing.T) {
+	want := map[string]Role{
+		"GET /health":           RoleNone,
+		"GET /plan":             RoleViewer,
+		"POST /apply":           RoleOperator,
+		"POST /rollback":        RoleAdmin,
+		"POST /suricata/ensure": RoleOperator,
+		"POST /plan":            RoleAdmin,
+		"POST /ndpi/enable":     RoleAdmin,
+		"DELETE /jobs/{id}":     RoleOperator,
+	}
+	got := map[string]Role{}
+	for _, rt := range Routes() {
+		got[rt.Method+" "+rt.Path] = rt.Role
+	}
+	for key, role := range want {
+		r, ok := got[key]
+		if !ok {
+			t.Errorf("%s is not served", key)
+			continue
+		}
+		if r != role {
+			t.Errorf("%s needs %s, want %s", key, r, role)
+		}
+	}
+}
+
+func TestAuth_Unauthenticated(t *testing.T) {
+	mux := newAuthMux(testAuth)
+	cases := []struct {
+		name, header string
+	}{
+		{"no credentials", ""},
+		{"unknown token", "Bearer nope"},
+		{"wrong scheme", "Basic dmlld2VyLXRva2Vu"},
+		{"empty bearer", "Bearer "},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/jobs", nil)
+		if c.header != "" {
+			req.Header.Set("Authorization", c.header)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: got %d %q", c.name, rec.Code, rec.Header().Get("WWW-Authenticate"))
+		}
+	}
+
+	// /health stays open for probes
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("/health: %d", rec.Code)
+	}
+}
+
+func TestAuth_Forbidden(t *testing.T) {
+	mux := newAuthMux(testAuth)
+	req := httptest.NewRequest(http.MethodPost, "/ndpi/enable", nil)
+	req.Header.Set("Authorization", "Bearer operator-token")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	var body struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+		Details struct {
+			Identity Identity `json:"identity"`
+		} `json:"details"`
+	}
+	if rec.Code != http.StatusForbidden || json.Unmarshal(rec.Body.Bytes(), &body) != nil {
+		t.Fatalf("%d %s", rec.Code, rec.Body.String())
+	}
+	if body.Code != "FORBIDDEN" || body.Message != "role admin required" || body.Details.Identity.Name != "ci" ||
+		rec.Header().Get("X-Auth-Identity") != "token:ci" {
+		t.Fatalf("bad 403: %+v %q", body, rec.Header().Get("X-Auth-Identity"))
+	}
+}
+
+func TestAuth_ClientCertAndTokenPrecedence(t *testing.T) {
+	a := &authenticator{cfg: testAuth}
+	req := httptest.NewRequest(http.MethodGet, "/jobs", nil)
+	req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: "ops.example"}}}}}
+
+	id, role, ok := a.authenticate(req)
+	if !ok || role != RoleOperator || id.String() != "mtls:ops.example" {
+		t.Fatalf("mtls: %+v %s %t", id, role, ok)
+	}
+
+	// a token narrows what the certificate holder does
+	req.Header.Set("Authorization", "Bearer viewer-token")
+	if id, role, ok := a.authenticate(req); !ok || role != RoleViewer || id.String() != "token:dash" {
+		t.Fatalf("token over cert: %+v %s %t", id, role, ok)
+	}
+
+	// an unverified certificate is not enough
+	req = httptest.NewRequest(http.MethodGet, "/jobs", nil)
+	req.TLS = &tls.ConnectionState{}
+	if _, _, ok := a.authenticate(req); ok {
+		t.Fatal("unverified client must not authenticate")
+	}
+}
+
+func TestAuth_DisabledOnlyWhenExplicit(t *testing.T) {
+	rec := httptest.NewRecorder()
+	newAuthMux(AuthConfig{}).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/apply", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("no credentials configured must not open the API, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	newAuthMux(AuthConfig{Disabled: true}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/jobs", nil))
+	if rec.Code == http.StatusUnauthorized || rec.Header().Get("X-Auth-Identity") != "none:anonymous" || rec.Header().Get("X-Auth-Role") != "admin" {
+		t.Fatalf("disabled: %d %q", rec.Code, rec.Header().Get("X-Auth-Identity"))
+	}
+}
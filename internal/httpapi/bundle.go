@@ -0,0 +1,68 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// maxApplyRequest bounds the JSON form of POST /apply.
+const maxApplyRequest = 1 << 16
+
+// BundleSource is a rule bundle passed to POST /apply, either uploaded as the
+// request body or referenced by a path on the integration host.
+type BundleSource struct {
+	Path string
+	Data []byte
+}
+
+type applyRequest struct {
+	BundlePath string `json:"bundle_path"`
+}
+
+// readBundleSource reports hasBundle=false for a plain POST /apply without a
+// body. An uploaded bundle may be up to maxUpload bytes.
+func readBundleSource(w http.ResponseWriter, r *http.Request, maxUpload int64) (src BundleSource, hasBundle bool, err error) {
+	if r.ContentLength == 0 || r.Body == nil || r.Body == http.NoBody {
+		return src, false, nil
+	}
+
+	ct := r.Header.Get("Content-Type")
+	mt, _, _ := mime.ParseMediaType(ct)
+
+	switch mt {
+	case "application/gzip", "application/x-gzip", "application/x-tar", "application/octet-stream":
+		if maxUpload <= 0 {
+			return src, false, fmt.Errorf("bundle uploads are not configured")
+		}
+		data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxUpload))
+		if err != nil {
+			return src, false, fmt.Errorf("read bundle: %w", err)
+		}
+		if len(data) == 0 {
+			return src, false, fmt.Errorf("bundle upload is empty")
+		}
+		return BundleSource{Data: data}, true, nil
+
+	case "application/json", "":
+		var req applyRequest
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxApplyRequest))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&req); err != nil {
+			if err == io.EOF {
+				return src, false, nil
+			}
+			return src, false, fmt.Errorf("invalid apply request: %w", err)
+		}
+		if strings.TrimSpace(req.BundlePath) == "" {
+			return src, false, nil
+		}
+		return BundleSource{Path: req.BundlePath}, true, nil
+
+	default:
+		return src, false, fmt.Errorf("unsupported content type %q", ct)
+	}
+}
@@ -0,0 +1,38 @@
+package httpapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestApply_BundleUploadLimit(t *testing.T) {
+	var got []byte
+	mux := http.NewServeMux()
+	New(Deps{
+		Auth:          AuthConfig{Disabled: true},
+		MaxBundleSize: 8,
+		ApplyBundle: func(ctx context.Context, src BundleSource) (any, error) {
+			got = src.Data
+			return map[string]bool{"ok": true}, nil
+		},
+	}).Register(mux)
+
+	post := func(body string) int {
+		req := httptest.NewRequest(http.MethodPost, "/apply", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/gzip")
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := post("12345678"); code != http.StatusOK || string(got) != "12345678" {
+		t.Fatalf("bundle at the limit: %d %q", code, got)
+	}
+	got = nil
+	if code := post("123456789"); code != http.StatusBadRequest || got != nil {
+		t.Fatalf("bundle over the limit: %d, handler saw %q", code, got)
+	}
+}
@@ -0,0 +1,102 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"integration-suricata-ndpi/pkg/logger"
+)
+
+const sseKeepAlive = 15 * time.Second
+
+// Event is one typed state change published on GET /events.
+type Event struct {
+	ID   uint64    `json:"id"`
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	Data any       `json:"data,omitempty"`
+}
+
+// Events streams events as Server-Sent Events. A Last-Event-ID header (or
+// ?last_event_id=) replays what is still buffered after that id.
+func (h *Handlers) Events(w http.ResponseWriter, r *http.Request) {
+	if h.deps.SubscribeEvents == nil {
+		writeJSONError(w, http.StatusInternalServerError, "events are not configured")
+		return
+	}
+
+	last := strings.TrimSpace(r.Header.Get("Last-Event-ID"))
+	if last == "" {
+		last = r.URL.Query().Get("last_event_id")
+	}
+	var lastID uint64
+	if last != "" {
+		id, err := strconv.ParseUint(last, 10, 64)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Last-Event-ID must be an event id")
+			return
+		}
+		lastID = id
+	}
+
+	rc := http.NewResponseController(w)
+	// the stream outlives the server WriteTimeout
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	replay, live := h.deps.SubscribeEvents(ctx, lastID)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	for _, ev := range replay {
+		if err := writeSSE(w, ev); err != nil {
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-live:
+			if !ok {
+				// dropped as a slow consumer; the client reconnects with Last-Event-ID
+				return
+			}
+			if err := writeSSE(w, ev); err != nil {
+				logger.Warnw("SSE write failed", "error", err)
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func writeSSE(w http.ResponseWriter, ev Event) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, data)
+	return err
+}
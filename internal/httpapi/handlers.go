@@ -2,19 +2,50 @@ package httpapi
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
+	"strconv"
 
 	"integration-suricata-ndpi/pkg/logger"
 )
 
 type Deps struct {
-	Plan      func(ctx context.Context) (any, error) // GET /plan (dry-run)
-	Reconcile func(ctx context.Context) (any, error) // POST /plan (patch+restart)
-	Apply     func(ctx context.Context) (any, error) // POST /apply (suricatasc reload)
+	Plan      func(ctx context.Context) (any, error) // GET /plan (dry-run), between jobs
+	Reconcile func(ctx context.Context) (any, error) // POST /plan (patch+restart), async job
+	Apply     func(ctx context.Context) (any, error) // POST /apply (suricatasc reload), async job
 
-	EnsureSuricata func(ctx context.Context) error
-	EnableNDPI     func(ctx context.Context) (any, error)
-	DisableNDPI    func(ctx context.Context) (any, error)
+	ApplyBundle   func(ctx context.Context, src BundleSource) (any, error) // POST /apply with a rule bundle
+	MaxBundleSize int64                                                    // upload limit of POST /apply, integration.MaxRuleBundleSize
+	Rollback      func(ctx context.Context) (any, error)                   // POST /rollback, async job
+	GetReload     func(ctx context.Context, id string) (any, error)        // GET /reloads/{id}
+
+	NDPIStatus  func(ctx context.Context) (any, error) // GET /ndpi/status, asks the host agent
+	EnableNDPI  func(ctx context.Context) (any, error) // POST /ndpi/enable, async job
+	DisableNDPI func(ctx context.Context) (any, error) // POST /ndpi/disable, async job
+
+	EnsureSuricata func(ctx context.Context) (any, error) // POST /suricata/ensure via the host agent, async job
+
+	ListJobs  func(ctx context.Context) (any, error)            // GET /jobs
+	GetJob    func(ctx context.Context, id string) (any, error) // GET /jobs/{id}
+	CancelJob func(ctx context.Context, id string) (any, error) // DELETE /jobs/{id}
+
+	History func(ctx context.Context, q HistoryQuery) (any, error) // GET /history
+
+	// SubscribeEvents returns the buffered events after lastID and a live feed,
+	// closed when ctx ends or the subscriber falls behind (GET /events).
+	SubscribeEvents func(ctx context.Context, lastID uint64) ([]Event, <-chan Event)
+
+	RulesCoverage func(ctx context.Context) (any, error)                            // GET /rules/coverage
+	ListRules     func(ctx context.Context, q RuleQuery) (any, error)               // GET /rules
+	GetRule       func(ctx context.Context, sid uint64, source string) (any, error) // GET /rules/{sid}
+	ValidateRules func(ctx context.Context, text string) (any, error)               // POST /rules/validate
+	RulesMitre    func(ctx context.Context, source string) (any, error)             // GET /rules/mitre
+	RulesDiff     func(ctx context.Context) (any, error)                            // GET /rules/diff
+
+	// OverrideRule handles POST /rules/{sid}/disable|enable|action; action is set for "action" only.
+	OverrideRule func(ctx context.Context, sid uint64, op, action string) (any, error)
+
+	Auth AuthConfig
 }
 
 type Handlers struct {
@@ -41,7 +72,7 @@ func (h *Handlers) Plan(w http.ResponseWriter, r *http.Request) {
 		}
 		resp, err := h.deps.Plan(r.Context())
 		if err != nil {
-			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			writeErr(w, err)
 			return
 		}
 		writeJSON(w, http.StatusOK, resp)
@@ -54,10 +85,10 @@ func (h *Handlers) Plan(w http.ResponseWriter, r *http.Request) {
 		}
 		resp, err := h.deps.Reconcile(r.Context())
 		if err != nil {
-			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			writeErr(w, err)
 			return
 		}
-		writeJSON(w, http.StatusOK, resp)
+		writeResult(w, resp)
 		return
 
 	default:
@@ -71,22 +102,71 @@ func (h *Handlers) Apply(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if h.deps.EnsureSuricata != nil {
-		if err := h.deps.EnsureSuricata(r.Context()); err != nil {
-			logger.Errorw("HTTP apply: suricata ensure failed", "error", err)
-			writeJSONError(w, http.StatusBadGateway, err.Error())
+	src, hasBundle, err := readBundleSource(w, r, h.deps.MaxBundleSize)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var resp any
+	if hasBundle {
+		if h.deps.ApplyBundle == nil {
+			writeJSONError(w, http.StatusInternalServerError, "bundle apply is not configured")
 			return
 		}
+		resp, err = h.deps.ApplyBundle(r.Context(), src)
+	} else {
+		if h.deps.Apply == nil {
+			writeJSONError(w, http.StatusInternalServerError, "apply is not configured")
+			return
+		}
+		resp, err = h.deps.Apply(r.Context())
+	}
+	if err != nil {
+		logger.Errorw("HTTP apply: failed", "error", err)
+		writeErr(w, err)
+		return
+	}
+	writeResult(w, resp)
+}
+
+func (h *Handlers) Rollback(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+	if h.deps.Rollback == nil {
+		writeJSONError(w, http.StatusInternalServerError, "rollback is not configured")
+		return
 	}
+	resp, err := h.deps.Rollback(r.Context())
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	writeResult(w, resp)
+}
 
-	if h.deps.Apply == nil {
-		writeJSONError(w, http.StatusInternalServerError, "apply is not configured")
+func (h *Handlers) ReloadGet(w http.ResponseWriter, r *http.Request) {
+	if h.deps.GetReload == nil {
+		writeJSONError(w, http.StatusInternalServerError, "reload tracking is not configured")
+		return
+	}
+	resp, err := h.deps.GetReload(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeErr(w, err)
 		return
 	}
+	writeJSON(w, http.StatusOK, resp)
+}
 
-	resp, err := h.deps.Apply(r.Context())
+func (h *Handlers) NDPIStatus(w http.ResponseWriter, r *http.Request) {
+	if h.deps.NDPIStatus == nil {
+		writeJSONError(w, http.StatusInternalServerError, "ndpi status is not configured")
+		return
+	}
+	resp, err := h.deps.NDPIStatus(r.Context())
 	if err != nil {
-		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		writeErr(w, err)
 		return
 	}
 	writeJSON(w, http.StatusOK, resp)
@@ -103,10 +183,10 @@ func (h *Handlers) NDPIEnable(w http.ResponseWriter, r *http.Request) {
 	resp, err := h.deps.EnableNDPI(r.Context())
 	if err != nil {
 		logger.Errorw("HTTP ndpi enable: failed", "error", err)
-		writeJSONError(w, http.StatusBadGateway, err.Error())
+		writeErr(w, err)
 		return
 	}
-	writeJSON(w, http.StatusOK, resp)
+	writeResult(w, resp)
 }
 
 func (h *Handlers) NDPIDisable(w http.ResponseWriter, r *http.Request) {
@@ -120,8 +200,104 @@ func (h *Handlers) NDPIDisable(w http.ResponseWriter, r *http.Request) {
 	resp, err := h.deps.DisableNDPI(r.Context())
 	if err != nil {
 		logger.Errorw("HTTP ndpi disable: failed", "error", err)
-		writeJSONError(w, http.StatusBadGateway, err.Error())
+		writeErr(w, err)
+		return
+	}
+	writeResult(w, resp)
+}
+
+func (h *Handlers) SuricataEnsure(w http.ResponseWriter, r *http.Request) {
+	if h.deps.EnsureSuricata == nil {
+		writeJSONError(w, http.StatusInternalServerError, "suricata ensure is not configured")
+		return
+	}
+	resp, err := h.deps.EnsureSuricata(r.Context())
+	if err != nil {
+		logger.Errorw("HTTP suricata ensure: failed", "error", err)
+		writeErr(w, err)
+		return
+	}
+	writeResult(w, resp)
+}
+
+func (h *Handlers) RulesCoverage(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	if h.deps.RulesCoverage == nil {
+		writeJSONError(w, http.StatusInternalServerError, "rules coverage is not configured")
+		return
+	}
+	resp, err := h.deps.RulesCoverage(r.Context())
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+
+	switch r.URL.Query().Get("format") {
+	case "", "json":
+		writeJSON(w, http.StatusOK, resp)
+	case "csv":
+		cw, ok := resp.(csvWriter)
+		if !ok {
+			writeJSONError(w, http.StatusNotAcceptable, "csv is not supported for this resource")
+			return
+		}
+		writeCSV(w, http.StatusOK, cw)
+	default:
+		writeJSONError(w, http.StatusBadRequest, "format must be json or csv")
+	}
+}
+
+func (h *Handlers) RulesList(w http.ResponseWriter, r *http.Request) {
+	if h.deps.ListRules == nil {
+		writeJSONError(w, http.StatusInternalServerError, "rules listing is not configured")
+		return
+	}
+	q, err := parseRuleQuery(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "sid must be a positive integer")
+		return
+	}
+	resp, err := h.deps.ListRules(r.Context(), q)
+	if err != nil {
+		writeErr(w, err)
 		return
 	}
 	writeJSON(w, http.StatusOK, resp)
 }
+
+func (h *Handlers) RuleOverride(op string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.deps.OverrideRule == nil {
+			writeJSONError(w, http.StatusInternalServerError, "rule overrides are not configured")
+			return
+		}
+
+		sid, err := strconv.ParseUint(r.PathValue("sid"), 10, 64)
+		if err != nil || sid == 0 {
+			writeJSONError(w, http.StatusBadRequest, "sid must be a positive integer")
+			return
+		}
+
+		var action string
+		if op == "action" {
+			var req struct {
+				Action string `json:"action"`
+			}
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&req); err != nil {
+				writeJSONError(w, http.StatusBadRequest, "body must be {\"action\": \"<action>\"}")
+				return
+			}
+			action = req.Action
+		}
+
+		resp, err := h.deps.OverrideRule(r.Context(), sid, op, action)
+		if err != nil {
+			logger.Errorw("HTTP rule override: failed", "sid", sid, "op", op, "error", err)
+			writeErr(w, err)
+			return
+		}
+		writeResult(w, resp)
+	}
+}
@@ -0,0 +1,72 @@
+package httpapi
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const maxHistoryLimit = 500
+
+// HistoryQuery holds the GET /history filters; Before pages to older records.
+type HistoryQuery struct {
+	Kind   string
+	Status string
+	JobID  string
+	Since  time.Time
+	Until  time.Time
+	Before uint64
+	Limit  int
+}
+
+func parseHistoryQuery(r *http.Request) (HistoryQuery, error) {
+	v := r.URL.Query()
+	q := HistoryQuery{
+		Kind:   v.Get("kind"),
+		Status: v.Get("status"),
+		JobID:  v.Get("job_id"),
+	}
+	for name, dst := range map[string]*time.Time{"since": &q.Since, "until": &q.Until} {
+		if s := v.Get(name); s != "" {
+			t, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				return q, fmt.Errorf("%s must be an RFC 3339 time", name)
+			}
+			*dst = t
+		}
+	}
+	if s := v.Get("before"); s != "" {
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return q, fmt.Errorf("before must be a record seq")
+		}
+		q.Before = n
+	}
+	if s := v.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 || n > maxHistoryLimit {
+			return q, fmt.Errorf("limit must be 1..%d", maxHistoryLimit)
+		}
+		q.Limit = n
+	}
+	return q, nil
+}
+
+func (h *Handlers) History(w http.ResponseWriter, r *http.Request) {
+	if h.deps.History == nil {
+		writeJSONError(w, http.StatusInternalServerError, "history is not configured")
+		return
+	}
+	q, err := parseHistoryQuery(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	resp, err := h.deps.History(r.Context(), q)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -2,7 +2,11 @@ package httpapi
 
 import (
 	"encoding/json"
+	"io"
 	"net/http"
+
+	"integration-suricata-ndpi/pkg/apierror"
+	"integration-suricata-ndpi/pkg/logger"
 )
 
 func requireMethod(w http.ResponseWriter, req *http.Request, method string) bool {
@@ -22,6 +26,43 @@ func writeJSON(w http.ResponseWriter, status int, payload any) {
 	_ = enc.Encode(payload)
 }
 
+// writeJSONError answers with the error model for a status the API decides
+// itself (bad input, missing dependency).
 func writeJSONError(w http.ResponseWriter, status int, message string) {
-	writeJSON(w, status, map[string]string{"error": message})
+	writeJSON(w, status, apierror.ForStatus(status, message))
+}
+
+type csvWriter interface {
+	WriteCSV(w io.Writer) error
+}
+
+func writeCSV(w http.ResponseWriter, status int, payload csvWriter) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.WriteHeader(status)
+	_ = payload.WriteCSV(w)
+}
+
+// jobRef is implemented by results that stand for a submitted job.
+type jobRef interface {
+	JobID() string
+}
+
+// writeResult answers 202 with a Location for a submitted job, 200 otherwise.
+func writeResult(w http.ResponseWriter, resp any) {
+	if j, ok := resp.(jobRef); ok {
+		w.Header().Set("Location", "/jobs/"+j.JobID())
+		writeJSON(w, http.StatusAccepted, resp)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// writeErr answers with the model of err; untyped errors become INTERNAL and
+// their text only reaches the log.
+func writeErr(w http.ResponseWriter, err error) {
+	ae := apierror.From(err)
+	if ae.Status >= http.StatusInternalServerError {
+		logger.Errorw("HTTP request failed", "code", ae.Code, "status", ae.Status, "error", err)
+	}
+	writeJSON(w, ae.Status, ae)
 }
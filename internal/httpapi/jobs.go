@@ -0,0 +1,44 @@
+package httpapi
+
+import "net/http"
+
+func (h *Handlers) JobsList(w http.ResponseWriter, r *http.Request) {
+	if h.deps.ListJobs == nil {
+		writeJSONError(w, http.StatusInternalServerError, "jobs are not configured")
+		return
+	}
+	resp, err := h.deps.ListJobs(r.Context())
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"jobs": resp})
+}
+
+func (h *Handlers) JobGet(w http.ResponseWriter, r *http.Request) {
+	if h.deps.GetJob == nil {
+		writeJSONError(w, http.StatusInternalServerError, "jobs are not configured")
+		return
+	}
+	resp, err := h.deps.GetJob(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// JobCancel drops a queued job or cancels the running one; the job is returned
+// as it is right after the request, a running job ends as canceled shortly after.
+func (h *Handlers) JobCancel(w http.ResponseWriter, r *http.Request) {
+	if h.deps.CancelJob == nil {
+		writeJSONError(w, http.StatusInternalServerError, "jobs are not configured")
+		return
+	}
+	resp, err := h.deps.CancelJob(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, resp)
+}
@@ -0,0 +1,111 @@
+package httpapi
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const maxRuleBody = 1 << 20
+
+// RuleQuery holds the GET /rules filters; empty fields match everything.
+type RuleQuery struct {
+	Source       string // local (default) | deployed
+	SID          uint64
+	Action       string
+	Transport    string
+	NDPIProtocol string
+	NDPIRisk     string
+	Mitre        string
+	File         string
+}
+
+func parseRuleQuery(r *http.Request) (RuleQuery, error) {
+	v := r.URL.Query()
+	q := RuleQuery{
+		Source:       v.Get("source"),
+		Action:       v.Get("action"),
+		Transport:    v.Get("transport"),
+		NDPIProtocol: v.Get("ndpi_protocol"),
+		NDPIRisk:     v.Get("ndpi_risk"),
+		Mitre:        v.Get("mitre"),
+		File:         v.Get("file"),
+	}
+	if s := v.Get("sid"); s != "" {
+		sid, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return q, err
+		}
+		q.SID = sid
+	}
+	return q, nil
+}
+
+func (h *Handlers) RuleGet(w http.ResponseWriter, r *http.Request) {
+	if h.deps.GetRule == nil {
+		writeJSONError(w, http.StatusInternalServerError, "rules lookup is not configured")
+		return
+	}
+	sid, err := strconv.ParseUint(r.PathValue("sid"), 10, 64)
+	if err != nil || sid == 0 {
+		writeJSONError(w, http.StatusBadRequest, "sid must be a positive integer")
+		return
+	}
+	resp, err := h.deps.GetRule(r.Context(), sid, r.URL.Query().Get("source"))
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *Handlers) RulesMitre(w http.ResponseWriter, r *http.Request) {
+	if h.deps.RulesMitre == nil {
+		writeJSONError(w, http.StatusInternalServerError, "mitre report is not configured")
+		return
+	}
+	resp, err := h.deps.RulesMitre(r.Context(), r.URL.Query().Get("source"))
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// RulesDiff compares the local rule set with what is deployed.
+func (h *Handlers) RulesDiff(w http.ResponseWriter, r *http.Request) {
+	if h.deps.RulesDiff == nil {
+		writeJSONError(w, http.StatusInternalServerError, "rules diff is not configured")
+		return
+	}
+	resp, err := h.deps.RulesDiff(r.Context())
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// RulesValidate lints the request body, one or more rules in .rules syntax.
+func (h *Handlers) RulesValidate(w http.ResponseWriter, r *http.Request) {
+	if h.deps.ValidateRules == nil {
+		writeJSONError(w, http.StatusInternalServerError, "rules validation is not configured")
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRuleBody))
+	if err != nil {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, "rule body is too large")
+		return
+	}
+	if strings.TrimSpace(string(body)) == "" {
+		writeJSONError(w, http.StatusBadRequest, "rule body is empty")
+		return
+	}
+	resp, err := h.deps.ValidateRules(r.Context(), string(body))
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -3,17 +3,107 @@ package httpapi
 import "net/http"
 
 type Server struct {
-	h *Handlers
+	h    *Handlers
+	auth *authenticator
 }
 
 func New(deps Deps) *Server {
-	return &Server{h: NewHandlers(deps)}
+	return &Server{h: NewHandlers(deps), auth: &authenticator{cfg: deps.Auth}}
+}
+
+// Route is one operation as published in openapi.json, with the role it
+// needs; RoleNone marks the open ones.
+type Route struct {
+	Method string
+	Path   string
+	Role   Role
+}
+
+// mount is one mux pattern and the operations it serves. Patterns without a
+// method leave the method check to the handler, so a wrong method still gets
+// the JSON error model.
+type mount struct {
+	pattern string
+	ops     []Route
+	h       http.HandlerFunc
+}
+
+// need is the role of the operation matching the request method, or the
+// highest role of the mount when none does.
+func (m mount) need(r *http.Request) Role {
+	var top Role
+	for _, op := range m.ops {
+		if op.Method == r.Method || (r.Method == http.MethodHead && op.Method == http.MethodGet) {
+			return op.Role
+		}
+		if op.Role > top {
+			top = op.Role
+		}
+	}
+	return top
+}
+
+func (m mount) open() bool {
+	for _, op := range m.ops {
+		if op.Role != RoleNone {
+			return false
+		}
+	}
+	return true
+}
+
+func only(method, path string, role Role) []Route {
+	return []Route{{Method: method, Path: path, Role: role}}
+}
+
+// mounts lists every route with the role it needs: viewers read, operators
+// apply and roll back rules, start Suricata and manage jobs, admins reconcile
+// and toggle nDPI. /health and /openapi.json stay open for probes and tooling.
+func (s *Server) mounts() []mount {
+	return []mount{
+		{"/health", only("GET", "/health", RoleNone), s.h.Health},
+		{"GET /openapi.json", only("GET", "/openapi.json", RoleNone), s.h.OpenAPI},
+		{"/plan", []Route{{"GET", "/plan", RoleViewer}, {"POST", "/plan", RoleAdmin}}, s.h.Plan},
+		{"/apply", only("POST", "/apply", RoleOperator), s.h.Apply},
+		{"/rollback", only("POST", "/rollback", RoleAdmin), s.h.Rollback},
+		{"GET /reloads/{id}", only("GET", "/reloads/{id}", RoleViewer), s.h.ReloadGet},
+		{"GET /events", only("GET", "/events", RoleViewer), s.h.Events},
+		{"GET /history", only("GET", "/history", RoleViewer), s.h.History},
+		{"GET /jobs", only("GET", "/jobs", RoleViewer), s.h.JobsList},
+		{"GET /jobs/{id}", only("GET", "/jobs/{id}", RoleViewer), s.h.JobGet},
+		{"DELETE /jobs/{id}", only("DELETE", "/jobs/{id}", RoleOperator), s.h.JobCancel},
+		{"GET /ndpi/status", only("GET", "/ndpi/status", RoleViewer), s.h.NDPIStatus},
+		{"/ndpi/enable", only("POST", "/ndpi/enable", RoleAdmin), s.h.NDPIEnable},
+		{"/ndpi/disable", only("POST", "/ndpi/disable", RoleAdmin), s.h.NDPIDisable},
+		{"POST /suricata/ensure", only("POST", "/suricata/ensure", RoleOperator), s.h.SuricataEnsure},
+		{"GET /rules/coverage", only("GET", "/rules/coverage", RoleViewer), s.h.RulesCoverage},
+		{"GET /rules", only("GET", "/rules", RoleViewer), s.h.RulesList},
+		{"GET /rules/mitre", only("GET", "/rules/mitre", RoleViewer), s.h.RulesMitre},
+		{"GET /rules/diff", only("GET", "/rules/diff", RoleViewer), s.h.RulesDiff},
+		{"GET /rules/{sid}", only("GET", "/rules/{sid}", RoleViewer), s.h.RuleGet},
+		{"POST /rules/validate", only("POST", "/rules/validate", RoleOperator), s.h.RulesValidate},
+		{"POST /rules/{sid}/disable", only("POST", "/rules/{sid}/disable", RoleOperator), s.h.RuleOverride("disable")},
+		{"POST /rules/{sid}/enable", only("POST", "/rules/{sid}/enable", RoleOperator), s.h.RuleOverride("enable")},
+		{"POST /rules/{sid}/action", only("POST", "/rules/{sid}/action", RoleOperator), s.h.RuleOverride("action")},
+	}
 }
 
 func (s *Server) Register(mux *http.ServeMux) {
-	mux.HandleFunc("/health", s.h.Health)
-	mux.HandleFunc("/plan", s.h.Plan)
-	mux.HandleFunc("/apply", s.h.Apply)
-	mux.HandleFunc("/ndpi/enable", s.h.NDPIEnable)
-	mux.HandleFunc("/ndpi/disable", s.h.NDPIDisable)
+	for _, m := range s.mounts() {
+		if m.open() {
+			mux.HandleFunc(m.pattern, m.h)
+			continue
+		}
+		mux.HandleFunc(m.pattern, s.guardFunc(m.need, m.h))
+	}
+}
+
+// Routes lists the operations Register mounts, for checking them against the
+// OpenAPI spec.
+func Routes() []Route {
+	var out []Route
+	for _, m := range New(Deps{}).mounts() {
+		out = append(out, m.ops...)
+	}
+	return out
 }
@@ -2,6 +2,8 @@ package mocks
 
 import (
 	"os"
+	"path/filepath"
+	"strings"
 
 	"integration-suricata-ndpi/pkg/fsutil"
 )
@@ -49,6 +51,10 @@ type FS struct {
 	RenameFunc     func(oldpath, newpath string) error
 	ChmodFunc      func(name string, mode os.FileMode) error
 	GlobFunc       func(pattern string) ([]string, error)
+	MkdirTempFunc  func(dir, pattern string) (string, error)
+	MkdirAllFunc   func(path string, perm os.FileMode) error
+	WriteFileFunc  func(name string, data []byte, perm os.FileMode) error
+	RemoveAllFunc  func(path string) error
 }
 
 func (m *FS) ReadFile(name string) ([]byte, error) {
@@ -99,3 +105,31 @@ func (m *FS) Glob(pattern string) ([]string, error) {
 	}
 	return nil, nil
 }
+
+func (m *FS) MkdirTemp(dir, pattern string) (string, error) {
+	if m.MkdirTempFunc != nil {
+		return m.MkdirTempFunc(dir, pattern)
+	}
+	return filepath.Join(dir, strings.ReplaceAll(pattern, "*", "mock")), nil
+}
+
+func (m *FS) MkdirAll(path string, perm os.FileMode) error {
+	if m.MkdirAllFunc != nil {
+		return m.MkdirAllFunc(path, perm)
+	}
+	return nil
+}
+
+func (m *FS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	if m.WriteFileFunc != nil {
+		return m.WriteFileFunc(name, data, perm)
+	}
+	return nil
+}
+
+func (m *FS) RemoveAll(path string) error {
+	if m.RemoveAllFunc != nil {
+		return m.RemoveAllFunc(path)
+	}
+	return nil
+}
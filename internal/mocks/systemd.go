@@ -2,11 +2,33 @@ package mocks
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"time"
+
+	"integration-suricata-ndpi/pkg/systemd"
 )
 
 type SystemdManager struct {
-	RestartFunc func(ctx context.Context, unit string, timeout time.Duration) error
+	StartFunc           func(ctx context.Context, unit string, timeout time.Duration) error
+	StopFunc            func(ctx context.Context, unit string, timeout time.Duration) error
+	RestartFunc         func(ctx context.Context, unit string, timeout time.Duration) error
+	ReloadOrRestartFunc func(ctx context.Context, unit string, timeout time.Duration) error
+	StatusFunc          func(ctx context.Context, unit string) (systemd.UnitStatus, error)
+}
+
+func (m *SystemdManager) Start(ctx context.Context, unit string, timeout time.Duration) error {
+	if m.StartFunc != nil {
+		return m.StartFunc(ctx, unit, timeout)
+	}
+	return nil
+}
+
+func (m *SystemdManager) Stop(ctx context.Context, unit string, timeout time.Duration) error {
+	if m.StopFunc != nil {
+		return m.StopFunc(ctx, unit, timeout)
+	}
+	return nil
 }
 
 func (m *SystemdManager) Restart(ctx context.Context, unit string, timeout time.Duration) error {
@@ -15,3 +37,102 @@ func (m *SystemdManager) Restart(ctx context.Context, unit string, timeout time.
 	}
 	return nil
 }
+
+func (m *SystemdManager) ReloadOrRestart(ctx context.Context, unit string, timeout time.Duration) error {
+	if m.ReloadOrRestartFunc != nil {
+		return m.ReloadOrRestartFunc(ctx, unit, timeout)
+	}
+	return nil
+}
+
+func (m *SystemdManager) Status(ctx context.Context, unit string) (systemd.UnitStatus, error) {
+	if m.StatusFunc != nil {
+		return m.StatusFunc(ctx, unit)
+	}
+	return systemd.UnitStatus{Unit: unit, LoadState: "loaded", ActiveState: "active", SubState: "running"}, nil
+}
+
+func (m *SystemdManager) IsActive(ctx context.Context, unit string) (bool, error) {
+	st, err := m.Status(ctx, unit)
+	return st.ActiveState == "active", err
+}
+
+func (m *SystemdManager) MainPID(ctx context.Context, unit string) (int, error) {
+	st, err := m.Status(ctx, unit)
+	return st.MainPID, err
+}
+
+// SystemdBus fakes go-systemd's D-Bus connection. Jobs answer on ch with
+// JobResult (default "done") unless JobResult returns "" (never finishes).
+type SystemdBus struct {
+	Calls []string // "RestartUnit suricata.service"
+
+	JobErr    error
+	JobResult func(method, unit string) string
+
+	UnitProperties    map[string]any
+	ServiceProperties map[string]any
+	PropertiesErr     error
+
+	Closed bool
+}
+
+// checkName rejects bare names like systemd does: go-systemd sends them as is.
+func checkName(name string) error {
+	if !strings.Contains(name, ".") {
+		return fmt.Errorf("Unit name %s is missing the suffix.", name)
+	}
+	return nil
+}
+
+func (b *SystemdBus) job(method, name string, ch chan<- string) (int, error) {
+	b.Calls = append(b.Calls, method+" "+name)
+	if err := checkName(name); err != nil {
+		return 0, err
+	}
+	if b.JobErr != nil {
+		return 0, b.JobErr
+	}
+	result := "done"
+	if b.JobResult != nil {
+		result = b.JobResult(method, name)
+	}
+	if result != "" && ch != nil {
+		ch <- result
+	}
+	return len(b.Calls), nil
+}
+
+func (b *SystemdBus) StartUnitContext(_ context.Context, name, _ string, ch chan<- string) (int, error) {
+	return b.job("StartUnit", name, ch)
+}
+
+func (b *SystemdBus) StopUnitContext(_ context.Context, name, _ string, ch chan<- string) (int, error) {
+	return b.job("StopUnit", name, ch)
+}
+
+func (b *SystemdBus) RestartUnitContext(_ context.Context, name, _ string, ch chan<- string) (int, error) {
+	return b.job("RestartUnit", name, ch)
+}
+
+func (b *SystemdBus) ReloadOrRestartUnitContext(_ context.Context, name, _ string, ch chan<- string) (int, error) {
+	return b.job("ReloadOrRestartUnit", name, ch)
+}
+
+func (b *SystemdBus) GetUnitPropertiesContext(_ context.Context, unit string) (map[string]any, error) {
+	b.Calls = append(b.Calls, "GetUnitProperties "+unit)
+	if err := checkName(unit); err != nil {
+		return nil, err
+	}
+	return b.UnitProperties, b.PropertiesErr
+}
+
+func (b *SystemdBus) GetUnitTypePropertiesContext(_ context.Context, unit, unitType string) (map[string]any, error) {
+	b.Calls = append(b.Calls, "Get"+unitType+"Properties "+unit)
+	if err := checkName(unit); err != nil {
+		return nil, err
+	}
+	return b.ServiceProperties, b.PropertiesErr
+}
+
+func (b *SystemdBus) Close() { b.Closed = true }
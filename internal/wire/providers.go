@@ -1,6 +1,7 @@
 package wire
 
 import (
+	"context"
 	"strings"
 	"time"
 
@@ -20,6 +21,7 @@ type HostAgentOptions struct {
 	NDPIPluginPath  string
 	SystemdUnit     string
 	SystemctlPath   string
+	AuditLogPath    string
 	RestartTimeout  time.Duration
 	ShutdownTimeout time.Duration
 }
@@ -75,6 +77,21 @@ func newHostAgentService(opts HostAgentOptions) (app.Service, error) {
 		systemctlPath = cfg.System.Systemctl
 	}
 
+	manager, err := systemd.New(context.Background(), cfg.System.SystemdBackend, systemctlPath, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	auditLog := opts.AuditLogPath
+	if auditLog == "" {
+		auditLog = cfg.HostAgent.AuditLog
+	}
+
+	access := make([]hostagent.AccessRule, 0, len(cfg.HostAgent.Access))
+	for _, a := range cfg.HostAgent.Access {
+		access = append(access, hostagent.AccessRule{Name: a.Name, Users: a.Users, Groups: a.Groups, Routes: a.Routes})
+	}
+
 	deps := hostagent.Deps{
 		SocketPath:    firstNonEmpty([]string{opts.SocketPath, cfg.HTTP.HostAgentSocket}),
 		SystemctlPath: systemctlPath,
@@ -85,15 +102,19 @@ func newHostAgentService(opts HostAgentOptions) (app.Service, error) {
 		SuricataCfgPath: suricataCfgPath,
 		NDPIPluginPath:  ndpiPluginPath,
 
-		SuricataSCPath: cfg.Paths.SuricataSC,
-		ReloadCommand:  cfg.Reload.Command,
-		ReloadTimeout:  cfg.Reload.Timeout,
+		SuricataSCPath:  cfg.Paths.SuricataSC,
+		SuricataBinPath: cfg.Paths.SuricataBin,
+		ReloadCommand:   cfg.Reload.Command,
+		ReloadTimeout:   cfg.Reload.Timeout,
+
+		AuditLogPath: auditLog,
+		Access:       access,
 
 		RestartTimeout:         opts.RestartTimeout,
 		SuricataConnectTimeout: 300 * time.Millisecond,
 
 		FS:      fsutil.OSFS{},
-		Systemd: systemd.NewManager(systemctlPath, nil),
+		Systemd: manager,
 	}
 
 	return hostagent.New(deps)
@@ -3,10 +3,15 @@ package agentclient
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
+	"strconv"
 	"time"
+
+	"integration-suricata-ndpi/pkg/apierror"
 )
 
 type Client struct {
@@ -33,6 +38,47 @@ func New(sockPath string, timeout time.Duration) *Client {
 	}
 }
 
+type requestIDKey struct{}
+
+// WithRequestID makes calls made with ctx send id as X-Request-ID, which the
+// agent writes to its audit log.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+func newRequest(ctx context.Context, method, url string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if id, ok := ctx.Value(requestIDKey{}).(string); ok {
+		req.Header.Set("X-Request-ID", id)
+	}
+	return req, nil
+}
+
+// Health returns nil when the agent answers its liveness probe.
+func (c *Client) Health(ctx context.Context) error {
+	_, err := c.raw(ctx, "http://unix/health")
+	return err
+}
+
+// OpenAPI returns the agent's OpenAPI document.
+func (c *Client) OpenAPI(ctx context.Context) ([]byte, error) {
+	return c.raw(ctx, "http://unix/openapi.json")
+}
+
+func (c *Client) NDPIStatus(ctx context.Context) (*NDPIStatusResponse, error) {
+	var out NDPIStatusResponse
+	if err := c.do(ctx, http.MethodGet, "http://unix/ndpi/status", &out); err != nil {
+		return &out, err
+	}
+	return &out, nil
+}
+
 func (c *Client) EnableNDPI(ctx context.Context) (*ToggleResponse, error) {
 	return c.postToggle(ctx, "http://unix/ndpi/enable")
 }
@@ -42,53 +88,106 @@ func (c *Client) DisableNDPI(ctx context.Context) (*ToggleResponse, error) {
 }
 
 func (c *Client) EnsureSuricataStarted(ctx context.Context) (*EnsureSuricataResponse, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://unix/suricata/ensure", nil)
-	if err != nil {
-		return nil, err
+	var out EnsureSuricataResponse
+	if err := c.do(ctx, http.MethodPost, "http://unix/suricata/ensure", &out); err != nil {
+		return &out, err
 	}
+	return &out, nil
+}
 
-	resp, err := c.http.Do(req)
-	if err != nil {
-		return nil, err
+// ReloadSuricata runs the agent's suricatasc reload command.
+func (c *Client) ReloadSuricata(ctx context.Context) (*ReloadResponse, error) {
+	var out ReloadResponse
+	if err := c.do(ctx, http.MethodPost, "http://unix/suricata/reload", &out); err != nil {
+		return &out, err
 	}
-	defer resp.Body.Close()
+	return &out, nil
+}
 
-	var out EnsureSuricataResponse
-	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
-		return nil, err
+// SuricataStatus reports the Suricata unit, process and plugin state.
+func (c *Client) SuricataStatus(ctx context.Context) (*SuricataStatusResponse, error) {
+	var out SuricataStatusResponse
+	if err := c.do(ctx, http.MethodGet, "http://unix/suricata/status", &out); err != nil {
+		return &out, err
 	}
+	return &out, nil
+}
 
-	if resp.StatusCode >= 300 || !out.OK {
-		msg := out.Message
-		if msg == "" {
-			msg = resp.Status
-		}
-		return &out, fmt.Errorf("agent error: %s", msg)
+// Audit returns the newest limit audit records (0 for the agent's default)
+// and the verdict on the whole hash chain.
+func (c *Client) Audit(ctx context.Context, limit int) (*AuditResponse, error) {
+	url := "http://unix/audit"
+	if limit > 0 {
+		url += "?limit=" + strconv.Itoa(limit)
+	}
+	var out AuditResponse
+	if err := c.do(ctx, http.MethodGet, url, &out); err != nil {
+		return &out, err
 	}
-
 	return &out, nil
 }
 
 func (c *Client) postToggle(ctx context.Context, url string) (*ToggleResponse, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
+	var out ToggleResponse
+	if err := c.do(ctx, http.MethodPost, url, &out); err != nil {
+		return &out, err
+	}
+	return &out, nil
+}
+
+func (c *Client) send(ctx context.Context, method, url string) (*http.Response, []byte, error) {
+	req, err := newRequest(ctx, method, url)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	resp, err := c.http.Do(req)
 	if err != nil {
-		return nil, err
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, nil, apierror.ErrTimeout.Wrap(err)
+		}
+		return nil, nil, ErrUnavailable.Wrap(err)
 	}
 	defer resp.Body.Close()
 
-	var out ToggleResponse
-	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
-		return nil, err
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 8<<20))
+	if err != nil {
+		return nil, nil, ErrUnavailable.Wrap(err)
 	}
+	return resp, raw, nil
+}
 
-	if resp.StatusCode >= 300 || !out.OK {
-		return &out, fmt.Errorf("agent error: %s", out.Message)
+// do decodes the agent's answer into out; a failed call comes back as an
+// *apierror.Error carrying the agent's code.
+func (c *Client) do(ctx context.Context, method, url string, out any) error {
+	resp, raw, err := c.send(ctx, method, url)
+	if err != nil {
+		return err
+	}
+	var status agentStatus
+	if err := json.Unmarshal(raw, &status); err != nil {
+		return ErrUnavailable.Wrap(fmt.Errorf("agent answered %s with non-JSON body: %w", resp.Status, err))
+	}
+	if err := json.Unmarshal(raw, out); err != nil {
+		return err
 	}
 
-	return &out, nil
+	if resp.StatusCode >= 300 || !status.OK {
+		return agentError(resp.StatusCode, status.Code, status.Message)
+	}
+	return nil
+}
+
+// raw is do for the routes that do not answer in the agent's status shape.
+func (c *Client) raw(ctx context.Context, url string) ([]byte, error) {
+	resp, raw, err := c.send(ctx, http.MethodGet, url)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		var status agentStatus
+		_ = json.Unmarshal(raw, &status)
+		return nil, agentError(resp.StatusCode, status.Code, status.Message)
+	}
+	return raw, nil
 }
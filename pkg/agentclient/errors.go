@@ -0,0 +1,53 @@
+package agentclient
+
+import (
+	"fmt"
+	"net/http"
+
+	"integration-suricata-ndpi/pkg/apierror"
+)
+
+// Errors for the codes only the host agent answers with. The agent's code is
+// kept, so errors.Is works against these and against any *apierror.Error with
+// the same code; RESTART_FAILED, SURICATA_NOT_READY, RELOAD_FAILED and TIMEOUT
+// map onto the apierror sentinels.
+var (
+	ErrUnavailable           = apierror.New(http.StatusBadGateway, "HOST_AGENT_UNAVAILABLE", "host agent not reachable", true)
+	ErrNDPINotConfigured     = apierror.New(http.StatusConflict, "NDPI_NOT_CONFIGURED", "ndpi plugin line not found in suricata config", false)
+	ErrSuricataRestartFailed = apierror.New(http.StatusBadGateway, "SURICATA_RESTART_FAILED", "failed to restart suricata", true)
+	ErrAuditDisabled         = apierror.New(http.StatusNotFound, "AUDIT_DISABLED", "host agent audit log is not configured", false)
+)
+
+var agentErrors = map[string]*apierror.Error{
+	ErrNDPINotConfigured.Code:         ErrNDPINotConfigured,
+	apierror.ErrSuricataNotReady.Code: apierror.ErrSuricataNotReady,
+	apierror.ErrRestartFailed.Code:    apierror.ErrRestartFailed,
+	ErrSuricataRestartFailed.Code:     ErrSuricataRestartFailed,
+	apierror.ErrReloadFailed.Code:     apierror.ErrReloadFailed,
+	apierror.ErrTimeout.Code:          apierror.ErrTimeout,
+	ErrAuditDisabled.Code:             ErrAuditDisabled,
+}
+
+type agentStatus struct {
+	OK      bool   `json:"ok"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// agentError maps a failed agent answer. Codes without a sentinel (permission
+// problems on the host, the agent refusing the caller) are a fault on the
+// host side and become HOST_AGENT_<code> with 502.
+func agentError(status int, code, message string) *apierror.Error {
+	if message == "" {
+		message = http.StatusText(status)
+	}
+	details := map[string]any{"agent_status": status, "agent_message": message}
+	if e, ok := agentErrors[code]; ok {
+		return e.WithDetails(details)
+	}
+	if code == "" {
+		code = "ERROR"
+	}
+	out := apierror.New(http.StatusBadGateway, "HOST_AGENT_"+code, fmt.Sprintf("host agent: %s", message), false)
+	return out.WithDetails(details)
+}
@@ -1,10 +1,13 @@
 package agentclient
 
+import "time"
+
 type ToggleResponse struct {
 	OK      bool   `json:"ok"`
 	Changed bool   `json:"changed"`
 	Message string `json:"message"`
 	Enabled bool   `json:"enabled,omitempty"`
+	Code    string `json:"code,omitempty"`
 }
 
 type EnsureSuricataResponse struct {
@@ -14,3 +17,113 @@ type EnsureSuricataResponse struct {
 	Code    string `json:"code,omitempty"`
 	Message string `json:"message,omitempty"`
 }
+
+type NDPIStatusResponse struct {
+	OK      bool   `json:"ok"`
+	Enabled bool   `json:"enabled"`
+	Line    string `json:"line,omitempty"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type SuricataStatusResponse struct {
+	OK bool `json:"ok"`
+
+	Unit                  string     `json:"unit"`
+	LoadState             string     `json:"load_state,omitempty"`
+	ActiveState           string     `json:"active_state,omitempty"`
+	SubState              string     `json:"sub_state,omitempty"`
+	MainPID               int        `json:"main_pid,omitempty"`
+	ActiveSince           *time.Time `json:"active_since,omitempty"`
+	UptimeSeconds         int64      `json:"uptime_seconds,omitempty"`
+	SuricataUptimeSeconds *int64     `json:"suricata_uptime_seconds,omitempty"`
+	NRestarts             int        `json:"n_restarts"`
+	Result                string     `json:"result,omitempty"`
+
+	Version     string       `json:"version,omitempty"`
+	ConfigPath  string       `json:"config_path"`
+	Socket      string       `json:"socket,omitempty"`
+	NDPI        NDPILoaded   `json:"ndpi"`
+	LastRestart *LastRestart `json:"last_restart,omitempty"`
+
+	Warnings []string `json:"warnings,omitempty"`
+	Code     string   `json:"code,omitempty"`
+	Message  string   `json:"message,omitempty"`
+}
+
+// NDPILoaded says whether the running Suricata has the plugin loaded and
+// how that was determined (maps or build-info).
+type NDPILoaded struct {
+	Loaded bool   `json:"loaded"`
+	Source string `json:"source,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type LastRestart struct {
+	Time      time.Time `json:"time"`
+	Reason    string    `json:"reason"`
+	By        string    `json:"by"` // host-agent | systemd
+	OK        bool      `json:"ok"`
+	Error     string    `json:"error,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+}
+
+type ReloadResponse struct {
+	OK      bool   `json:"ok"`
+	Socket  string `json:"socket,omitempty"`
+	Command string `json:"command,omitempty"`
+	Output  string `json:"output,omitempty"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type AuditResponse struct {
+	OK      bool          `json:"ok"`
+	Records []AuditRecord `json:"records"`
+	Chain   AuditChain    `json:"chain"`
+	Code    string        `json:"code,omitempty"`
+	Message string        `json:"message,omitempty"`
+}
+
+// AuditRecord mirrors hostagent.AuditRecord.
+type AuditRecord struct {
+	Seq          uint64        `json:"seq"`
+	Time         time.Time     `json:"time"`
+	RequestID    string        `json:"request_id"`
+	Phase        string        `json:"phase,omitempty"`
+	Method       string        `json:"method"`
+	Path         string        `json:"path"`
+	Peer         *PeerCred     `json:"peer,omitempty"`
+	Status       int           `json:"status"`
+	OK           bool          `json:"ok"`
+	Code         string        `json:"code,omitempty"`
+	Message      string        `json:"message,omitempty"`
+	DurationMS   int64         `json:"duration_ms"`
+	ConfigPath   string        `json:"config_path"`
+	ConfigBefore string        `json:"config_sha256_before,omitempty"`
+	ConfigAfter  string        `json:"config_sha256_after,omitempty"`
+	Restart      *AuditRestart `json:"restart,omitempty"`
+	PrevHash     string        `json:"prev_hash"`
+	Hash         string        `json:"hash"`
+}
+
+type PeerCred struct {
+	UID uint32 `json:"uid"`
+	GID uint32 `json:"gid"`
+	PID int32  `json:"pid"`
+}
+
+type AuditRestart struct {
+	Unit        string     `json:"unit"`
+	OK          bool       `json:"ok"`
+	Error       string     `json:"error,omitempty"`
+	DurationMS  int64      `json:"duration_ms"`
+	ActiveSince *time.Time `json:"active_since,omitempty"`
+}
+
+type AuditChain struct {
+	OK       bool   `json:"ok"`
+	Records  int    `json:"records"`
+	BrokenAt uint64 `json:"broken_at,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
@@ -0,0 +1,406 @@
+// Package apiclient is a Go client for the integration HTTP API described by
+// internal/httpapi/openapi.json. Failed calls return an *apierror.Error with
+// the code the server answered.
+package apiclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"integration-suricata-ndpi/integration"
+	"integration-suricata-ndpi/internal/httpapi"
+	"integration-suricata-ndpi/pkg/agentclient"
+	"integration-suricata-ndpi/pkg/apierror"
+	"integration-suricata-ndpi/pkg/rules"
+)
+
+// ErrUnavailable is returned when the server cannot be reached or answers
+// something other than the API.
+var ErrUnavailable = apierror.New(http.StatusBadGateway, "API_UNAVAILABLE", "integration API not reachable", true)
+
+type Options struct {
+	// Token is sent as a bearer token when set.
+	Token string
+	// TLS is used for https URLs, e.g. to trust a private CA or present a
+	// client certificate.
+	TLS     *tls.Config
+	Timeout time.Duration
+	// HTTPClient replaces the client built from TLS and Timeout.
+	HTTPClient *http.Client
+}
+
+type Client struct {
+	base  string
+	token string
+	http  *http.Client
+}
+
+// New returns a client for the API at baseURL, e.g. "https://127.0.0.1:8080".
+func New(baseURL string, opts Options) (*Client, error) {
+	u, err := url.Parse(strings.TrimRight(baseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("api url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("api url %q: scheme must be http or https", baseURL)
+	}
+
+	hc := opts.HTTPClient
+	if hc == nil {
+		timeout := opts.Timeout
+		if timeout <= 0 {
+			timeout = 30 * time.Second
+		}
+		tr := http.DefaultTransport.(*http.Transport).Clone()
+		tr.TLSClientConfig = opts.TLS
+		hc = &http.Client{Transport: tr, Timeout: timeout}
+	}
+	return &Client{base: u.String(), token: opts.Token, http: hc}, nil
+}
+
+func (c *Client) Health(ctx context.Context) error {
+	return c.do(ctx, http.MethodGet, "/health", nil, "", nil)
+}
+
+// OpenAPI returns the server's OpenAPI document.
+func (c *Client) OpenAPI(ctx context.Context) ([]byte, error) {
+	var out json.RawMessage
+	err := c.do(ctx, http.MethodGet, "/openapi.json", nil, "", &out)
+	return out, err
+}
+
+// Plan is the dry run of a reconcile.
+func (c *Client) Plan(ctx context.Context) (*integration.PlanReport, error) {
+	var out integration.PlanReport
+	if err := c.do(ctx, http.MethodGet, "/plan", nil, "", &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Reconcile submits a reconcile job; its result is a ReconcileReport.
+func (c *Client) Reconcile(ctx context.Context) (*integration.Job, error) {
+	return c.job(ctx, http.MethodPost, "/plan", nil, "")
+}
+
+// Apply submits an apply of the local rules.
+func (c *Client) Apply(ctx context.Context) (*integration.Job, error) {
+	return c.job(ctx, http.MethodPost, "/apply", nil, "")
+}
+
+// ApplyBundlePath submits an apply of the rule bundle at path on the server.
+func (c *Client) ApplyBundlePath(ctx context.Context, path string) (*integration.Job, error) {
+	body, err := json.Marshal(map[string]string{"bundle_path": path})
+	if err != nil {
+		return nil, err
+	}
+	return c.job(ctx, http.MethodPost, "/apply", body, "application/json")
+}
+
+// ApplyBundle uploads a rule bundle (tar.gz) and submits its apply.
+func (c *Client) ApplyBundle(ctx context.Context, bundle []byte) (*integration.Job, error) {
+	return c.job(ctx, http.MethodPost, "/apply", bundle, "application/gzip")
+}
+
+// Rollback submits a redeploy of the rules the last deploy replaced.
+func (c *Client) Rollback(ctx context.Context) (*integration.Job, error) {
+	return c.job(ctx, http.MethodPost, "/rollback", nil, "")
+}
+
+// NDPIStatus is the plugin state as the host agent reads it.
+func (c *Client) NDPIStatus(ctx context.Context) (*agentclient.NDPIStatusResponse, error) {
+	var out agentclient.NDPIStatusResponse
+	if err := c.do(ctx, http.MethodGet, "/ndpi/status", nil, "", &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// EnableNDPI submits a job enabling the plugin through the host agent; its
+// result is an agentclient.ToggleResponse.
+func (c *Client) EnableNDPI(ctx context.Context) (*integration.Job, error) {
+	return c.job(ctx, http.MethodPost, "/ndpi/enable", nil, "")
+}
+
+// DisableNDPI submits a job disabling the plugin through the host agent; its
+// result is an agentclient.ToggleResponse.
+func (c *Client) DisableNDPI(ctx context.Context) (*integration.Job, error) {
+	return c.job(ctx, http.MethodPost, "/ndpi/disable", nil, "")
+}
+
+// EnsureSuricata submits a job starting Suricata through the host agent unless
+// it runs; its result is an agentclient.EnsureSuricataResponse.
+func (c *Client) EnsureSuricata(ctx context.Context) (*integration.Job, error) {
+	return c.job(ctx, http.MethodPost, "/suricata/ensure", nil, "")
+}
+
+// Reload is a ruleset-reload-nonblocking started by an apply.
+func (c *Client) Reload(ctx context.Context, id string) (*integration.RuleReload, error) {
+	var out integration.RuleReload
+	if err := c.do(ctx, http.MethodGet, "/reloads/"+url.PathEscape(id), nil, "", &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) Jobs(ctx context.Context) ([]integration.Job, error) {
+	var out struct {
+		Jobs []integration.Job `json:"jobs"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/jobs", nil, "", &out); err != nil {
+		return nil, err
+	}
+	return out.Jobs, nil
+}
+
+func (c *Client) Job(ctx context.Context, id string) (*integration.Job, error) {
+	return c.job(ctx, http.MethodGet, "/jobs/"+url.PathEscape(id), nil, "")
+}
+
+func (c *Client) CancelJob(ctx context.Context, id string) (*integration.Job, error) {
+	return c.job(ctx, http.MethodDelete, "/jobs/"+url.PathEscape(id), nil, "")
+}
+
+// WaitJob polls the job every interval until it has finished or ctx ends.
+func (c *Client) WaitJob(ctx context.Context, id string, interval time.Duration) (*integration.Job, error) {
+	if interval <= 0 {
+		interval = 500 * time.Millisecond
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		job, err := c.Job(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		switch job.Status {
+		case integration.JobSucceeded, integration.JobFailed, integration.JobCanceled:
+			return job, nil
+		}
+		select {
+		case <-ctx.Done():
+			return job, ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+func (c *Client) History(ctx context.Context, q httpapi.HistoryQuery) (*integration.HistoryPage, error) {
+	v := url.Values{}
+	set(v, "kind", q.Kind)
+	set(v, "status", q.Status)
+	set(v, "job_id", q.JobID)
+	if !q.Since.IsZero() {
+		v.Set("since", q.Since.Format(time.RFC3339))
+	}
+	if !q.Until.IsZero() {
+		v.Set("until", q.Until.Format(time.RFC3339))
+	}
+	if q.Before > 0 {
+		v.Set("before", strconv.FormatUint(q.Before, 10))
+	}
+	if q.Limit > 0 {
+		v.Set("limit", strconv.Itoa(q.Limit))
+	}
+	var out integration.HistoryPage
+	if err := c.do(ctx, http.MethodGet, withQuery("/history", v), nil, "", &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) Rules(ctx context.Context, q httpapi.RuleQuery) (*integration.RulesListing, error) {
+	v := url.Values{}
+	set(v, "source", q.Source)
+	if q.SID > 0 {
+		v.Set("sid", strconv.FormatUint(q.SID, 10))
+	}
+	set(v, "action", q.Action)
+	set(v, "transport", q.Transport)
+	set(v, "ndpi_protocol", q.NDPIProtocol)
+	set(v, "ndpi_risk", q.NDPIRisk)
+	set(v, "mitre", q.Mitre)
+	set(v, "file", q.File)
+	var out integration.RulesListing
+	if err := c.do(ctx, http.MethodGet, withQuery("/rules", v), nil, "", &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Rule returns one rule; source is "local" (default) or "deployed".
+func (c *Client) Rule(ctx context.Context, sid uint64, source string) (*integration.RuleDetail, error) {
+	v := url.Values{}
+	set(v, "source", source)
+	var out integration.RuleDetail
+	if err := c.do(ctx, http.MethodGet, withQuery("/rules/"+strconv.FormatUint(sid, 10), v), nil, "", &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) RulesCoverage(ctx context.Context) (*integration.CoverageMatrix, error) {
+	var out integration.CoverageMatrix
+	if err := c.do(ctx, http.MethodGet, "/rules/coverage", nil, "", &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) RulesMitre(ctx context.Context, source string) (*integration.MitreReport, error) {
+	v := url.Values{}
+	set(v, "source", source)
+	var out integration.MitreReport
+	if err := c.do(ctx, http.MethodGet, withQuery("/rules/mitre", v), nil, "", &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) RulesDiff(ctx context.Context) (*integration.RulesDiff, error) {
+	var out integration.RulesDiff
+	if err := c.do(ctx, http.MethodGet, "/rules/diff", nil, "", &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ValidateRules lints text in .rules syntax.
+func (c *Client) ValidateRules(ctx context.Context, text string) (*rules.LintReport, error) {
+	var out rules.LintReport
+	if err := c.do(ctx, http.MethodPost, "/rules/validate", []byte(text), "text/plain", &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DisableRule, EnableRule and SetRuleAction submit an override job; its
+// result is an integration.RuleOverrideResult.
+func (c *Client) DisableRule(ctx context.Context, sid uint64) (*integration.Job, error) {
+	return c.override(ctx, sid, "disable", nil)
+}
+
+func (c *Client) EnableRule(ctx context.Context, sid uint64) (*integration.Job, error) {
+	return c.override(ctx, sid, "enable", nil)
+}
+
+func (c *Client) SetRuleAction(ctx context.Context, sid uint64, action string) (*integration.Job, error) {
+	body, err := json.Marshal(map[string]string{"action": action})
+	if err != nil {
+		return nil, err
+	}
+	return c.override(ctx, sid, "action", body)
+}
+
+func (c *Client) override(ctx context.Context, sid uint64, op string, body []byte) (*integration.Job, error) {
+	ct := ""
+	if body != nil {
+		ct = "application/json"
+	}
+	return c.job(ctx, http.MethodPost, "/rules/"+strconv.FormatUint(sid, 10)+"/"+op, body, ct)
+}
+
+func (c *Client) job(ctx context.Context, method, path string, body []byte, ct string) (*integration.Job, error) {
+	var out integration.Job
+	if err := c.do(ctx, method, path, body, ct, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) newRequest(ctx context.Context, method, path string, body io.Reader, ct string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.base+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if ct != "" {
+		req.Header.Set("Content-Type", ct)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return req, nil
+}
+
+// do sends the request and decodes a 2xx answer into out (when not nil). Any
+// other answer is decoded as the API error model.
+func (c *Client) do(ctx context.Context, method, path string, body []byte, ct string, out any) error {
+	var rd io.Reader
+	if body != nil {
+		rd = bytes.NewReader(body)
+	}
+	req, err := c.newRequest(ctx, method, path, rd, ct)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return transportError(err)
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 64<<20))
+	if err != nil {
+		return ErrUnavailable.Wrap(err)
+	}
+	if resp.StatusCode >= 300 {
+		return responseError(resp, raw)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(raw, out); err != nil {
+		return ErrUnavailable.Wrap(fmt.Errorf("decode %s %s: %w", method, path, err))
+	}
+	return nil
+}
+
+func transportError(err error) error {
+	var ue *url.Error
+	switch {
+	case errors.Is(err, context.Canceled):
+		return apierror.ErrCanceled.Wrap(err)
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &ue) && ue.Timeout():
+		return apierror.ErrTimeout.Wrap(err)
+	}
+	return ErrUnavailable.Wrap(err)
+}
+
+func responseError(resp *http.Response, raw []byte) *apierror.Error {
+	var ae apierror.Error
+	if err := json.Unmarshal(raw, &ae); err != nil || ae.Code == "" {
+		msg := strings.TrimSpace(string(raw))
+		if msg == "" {
+			msg = resp.Status
+		}
+		out := apierror.ForStatus(resp.StatusCode, msg)
+		out.Retryable = resp.StatusCode == http.StatusServiceUnavailable
+		return out
+	}
+	ae.Status = resp.StatusCode
+	return &ae
+}
+
+func set(v url.Values, key, value string) {
+	if value != "" {
+		v.Set(key, value)
+	}
+}
+
+func withQuery(path string, v url.Values) string {
+	if len(v) == 0 {
+		return path
+	}
+	return path + "?" + v.Encode()
+}
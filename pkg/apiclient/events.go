@@ -0,0 +1,74 @@
+package apiclient
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"integration-suricata-ndpi/internal/httpapi"
+)
+
+// Events subscribes to GET /events and replays what the server still buffers
+// after lastID (0 for none). The channel is closed when ctx ends or the
+// server drops the stream; reconnect with the last ID seen to resume.
+func (c *Client) Events(ctx context.Context, lastID uint64) (<-chan httpapi.Event, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, "/events", nil, "")
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if lastID > 0 {
+		req.Header.Set("Last-Event-ID", strconv.FormatUint(lastID, 10))
+	}
+
+	// the stream outlives the client timeout
+	hc := *c.http
+	hc.Timeout = 0
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, transportError(err)
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		raw, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		return nil, responseError(resp, raw)
+	}
+
+	out := make(chan httpapi.Event, 16)
+	go func() {
+		defer close(out)
+		defer resp.Body.Close()
+
+		sc := bufio.NewScanner(resp.Body)
+		sc.Buffer(make([]byte, 64<<10), 4<<20)
+		var data strings.Builder
+		for sc.Scan() {
+			line := sc.Text()
+			if line == "" {
+				if data.Len() > 0 {
+					var ev httpapi.Event
+					if json.Unmarshal([]byte(data.String()), &ev) == nil {
+						select {
+						case out <- ev:
+						case <-ctx.Done():
+							return
+						}
+					}
+					data.Reset()
+				}
+				continue
+			}
+			if v, ok := strings.CutPrefix(line, "data:"); ok {
+				if data.Len() > 0 {
+					data.WriteByte('\n')
+				}
+				data.WriteString(strings.TrimPrefix(v, " "))
+			}
+		}
+	}()
+	return out, nil
+}
@@ -0,0 +1,130 @@
+// Package apierror is the error model shared by the integration API, the host
+// agent client and the operations behind them.
+package apierror
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// Error is what an API caller sees: a stable Code to branch on, a Message
+// safe to show, optional Details and whether retrying may help. Cause is
+// kept for logs and errors.Is/As but never sent.
+type Error struct {
+	Status    int    `json:"-"`
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Details   any    `json:"details,omitempty"`
+	Retryable bool   `json:"retryable"`
+	Cause     error  `json:"-"`
+}
+
+// New returns a sentinel; use Wrap or WithDetails to attach a cause or details.
+func New(status int, code, message string, retryable bool) *Error {
+	return &Error{Status: status, Code: code, Message: message, Retryable: retryable}
+}
+
+func (e *Error) Error() string {
+	if e.Cause != nil {
+		return e.Message + ": " + e.Cause.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error { return e.Cause }
+
+// Is matches any *Error with the same code, so errors.Is(err, ErrX) holds for
+// every copy made from the sentinel ErrX.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// Wrap returns a copy of e caused by err.
+func (e *Error) Wrap(err error) *Error {
+	out := *e
+	out.Cause = err
+	return &out
+}
+
+// WithDetails returns a copy of e carrying details.
+func (e *Error) WithDetails(details any) *Error {
+	out := *e
+	out.Details = details
+	return &out
+}
+
+// Coded is implemented by typed errors that know their API code. The caller
+// gets PublicMessage, a fixed text per code; what varies goes in Details.
+type Coded interface {
+	error
+	HTTPStatus() int
+	ErrorCode() string
+	PublicMessage() string
+}
+
+var (
+	ErrInternal = New(http.StatusInternalServerError, "INTERNAL", "internal error", false)
+	ErrTimeout  = New(http.StatusGatewayTimeout, "TIMEOUT", "operation timed out", true)
+	ErrCanceled = New(499, "CANCELED", "operation canceled", false)
+
+	// Suricata errors both the integration and the host agent answer with.
+	ErrRestartFailed    = New(http.StatusBadGateway, "RESTART_FAILED", "suricata restart failed", true)
+	ErrSuricataNotReady = New(http.StatusServiceUnavailable, "SURICATA_NOT_READY", "suricata control socket not reachable", true)
+	ErrReloadFailed     = New(http.StatusBadGateway, "RELOAD_FAILED", "suricata rule reload failed", true)
+)
+
+// From maps err onto the model. The message is always the stable one of the
+// code; err stays the Cause, so paths and command output in its text only
+// reach the logs.
+func From(err error) *Error {
+	var ae *Error
+	if errors.As(err, &ae) {
+		return ae
+	}
+	var c Coded
+	if errors.As(err, &c) {
+		out := &Error{Status: c.HTTPStatus(), Code: c.ErrorCode(), Message: c.PublicMessage(), Cause: err}
+		var d interface{ Details() any }
+		if errors.As(err, &d) {
+			out.Details = d.Details()
+		}
+		var r interface{ Retryable() bool }
+		if errors.As(err, &r) {
+			out.Retryable = r.Retryable()
+		}
+		return out
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrTimeout.Wrap(err)
+	case errors.Is(err, context.Canceled):
+		return ErrCanceled.Wrap(err)
+	}
+	return ErrInternal.Wrap(err)
+}
+
+// ForStatus is the model for a plain status answered by the API itself.
+func ForStatus(status int, message string) *Error {
+	code := "INTERNAL"
+	switch status {
+	case http.StatusBadRequest:
+		code = "BAD_REQUEST"
+	case http.StatusUnauthorized:
+		code = "UNAUTHENTICATED"
+	case http.StatusForbidden:
+		code = "FORBIDDEN"
+	case http.StatusNotFound:
+		code = "NOT_FOUND"
+	case http.StatusMethodNotAllowed:
+		code = "METHOD_NOT_ALLOWED"
+	case http.StatusNotAcceptable:
+		code = "NOT_ACCEPTABLE"
+	case http.StatusRequestEntityTooLarge:
+		code = "TOO_LARGE"
+	case http.StatusServiceUnavailable:
+		code = "UNAVAILABLE"
+	}
+	return &Error{Status: status, Code: code, Message: message}
+}
@@ -20,6 +20,11 @@ type FS interface {
 	Rename(oldpath, newpath string) error
 	Chmod(name string, mode os.FileMode) error
 	Glob(pattern string) ([]string, error)
+
+	MkdirTemp(dir, pattern string) (string, error)
+	MkdirAll(path string, perm os.FileMode) error
+	WriteFile(name string, data []byte, perm os.FileMode) error
+	RemoveAll(path string) error
 }
 
 type OSFS struct{}
@@ -35,3 +40,9 @@ func (OSFS) Chmod(name string, mode os.FileMode) error { return os.Chmod(name, m
 func (OSFS) Glob(pattern string) ([]string, error) {
 	return filepath.Glob(pattern)
 }
+func (OSFS) MkdirTemp(dir, pattern string) (string, error) { return os.MkdirTemp(dir, pattern) }
+func (OSFS) MkdirAll(path string, perm os.FileMode) error  { return os.MkdirAll(path, perm) }
+func (OSFS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	return os.WriteFile(name, data, perm)
+}
+func (OSFS) RemoveAll(path string) error { return os.RemoveAll(path) }
@@ -0,0 +1,185 @@
+package hostagent
+
+import (
+	"fmt"
+	"net/http"
+	"os/user"
+	"strconv"
+	"strings"
+
+	"integration-suricata-ndpi/pkg/logger"
+)
+
+// AccessRule grants Routes to the listed users and groups (names or numeric
+// ids). A route is "*", a path ("/health", any method), "METHOD /path", and a
+// path may end in "*" to match a prefix.
+type AccessRule struct {
+	Name   string
+	Users  []string
+	Groups []string
+	Routes []string
+}
+
+type accessGrant struct {
+	name   string
+	uids   map[uint32]bool
+	gids   map[uint32]bool
+	routes []string
+}
+
+// accessPolicy is the compiled form of Deps.Access. Nothing is allowed that a
+// grant does not name, so an empty or nil policy denies every caller.
+type accessPolicy struct {
+	grants     []accessGrant
+	needGroups bool
+}
+
+func newAccessPolicy(rules []AccessRule) (*accessPolicy, error) {
+	p := &accessPolicy{}
+	for i, r := range rules {
+		name := r.Name
+		if name == "" {
+			name = fmt.Sprintf("access[%d]", i)
+		}
+		g := accessGrant{name: name, uids: map[uint32]bool{}, gids: map[uint32]bool{}, routes: r.Routes}
+		for _, u := range r.Users {
+			id, err := lookupID(u, func(n string) (string, error) {
+				usr, err := user.Lookup(n)
+				if err != nil {
+					return "", err
+				}
+				return usr.Uid, nil
+			})
+			if err != nil {
+				return nil, fmt.Errorf("%s: user %q: %w", name, u, err)
+			}
+			g.uids[id] = true
+		}
+		for _, gr := range r.Groups {
+			id, err := lookupID(gr, func(n string) (string, error) {
+				grp, err := user.LookupGroup(n)
+				if err != nil {
+					return "", err
+				}
+				return grp.Gid, nil
+			})
+			if err != nil {
+				return nil, fmt.Errorf("%s: group %q: %w", name, gr, err)
+			}
+			g.gids[id] = true
+			p.needGroups = true
+		}
+		p.grants = append(p.grants, g)
+	}
+	return p, nil
+}
+
+func lookupID(s string, byName func(string) (string, error)) (uint32, error) {
+	s = strings.TrimSpace(s)
+	if n, err := strconv.ParseUint(s, 10, 32); err == nil {
+		return uint32(n), nil
+	}
+	id, err := byName(s)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("non-numeric id %q", id)
+	}
+	return uint32(n), nil
+}
+
+// allow returns the grant that lets cred call method path, if any.
+func (p *accessPolicy) allow(cred *PeerCred, method, path string) (string, bool) {
+	if p == nil || cred == nil {
+		return "", false
+	}
+	var groups map[uint32]bool
+	if p.needGroups {
+		groups = callerGroups(cred)
+	}
+	for _, g := range p.grants {
+		if !g.uids[cred.UID] && !anyOf(g.gids, groups) {
+			continue
+		}
+		for _, rt := range g.routes {
+			if routeMatches(rt, method, path) {
+				return g.name, true
+			}
+		}
+	}
+	return "", false
+}
+
+// callerGroups is the caller's primary group plus the supplementary groups of
+// its user.
+func callerGroups(cred *PeerCred) map[uint32]bool {
+	out := map[uint32]bool{cred.GID: true}
+	usr, err := user.LookupId(strconv.FormatUint(uint64(cred.UID), 10))
+	if err != nil {
+		return out
+	}
+	ids, err := usr.GroupIds()
+	if err != nil {
+		return out
+	}
+	for _, id := range ids {
+		if n, err := strconv.ParseUint(id, 10, 32); err == nil {
+			out[uint32(n)] = true
+		}
+	}
+	return out
+}
+
+func anyOf(want, have map[uint32]bool) bool {
+	for id := range have {
+		if want[id] {
+			return true
+		}
+	}
+	return false
+}
+
+func routeMatches(route, method, path string) bool {
+	route = strings.TrimSpace(route)
+	if route == "*" {
+		return true
+	}
+	if m, p, ok := strings.Cut(route, " "); ok {
+		if !strings.EqualFold(m, method) {
+			return false
+		}
+		route = strings.TrimSpace(p)
+	}
+	if prefix, ok := strings.CutSuffix(route, "*"); ok {
+		return strings.HasPrefix(path, prefix)
+	}
+	return route == path
+}
+
+// authorized checks every request against the access policy. Denied POSTs go
+// through the audit log like any other mutating call; they change nothing, so
+// only their outcome is logged.
+func (h *Handlers) authorized(next http.Handler) http.Handler {
+	deny := h.auditWrap(func(w http.ResponseWriter, r *http.Request) {
+		writeErrPublic(w, http.StatusForbidden, "FORBIDDEN", "caller is not allowed to use this endpoint", nil)
+	}, false)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cred := peerFromContext(r.Context())
+		if _, ok := h.access.allow(cred, r.Method, r.URL.Path); ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if cred == nil {
+			logger.Warnw("Host-agent request denied: peer credentials unavailable",
+				"method", r.Method, "path", r.URL.Path)
+		} else {
+			logger.Warnw("Host-agent request denied",
+				"uid", cred.UID, "gid", cred.GID, "pid", cred.PID,
+				"method", r.Method, "path", r.URL.Path)
+		}
+		deny(w, r)
+	})
+}
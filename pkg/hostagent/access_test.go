@@ -0,0 +1,133 @@
+package hostagent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestRouteMatches(t *testing.T) {
+	cases := []struct {
+		route, method, path string
+		want                bool
+	}{
+		{"*", http.MethodPost, "/ndpi/enable", true},
+		{"/health", http.MethodGet, "/health", true},
+		{"/health", http.MethodPost, "/health", true},
+		{"/health", http.MethodGet, "/healthz", false},
+		{"GET /ndpi/status", http.MethodGet, "/ndpi/status", true},
+		{"get /ndpi/status", http.MethodGet, "/ndpi/status", true},
+		{"GET /ndpi/status", http.MethodPost, "/ndpi/status", false},
+		{"POST /ndpi/*", http.MethodPost, "/ndpi/enable", true},
+		{"POST /ndpi/*", http.MethodPost, "/suricata/reload", false},
+		{"POST /ndpi/*", http.MethodGet, "/ndpi/status", false},
+		{" GET  /audit ", http.MethodGet, "/audit", true},
+	}
+	for _, c := range cases {
+		if got := routeMatches(c.route, c.method, c.path); got != c.want {
+			t.Errorf("routeMatches(%q, %s %s) = %t, want %t", c.route, c.method, c.path, got, c.want)
+		}
+	}
+}
+
+// serveAs runs one request through authorized as the given peer.
+func serveAs(t *testing.T, h *Handlers, cred *PeerCred, method, path string) *httptest.ResponseRecorder {
+	t.Helper()
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	req := httptest.NewRequest(method, path, nil)
+	if cred != nil {
+		req = req.WithContext(context.WithValue(req.Context(), peerCredKey{}, cred))
+	}
+	rec := httptest.NewRecorder()
+	h.authorized(next).ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAuthorized(t *testing.T) {
+	access, err := newAccessPolicy([]AccessRule{
+		{Name: "integration", Users: []string{"1001"}, Routes: []string{"*"}},
+		{Name: "monitoring", Groups: []string{"2002"}, Routes: []string{"GET /health", "GET /ndpi/status"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewHandlers(Deps{}, nil, access)
+
+	integration := &PeerCred{UID: 1001, GID: 1001, PID: 10}
+	monitoring := &PeerCred{UID: 424242, GID: 2002, PID: 11}
+	other := &PeerCred{UID: 424243, GID: 424243, PID: 12}
+
+	cases := []struct {
+		name         string
+		cred         *PeerCred
+		method, path string
+		want         int
+	}{
+		{"integration toggles", integration, http.MethodPost, "/ndpi/enable", http.StatusNoContent},
+		{"monitoring reads status", monitoring, http.MethodGet, "/ndpi/status", http.StatusNoContent},
+		{"monitoring cannot toggle", monitoring, http.MethodPost, "/ndpi/enable", http.StatusForbidden},
+		{"monitoring cannot read the audit log", monitoring, http.MethodGet, "/audit", http.StatusForbidden},
+		{"anyone else", other, http.MethodGet, "/health", http.StatusForbidden},
+		{"no peer credentials", nil, http.MethodGet, "/health", http.StatusForbidden},
+	}
+	for _, c := range cases {
+		rec := serveAs(t, h, c.cred, c.method, c.path)
+		if rec.Code != c.want {
+			t.Errorf("%s: got %d, want %d", c.name, rec.Code, c.want)
+			continue
+		}
+		if c.want == http.StatusForbidden {
+			var body struct {
+				OK   bool   `json:"ok"`
+				Code string `json:"code"`
+			}
+			if json.Unmarshal(rec.Body.Bytes(), &body) != nil || body.OK || body.Code != "FORBIDDEN" {
+				t.Errorf("%s: bad body %s", c.name, rec.Body.String())
+			}
+		}
+	}
+}
+
+func TestAuthorized_NoRulesDeniesEveryone(t *testing.T) {
+	access, err := newAccessPolicy(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []*accessPolicy{access, nil} {
+		h := NewHandlers(Deps{}, nil, p)
+		if rec := serveAs(t, h, &PeerCred{UID: 0}, http.MethodGet, "/health"); rec.Code != http.StatusForbidden {
+			t.Fatalf("empty policy must deny, got %d", rec.Code)
+		}
+	}
+}
+
+func TestAuthorized_DeniedPostIsAudited(t *testing.T) {
+	audit, err := OpenAuditLog(filepath.Join(t.TempDir(), "audit.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	access, _ := newAccessPolicy([]AccessRule{{Users: []string{"1001"}, Routes: []string{"GET /health"}}})
+	h := NewHandlers(Deps{FS: procFS(nil)}, audit, access)
+
+	if rec := serveAs(t, h, &PeerCred{UID: 1001, GID: 1001, PID: 7}, http.MethodPost, "/ndpi/enable"); rec.Code != http.StatusForbidden {
+		t.Fatalf("got %d", rec.Code)
+	}
+	recs, chain, err := audit.Read(0)
+	if err != nil || !chain.OK || len(recs) != 1 {
+		t.Fatalf("audit: %+v %+v %v", recs, chain, err)
+	}
+	if r := recs[0]; r.Status != http.StatusForbidden || r.Code != "FORBIDDEN" || r.Peer == nil || r.Peer.UID != 1001 {
+		t.Fatalf("bad record: %+v", r)
+	}
+}
+
+func TestNewAccessPolicy_UnknownName(t *testing.T) {
+	if _, err := newAccessPolicy([]AccessRule{{Name: "x", Users: []string{"no-such-user-ndpi"}, Routes: []string{"*"}}}); err == nil {
+		t.Fatal("expected an error for an unknown user")
+	}
+}
@@ -0,0 +1,244 @@
+package hostagent
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"integration-suricata-ndpi/pkg/logger"
+)
+
+// Audit record phases: a call is logged as started before its handler runs
+// and as finished with the response once it has.
+const (
+	AuditStarted  = "started"
+	AuditFinished = "finished"
+)
+
+// AuditRecord is one mutating call on the host agent. Hash covers the record
+// (with Hash empty) including PrevHash, so editing, dropping or reordering a
+// line breaks the chain from that point on.
+type AuditRecord struct {
+	Seq          uint64        `json:"seq"`
+	Time         time.Time     `json:"time"`
+	RequestID    string        `json:"request_id"`
+	Phase        string        `json:"phase,omitempty"`
+	Method       string        `json:"method"`
+	Path         string        `json:"path"`
+	Peer         *PeerCred     `json:"peer,omitempty"`
+	Status       int           `json:"status"`
+	OK           bool          `json:"ok"`
+	Code         string        `json:"code,omitempty"`
+	Message      string        `json:"message,omitempty"`
+	DurationMS   int64         `json:"duration_ms"`
+	ConfigPath   string        `json:"config_path"`
+	ConfigBefore string        `json:"config_sha256_before,omitempty"`
+	ConfigAfter  string        `json:"config_sha256_after,omitempty"`
+	Restart      *AuditRestart `json:"restart,omitempty"`
+	PrevHash     string        `json:"prev_hash"`
+	Hash         string        `json:"hash"`
+}
+
+type AuditRestart struct {
+	Unit       string `json:"unit"`
+	OK         bool   `json:"ok"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+	// ActiveSince is the unit's activation the restart produced.
+	ActiveSince *time.Time `json:"active_since,omitempty"`
+}
+
+// AuditChain is the result of walking the whole log.
+type AuditChain struct {
+	OK       bool   `json:"ok"`
+	Records  int    `json:"records"`
+	BrokenAt uint64 `json:"broken_at,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// AuditLog appends hash-chained records to a JSONL file, one fsync per record.
+type AuditLog struct {
+	mu       sync.Mutex
+	path     string
+	nextSeq  uint64
+	lastHash string
+}
+
+func OpenAuditLog(path string) (*AuditLog, error) {
+	if strings.TrimSpace(path) == "" {
+		return nil, fmt.Errorf("audit log path is empty")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return nil, fmt.Errorf("create audit log dir: %w", err)
+	}
+
+	l := &AuditLog{path: path, nextSeq: 1}
+	if err := l.dropTornTail(); err != nil {
+		return nil, err
+	}
+	recs, chain, err := l.read()
+	if err != nil {
+		return nil, err
+	}
+	if !chain.OK {
+		logger.Errorw("Audit log chain is broken", "path", path, "seq", chain.BrokenAt, "error", chain.Error)
+	}
+	if n := len(recs); n > 0 {
+		l.nextSeq = recs[n-1].Seq + 1
+		l.lastHash = recs[n-1].Hash
+	}
+	return l, nil
+}
+
+// dropTornTail cuts a last line left unterminated by a crash while appending;
+// it was never acknowledged, so it is not part of the chain.
+func (l *AuditLog) dropTornTail() error {
+	raw, err := os.ReadFile(l.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("read audit log %s: %w", l.path, err)
+	}
+	if len(raw) == 0 || raw[len(raw)-1] == '\n' {
+		return nil
+	}
+	keep := bytes.LastIndexByte(raw, '\n') + 1
+	logger.Warnw("Dropping torn audit record", "path", l.path, "bytes", len(raw)-keep)
+	return os.Truncate(l.path, int64(keep))
+}
+
+func auditHash(rec AuditRecord) (string, error) {
+	rec.Hash = ""
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func (l *AuditLog) Append(rec AuditRecord) (AuditRecord, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	rec.Seq = l.nextSeq
+	rec.PrevHash = l.lastHash
+	hash, err := auditHash(rec)
+	if err != nil {
+		return rec, err
+	}
+	rec.Hash = hash
+
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return rec, err
+	}
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return rec, fmt.Errorf("open audit log %s: %w", l.path, err)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		_ = f.Close()
+		return rec, fmt.Errorf("append audit log %s: %w", l.path, err)
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return rec, fmt.Errorf("sync audit log %s: %w", l.path, err)
+	}
+	if err := f.Close(); err != nil {
+		return rec, err
+	}
+
+	l.nextSeq++
+	l.lastHash = rec.Hash
+	return rec, nil
+}
+
+// Read returns the newest limit records (newest first) and the verification
+// of the whole chain.
+func (l *AuditLog) Read(limit int) ([]AuditRecord, AuditChain, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	recs, chain, err := l.read()
+	if err != nil {
+		return nil, chain, err
+	}
+	if limit <= 0 || limit > len(recs) {
+		limit = len(recs)
+	}
+	out := make([]AuditRecord, 0, limit)
+	for i := len(recs) - 1; i >= len(recs)-limit; i-- {
+		out = append(out, recs[i])
+	}
+	return out, chain, nil
+}
+
+// read loads every record, oldest first, and checks sequence numbers and
+// hashes; records after the first break are still returned.
+func (l *AuditLog) read() ([]AuditRecord, AuditChain, error) {
+	chain := AuditChain{OK: true}
+
+	f, err := os.Open(l.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, chain, nil
+		}
+		return nil, chain, fmt.Errorf("open audit log %s: %w", l.path, err)
+	}
+	defer f.Close()
+
+	var (
+		out      []AuditRecord
+		prevHash string
+		wantSeq  uint64 = 1
+	)
+	fail := func(seq uint64, format string, args ...any) {
+		if chain.OK {
+			chain.OK = false
+			chain.BrokenAt = seq
+			chain.Error = fmt.Sprintf(format, args...)
+		}
+	}
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	line := 0
+	for sc.Scan() {
+		line++
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+		var rec AuditRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			fail(wantSeq, "line %d: unreadable record: %v", line, err)
+			continue
+		}
+		if rec.Seq != wantSeq {
+			fail(wantSeq, "line %d: seq %d, want %d", line, rec.Seq, wantSeq)
+		}
+		if rec.PrevHash != prevHash {
+			fail(rec.Seq, "seq %d: prev_hash does not match the previous record", rec.Seq)
+		}
+		if hash, err := auditHash(rec); err != nil || hash != rec.Hash {
+			fail(rec.Seq, "seq %d: hash mismatch", rec.Seq)
+		}
+		out = append(out, rec)
+		prevHash = rec.Hash
+		wantSeq = rec.Seq + 1
+	}
+	if err := sc.Err(); err != nil {
+		return out, chain, fmt.Errorf("read audit log %s: %w", l.path, err)
+	}
+	chain.Records = len(out)
+	return out, chain, nil
+}
@@ -0,0 +1,234 @@
+package hostagent
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func openTestAudit(t *testing.T) (*AuditLog, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "audit", "audit.jsonl")
+	l, err := OpenAuditLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l, path
+}
+
+func appendN(t *testing.T, l *AuditLog, n int) []AuditRecord {
+	t.Helper()
+	var out []AuditRecord
+	for i := 0; i < n; i++ {
+		rec, err := l.Append(AuditRecord{Time: time.Unix(int64(i), 0).UTC(), RequestID: "r", Method: http.MethodPost, Path: "/ndpi/enable"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, rec)
+	}
+	return out
+}
+
+func TestAuditLog_HashChain(t *testing.T) {
+	l, path := openTestAudit(t)
+	recs := appendN(t, l, 3)
+
+	for i, rec := range recs {
+		if rec.Seq != uint64(i+1) {
+			t.Fatalf("record %d: seq %d", i, rec.Seq)
+		}
+		want := ""
+		if i > 0 {
+			want = recs[i-1].Hash
+		}
+		if rec.PrevHash != want {
+			t.Fatalf("record %d: prev_hash %q, want %q", i, rec.PrevHash, want)
+		}
+		if hash, _ := auditHash(rec); hash != rec.Hash {
+			t.Fatalf("record %d: hash does not cover the record", i)
+		}
+	}
+
+	// a reopened log continues the chain
+	l2, err := OpenAuditLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := appendN(t, l2, 1)[0]
+	if next.Seq != 4 || next.PrevHash != recs[2].Hash {
+		t.Fatalf("reopened log restarted the chain: %+v", next)
+	}
+	got, chain, err := l2.Read(2)
+	if err != nil || !chain.OK || chain.Records != 4 || len(got) != 2 || got[0].Seq != 4 || got[1].Seq != 3 {
+		t.Fatalf("read: %+v %+v %v", got, chain, err)
+	}
+}
+
+func TestAuditLog_DropsTornTail(t *testing.T) {
+	l, path := openTestAudit(t)
+	recs := appendN(t, l, 2)
+
+	// a crash in the middle of the third append
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString(`{"seq":3,"time":"2026-`)
+	_ = f.Close()
+
+	l, err = OpenAuditLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := os.ReadFile(path)
+	if bytes.Count(raw, []byte("\n")) != 2 || raw[len(raw)-1] != '\n' {
+		t.Fatalf("torn line not dropped:\n%s", raw)
+	}
+	next := appendN(t, l, 1)[0]
+	if next.Seq != 3 || next.PrevHash != recs[1].Hash {
+		t.Fatalf("chain not continued after the torn tail: %+v", next)
+	}
+	if _, chain, err := l.Read(0); err != nil || !chain.OK || chain.Records != 3 {
+		t.Fatalf("chain: %+v %v", chain, err)
+	}
+}
+
+func TestAuditLog_DetectsTampering(t *testing.T) {
+	cases := []struct {
+		name   string
+		edit   func(lines []string) []string
+		wantAt uint64
+		errHas string
+	}{
+		{"edited field", func(lines []string) []string {
+			lines[1] = strings.Replace(lines[1], `"path":"/ndpi/enable"`, `"path":"/ndpi/disable"`, 1)
+			return lines
+		}, 2, "seq 2: hash mismatch"},
+		{"dropped line", func(lines []string) []string {
+			return append(lines[:1:1], lines[2:]...)
+		}, 2, "seq 3, want 2"},
+		{"reordered lines", func(lines []string) []string {
+			lines[1], lines[2] = lines[2], lines[1]
+			return lines
+		}, 2, "seq 3, want 2"},
+		{"rehashed but unlinked", func(lines []string) []string {
+			var rec AuditRecord
+			_ = json.Unmarshal([]byte(lines[1]), &rec)
+			rec.Message = "nothing to see"
+			rec.Hash, _ = auditHash(rec)
+			b, _ := json.Marshal(rec)
+			lines[1] = string(b)
+			return lines
+		}, 3, "seq 3: prev_hash does not match"},
+		{"garbage line", func(lines []string) []string {
+			lines[0] = "not json"
+			return lines
+		}, 1, "line 1: unreadable record"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			l, path := openTestAudit(t)
+			appendN(t, l, 4)
+
+			raw, _ := os.ReadFile(path)
+			lines := strings.Split(strings.TrimSuffix(string(raw), "\n"), "\n")
+			if err := os.WriteFile(path, []byte(strings.Join(c.edit(lines), "\n")+"\n"), 0o640); err != nil {
+				t.Fatal(err)
+			}
+
+			_, chain, err := l.Read(0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if chain.OK || chain.BrokenAt != c.wantAt || !strings.Contains(chain.Error, c.errHas) {
+				t.Fatalf("got %+v, want broken at %d with %q", chain, c.wantAt, c.errHas)
+			}
+		})
+	}
+}
+
+// breakAuditLog makes every further append fail by putting a directory where
+// the log file is.
+func breakAuditLog(t *testing.T, path string) {
+	t.Helper()
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(path, 0o750); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAudited_LogsStartBeforeTheCall(t *testing.T) {
+	l, _ := openTestAudit(t)
+	h := NewHandlers(Deps{FS: procFS(nil)}, l, nil)
+
+	var seenStarted bool
+	next := func(w http.ResponseWriter, r *http.Request) {
+		recs, _, _ := l.Read(0)
+		seenStarted = len(recs) == 1 && recs[0].Phase == AuditStarted
+		writeJSONWithStatus(w, http.StatusOK, toggleResp{OK: true, Changed: true})
+	}
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/ndpi/enable", nil)
+	req.Header.Set(RequestIDHeader, "job-1")
+	h.audited(next)(rec, req)
+
+	if rec.Code != http.StatusOK || !seenStarted {
+		t.Fatalf("status %d, started record before the call: %t", rec.Code, seenStarted)
+	}
+	recs, chain, _ := l.Read(0)
+	if !chain.OK || len(recs) != 2 {
+		t.Fatalf("%+v %+v", recs, chain)
+	}
+	if done := recs[0]; done.Phase != AuditFinished || done.RequestID != "job-1" || done.Status != http.StatusOK || !done.OK {
+		t.Fatalf("bad finished record: %+v", done)
+	}
+}
+
+func TestAudited_RefusesTheCallWhenStartCannotBeLogged(t *testing.T) {
+	l, path := openTestAudit(t)
+	breakAuditLog(t, path)
+	h := NewHandlers(Deps{FS: procFS(nil)}, l, nil)
+
+	ran := false
+	rec := httptest.NewRecorder()
+	h.audited(func(w http.ResponseWriter, r *http.Request) { ran = true })(rec, httptest.NewRequest(http.MethodPost, "/ndpi/enable", nil))
+
+	if ran {
+		t.Fatal("handler ran without an audit record")
+	}
+	if resp := decodeToggle(t, rec); rec.Code != http.StatusInternalServerError || resp.Code != "AUDIT_FAILED" {
+		t.Fatalf("got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestAudited_FailsTheRequestWhenOutcomeCannotBeLogged(t *testing.T) {
+	l, path := openTestAudit(t)
+	h := NewHandlers(Deps{FS: procFS(nil)}, l, nil)
+
+	rec := httptest.NewRecorder()
+	h.audited(func(w http.ResponseWriter, r *http.Request) {
+		breakAuditLog(t, path)
+		writeJSONWithStatus(w, http.StatusOK, toggleResp{OK: true, Changed: true})
+	})(rec, httptest.NewRequest(http.MethodPost, "/ndpi/enable", nil))
+
+	if resp := decodeToggle(t, rec); rec.Code != http.StatusInternalServerError || resp.Code != "AUDIT_FAILED" || resp.OK {
+		t.Fatalf("got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func decodeToggle(t *testing.T, rec *httptest.ResponseRecorder) toggleResp {
+	t.Helper()
+	var resp toggleResp
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("bad body %q: %v", rec.Body.String(), err)
+	}
+	return resp
+}
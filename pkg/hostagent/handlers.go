@@ -7,6 +7,7 @@ import (
 	"io/fs"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"integration-suricata-ndpi/integration"
@@ -14,11 +15,16 @@ import (
 )
 
 type Handlers struct {
-	deps Deps
+	deps   Deps
+	audit  *AuditLog
+	access *accessPolicy
+
+	mu          sync.Mutex
+	lastRestart *restartInfo
 }
 
-func NewHandlers(deps Deps) *Handlers {
-	return &Handlers{deps: deps}
+func NewHandlers(deps Deps, audit *AuditLog, access *accessPolicy) *Handlers {
+	return &Handlers{deps: deps, audit: audit, access: access}
 }
 
 func (h *Handlers) Health(w http.ResponseWriter, r *http.Request) {
@@ -55,7 +61,7 @@ func (h *Handlers) SuricataEnsure(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), h.deps.RestartTimeout)
 	defer cancel()
 
-	if err := h.deps.Systemd.Restart(ctx, h.deps.SuricataUnit, h.deps.RestartTimeout); err != nil {
+	if err := h.restartSuricata(ctx, r.Method+" "+r.URL.Path); err != nil {
 		writeErrPublic(w, http.StatusInternalServerError, "SURICATA_RESTART_FAILED", "failed to restart suricata", err)
 		return
 	}
@@ -136,7 +142,7 @@ func (h *Handlers) NDPIEnable(w http.ResponseWriter, r *http.Request) {
 		ctx, cancel := context.WithTimeout(r.Context(), h.deps.RestartTimeout)
 		defer cancel()
 
-		if err := h.deps.Systemd.Restart(ctx, h.deps.SuricataUnit, h.deps.RestartTimeout); err != nil {
+		if err := h.restartSuricata(ctx, r.Method+" "+r.URL.Path); err != nil {
 			writeErrPublic(w, http.StatusInternalServerError, "RESTART_FAILED", "failed to restart suricata", err)
 			return
 		}
@@ -172,7 +178,7 @@ func (h *Handlers) NDPIDisable(w http.ResponseWriter, r *http.Request) {
 		ctx, cancel := context.WithTimeout(r.Context(), h.deps.RestartTimeout)
 		defer cancel()
 
-		if err := h.deps.Systemd.Restart(ctx, h.deps.SuricataUnit, h.deps.RestartTimeout); err != nil {
+		if err := h.restartSuricata(ctx, r.Method+" "+r.URL.Path); err != nil {
 			writeErrPublic(w, http.StatusInternalServerError, "RESTART_FAILED", "failed to restart suricata", err)
 			return
 		}
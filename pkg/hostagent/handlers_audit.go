@@ -0,0 +1,207 @@
+package hostagent
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"integration-suricata-ndpi/pkg/logger"
+)
+
+// RequestIDHeader carries the caller's request ID; the agent makes one up
+// when it is missing and always echoes it back.
+const RequestIDHeader = "X-Request-ID"
+
+type auditEntryKey struct{}
+
+// auditEntry collects what a handler reports while it runs.
+type auditEntry struct {
+	requestID string
+	restart   *AuditRestart
+}
+
+type auditResp struct {
+	OK      bool          `json:"ok"`
+	Records []AuditRecord `json:"records"`
+	Chain   AuditChain    `json:"chain"`
+	Code    string        `json:"code,omitempty"`
+	Message string        `json:"message,omitempty"`
+}
+
+// recordingWriter holds the status and body of a response back until the
+// audit record for it is written.
+type recordingWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *recordingWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(b)
+}
+
+func (w *recordingWriter) flush() {
+	w.ResponseWriter.WriteHeader(w.status)
+	_, _ = w.ResponseWriter.Write(w.body.Bytes())
+}
+
+// audited records every POST to next in the audit log: who called, with which
+// request ID, the config hash around the call and how a restart went. The call
+// is logged as started before next runs, and next does not run if that record
+// cannot be written; the response is held back until the finished record is
+// written, and replaced by a 500 if it cannot be.
+func (h *Handlers) audited(next http.HandlerFunc) http.HandlerFunc {
+	return h.auditWrap(next, true)
+}
+
+// auditWrap is audited; started says whether the call is logged before next
+// runs, which only matters for calls that change something.
+func (h *Handlers) auditWrap(next http.HandlerFunc, started bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.audit == nil || r.Method != http.MethodPost {
+			next(w, r)
+			return
+		}
+
+		reqID := r.Header.Get(RequestIDHeader)
+		if reqID == "" {
+			reqID = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, reqID)
+
+		entry := &auditEntry{requestID: reqID}
+		rec := AuditRecord{
+			Time:         time.Now().UTC(),
+			RequestID:    reqID,
+			Phase:        AuditStarted,
+			Method:       r.Method,
+			Path:         r.URL.Path,
+			Peer:         peerFromContext(r.Context()),
+			ConfigPath:   h.deps.SuricataCfgPath,
+			ConfigBefore: h.configHash(),
+		}
+		if started {
+			if _, err := h.audit.Append(rec); err != nil {
+				logger.Errorw("Audit record not written, call refused", "request_id", reqID, "path", rec.Path, "error", err)
+				writeErrPublic(w, http.StatusInternalServerError, "AUDIT_FAILED", "audit log is not writable; nothing was changed", nil)
+				return
+			}
+		}
+
+		rw := &recordingWriter{ResponseWriter: w}
+		next(rw, r.WithContext(context.WithValue(r.Context(), auditEntryKey{}, entry)))
+		if rw.status == 0 {
+			rw.status = http.StatusOK
+		}
+
+		var body struct {
+			OK      bool   `json:"ok"`
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		}
+		_ = json.Unmarshal(rw.body.Bytes(), &body)
+
+		rec.Phase = AuditFinished
+		rec.Status = rw.status
+		rec.OK = body.OK
+		rec.Code = body.Code
+		rec.Message = body.Message
+		rec.ConfigAfter = h.configHash()
+		rec.Restart = entry.restart
+		rec.DurationMS = time.Since(rec.Time).Milliseconds()
+
+		if _, err := h.audit.Append(rec); err != nil {
+			logger.Errorw("Audit record not written", "request_id", reqID, "path", rec.Path,
+				"status", rec.Status, "ok", rec.OK, "error", err)
+			writeErrPublic(w, http.StatusInternalServerError, "AUDIT_FAILED",
+				"the call ran but its outcome is not in the audit log; check GET /suricata/status", nil)
+			return
+		}
+		rw.flush()
+	}
+}
+
+func (h *Handlers) configHash() string {
+	b, err := h.deps.FS.ReadFile(h.deps.SuricataCfgPath)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// restartSuricata restarts the unit and notes the outcome for the audit log
+// and GET /suricata/status.
+func (h *Handlers) restartSuricata(ctx context.Context, reason string) error {
+	start := time.Now()
+	err := h.deps.Systemd.Restart(ctx, h.deps.SuricataUnit, h.deps.RestartTimeout)
+	var since *time.Time
+	if err == nil {
+		if st, serr := h.deps.Systemd.Status(ctx, h.deps.SuricataUnit); serr == nil {
+			since = st.Since
+		}
+	}
+	h.noteRestart(ctx, reason, since, err)
+
+	if entry, ok := ctx.Value(auditEntryKey{}).(*auditEntry); ok {
+		entry.restart = &AuditRestart{
+			Unit:        h.deps.SuricataUnit,
+			OK:          err == nil,
+			DurationMS:  time.Since(start).Milliseconds(),
+			ActiveSince: since,
+		}
+		if err != nil {
+			entry.restart.Error = err.Error()
+		}
+	}
+	return err
+}
+
+func (h *Handlers) Audit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeErrPublic(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "method not allowed", nil)
+		return
+	}
+	if h.audit == nil {
+		writeErrPublic(w, http.StatusNotFound, "AUDIT_DISABLED", "audit log is not configured", nil)
+		return
+	}
+
+	limit := 100
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 1000 {
+			writeErrPublic(w, http.StatusBadRequest, "BAD_REQUEST", "limit must be 1..1000", nil)
+			return
+		}
+		limit = n
+	}
+
+	recs, chain, err := h.audit.Read(limit)
+	if err != nil {
+		writeErrFromErr(w, err)
+		return
+	}
+	writeJSONWithStatus(w, http.StatusOK, auditResp{OK: true, Records: recs, Chain: chain})
+}
+
+func newRequestID() string {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,282 @@
+package hostagent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"integration-suricata-ndpi/integration"
+	"integration-suricata-ndpi/pkg/systemd"
+)
+
+// restartInfo is the last restart the agent did, or found in the audit log.
+type restartInfo struct {
+	Time      time.Time `json:"time"`
+	Reason    string    `json:"reason"`
+	By        string    `json:"by"` // host-agent | systemd
+	OK        bool      `json:"ok"`
+	Error     string    `json:"error,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+
+	// activeSince is the unit's ActiveEnterTimestamp right after the restart.
+	activeSince *time.Time
+}
+
+// covers reports whether the unit activation at since came from this restart.
+func (ri *restartInfo) covers(since time.Time) bool {
+	if ri == nil {
+		return false
+	}
+	if ri.activeSince != nil {
+		// the systemctl backend only has second precision
+		return since.Truncate(time.Second).Equal(ri.activeSince.Truncate(time.Second))
+	}
+	// no activation recorded (a failed restart, an older audit record): the
+	// restart returns once the unit is up, so any later activation is not ours
+	return !since.After(ri.Time)
+}
+
+type ndpiLoadedResp struct {
+	Loaded bool   `json:"loaded"`
+	Source string `json:"source,omitempty"` // maps | build-info
+	Detail string `json:"detail,omitempty"`
+}
+
+type suricataStatusResp struct {
+	OK bool `json:"ok"`
+
+	Unit        string     `json:"unit"`
+	LoadState   string     `json:"load_state,omitempty"`
+	ActiveState string     `json:"active_state,omitempty"`
+	SubState    string     `json:"sub_state,omitempty"`
+	MainPID     int        `json:"main_pid,omitempty"`
+	ActiveSince *time.Time `json:"active_since,omitempty"`
+	// UptimeSeconds comes from systemd; SuricataUptimeSeconds from `uptime`
+	// on the control socket.
+	UptimeSeconds         int64  `json:"uptime_seconds,omitempty"`
+	SuricataUptimeSeconds *int64 `json:"suricata_uptime_seconds,omitempty"`
+	NRestarts             int    `json:"n_restarts"`
+	Result                string `json:"result,omitempty"`
+
+	Version    string         `json:"version,omitempty"`
+	ConfigPath string         `json:"config_path"`
+	Socket     string         `json:"socket,omitempty"`
+	NDPI       ndpiLoadedResp `json:"ndpi"`
+
+	LastRestart *restartInfo `json:"last_restart,omitempty"`
+
+	// Warnings lists the probes that failed; the rest of the status is
+	// still reported.
+	Warnings []string `json:"warnings,omitempty"`
+	Code     string   `json:"code,omitempty"`
+	Message  string   `json:"message,omitempty"`
+}
+
+func (h *Handlers) SuricataStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeErrPublic(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "method not allowed", nil)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	resp := suricataStatusResp{OK: true, Unit: h.deps.SuricataUnit, ConfigPath: h.deps.SuricataCfgPath}
+	warn := func(format string, args ...any) {
+		resp.Warnings = append(resp.Warnings, fmt.Sprintf(format, args...))
+	}
+
+	st, err := h.deps.Systemd.Status(ctx, h.deps.SuricataUnit)
+	if err != nil {
+		warn("systemd: %v", err)
+	} else {
+		resp.LoadState, resp.ActiveState, resp.SubState = st.LoadState, st.ActiveState, st.SubState
+		resp.MainPID, resp.NRestarts, resp.Result = st.MainPID, st.NRestarts, st.Result
+		if st.ActiveState == "active" && st.Since != nil {
+			resp.ActiveSince = st.Since
+			resp.UptimeSeconds = int64(time.Since(*st.Since).Seconds())
+		}
+	}
+
+	if resp.MainPID > 0 {
+		if p, err := h.procConfigPath(resp.MainPID); err != nil {
+			warn("read command line of pid %d: %v", resp.MainPID, err)
+		} else if p != "" {
+			if p != h.deps.SuricataCfgPath {
+				warn("suricata runs with %s but the agent manages %s", p, h.deps.SuricataCfgPath)
+			}
+			resp.ConfigPath = p
+		}
+	}
+
+	if sock, err := integration.FirstExistingSocket(h.deps.SuricataSocketCandidates); err != nil {
+		warn("control socket: %v", err)
+	} else {
+		resp.Socket = sock
+		if h.deps.SuricataSCPath == "" {
+			warn("paths.suricatasc is empty; uptime and version not queried")
+		} else {
+			if msg, err := suricataSCMessage(ctx, h.deps.SuricataSCPath, "uptime", sock); err != nil {
+				warn("suricatasc uptime: %v", err)
+			} else if n, err := strconv.ParseInt(strings.Trim(string(msg), `"`), 10, 64); err == nil {
+				resp.SuricataUptimeSeconds = &n
+			}
+			if msg, err := suricataSCMessage(ctx, h.deps.SuricataSCPath, "version", sock); err != nil {
+				warn("suricatasc version: %v", err)
+			} else {
+				_ = json.Unmarshal(msg, &resp.Version)
+			}
+		}
+	}
+
+	resp.NDPI = h.ndpiLoaded(ctx, resp.MainPID, &resp)
+	resp.LastRestart = h.lastRestartInfo(st)
+
+	writeJSONWithStatus(w, http.StatusOK, resp)
+}
+
+// procConfigPath returns the -c argument Suricata was started with, "" when
+// it runs with its built-in default.
+func (h *Handlers) procConfigPath(pid int) (string, error) {
+	raw, err := h.deps.FS.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if err != nil {
+		return "", err
+	}
+	args := strings.Split(strings.TrimRight(string(raw), "\x00"), "\x00")
+	for i, a := range args {
+		switch {
+		case a == "-c" && i+1 < len(args):
+			return args[i+1], nil
+		case strings.HasPrefix(a, "-c") && len(a) > 2:
+			return a[2:], nil
+		}
+	}
+	return "", nil
+}
+
+// ndpiLoaded checks the plugin in the process maps and, when those cannot be
+// read, falls back to build-info plus the plugin line in the config.
+func (h *Handlers) ndpiLoaded(ctx context.Context, pid int, resp *suricataStatusResp) ndpiLoadedResp {
+	if pid > 0 {
+		maps, err := h.deps.FS.ReadFile(fmt.Sprintf("/proc/%d/maps", pid))
+		if err == nil {
+			return ndpiLoadedResp{Loaded: mapsHasFile(maps, h.deps.NDPIPluginPath), Source: "maps"}
+		}
+		resp.Warnings = append(resp.Warnings, fmt.Sprintf("read maps of pid %d: %v", pid, err))
+	}
+
+	if h.deps.SuricataBinPath == "" {
+		return ndpiLoadedResp{Detail: "no process maps and paths.suricata_bin is empty"}
+	}
+	info, err := integration.ReadSuricataBuildInfo(ctx, nil, h.deps.SuricataBinPath)
+	if err != nil {
+		resp.Warnings = append(resp.Warnings, "build-info: "+err.Error())
+		return ndpiLoadedResp{}
+	}
+	enabled, _, err := integration.NDPIStatusWithFS(h.deps.SuricataCfgPath, h.deps.NDPIPluginPath, h.deps.FS)
+	if err != nil {
+		resp.Warnings = append(resp.Warnings, "plugin line: "+err.Error())
+	}
+	if resp.Version == "" {
+		resp.Version = info.Version
+	}
+	return ndpiLoadedResp{
+		Loaded: resp.ActiveState == "active" && info.NDPISupport && enabled,
+		Source: "build-info",
+		Detail: fmt.Sprintf("nDPI support=%t, plugin line enabled=%t", info.NDPISupport, enabled),
+	}
+}
+
+// mapsHasFile reports whether a /proc/<pid>/maps pathname is path, or a file
+// with the same name (the plugin loaded through a symlinked dir). Substring
+// matches are not enough: "ndpi.so" is also part of libndpi.so.4.
+func mapsHasFile(maps []byte, path string) bool {
+	base := "/" + filepath.Base(path)
+	for _, ln := range strings.Split(string(maps), "\n") {
+		f := strings.Fields(ln)
+		if len(f) < 6 {
+			continue
+		}
+		p := strings.TrimSuffix(strings.Join(f[5:], " "), " (deleted)")
+		if p == path || strings.HasSuffix(p, base) {
+			return true
+		}
+	}
+	return false
+}
+
+// lastRestartInfo prefers the agent's own last restart (in memory, else the
+// audit log) unless the unit's current activation is not the one it caused.
+func (h *Handlers) lastRestartInfo(st systemd.UnitStatus) *restartInfo {
+	h.mu.Lock()
+	last := h.lastRestart
+	h.mu.Unlock()
+
+	if last == nil && h.audit != nil {
+		if recs, _, err := h.audit.Read(0); err == nil {
+			for _, rec := range recs {
+				if rec.Restart == nil {
+					continue
+				}
+				last = &restartInfo{
+					Time:        rec.Time.Add(time.Duration(rec.DurationMS) * time.Millisecond),
+					Reason:      rec.Method + " " + rec.Path,
+					By:          "host-agent",
+					OK:          rec.Restart.OK,
+					Error:       rec.Restart.Error,
+					RequestID:   rec.RequestID,
+					activeSince: rec.Restart.ActiveSince,
+				}
+				break
+			}
+		}
+	}
+
+	// a crash restart, a manual systemctl, a reboot
+	if st.Since != nil && !last.covers(*st.Since) {
+		reason := "started outside the host agent"
+		if st.NRestarts > 0 {
+			reason = fmt.Sprintf("restarted by systemd (NRestarts=%d, last result %s)", st.NRestarts, st.Result)
+		}
+		return &restartInfo{Time: *st.Since, Reason: reason, By: "systemd", OK: st.ActiveState == "active"}
+	}
+	return last
+}
+
+// noteRestart remembers the agent's restart for GET /suricata/status.
+func (h *Handlers) noteRestart(ctx context.Context, reason string, activeSince *time.Time, err error) {
+	info := &restartInfo{Time: time.Now().UTC(), Reason: reason, By: "host-agent", OK: err == nil, activeSince: activeSince}
+	if err != nil {
+		info.Error = err.Error()
+	}
+	if entry, ok := ctx.Value(auditEntryKey{}).(*auditEntry); ok {
+		info.RequestID = entry.requestID
+	}
+	h.mu.Lock()
+	h.lastRestart = info
+	h.mu.Unlock()
+}
+
+// suricataSCMessage runs one suricatasc command and returns its "message".
+func suricataSCMessage(ctx context.Context, scPath, cmdName, socketPath string) (json.RawMessage, error) {
+	out, err := runSuricataSC(ctx, scPath, cmdName, socketPath)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Return  string          `json:"return"`
+		Message json.RawMessage `json:"message"`
+	}
+	if err := json.Unmarshal([]byte(out), &resp); err != nil {
+		return nil, fmt.Errorf("unexpected output %q", out)
+	}
+	if resp.Return != "OK" {
+		return nil, fmt.Errorf("%s returned %s: %s", cmdName, resp.Return, resp.Message)
+	}
+	return resp.Message, nil
+}
@@ -0,0 +1,208 @@
+package hostagent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"integration-suricata-ndpi/internal/mocks"
+	"integration-suricata-ndpi/pkg/systemd"
+)
+
+const testPlugin = "/usr/local/lib/suricata/ndpi.so"
+
+// procFS serves the given files and reports every other path as missing.
+func procFS(files map[string]string) *mocks.FS {
+	return &mocks.FS{ReadFileFunc: func(name string) ([]byte, error) {
+		if s, ok := files[name]; ok {
+			return []byte(s), nil
+		}
+		return nil, os.ErrNotExist
+	}}
+}
+
+func TestProcConfigPath(t *testing.T) {
+	cases := []struct {
+		name    string
+		cmdline string
+		want    string
+		wantErr bool
+	}{
+		{"separate arg", "/usr/bin/suricata\x00-c\x00/etc/suricata/suricata.yaml\x00--af-packet\x00", "/etc/suricata/suricata.yaml", false},
+		{"joined arg", "/usr/bin/suricata\x00-c/opt/s.yaml\x00", "/opt/s.yaml", false},
+		{"built-in default", "/usr/bin/suricata\x00--af-packet\x00", "", false},
+		{"-c without value", "/usr/bin/suricata\x00-c\x00", "", false},
+		{"no process", "", "", true},
+	}
+	for _, c := range cases {
+		files := map[string]string{}
+		if c.cmdline != "" {
+			files["/proc/42/cmdline"] = c.cmdline
+		}
+		h := NewHandlers(Deps{FS: procFS(files)}, nil, nil)
+		got, err := h.procConfigPath(42)
+		if (err != nil) != c.wantErr || got != c.want {
+			t.Errorf("%s: got %q, %v; want %q", c.name, got, err, c.want)
+		}
+	}
+}
+
+func TestNDPILoaded_Maps(t *testing.T) {
+	libndpi := "7f1c2a000000-7f1c2a100000 r-xp 00000000 08:01 1234 /usr/lib/x86_64-linux-gnu/libndpi.so.4.10.0\n"
+	cases := []struct {
+		name string
+		maps string
+		want bool
+	}{
+		{"configured path", libndpi + "7f1c2b000000-7f1c2b010000 r-xp 00000000 08:01 99 " + testPlugin + "\n", true},
+		{"same file through another dir", "7f1c2b000000-7f1c2b010000 r-xp 00000000 08:01 99 /opt/suricata/plugins/ndpi.so\n", true},
+		{"replaced on disk", "7f1c2b000000-7f1c2b010000 r-xp 00000000 08:01 99 " + testPlugin + " (deleted)\n", true},
+		{"only libndpi", libndpi, false},
+		{"ndpi.so in a longer name", "7f1c2b000000-7f1c2b010000 r-xp 00000000 08:01 99 /usr/lib/myndpi.so\n", false},
+		{"anonymous mappings", "7ffd1000-7ffd2000 rw-p 00000000 00:00 0 \n7ffd3000-7ffd4000 rw-p 00000000 00:00 0 [stack]\n", false},
+	}
+	for _, c := range cases {
+		h := NewHandlers(Deps{NDPIPluginPath: testPlugin, FS: procFS(map[string]string{"/proc/42/maps": c.maps})}, nil, nil)
+		var resp suricataStatusResp
+		got := h.ndpiLoaded(context.Background(), 42, &resp)
+		if got.Loaded != c.want || got.Source != "maps" || len(resp.Warnings) != 0 {
+			t.Errorf("%s: got %+v %v, want loaded=%t", c.name, got, resp.Warnings, c.want)
+		}
+	}
+}
+
+func TestNDPILoaded_NoMaps(t *testing.T) {
+	h := NewHandlers(Deps{NDPIPluginPath: testPlugin, FS: procFS(nil)}, nil, nil)
+	var resp suricataStatusResp
+	got := h.ndpiLoaded(context.Background(), 42, &resp)
+	if got.Loaded || got.Source != "" || !strings.Contains(got.Detail, "paths.suricata_bin is empty") {
+		t.Fatalf("got %+v", got)
+	}
+	if len(resp.Warnings) != 1 || !strings.Contains(resp.Warnings[0], "read maps of pid 42") {
+		t.Fatalf("warnings: %v", resp.Warnings)
+	}
+}
+
+func TestLastRestartInfo(t *testing.T) {
+	restartedAt := time.Date(2026, 10, 19, 9, 0, 10, 0, time.UTC)
+	ours := restartedAt.Add(-2 * time.Second)
+	later := restartedAt.Add(time.Hour)
+	earlier := restartedAt.Add(-time.Hour)
+
+	cases := []struct {
+		name   string
+		last   *restartInfo
+		status systemd.UnitStatus
+		wantBy string // "" for no restart at all
+	}{
+		{"nothing known", nil, systemd.UnitStatus{}, ""},
+		{"never restarted by the agent", nil, systemd.UnitStatus{Since: &earlier}, "systemd"},
+		{"our activation", &restartInfo{Time: restartedAt, OK: true, activeSince: &ours}, systemd.UnitStatus{Since: &ours}, "host-agent"},
+		{"our activation, second precision", &restartInfo{Time: restartedAt, OK: true, activeSince: ptr(ours.Add(300 * time.Millisecond))}, systemd.UnitStatus{Since: &ours}, "host-agent"},
+		{"activated again since", &restartInfo{Time: restartedAt, OK: true, activeSince: &ours}, systemd.UnitStatus{Since: &later, NRestarts: 3}, "systemd"},
+		{"failed restart, unit up from before", &restartInfo{Time: restartedAt}, systemd.UnitStatus{Since: &earlier}, "host-agent"},
+		{"failed restart, unit up afterwards", &restartInfo{Time: restartedAt}, systemd.UnitStatus{Since: &later}, "systemd"},
+		{"unit down", &restartInfo{Time: restartedAt}, systemd.UnitStatus{}, "host-agent"},
+	}
+	for _, c := range cases {
+		h := NewHandlers(Deps{}, nil, nil)
+		if c.last != nil {
+			c.last.By = "host-agent"
+		}
+		h.lastRestart = c.last
+		got := h.lastRestartInfo(c.status)
+		if gotBy := byOf(got); gotBy != c.wantBy {
+			t.Errorf("%s: got %+v, want by=%q", c.name, got, c.wantBy)
+		}
+	}
+
+	h := NewHandlers(Deps{}, nil, nil)
+	h.lastRestart = &restartInfo{Time: restartedAt, activeSince: &ours}
+	got := h.lastRestartInfo(systemd.UnitStatus{ActiveState: "active", Since: &later, NRestarts: 3, Result: "signal"})
+	if got.Reason != "restarted by systemd (NRestarts=3, last result signal)" || !got.OK || !got.Time.Equal(later) {
+		t.Fatalf("systemd restart: %+v", got)
+	}
+}
+
+func TestLastRestartInfo_FromAuditLog(t *testing.T) {
+	audit, err := OpenAuditLog(filepath.Join(t.TempDir(), "audit.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	since := time.Date(2026, 10, 19, 9, 0, 9, 0, time.UTC)
+	for _, rec := range []AuditRecord{
+		{Time: since.Add(-time.Hour), RequestID: "old", Method: http.MethodPost, Path: "/ndpi/disable", Restart: &AuditRestart{OK: true}},
+		{Time: since.Add(-time.Second), RequestID: "r1", Method: http.MethodPost, Path: "/ndpi/enable", DurationMS: 1500, Restart: &AuditRestart{OK: true, ActiveSince: &since}},
+		{Time: since.Add(time.Minute), RequestID: "r2", Method: http.MethodPost, Path: "/suricata/reload"},
+	} {
+		if _, err := audit.Append(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a fresh agent has nothing in memory and reads the newest restart back
+	h := NewHandlers(Deps{}, audit, nil)
+	got := h.lastRestartInfo(systemd.UnitStatus{Since: &since})
+	if got == nil || got.By != "host-agent" || got.RequestID != "r1" || got.Reason != "POST /ndpi/enable" || !got.OK {
+		t.Fatalf("got %+v", got)
+	}
+}
+
+func TestSuricataStatus_ReportsPartialFailures(t *testing.T) {
+	since := time.Now().Add(-90 * time.Minute).UTC()
+	h := NewHandlers(Deps{
+		SuricataUnit:    "suricata",
+		SuricataCfgPath: "/etc/suricata/suricata.yaml",
+		NDPIPluginPath:  testPlugin,
+		Systemd: &mocks.SystemdManager{StatusFunc: func(_ context.Context, unit string) (systemd.UnitStatus, error) {
+			return systemd.UnitStatus{Unit: unit, LoadState: "loaded", ActiveState: "active", SubState: "running",
+				MainPID: 42, Since: &since, Result: "success"}, nil
+		}},
+		FS: procFS(map[string]string{
+			"/proc/42/cmdline": "/usr/bin/suricata\x00-c\x00/etc/suricata/other.yaml\x00",
+			"/proc/42/maps":    "7f1c2b000000-7f1c2b010000 r-xp 00000000 08:01 99 " + testPlugin + "\n",
+		}),
+	}, nil, nil)
+
+	rec := httptest.NewRecorder()
+	h.SuricataStatus(rec, httptest.NewRequest(http.MethodGet, "/suricata/status", nil))
+	var resp suricataStatusResp
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &resp) != nil {
+		t.Fatalf("%d %s", rec.Code, rec.Body.String())
+	}
+	if !resp.OK || resp.MainPID != 42 || resp.UptimeSeconds < 5390 || resp.ConfigPath != "/etc/suricata/other.yaml" ||
+		!resp.NDPI.Loaded || resp.LastRestart == nil || resp.LastRestart.By != "systemd" {
+		t.Fatalf("bad status: %+v", resp)
+	}
+	warnings := strings.Join(resp.Warnings, "\n")
+	for _, want := range []string{"but the agent manages /etc/suricata/suricata.yaml", "control socket"} {
+		if !strings.Contains(warnings, want) {
+			t.Errorf("warnings lack %q:\n%s", want, warnings)
+		}
+	}
+
+	h.deps.Systemd = &mocks.SystemdManager{StatusFunc: func(context.Context, string) (systemd.UnitStatus, error) {
+		return systemd.UnitStatus{}, errors.New("bus gone")
+	}}
+	rec = httptest.NewRecorder()
+	h.SuricataStatus(rec, httptest.NewRequest(http.MethodGet, "/suricata/status", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "systemd: bus gone") {
+		t.Fatalf("systemd failure must be a warning: %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func byOf(ri *restartInfo) string {
+	if ri == nil {
+		return ""
+	}
+	return ri.By
+}
+
+func ptr[T any](v T) *T { return &v }
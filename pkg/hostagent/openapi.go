@@ -0,0 +1,25 @@
+package hostagent
+
+import (
+	"bytes"
+	_ "embed"
+	"net/http"
+)
+
+//go:embed openapi.json
+var openAPISpec []byte
+
+// OpenAPISpec returns the OpenAPI 3.1 document served at GET /openapi.json.
+func OpenAPISpec() []byte {
+	return bytes.Clone(openAPISpec)
+}
+
+func (h *Handlers) OpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeErrPublic(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "method not allowed", nil)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(openAPISpec)
+}
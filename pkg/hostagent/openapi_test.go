@@ -0,0 +1,47 @@
+package hostagent
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOpenAPI_SpecMatchesRoutes(t *testing.T) {
+	var doc struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(OpenAPISpec(), &doc); err != nil {
+		t.Fatalf("spec is not JSON: %v", err)
+	}
+	documented := map[Route]bool{}
+	for path, ops := range doc.Paths {
+		for method := range ops {
+			if method == "parameters" {
+				continue
+			}
+			documented[Route{strings.ToUpper(method), path}] = true
+		}
+	}
+
+	served := map[Route]bool{}
+	for _, rt := range Routes() {
+		served[rt] = true
+		if !documented[rt] {
+			t.Errorf("%s %s is served but not in openapi.json", rt.Method, rt.Path)
+		}
+	}
+	for rt := range documented {
+		if !served[rt] {
+			t.Errorf("%s %s is in openapi.json but not served", rt.Method, rt.Path)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	NewHandlers(Deps{}, nil, nil).OpenAPI(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if rec.Code != http.StatusOK || !bytes.Equal(rec.Body.Bytes(), OpenAPISpec()) {
+		t.Fatalf("GET /openapi.json: %d", rec.Code)
+	}
+}
@@ -0,0 +1,29 @@
+package hostagent
+
+import (
+	"context"
+	"net"
+)
+
+// PeerCred is the identity of the process on the other end of the unix socket.
+type PeerCred struct {
+	UID uint32 `json:"uid"`
+	GID uint32 `json:"gid"`
+	PID int32  `json:"pid"`
+}
+
+type peerCredKey struct{}
+
+// connContext attaches the caller's credentials to every request on the connection.
+func connContext(ctx context.Context, c net.Conn) context.Context {
+	cred, err := peerCred(c)
+	if err != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, peerCredKey{}, cred)
+}
+
+func peerFromContext(ctx context.Context) *PeerCred {
+	cred, _ := ctx.Value(peerCredKey{}).(*PeerCred)
+	return cred
+}
@@ -0,0 +1,34 @@
+//go:build linux
+
+package hostagent
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+)
+
+func peerCred(c net.Conn) (*PeerCred, error) {
+	uc, ok := c.(*net.UnixConn)
+	if !ok {
+		return nil, fmt.Errorf("not a unix connection: %T", c)
+	}
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		ucred  *syscall.Ucred
+		optErr error
+	)
+	if err := raw.Control(func(fd uintptr) {
+		ucred, optErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	}); err != nil {
+		return nil, err
+	}
+	if optErr != nil {
+		return nil, fmt.Errorf("getsockopt SO_PEERCRED: %w", optErr)
+	}
+	return &PeerCred{UID: ucred.Uid, GID: ucred.Gid, PID: ucred.Pid}, nil
+}
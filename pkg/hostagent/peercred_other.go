@@ -0,0 +1,12 @@
+//go:build !linux
+
+package hostagent
+
+import (
+	"errors"
+	"net"
+)
+
+func peerCred(net.Conn) (*PeerCred, error) {
+	return nil, errors.New("SO_PEERCRED is only available on linux")
+}
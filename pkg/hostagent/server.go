@@ -4,12 +4,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"os"
 	"syscall"
 	"time"
 
+	"integration-suricata-ndpi/integration"
 	"integration-suricata-ndpi/pkg/fsutil"
 	"integration-suricata-ndpi/pkg/logger"
 	"integration-suricata-ndpi/pkg/systemd"
@@ -51,29 +53,62 @@ func New(deps Deps) (*Server, error) {
 		deps.FS = fsutil.OSFS{}
 	}
 
+	// The service container sees only ndpi.so and the Suricata binary, so
+	// whether the plugin can load into this Suricata is checked here.
+	if deps.SuricataBinPath != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		info, err := integration.CheckSuricataCompat(ctx, integration.SuricataCompatOptions{
+			PluginPath:      deps.NDPIPluginPath,
+			SuricataBinPath: deps.SuricataBinPath,
+			FS:              deps.FS,
+		})
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+		logger.Infow("Suricata build supports nDPI",
+			"version", info.Version,
+			"suricata_bin", deps.SuricataBinPath,
+		)
+	}
+
+	access, err := newAccessPolicy(deps.Access)
+	if err != nil {
+		return nil, fmt.Errorf("host_agent.access: %w", err)
+	}
+	if len(deps.Access) == 0 {
+		logger.Warnw("Host-agent has no access rules: every request will be denied, grant callers in host_agent.access",
+			"socket", deps.SocketPath)
+	}
+
 	ln, usingActivation, err := getListener(deps.SocketPath)
 	if err != nil {
 		return nil, err
 	}
 
-	h := NewHandlers(deps)
-
-	mux := http.NewServeMux()
-	mux.HandleFunc("/health", h.Health)
+	var audit *AuditLog
+	if deps.AuditLogPath != "" {
+		audit, err = OpenAuditLog(deps.AuditLogPath)
+		if err != nil {
+			_ = ln.Close()
+			return nil, err
+		}
+	}
 
-	mux.HandleFunc("/suricata/ensure", h.SuricataEnsure)
+	h := NewHandlers(deps, audit, access)
 
-	mux.HandleFunc("/ndpi/status", h.NDPIStatus)
-	mux.HandleFunc("/ndpi/enable", h.NDPIEnable)
-	mux.HandleFunc("/ndpi/disable", h.NDPIDisable)
-	mux.HandleFunc("/suricata/reload", h.SuricataReload)
+	mux := http.NewServeMux()
+	for _, rt := range h.routes() {
+		mux.HandleFunc(rt.Path, rt.h)
+	}
 
 	s := &http.Server{
-		Handler:           mux,
+		Handler:           h.authorized(mux),
 		ReadHeaderTimeout: 5 * time.Second,
 		ReadTimeout:       5 * time.Second,
 		WriteTimeout:      45 * time.Second,
 		IdleTimeout:       30 * time.Second,
+		ConnContext:       connContext,
 	}
 
 	if usingActivation {
@@ -87,6 +122,43 @@ func New(deps Deps) (*Server, error) {
 	}, nil
 }
 
+// Route is one host-agent operation as published in openapi.json.
+type Route struct {
+	Method string
+	Path   string
+}
+
+// route is mounted by path alone; handlers check the method themselves and
+// answer METHOD_NOT_ALLOWED in the agent's JSON shape.
+type route struct {
+	Route
+	h http.HandlerFunc
+}
+
+func (h *Handlers) routes() []route {
+	return []route{
+		{Route{http.MethodGet, "/health"}, h.Health},
+		{Route{http.MethodGet, "/openapi.json"}, h.OpenAPI},
+		{Route{http.MethodPost, "/suricata/ensure"}, h.audited(h.SuricataEnsure)},
+		{Route{http.MethodPost, "/suricata/reload"}, h.audited(h.SuricataReload)},
+		{Route{http.MethodGet, "/suricata/status"}, h.SuricataStatus},
+		{Route{http.MethodGet, "/ndpi/status"}, h.NDPIStatus},
+		{Route{http.MethodPost, "/ndpi/enable"}, h.audited(h.NDPIEnable)},
+		{Route{http.MethodPost, "/ndpi/disable"}, h.audited(h.NDPIDisable)},
+		{Route{http.MethodGet, "/audit"}, h.Audit},
+	}
+}
+
+// Routes lists the operations the agent serves, for checking them against the
+// OpenAPI spec.
+func Routes() []Route {
+	var out []Route
+	for _, rt := range NewHandlers(Deps{}, nil, nil).routes() {
+		out = append(out, rt.Route)
+	}
+	return out
+}
+
 func getListener(socketPath string) (net.Listener, bool, error) {
 	listeners, err := activation.Listeners()
 	if err == nil && len(listeners) > 0 {
@@ -113,6 +185,7 @@ func (s *Server) Start(ctx context.Context) error {
 		"suricata_config", s.deps.SuricataCfgPath,
 		"ndpi_plugin", s.deps.NDPIPluginPath,
 		"suricata_socket_candidates", s.deps.SuricataSocketCandidates,
+		"audit_log", s.deps.AuditLogPath,
 	)
 
 	errCh := make(chan error, 1)
@@ -141,6 +214,10 @@ func (s *Server) Stop(ctx context.Context) error {
 	if s.ln != nil {
 		_ = s.ln.Close()
 	}
+	// the D-Bus manager holds a bus connection
+	if c, ok := s.deps.Systemd.(io.Closer); ok {
+		_ = c.Close()
+	}
 
 	return err
 }
@@ -0,0 +1,22 @@
+package hostagent
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNew_RefusesIncompatiblePlugin(t *testing.T) {
+	dir := t.TempDir()
+	_, err := New(Deps{
+		SocketPath:      filepath.Join(dir, "agent.sock"),
+		SuricataCfgPath: "/etc/suricata/suricata.yaml",
+		NDPIPluginPath:  testPlugin,
+		SuricataUnit:    "suricata",
+		SuricataBinPath: "/usr/bin/suricata",
+		FS:              procFS(map[string]string{testPlugin: "not an elf"}),
+	})
+	if err == nil || !strings.Contains(err.Error(), "is not an ELF file") {
+		t.Fatalf("got %v", err)
+	}
+}
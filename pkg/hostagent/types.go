@@ -5,10 +5,12 @@ import (
 	"time"
 
 	"integration-suricata-ndpi/pkg/fsutil"
+	"integration-suricata-ndpi/pkg/systemd"
 )
 
 type SystemdManager interface {
 	Restart(ctx context.Context, unit string, timeout time.Duration) error
+	Status(ctx context.Context, unit string) (systemd.UnitStatus, error)
 }
 
 type Deps struct {
@@ -22,9 +24,15 @@ type Deps struct {
 	SuricataSocketCandidates []string
 	SuricataConnectTimeout   time.Duration
 
-	SuricataSCPath string
-	ReloadCommand  string
-	ReloadTimeout  time.Duration
+	SuricataSCPath  string
+	SuricataBinPath string
+	ReloadCommand   string
+	ReloadTimeout   time.Duration
+
+	// AuditLogPath is the hash-chained log of mutating calls; empty disables it.
+	AuditLogPath string
+	// Access authorizes callers by peer credentials; empty denies everyone.
+	Access []AccessRule
 
 	RestartTimeout time.Duration
 	SystemctlPath  string
@@ -0,0 +1,48 @@
+package rules
+
+import (
+	_ "embed"
+	"strings"
+)
+
+var (
+	//go:embed data/ndpi_protocols.txt
+	ndpiProtocolsRaw string
+
+	//go:embed data/ndpi_risks.txt
+	ndpiRisksRaw string
+
+	ndpiProtocols = readCatalog(ndpiProtocolsRaw)
+	ndpiRisks     = readCatalog(ndpiRisksRaw)
+)
+
+// NDPIProtocols returns the bundled nDPI protocol catalog (nDPI 4.14).
+func NDPIProtocols() []string { return append([]string(nil), ndpiProtocols...) }
+
+// NDPIRisks returns the bundled nDPI flow risk catalog (nDPI 4.14).
+func NDPIRisks() []string { return append([]string(nil), ndpiRisks...) }
+
+func IsNDPIProtocol(name string) bool { return inCatalog(ndpiProtocols, name) }
+
+func IsNDPIRisk(name string) bool { return inCatalog(ndpiRisks, name) }
+
+func readCatalog(raw string) []string {
+	var out []string
+	for _, ln := range strings.Split(raw, "\n") {
+		ln = strings.TrimSpace(ln)
+		if ln == "" || strings.HasPrefix(ln, "#") {
+			continue
+		}
+		out = append(out, ln)
+	}
+	return out
+}
+
+func inCatalog(catalog []string, name string) bool {
+	for _, v := range catalog {
+		if strings.EqualFold(v, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,156 @@
+package rules
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type Change struct {
+	Field string `json:"field"`
+	From  string `json:"from,omitempty"`
+	To    string `json:"to,omitempty"`
+}
+
+type DiffEntry struct {
+	SID      uint64 `json:"sid"`
+	Msg      string `json:"msg,omitempty"`
+	File     string `json:"file,omitempty"`
+	Disabled bool   `json:"disabled,omitempty"`
+}
+
+type Modification struct {
+	DiffEntry
+	Changes []Change `json:"changes"`
+}
+
+type Diff struct {
+	Added     []DiffEntry    `json:"added"`
+	Removed   []DiffEntry    `json:"removed"`
+	Modified  []Modification `json:"modified"`
+	Unchanged int            `json:"unchanged"`
+}
+
+func (d Diff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Modified) == 0
+}
+
+// DiffRules compares two rule sets by SID. Both sides are canonicalized first,
+// so pure formatting differences do not count.
+func DiffRules(from, to []*Rule) Diff {
+	a, b := indexBySID(from), indexBySID(to)
+	d := Diff{Added: []DiffEntry{}, Removed: []DiffEntry{}, Modified: []Modification{}}
+
+	for sid, nr := range b {
+		or, ok := a[sid]
+		if !ok {
+			d.Added = append(d.Added, diffEntry(nr))
+			continue
+		}
+		changes := ruleChanges(or, nr)
+		if len(changes) == 0 {
+			d.Unchanged++
+			continue
+		}
+		d.Modified = append(d.Modified, Modification{DiffEntry: diffEntry(nr), Changes: changes})
+	}
+	for sid, or := range a {
+		if _, ok := b[sid]; !ok {
+			d.Removed = append(d.Removed, diffEntry(or))
+		}
+	}
+
+	sort.Slice(d.Added, func(i, j int) bool { return d.Added[i].SID < d.Added[j].SID })
+	sort.Slice(d.Removed, func(i, j int) bool { return d.Removed[i].SID < d.Removed[j].SID })
+	sort.Slice(d.Modified, func(i, j int) bool { return d.Modified[i].SID < d.Modified[j].SID })
+	return d
+}
+
+// indexBySID prefers an enabled rule when a SID also appears commented out.
+func indexBySID(list []*Rule) map[uint64]*Rule {
+	out := make(map[uint64]*Rule, len(list))
+	for _, r := range list {
+		sid := r.SID()
+		if sid == 0 {
+			continue
+		}
+		if cur, ok := out[sid]; ok && !(cur.Disabled && !r.Disabled) {
+			continue
+		}
+		out[sid] = Canonical(r)
+	}
+	return out
+}
+
+func diffEntry(r *Rule) DiffEntry {
+	return DiffEntry{SID: r.SID(), Msg: r.Msg(), File: r.File, Disabled: r.Disabled}
+}
+
+func ruleChanges(a, b *Rule) []Change {
+	var out []Change
+	add := func(field, from, to string) {
+		if from != to {
+			out = append(out, Change{Field: field, From: from, To: to})
+		}
+	}
+
+	add("disabled", strconv.FormatBool(a.Disabled), strconv.FormatBool(b.Disabled))
+	add("action", a.Action, b.Action)
+	add("header", headerWithoutAction(a), headerWithoutAction(b))
+	add("rev", strconv.Itoa(a.Rev()), strconv.Itoa(b.Rev()))
+
+	av, bv := optionValues(a), optionValues(b)
+	names := make(map[string]struct{}, len(av)+len(bv))
+	for n := range av {
+		names[n] = struct{}{}
+	}
+	for n := range bv {
+		names[n] = struct{}{}
+	}
+	sorted := make([]string, 0, len(names))
+	for n := range names {
+		sorted = append(sorted, n)
+	}
+	sort.Strings(sorted)
+
+	keywordChanged := false
+	for _, n := range sorted {
+		from, to := strings.Join(av[n], " | "), strings.Join(bv[n], " | ")
+		if from != to {
+			keywordChanged = true
+		}
+		add("option:"+n, from, to)
+	}
+	if !keywordChanged && optionOrder(a) != optionOrder(b) {
+		add("options order", optionOrder(a), optionOrder(b))
+	}
+	return out
+}
+
+func headerWithoutAction(r *Rule) string {
+	return strings.Join([]string{r.Proto, r.Src, r.SrcPort, r.Direction, r.Dst, r.DstPort}, " ")
+}
+
+// optionValues groups option values by keyword; sid and rev are compared separately.
+func optionValues(r *Rule) map[string][]string {
+	out := make(map[string][]string)
+	for _, o := range r.Options {
+		if o.Name == "sid" || o.Name == "rev" {
+			continue
+		}
+		v := o.Value
+		if v == "" {
+			v = "(set)"
+		}
+		out[o.Name] = append(out[o.Name], v)
+	}
+	return out
+}
+
+func optionOrder(r *Rule) string {
+	names := make([]string, 0, len(r.Options))
+	for _, o := range r.Options {
+		names = append(names, o.Name)
+	}
+	return strings.Join(names, ",")
+}
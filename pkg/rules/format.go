@@ -0,0 +1,153 @@
+package rules
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Canonical option layout: requires and msg lead, detection options keep their
+// relative order (content modifiers and sticky buffers depend on it), and the
+// descriptive options close the rule in this order.
+var (
+	leadingOptions  = []string{"requires", "msg"}
+	trailingOptions = []string{"reference", "classtype", "priority", "target", "metadata", "gid", "sid", "rev"}
+
+	listOptions = map[string]bool{"requires": true, "metadata": true}
+)
+
+// Canonical returns a copy of r in canonical form: options reordered, spacing
+// normalized outside quoted strings and rev:1 added when missing.
+func Canonical(r *Rule) *Rule {
+	c := r.Clone()
+
+	rank := func(name string) (int, int) {
+		for i, n := range leadingOptions {
+			if n == name {
+				return 0, i
+			}
+		}
+		for i, n := range trailingOptions {
+			if n == name {
+				return 2, i
+			}
+		}
+		return 1, 0
+	}
+
+	var groups [3][][]Option
+	groups[0] = make([][]Option, len(leadingOptions))
+	groups[2] = make([][]Option, len(trailingOptions))
+	groups[1] = make([][]Option, 1)
+	for _, o := range r.Options {
+		o = Option{Name: strings.TrimSpace(o.Name), Value: normalizeValue(o.Name, o.Value)}
+		g, i := rank(o.Name)
+		groups[g][i] = append(groups[g][i], o)
+	}
+
+	if len(groups[2][len(trailingOptions)-1]) == 0 {
+		groups[2][len(trailingOptions)-1] = []Option{{Name: "rev", Value: "1"}}
+	}
+
+	c.Options = c.Options[:0]
+	for _, g := range groups {
+		for _, opts := range g {
+			c.Options = append(c.Options, opts...)
+		}
+	}
+	return c
+}
+
+func normalizeValue(name, v string) string {
+	v = collapseSpaces(strings.TrimSpace(v))
+	if !listOptions[name] {
+		return v
+	}
+	return strings.Join(splitList(v), ", ")
+}
+
+// collapseSpaces squeezes whitespace runs to one space outside double quotes.
+func collapseSpaces(s string) string {
+	var b strings.Builder
+	inQuote, space := false, false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s):
+			b.WriteByte(c)
+			b.WriteByte(s[i+1])
+			i++
+			space = false
+			continue
+		case c == '"':
+			inQuote = !inQuote
+		case !inQuote && (c == ' ' || c == '\t' || c == '\n' || c == '\r'):
+			space = true
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// FormatRules rewrites a rule file in canonical form: every rule on one line,
+// comments found inside a multi-line rule moved above it, other comments and
+// single blank lines kept. Files with parse errors are not formatted.
+func FormatRules(data []byte, file string) ([]byte, error) {
+	parsed, perrs, err := ParseReader(bytes.NewReader(data), file)
+	if err != nil {
+		return nil, err
+	}
+	if len(perrs) > 0 {
+		msgs := make([]string, 0, len(perrs))
+		for _, e := range perrs {
+			msgs = append(msgs, e.Error())
+		}
+		return nil, fmt.Errorf("cannot format: %s", strings.Join(msgs, "; "))
+	}
+
+	byLine := make(map[int]*Rule, len(parsed))
+	for _, r := range parsed {
+		byLine[r.Line] = r
+	}
+
+	lines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	var out []string
+	blank := false
+	emit := func(s string) {
+		if s == "" {
+			if blank || len(out) == 0 {
+				return
+			}
+			blank = true
+		} else {
+			blank = false
+		}
+		out = append(out, s)
+	}
+
+	for i := 0; i < len(lines); i++ {
+		r, ok := byLine[i+1]
+		if !ok {
+			emit(strings.TrimRight(lines[i], " \t"))
+			continue
+		}
+		for _, c := range r.Comments {
+			emit(c)
+		}
+		emit(Canonical(r).String())
+		i = r.EndLine - 1
+	}
+
+	for len(out) > 0 && out[len(out)-1] == "" {
+		out = out[:len(out)-1]
+	}
+	if len(out) == 0 {
+		return []byte{}, nil
+	}
+	return []byte(strings.Join(out, "\n") + "\n"), nil
+}
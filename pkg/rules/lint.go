@@ -0,0 +1,194 @@
+package rules
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"strings"
+)
+
+//go:embed data/transports.txt
+var transportsRaw string
+
+var transports = readCatalog(transportsRaw)
+
+// IsTransport reports whether proto is accepted in a rule header (scripts/protocol.txt).
+func IsTransport(proto string) bool { return inCatalog(transports, proto) }
+
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+type Finding struct {
+	Severity Severity `json:"severity"`
+	Code     string   `json:"code"`
+	Message  string   `json:"message"`
+}
+
+type LintResult struct {
+	Line     int       `json:"line"`
+	SID      uint64    `json:"sid,omitempty"`
+	Rule     string    `json:"rule"`
+	Findings []Finding `json:"findings,omitempty"`
+}
+
+type LintReport struct {
+	Valid   bool         `json:"valid"`
+	Rules   []LintResult `json:"rules"`
+	Errors  []ParseError `json:"errors,omitempty"`
+	Summary struct {
+		Rules    int `json:"rules"`
+		Errors   int `json:"errors"`
+		Warnings int `json:"warnings"`
+	} `json:"summary"`
+}
+
+// requiredOptions mirrors scripts/required_fields.txt.
+var requiredOptions = []string{"msg", "requires", "metadata"}
+
+// Lint applies the repository rule conventions (scripts/rules_validation_script.sh)
+// to a single parsed rule.
+func Lint(r *Rule) []Finding {
+	var out []Finding
+	errorf := func(code, format string, args ...any) {
+		out = append(out, Finding{Severity: SeverityError, Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+	warnf := func(code, format string, args ...any) {
+		out = append(out, Finding{Severity: SeverityWarning, Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if r.Action == "config" {
+		errorf("action", "action %q is not allowed", r.Action)
+	}
+	if !IsTransport(r.Proto) {
+		errorf("transport", "unsupported protocol %q", r.Proto)
+	}
+
+	if v, ok := r.Opt("sid"); !ok {
+		errorf("sid", "sid is missing")
+	} else if r.SID() == 0 {
+		errorf("sid", "sid %q is not a positive integer", v)
+	}
+
+	for _, name := range requiredOptions {
+		switch n := len(r.Opts(name)); {
+		case n == 0:
+			errorf("required", "%s is missing", name)
+		case n > 1:
+			errorf("required", "%s is set %d times", name, n)
+		}
+	}
+
+	if r.HasOpt("metadata") && len(r.MitreTechniques()) == 0 {
+		errorf("mitre", "metadata has no mitre_technique_id")
+	}
+	out = append(out, lintMitre(r)...)
+
+	requires := make(map[string]bool)
+	for _, req := range r.Requires() {
+		requires[strings.Join(strings.Fields(req), " ")] = true
+	}
+	for _, kw := range []string{"ndpi-protocol", "ndpi-risk"} {
+		used := r.HasOpt(kw)
+		declared := requires["keyword "+kw]
+		switch {
+		case used && !declared:
+			errorf("requires", "%s is used without 'requires:keyword %s'", kw, kw)
+		case declared && !used:
+			errorf("requires", "'requires:keyword %s' is declared but %s is not used", kw, kw)
+		}
+	}
+
+	for _, p := range r.NDPIProtocols() {
+		if !IsNDPIProtocol(p) {
+			warnf("ndpi-protocol", "unknown nDPI protocol %q", p)
+		}
+	}
+	for _, risk := range r.NDPIRisks() {
+		if !IsNDPIRisk(risk) {
+			warnf("ndpi-risk", "unknown nDPI risk %q", risk)
+		}
+	}
+	return out
+}
+
+// LintText parses and lints a rule body; duplicate SIDs within the body are errors.
+func LintText(text string) LintReport {
+	var rep LintReport
+
+	parsed, perrs, err := ParseReader(bytes.NewReader([]byte(text)), "")
+	if err != nil {
+		perrs = append(perrs, ParseError{Err: err.Error()})
+	}
+	rep.Errors = perrs
+
+	seen := make(map[uint64]int)
+	for _, r := range parsed {
+		if r.Disabled {
+			continue
+		}
+		res := LintResult{Line: r.Line, SID: r.SID(), Rule: r.String(), Findings: Lint(r)}
+		if res.SID != 0 {
+			if first, dup := seen[res.SID]; dup {
+				res.Findings = append(res.Findings, Finding{
+					Severity: SeverityError,
+					Code:     "duplicate-sid",
+					Message:  fmt.Sprintf("sid %d is already used on line %d", res.SID, first),
+				})
+			} else {
+				seen[res.SID] = r.Line
+			}
+		}
+		rep.Rules = append(rep.Rules, res)
+	}
+
+	rep.Summary.Rules = len(rep.Rules)
+	rep.Summary.Errors = len(rep.Errors)
+	for _, res := range rep.Rules {
+		for _, f := range res.Findings {
+			if f.Severity == SeverityError {
+				rep.Summary.Errors++
+			} else {
+				rep.Summary.Warnings++
+			}
+		}
+	}
+	rep.Valid = rep.Summary.Errors == 0 && len(rep.Rules) > 0
+	return rep
+}
+
+func lintMitre(r *Rule) []Finding {
+	var out []Finding
+
+	tactics := make(map[string]bool)
+	for _, id := range r.MitreTechniques() {
+		if !IsMitreTechniqueID(id) {
+			out = append(out, Finding{Severity: SeverityError, Code: "mitre", Message: fmt.Sprintf("%q is not an ATT&CK technique id", id)})
+			continue
+		}
+		t, ok := LookupMitreTechnique(id)
+		if !ok {
+			// the bundled catalog is a subset of ATT&CK, so a well-formed id
+			// missing from it may still be valid
+			out = append(out, Finding{Severity: SeverityWarning, Code: "mitre-unknown", Message: fmt.Sprintf("technique %s is not in the bundled ATT&CK catalog", id)})
+			continue
+		}
+		for _, ta := range t.Tactics {
+			tactics[ta] = true
+		}
+	}
+
+	for _, id := range r.Metadata()["mitre_tactic_id"] {
+		if _, ok := LookupMitreTactic(id); !ok {
+			out = append(out, Finding{Severity: SeverityError, Code: "mitre-unknown", Message: fmt.Sprintf("unknown ATT&CK tactic %s", id)})
+			continue
+		}
+		if len(tactics) > 0 && !tactics[strings.ToUpper(id)] {
+			out = append(out, Finding{Severity: SeverityError, Code: "mitre-tactic", Message: fmt.Sprintf("tactic %s does not match the rule's techniques", id)})
+		}
+	}
+	return out
+}
@@ -0,0 +1,82 @@
+package rules
+
+import (
+	_ "embed"
+	"regexp"
+	"strings"
+)
+
+type MitreTactic struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Domain string `json:"domain"`
+}
+
+type MitreTechnique struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Tactics []string `json:"tactics"`
+}
+
+var (
+	//go:embed data/mitre_tactics.tsv
+	mitreTacticsRaw string
+
+	//go:embed data/mitre_techniques.tsv
+	mitreTechniquesRaw string
+
+	mitreTactics, mitreTacticOrder = readMitreTactics(mitreTacticsRaw)
+	mitreTechniques                = readMitreTechniques(mitreTechniquesRaw)
+
+	mitreIDPattern = regexp.MustCompile(`^T\d{4}(\.\d{3})?$`)
+)
+
+// MitreTactics returns the bundled tactics in kill-chain order, Enterprise first.
+func MitreTactics() []MitreTactic {
+	out := make([]MitreTactic, 0, len(mitreTacticOrder))
+	for _, id := range mitreTacticOrder {
+		out = append(out, mitreTactics[id])
+	}
+	return out
+}
+
+func LookupMitreTactic(id string) (MitreTactic, bool) {
+	t, ok := mitreTactics[strings.ToUpper(strings.TrimSpace(id))]
+	return t, ok
+}
+
+// LookupMitreTechnique finds a technique or sub-technique in the bundled catalog.
+func LookupMitreTechnique(id string) (MitreTechnique, bool) {
+	t, ok := mitreTechniques[strings.ToUpper(strings.TrimSpace(id))]
+	return t, ok
+}
+
+func IsMitreTechniqueID(id string) bool {
+	return mitreIDPattern.MatchString(strings.TrimSpace(id))
+}
+
+func readMitreTactics(raw string) (map[string]MitreTactic, []string) {
+	byID := make(map[string]MitreTactic)
+	var order []string
+	for _, ln := range readCatalog(raw) {
+		f := strings.Split(ln, "\t")
+		if len(f) != 3 {
+			continue
+		}
+		byID[f[0]] = MitreTactic{ID: f[0], Name: f[1], Domain: f[2]}
+		order = append(order, f[0])
+	}
+	return byID, order
+}
+
+func readMitreTechniques(raw string) map[string]MitreTechnique {
+	out := make(map[string]MitreTechnique)
+	for _, ln := range readCatalog(raw) {
+		f := strings.Split(ln, "\t")
+		if len(f) != 3 {
+			continue
+		}
+		out[f[0]] = MitreTechnique{ID: f[0], Name: f[1], Tactics: splitList(f[2])}
+	}
+	return out
+}
@@ -0,0 +1,317 @@
+package rules
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+var actions = map[string]struct{}{
+	"alert":      {},
+	"pass":       {},
+	"drop":       {},
+	"reject":     {},
+	"rejectsrc":  {},
+	"rejectdst":  {},
+	"rejectboth": {},
+	"config":     {},
+}
+
+func IsAction(s string) bool {
+	_, ok := actions[s]
+	return ok
+}
+
+type ParseError struct {
+	File string `json:"file,omitempty"`
+	Line int    `json:"line"`
+	Text string `json:"text"`
+	Err  string `json:"error"`
+}
+
+func (e ParseError) Error() string {
+	if e.File != "" {
+		return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Err)
+	}
+	return fmt.Sprintf("line %d: %s", e.Line, e.Err)
+}
+
+// Parse parses a single rule; backslash continuations and newlines are allowed.
+func Parse(text string) (*Rule, error) {
+	joined := joinContinuations(text)
+	if joined == "" {
+		return nil, fmt.Errorf("empty rule")
+	}
+
+	open := strings.Index(joined, "(")
+	closeIdx := strings.LastIndex(joined, ")")
+	if open < 0 || closeIdx < open {
+		return nil, fmt.Errorf("rule options must be enclosed in parentheses")
+	}
+	if rest := strings.TrimSpace(joined[closeIdx+1:]); rest != "" {
+		return nil, fmt.Errorf("unexpected text after options: %q", rest)
+	}
+
+	header := splitHeader(joined[:open])
+	if len(header) != 7 {
+		return nil, fmt.Errorf("rule header must have 7 fields (action proto src sport dir dst dport), got %d", len(header))
+	}
+	if !IsAction(header[0]) {
+		return nil, fmt.Errorf("unknown action %q", header[0])
+	}
+	switch header[4] {
+	case "->", "<>", "=>":
+	default:
+		return nil, fmt.Errorf("invalid direction %q", header[4])
+	}
+
+	opts, err := splitOptions(joined[open+1 : closeIdx])
+	if err != nil {
+		return nil, err
+	}
+
+	return &Rule{
+		Action:    header[0],
+		Proto:     header[1],
+		Src:       header[2],
+		SrcPort:   header[3],
+		Direction: header[4],
+		Dst:       header[5],
+		DstPort:   header[6],
+		Options:   opts,
+		Raw:       strings.TrimSpace(text),
+	}, nil
+}
+
+func ParseFile(path string) ([]*Rule, []ParseError, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	rs, perrs, err := ParseReader(f, path)
+	return rs, perrs, err
+}
+
+// ParseReader reads single-line and multi-line rules. A rule continues while
+// a line ends with '\' or its option parentheses are not yet closed; comment
+// lines inside a multi-line rule are kept in Comments. A commented-out rule on a single
+// line is returned with Disabled set.
+func ParseReader(r io.Reader, file string) ([]*Rule, []ParseError, error) {
+	var (
+		out   []*Rule
+		perrs []ParseError
+
+		buf       []string
+		comments  []string
+		startLine int
+	)
+
+	lineNo := 0
+	flush := func() {
+		text := strings.Join(buf, "\n")
+		inner := comments
+		buf, comments = nil, nil
+
+		rule, err := Parse(text)
+		if err != nil {
+			perrs = append(perrs, ParseError{File: file, Line: startLine, Text: text, Err: err.Error()})
+			return
+		}
+		rule.File = file
+		rule.Line = startLine
+		rule.EndLine = lineNo
+		rule.Comments = inner
+		out = append(out, rule)
+	}
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for sc.Scan() {
+		lineNo++
+		line := strings.TrimRight(sc.Text(), "\r")
+		trim := strings.TrimSpace(line)
+
+		if len(buf) == 0 {
+			if trim == "" {
+				continue
+			}
+			if strings.HasPrefix(trim, "#") {
+				if rule := parseDisabled(trim); rule != nil {
+					rule.File = file
+					rule.Line = lineNo
+					rule.EndLine = lineNo
+					out = append(out, rule)
+				}
+				continue
+			}
+			startLine = lineNo
+		} else if strings.HasPrefix(trim, "#") {
+			comments = append(comments, trim)
+			continue
+		} else if trim == "" {
+			continue
+		}
+
+		buf = append(buf, line)
+
+		joined := joinContinuations(strings.Join(buf, "\n"))
+		if strings.HasSuffix(trim, `\`) {
+			continue
+		}
+		if depth := parenDepth(joined); depth > 0 {
+			continue
+		}
+		flush()
+	}
+	if err := sc.Err(); err != nil {
+		return out, perrs, err
+	}
+	if len(buf) > 0 {
+		text := strings.Join(buf, "\n")
+		perrs = append(perrs, ParseError{File: file, Line: startLine, Text: text, Err: "unterminated rule at end of file"})
+	}
+	return out, perrs, nil
+}
+
+func parseDisabled(comment string) *Rule {
+	text := strings.TrimSpace(strings.TrimLeft(comment, "#"))
+	first, _, _ := strings.Cut(text, " ")
+	if !IsAction(first) || !strings.HasSuffix(text, ")") {
+		return nil
+	}
+	rule, err := Parse(text)
+	if err != nil {
+		return nil
+	}
+	rule.Disabled = true
+	rule.Raw = comment
+	return rule
+}
+
+func joinContinuations(text string) string {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	parts := make([]string, 0, len(lines))
+	for _, ln := range lines {
+		t := strings.TrimSpace(ln)
+		if strings.HasPrefix(t, "#") {
+			continue
+		}
+		t = strings.TrimSpace(strings.TrimSuffix(t, `\`))
+		if t != "" {
+			parts = append(parts, t)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func parenDepth(s string) int {
+	depth := 0
+	inQuote := false
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			inQuote = !inQuote
+		case '(':
+			if !inQuote {
+				depth++
+			}
+		case ')':
+			if !inQuote {
+				depth--
+			}
+		}
+	}
+	if strings.Count(s, "(") == 0 {
+		return 0
+	}
+	return depth
+}
+
+func splitHeader(s string) []string {
+	var (
+		out   []string
+		cur   strings.Builder
+		depth int
+	)
+	for _, r := range strings.TrimSpace(s) {
+		switch {
+		case r == '[':
+			depth++
+			cur.WriteRune(r)
+		case r == ']':
+			depth--
+			cur.WriteRune(r)
+		case (r == ' ' || r == '\t') && depth == 0:
+			if cur.Len() > 0 {
+				out = append(out, cur.String())
+				cur.Reset()
+			}
+		case (r == ' ' || r == '\t') && depth > 0:
+			// "[1.1.1.1, 2.2.2.2]" keeps its members together
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	if cur.Len() > 0 {
+		out = append(out, cur.String())
+	}
+	return out
+}
+
+func splitOptions(body string) ([]Option, error) {
+	var (
+		out     []Option
+		cur     strings.Builder
+		inQuote bool
+	)
+
+	emit := func() error {
+		raw := strings.TrimSpace(cur.String())
+		cur.Reset()
+		if raw == "" {
+			return nil
+		}
+		name, value, _ := strings.Cut(raw, ":")
+		name = strings.TrimSpace(name)
+		if name == "" || strings.ContainsAny(name, " \t\"") {
+			return fmt.Errorf("invalid option %q", raw)
+		}
+		out = append(out, Option{Name: name, Value: strings.TrimSpace(value)})
+		return nil
+	}
+
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		switch {
+		case c == '\\' && i+1 < len(body):
+			cur.WriteByte(c)
+			cur.WriteByte(body[i+1])
+			i++
+		case c == '"':
+			inQuote = !inQuote
+			cur.WriteByte(c)
+		case c == ';' && !inQuote:
+			if err := emit(); err != nil {
+				return nil, err
+			}
+		default:
+			cur.WriteByte(c)
+		}
+	}
+	if inQuote {
+		return nil, fmt.Errorf("unterminated quoted string in options")
+	}
+	if strings.TrimSpace(cur.String()) != "" {
+		return nil, fmt.Errorf("last option %q is not terminated with ';'", strings.TrimSpace(cur.String()))
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("rule has no options")
+	}
+	return out, nil
+}
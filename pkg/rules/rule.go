@@ -0,0 +1,170 @@
+package rules
+
+import (
+	"strconv"
+	"strings"
+)
+
+type Option struct {
+	Name  string `json:"name"`
+	Value string `json:"value,omitempty"`
+}
+
+type Rule struct {
+	Action    string   `json:"action"`
+	Proto     string   `json:"proto"`
+	Src       string   `json:"src"`
+	SrcPort   string   `json:"src_port"`
+	Direction string   `json:"direction"`
+	Dst       string   `json:"dst"`
+	DstPort   string   `json:"dst_port"`
+	Options   []Option `json:"options"`
+
+	// Disabled is set for rules commented out with a leading '#'.
+	Disabled bool   `json:"disabled,omitempty"`
+	File     string `json:"file,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	EndLine  int    `json:"end_line,omitempty"`
+	Raw      string `json:"raw"`
+
+	// Comments are the comment lines found inside a multi-line rule.
+	Comments []string `json:"comments,omitempty"`
+}
+
+func (r *Rule) Opt(name string) (string, bool) {
+	for _, o := range r.Options {
+		if o.Name == name {
+			return o.Value, true
+		}
+	}
+	return "", false
+}
+
+func (r *Rule) Opts(name string) []string {
+	var out []string
+	for _, o := range r.Options {
+		if o.Name == name {
+			out = append(out, o.Value)
+		}
+	}
+	return out
+}
+
+func (r *Rule) HasOpt(name string) bool {
+	_, ok := r.Opt(name)
+	return ok
+}
+
+func (r *Rule) SID() uint64 {
+	v, _ := r.Opt("sid")
+	sid, _ := strconv.ParseUint(strings.TrimSpace(v), 10, 64)
+	return sid
+}
+
+func (r *Rule) Rev() int {
+	v, _ := r.Opt("rev")
+	rev, _ := strconv.Atoi(strings.TrimSpace(v))
+	return rev
+}
+
+func (r *Rule) Msg() string {
+	v, _ := r.Opt("msg")
+	return Unquote(v)
+}
+
+func (r *Rule) Header() string {
+	return strings.Join([]string{r.Action, r.Proto, r.Src, r.SrcPort, r.Direction, r.Dst, r.DstPort}, " ")
+}
+
+func (r *Rule) Metadata() map[string][]string {
+	out := make(map[string][]string)
+	for _, v := range r.Opts("metadata") {
+		for _, kv := range splitList(v) {
+			key, val, _ := strings.Cut(kv, " ")
+			key = strings.TrimSpace(key)
+			if key == "" {
+				continue
+			}
+			out[key] = append(out[key], strings.TrimSpace(val))
+		}
+	}
+	return out
+}
+
+func (r *Rule) Requires() []string {
+	var out []string
+	for _, v := range r.Opts("requires") {
+		out = append(out, splitList(v)...)
+	}
+	return out
+}
+
+func (r *Rule) NDPIProtocols() []string {
+	var out []string
+	for _, v := range r.Opts("ndpi-protocol") {
+		out = append(out, strings.TrimPrefix(Unquote(v), "!"))
+	}
+	return out
+}
+
+func (r *Rule) NDPIRisks() []string {
+	var out []string
+	for _, v := range r.Opts("ndpi-risk") {
+		for _, risk := range splitList(Unquote(v)) {
+			out = append(out, strings.TrimPrefix(risk, "!"))
+		}
+	}
+	return out
+}
+
+func (r *Rule) MitreTechniques() []string {
+	return r.Metadata()["mitre_technique_id"]
+}
+
+func (r *Rule) String() string {
+	var b strings.Builder
+	if r.Disabled {
+		b.WriteString("# ")
+	}
+	b.WriteString(r.Header())
+	b.WriteString(" (")
+	for i, o := range r.Options {
+		if i > 0 {
+			b.WriteString(" ")
+		}
+		b.WriteString(o.Name)
+		if o.Value != "" {
+			b.WriteString(":")
+			b.WriteString(o.Value)
+		}
+		b.WriteString(";")
+	}
+	b.WriteString(")")
+	return b.String()
+}
+
+func (r *Rule) Clone() *Rule {
+	c := *r
+	c.Options = append([]Option(nil), r.Options...)
+	c.Comments = append([]string(nil), r.Comments...)
+	return &c
+}
+
+func Unquote(v string) string {
+	v = strings.TrimSpace(v)
+	if len(v) >= 2 && strings.HasPrefix(v, `"`) && strings.HasSuffix(v, `"`) {
+		v = v[1 : len(v)-1]
+	}
+	r := strings.NewReplacer(`\"`, `"`, `\;`, `;`, `\\`, `\`)
+	return r.Replace(v)
+}
+
+func splitList(v string) []string {
+	var out []string
+	for _, p := range strings.Split(v, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
@@ -0,0 +1,265 @@
+package rules
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse_SingleLine(t *testing.T) {
+	r, err := Parse(`alert tcp any any -> any any (msg:"FTP; control"; requires:keyword ndpi-protocol; ndpi-protocol:FTP_CONTROL; metadata:mitre_technique_id T1046, created_at 2025_01_01; sid:50000000; rev:2;)`)
+	if err != nil {
+		t.Fatalf("unexpected: %v", err)
+	}
+	if r.Action != "alert" || r.Proto != "tcp" || r.Direction != "->" {
+		t.Fatalf("bad header: %+v", r)
+	}
+	if r.SID() != 50000000 || r.Rev() != 2 {
+		t.Fatalf("bad sid/rev: %d/%d", r.SID(), r.Rev())
+	}
+	if r.Msg() != "FTP; control" {
+		t.Fatalf("bad msg: %q", r.Msg())
+	}
+	if got := r.NDPIProtocols(); len(got) != 1 || got[0] != "FTP_CONTROL" {
+		t.Fatalf("bad protocols: %v", got)
+	}
+	if got := r.MitreTechniques(); len(got) != 1 || got[0] != "T1046" {
+		t.Fatalf("bad mitre: %v", got)
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	cases := map[string]string{
+		"no parens":      `alert tcp any any -> any any msg:"x"; sid:1;`,
+		"short header":   `alert tcp any -> any any (sid:1;)`,
+		"bad action":     `warn tcp any any -> any any (sid:1;)`,
+		"bad direction":  `alert tcp any any >> any any (sid:1;)`,
+		"unterminated":   `alert tcp any any -> any any (msg:"x; sid:1;)`,
+		"missing last ;": `alert tcp any any -> any any (msg:"x"; sid:1)`,
+	}
+	for name, text := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Parse(text); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestParseReader_MultiLineAndDisabled(t *testing.T) {
+	in := `# header comment
+alert tcp [10.0.0.1, 10.0.0.2] any -> any any (
+    msg:"[nDPI] multi"; \
+    # inline comment
+    requires:keyword ndpi-risk; \
+    ndpi-risk:NDPI_TLS_WEAK_CIPHER,NDPI_TLS_OBSOLETE_VERSION; \
+    sid:3000001; \
+    metadata: \
+        mitre_technique_id T1573, \
+        deployment Perimeter;
+)
+
+alert udp any any -> any any (msg:"one"; \
+  sid:3000002;)
+# alert tcp any any -> any any (msg:"off"; sid:3000003;)
+alert tcp any any -> any any (msg:"broken"; sid:3000004
+`
+	rs, perrs, err := ParseReader(strings.NewReader(in), "x.rules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs) != 3 {
+		t.Fatalf("want 3 rules, got %d (%+v)", len(rs), perrs)
+	}
+	if len(perrs) != 1 || perrs[0].Line != 16 {
+		t.Fatalf("want 1 parse error at line 16, got %+v", perrs)
+	}
+
+	multi := rs[0]
+	if multi.Src != "[10.0.0.1,10.0.0.2]" || multi.Line != 2 || multi.EndLine != 11 || multi.SID() != 3000001 {
+		t.Fatalf("bad multi-line rule: %+v", multi)
+	}
+	if got := multi.NDPIRisks(); len(got) != 2 || got[1] != "NDPI_TLS_OBSOLETE_VERSION" {
+		t.Fatalf("bad risks: %v", got)
+	}
+	if got := multi.Metadata()["deployment"]; len(got) != 1 || got[0] != "Perimeter" {
+		t.Fatalf("bad metadata: %v", multi.Metadata())
+	}
+	if rs[1].SID() != 3000002 || rs[1].Line != 13 {
+		t.Fatalf("bad continued rule: %+v", rs[1])
+	}
+	if !rs[2].Disabled || rs[2].SID() != 3000003 {
+		t.Fatalf("want disabled rule 3000003, got %+v", rs[2])
+	}
+}
+
+func TestCatalog(t *testing.T) {
+	if !IsNDPIProtocol("http") || !IsNDPIProtocol("FTP_CONTROL") {
+		t.Fatal("expected HTTP and FTP_CONTROL in protocol catalog")
+	}
+	if !IsNDPIRisk("NDPI_TLS_WEAK_CIPHER") || IsNDPIRisk("NDPI_NOT_A_RISK") {
+		t.Fatal("bad risk catalog lookup")
+	}
+}
+
+func TestLintText(t *testing.T) {
+	in := `alert tcp any any -> any any (msg:"ok"; requires:keyword ndpi-protocol; ndpi-protocol:HTTP; metadata:mitre_technique_id T1071; sid:1;)
+alert foo any any -> any any (msg:"bad proto"; requires:keyword ndpi-protocol; ndpi-protocol:HTTP; metadata:mitre_technique_id T1071; sid:2;)
+alert tcp any any -> any any (msg:"undeclared risk"; requires:keyword ndpi-protocol; ndpi-risk:NDPI_TLS_WEAK_CIPHER; metadata:mitre_technique_id T1071; sid:3;)
+alert tcp any any -> any any (msg:"no mitre"; requires:keyword ndpi-protocol; ndpi-protocol:HTTP; metadata:created_at 2025_01_01; sid:4;)
+alert tcp any any -> any any (msg:"dup"; requires:keyword ndpi-protocol; ndpi-protocol:NotAProto; metadata:mitre_technique_id T1071; sid:1;)
+`
+	rep := LintText(in)
+	if rep.Valid || len(rep.Rules) != 5 {
+		t.Fatalf("want invalid report with 5 rules, got %+v", rep)
+	}
+
+	codes := func(res LintResult) string {
+		var out []string
+		for _, f := range res.Findings {
+			out = append(out, f.Code)
+		}
+		return strings.Join(out, ",")
+	}
+	want := []string{"", "transport", "requires,requires", "mitre", "ndpi-protocol,duplicate-sid"}
+	for i, res := range rep.Rules {
+		if got := codes(res); got != want[i] {
+			t.Fatalf("rule %d (sid %d): want findings %q, got %q", i, res.SID, want[i], got)
+		}
+	}
+	if rep.Summary.Errors != 5 || rep.Summary.Warnings != 1 {
+		t.Fatalf("bad summary: %+v", rep.Summary)
+	}
+}
+
+func TestMitreCatalog_CoversRuleTechniques(t *testing.T) {
+	for _, id := range []string{"T0886", "T1001", "T1021", "T1040", "T1041", "T1046", "T1071", "T1090", "T1095",
+		"T1105", "T1119", "T1219", "T1572", "T1573", "T1590", "T1595", "T1596", "T1598"} {
+		tech, ok := LookupMitreTechnique(id)
+		if !ok || tech.Name == "" || len(tech.Tactics) == 0 {
+			t.Fatalf("%s missing from catalog: %+v", id, tech)
+		}
+		for _, ta := range tech.Tactics {
+			if _, ok := LookupMitreTactic(ta); !ok {
+				t.Fatalf("%s refers to unknown tactic %s", id, ta)
+			}
+		}
+	}
+}
+
+func TestLint_Mitre(t *testing.T) {
+	lint := func(meta string) []Finding {
+		r, err := Parse(`alert tcp any any -> any any (msg:"x"; requires:keyword ndpi-protocol; ndpi-protocol:HTTP; metadata:` + meta + `; sid:1;)`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return Lint(r)
+	}
+
+	cases := map[string]string{
+		"mitre_technique_id T1071":                         "",
+		"mitre_technique_id T1071.001":                     "",
+		"mitre_technique_id T1071.999":                     "warning:mitre-unknown",
+		"mitre_technique_id T9999":                         "warning:mitre-unknown",
+		"mitre_technique_id Txxxx":                         "error:mitre",
+		"mitre_technique_id T1071, mitre_tactic_id TA0011": "",
+		"mitre_technique_id T1071, mitre_tactic_id TA0043": "error:mitre-tactic",
+		"mitre_technique_id T1046, mitre_tactic_id TAxxxx": "error:mitre-unknown",
+	}
+	for meta, want := range cases {
+		var got []string
+		for _, f := range lint(meta) {
+			got = append(got, string(f.Severity)+":"+f.Code)
+		}
+		if strings.Join(got, ",") != want {
+			t.Fatalf("%s: want %q, got %q", meta, want, got)
+		}
+	}
+}
+
+func TestFormatRules(t *testing.T) {
+	in := `# header
+
+alert tcp any any -> any any (msg:"a  b"; metadata:mitre_technique_id T1071,created_at 2025_01_01; sid:1; requires:keyword ndpi-protocol; ndpi-protocol:HTTP;)   
+
+
+alert tcp [10.0.0.1, 10.0.0.2] any -> any any ( \
+    msg:"multi"; \
+    # why this rule exists
+    classtype:attempted-recon; \
+    rev:3; \
+    flow:established,  to_server; \
+    sid:2; \
+)
+# alert tcp any any -> any any (sid:3; msg:"off";)
+`
+	want := `# header
+
+alert tcp any any -> any any (requires:keyword ndpi-protocol; msg:"a  b"; ndpi-protocol:HTTP; metadata:mitre_technique_id T1071, created_at 2025_01_01; sid:1; rev:1;)
+
+# why this rule exists
+alert tcp [10.0.0.1,10.0.0.2] any -> any any (msg:"multi"; flow:established, to_server; classtype:attempted-recon; sid:2; rev:3;)
+# alert tcp any any -> any any (msg:"off"; sid:3; rev:1;)
+`
+	out, err := FormatRules([]byte(in), "x.rules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != want {
+		t.Fatalf("bad format:\n%s\nwant:\n%s", out, want)
+	}
+
+	again, err := FormatRules(out, "x.rules")
+	if err != nil || string(again) != string(out) {
+		t.Fatalf("format is not idempotent:\n%s", again)
+	}
+
+	if _, err := FormatRules([]byte("alert tcp any any -> any any (sid:1\n"), "bad.rules"); err == nil {
+		t.Fatal("expected error for unparsable file")
+	}
+}
+
+func TestDiffRules(t *testing.T) {
+	parse := func(text string) []*Rule {
+		t.Helper()
+		rs, perrs, err := ParseReader(strings.NewReader(text), "t.rules")
+		if err != nil || len(perrs) != 0 {
+			t.Fatalf("parse: %v %v", err, perrs)
+		}
+		return rs
+	}
+
+	from := parse(`alert tcp any any -> any any (msg:"a"; sid:1; rev:1;)
+alert tcp any any -> any 80 (msg:"b"; content:"x"; sid:2; rev:1;)
+alert udp any any -> any any (msg:"c"; sid:3;)
+alert tcp any any -> any any (msg:"gone"; sid:4;)
+`)
+	to := parse(`alert tcp any any -> any any (sid:1; msg:"a";   rev:1;)
+drop tcp any any -> any 443 (msg:"b"; content:"y"; nocase; sid:2; rev:2;)
+# alert udp any any -> any any (msg:"c"; sid:3;)
+alert tcp any any -> any any (msg:"new"; sid:5;)
+`)
+
+	d := DiffRules(from, to)
+	if len(d.Added) != 1 || d.Added[0].SID != 5 || len(d.Removed) != 1 || d.Removed[0].SID != 4 || d.Unchanged != 1 {
+		t.Fatalf("bad diff: %+v", d)
+	}
+	if len(d.Modified) != 2 || d.Modified[0].SID != 2 || d.Modified[1].SID != 3 {
+		t.Fatalf("bad modified: %+v", d.Modified)
+	}
+
+	fields := map[string]Change{}
+	for _, c := range d.Modified[0].Changes {
+		fields[c.Field] = c
+	}
+	for _, f := range []string{"action", "header", "rev", "option:content", "option:nocase"} {
+		if _, ok := fields[f]; !ok {
+			t.Fatalf("missing change %q in %+v", f, d.Modified[0].Changes)
+		}
+	}
+	if c := fields["option:content"]; c.From != `"x"` || c.To != `"y"` {
+		t.Fatalf("bad content change: %+v", c)
+	}
+	if c := d.Modified[1].Changes; len(c) != 1 || c[0].Field != "disabled" || c[0].To != "true" {
+		t.Fatalf("bad disabled change: %+v", c)
+	}
+}
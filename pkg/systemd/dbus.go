@@ -0,0 +1,193 @@
+package systemd
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	sdbus "github.com/coreos/go-systemd/v22/dbus"
+)
+
+// Bus is the part of go-systemd's *dbus.Conn DBusManager uses. Job calls
+// send the job result (done, failed, canceled, timeout, dependency, skipped)
+// on ch when systemd emits JobRemoved.
+type Bus interface {
+	StartUnitContext(ctx context.Context, name, mode string, ch chan<- string) (int, error)
+	StopUnitContext(ctx context.Context, name, mode string, ch chan<- string) (int, error)
+	RestartUnitContext(ctx context.Context, name, mode string, ch chan<- string) (int, error)
+	ReloadOrRestartUnitContext(ctx context.Context, name, mode string, ch chan<- string) (int, error)
+
+	GetUnitPropertiesContext(ctx context.Context, unit string) (map[string]any, error)
+	GetUnitTypePropertiesContext(ctx context.Context, unit, unitType string) (map[string]any, error)
+
+	Close()
+}
+
+// DBusManager talks to systemd over D-Bus and waits for each job's
+// JobRemoved signal, so a failed start is reported even when enqueueing it
+// succeeded.
+type DBusManager struct {
+	bus Bus
+}
+
+// NewDBusManager connects to systemd's private socket, or the system bus when
+// that is not accessible.
+func NewDBusManager(ctx context.Context) (*DBusManager, error) {
+	conn, err := sdbus.NewWithContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("connect to systemd over D-Bus: %w", err)
+	}
+	return NewDBusManagerWithBus(conn), nil
+}
+
+func NewDBusManagerWithBus(bus Bus) *DBusManager {
+	return &DBusManager{bus: bus}
+}
+
+func (m *DBusManager) Close() error {
+	m.bus.Close()
+	return nil
+}
+
+// unitTypes are the suffixes systemd accepts on unit names.
+var unitTypes = []string{"service", "socket", "device", "mount", "automount", "swap", "target", "path", "timer", "slice", "scope"}
+
+// unitName adds ".service" to a bare name the way systemctl does; the D-Bus
+// API only accepts full unit names.
+func unitName(unit string) string {
+	unit = strings.TrimSpace(unit)
+	if unit == "" {
+		return ""
+	}
+	if i := strings.LastIndexByte(unit, '.'); i >= 0 && slices.Contains(unitTypes, unit[i+1:]) {
+		return unit
+	}
+	return unit + ".service"
+}
+
+type jobFunc func(ctx context.Context, name, mode string, ch chan<- string) (int, error)
+
+func (m *DBusManager) Start(ctx context.Context, unit string, timeout time.Duration) error {
+	return m.job(ctx, "start", m.bus.StartUnitContext, unit, timeout)
+}
+
+func (m *DBusManager) Stop(ctx context.Context, unit string, timeout time.Duration) error {
+	return m.job(ctx, "stop", m.bus.StopUnitContext, unit, timeout)
+}
+
+func (m *DBusManager) Restart(ctx context.Context, unit string, timeout time.Duration) error {
+	return m.job(ctx, "restart", m.bus.RestartUnitContext, unit, timeout)
+}
+
+func (m *DBusManager) ReloadOrRestart(ctx context.Context, unit string, timeout time.Duration) error {
+	return m.job(ctx, "reload-or-restart", m.bus.ReloadOrRestartUnitContext, unit, timeout)
+}
+
+func (m *DBusManager) job(parent context.Context, verb string, call jobFunc, unit string, timeout time.Duration) error {
+	unit = unitName(unit)
+	if unit == "" {
+		return fmt.Errorf("systemd unit is empty")
+	}
+	if timeout <= 0 {
+		return fmt.Errorf("%s timeout must be > 0", verb)
+	}
+
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	defer cancel()
+
+	// buffered: go-systemd blocks its signal loop until the result is taken
+	ch := make(chan string, 1)
+	id, err := call(ctx, unit, "replace", ch)
+	if err != nil {
+		return fmt.Errorf("systemd %s failed for unit=%s: %w", verb, unit, err)
+	}
+
+	select {
+	case result := <-ch:
+		if result == "done" {
+			return nil
+		}
+		return fmt.Errorf("systemd %s job %d for unit=%s finished with %q%s", verb, id, unit, result, m.stateSuffix(parent, unit))
+	case <-ctx.Done():
+		return fmt.Errorf("systemd %s timed out for unit=%s (job %d)%s", verb, unit, id, m.stateSuffix(parent, unit))
+	}
+}
+
+// stateSuffix describes where the unit ended up, for error messages.
+func (m *DBusManager) stateSuffix(ctx context.Context, unit string) string {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 2*time.Second)
+	defer cancel()
+	st, err := m.Status(ctx, unit)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf(" (ActiveState=%s SubState=%s Result=%s)", st.ActiveState, st.SubState, st.Result)
+}
+
+func (m *DBusManager) IsActive(ctx context.Context, unit string) (bool, error) {
+	st, err := m.Status(ctx, unit)
+	if err != nil {
+		return false, err
+	}
+	return st.ActiveState == "active", nil
+}
+
+func (m *DBusManager) MainPID(ctx context.Context, unit string) (int, error) {
+	st, err := m.Status(ctx, unit)
+	if err != nil {
+		return 0, err
+	}
+	return st.MainPID, nil
+}
+
+func (m *DBusManager) Status(ctx context.Context, unit string) (UnitStatus, error) {
+	unit = unitName(unit)
+	if unit == "" {
+		return UnitStatus{}, fmt.Errorf("systemd unit is empty")
+	}
+
+	props, err := m.bus.GetUnitPropertiesContext(ctx, unit)
+	if err != nil {
+		return UnitStatus{}, fmt.Errorf("systemd properties of unit=%s: %w", unit, err)
+	}
+	st := UnitStatus{
+		Unit:        unit,
+		LoadState:   propString(props, "LoadState"),
+		ActiveState: propString(props, "ActiveState"),
+		SubState:    propString(props, "SubState"),
+	}
+	if usec := propUint(props, "ActiveEnterTimestamp"); usec > 0 {
+		t := time.UnixMicro(int64(usec)).UTC()
+		st.Since = &t
+	}
+
+	// MainPID and friends only exist on services
+	if strings.HasSuffix(unit, ".service") {
+		svc, err := m.bus.GetUnitTypePropertiesContext(ctx, unit, "Service")
+		if err == nil {
+			st.MainPID = int(propUint(svc, "MainPID"))
+			st.Result = propString(svc, "Result")
+			st.NRestarts = int(propUint(svc, "NRestarts"))
+		}
+	}
+	return st, nil
+}
+
+func propString(props map[string]any, key string) string {
+	s, _ := props[key].(string)
+	return s
+}
+
+func propUint(props map[string]any, key string) uint64 {
+	switch v := props[key].(type) {
+	case uint32:
+		return uint64(v)
+	case uint64:
+		return v
+	case int:
+		return uint64(v)
+	}
+	return 0
+}
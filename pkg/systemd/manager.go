@@ -3,16 +3,69 @@ package systemd
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
 	"integration-suricata-ndpi/pkg/executil"
+	"integration-suricata-ndpi/pkg/logger"
 )
 
 type Manager interface {
+	Start(ctx context.Context, unit string, timeout time.Duration) error
+	Stop(ctx context.Context, unit string, timeout time.Duration) error
 	Restart(ctx context.Context, unit string, timeout time.Duration) error
+	ReloadOrRestart(ctx context.Context, unit string, timeout time.Duration) error
+
+	IsActive(ctx context.Context, unit string) (bool, error)
+	Status(ctx context.Context, unit string) (UnitStatus, error)
+	MainPID(ctx context.Context, unit string) (int, error)
+}
+
+// UnitStatus is the subset of unit and service properties we report.
+type UnitStatus struct {
+	Unit        string `json:"unit"`
+	LoadState   string `json:"load_state"`   // loaded, not-found, masked, ...
+	ActiveState string `json:"active_state"` // active, inactive, failed, activating, ...
+	SubState    string `json:"sub_state"`    // running, dead, exited, ...
+	MainPID     int    `json:"main_pid"`
+	// Since is when the unit last entered the active state.
+	Since *time.Time `json:"since,omitempty"`
+	// Result is the service's last result (success, exit-code, signal, ...).
+	Result    string `json:"result,omitempty"`
+	NRestarts int    `json:"n_restarts"`
 }
 
+const (
+	BackendAuto      = "auto"
+	BackendDBus      = "dbus"
+	BackendSystemctl = "systemctl"
+)
+
+// New returns the manager for backend. auto uses D-Bus and falls back to
+// systemctl when the bus cannot be reached.
+func New(ctx context.Context, backend, commandPath string, runner executil.Runner) (Manager, error) {
+	switch backend {
+	case BackendSystemctl:
+		return NewManager(commandPath, runner), nil
+	case BackendDBus:
+		return NewDBusManager(ctx)
+	case "", BackendAuto:
+		m, err := NewDBusManager(ctx)
+		if err != nil {
+			logger.Warnw("systemd D-Bus unavailable, falling back to systemctl",
+				"systemctl", commandPath,
+				"error", err,
+			)
+			return NewManager(commandPath, runner), nil
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("unknown systemd backend %q (want auto, dbus or systemctl)", backend)
+}
+
+// ServiceManager shells out to systemctl; it is the fallback when D-Bus is
+// not reachable.
 type ServiceManager struct {
 	CommandPath string
 	Runner      executil.Runner
@@ -32,24 +85,102 @@ func NewManager(commandPath string, runner executil.Runner) *ServiceManager {
 	}
 }
 
-func (m *ServiceManager) Restart(parent context.Context, unit string, timeout time.Duration) error {
+func (m *ServiceManager) Start(ctx context.Context, unit string, timeout time.Duration) error {
+	return m.run(ctx, "start", unit, timeout)
+}
+
+func (m *ServiceManager) Stop(ctx context.Context, unit string, timeout time.Duration) error {
+	return m.run(ctx, "stop", unit, timeout)
+}
+
+func (m *ServiceManager) Restart(ctx context.Context, unit string, timeout time.Duration) error {
+	return m.run(ctx, "restart", unit, timeout)
+}
+
+func (m *ServiceManager) ReloadOrRestart(ctx context.Context, unit string, timeout time.Duration) error {
+	return m.run(ctx, "reload-or-restart", unit, timeout)
+}
+
+func (m *ServiceManager) run(parent context.Context, verb, unit string, timeout time.Duration) error {
 	unit = strings.TrimSpace(unit)
 	if unit == "" {
 		return fmt.Errorf("systemd unit is empty")
 	}
 	if timeout <= 0 {
-		return fmt.Errorf("restart timeout must be > 0")
+		return fmt.Errorf("%s timeout must be > 0", verb)
 	}
 
 	ctx, cancel := context.WithTimeout(parent, timeout)
 	defer cancel()
 
-	out, err := m.Runner.CombinedOutput(ctx, m.CommandPath, "restart", unit)
+	out, err := m.Runner.CombinedOutput(ctx, m.CommandPath, verb, unit)
 	if ctx.Err() == context.DeadlineExceeded {
-		return fmt.Errorf("systemctl restart timed out for unit=%s", unit)
+		return fmt.Errorf("systemctl %s timed out for unit=%s", verb, unit)
 	}
 	if err != nil {
-		return fmt.Errorf("systemctl restart failed for unit=%s: %v output=%q", unit, err, strings.TrimSpace(string(out)))
+		return fmt.Errorf("systemctl %s failed for unit=%s: %v output=%q", verb, unit, err, strings.TrimSpace(string(out)))
 	}
 	return nil
 }
+
+func (m *ServiceManager) IsActive(ctx context.Context, unit string) (bool, error) {
+	st, err := m.Status(ctx, unit)
+	if err != nil {
+		return false, err
+	}
+	return st.ActiveState == "active", nil
+}
+
+func (m *ServiceManager) MainPID(ctx context.Context, unit string) (int, error) {
+	st, err := m.Status(ctx, unit)
+	if err != nil {
+		return 0, err
+	}
+	return st.MainPID, nil
+}
+
+const showProperties = "LoadState,ActiveState,SubState,MainPID,ActiveEnterTimestamp,Result,NRestarts"
+
+func (m *ServiceManager) Status(ctx context.Context, unit string) (UnitStatus, error) {
+	unit = strings.TrimSpace(unit)
+	if unit == "" {
+		return UnitStatus{}, fmt.Errorf("systemd unit is empty")
+	}
+
+	out, err := m.Runner.CombinedOutput(ctx, m.CommandPath, "show", "--property="+showProperties, unit)
+	if err != nil {
+		return UnitStatus{}, fmt.Errorf("systemctl show failed for unit=%s: %v output=%q", unit, err, strings.TrimSpace(string(out)))
+	}
+	return parseShow(unit, string(out)), nil
+}
+
+// parseShow reads `systemctl show` KEY=VALUE lines.
+func parseShow(unit, out string) UnitStatus {
+	st := UnitStatus{Unit: unit}
+	for _, ln := range strings.Split(out, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(ln), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "LoadState":
+			st.LoadState = value
+		case "ActiveState":
+			st.ActiveState = value
+		case "SubState":
+			st.SubState = value
+		case "MainPID":
+			st.MainPID, _ = strconv.Atoi(value)
+		case "Result":
+			st.Result = value
+		case "NRestarts":
+			st.NRestarts, _ = strconv.Atoi(value)
+		case "ActiveEnterTimestamp":
+			// e.g. "Mon 2026-10-19 09:12:01 UTC"; empty or "n/a" when never active
+			if t, err := time.Parse("Mon 2006-01-02 15:04:05 MST", value); err == nil {
+				st.Since = &t
+			}
+		}
+	}
+	return st
+}